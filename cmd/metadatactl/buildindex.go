@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"metadata-api/internal/db"
+)
+
+func runBuildIndex(args []string) int {
+	fs := flag.NewFlagSet("build-index", flag.ExitOnError)
+	var (
+		dbPath  = fs.String("db", "", "path to main_database.sqlite3")
+		out     = fs.String("out", "", "sidecar path (default: search_index.sqlite3 next to -db)")
+		indexes = fs.Bool("indexes", false, "also create missing covering indexes in -db (must be a writable copy)")
+	)
+	fs.Parse(args)
+
+	if *dbPath == "" {
+		slog.Error("db path required")
+		return 2
+	}
+	if *out == "" {
+		*out = filepath.Join(filepath.Dir(*dbPath), db.SearchIndexFile)
+	}
+
+	ctx := context.Background()
+
+	// Indexes go first: they change the snapshot file, and the sidecar
+	// records the dataset version it was built against.
+	if *indexes {
+		start := time.Now()
+		created, err := db.EnsureIndexes(ctx, *dbPath)
+		for _, name := range created {
+			fmt.Printf("created index %s\n", name)
+		}
+		if err != nil {
+			slog.Error("create indexes", "err", err)
+			return 1
+		}
+		slog.Info("covering indexes ready", "created", len(created), "took", time.Since(start).Round(time.Millisecond))
+	}
+
+	start := time.Now()
+	if err := db.BuildSearchIndex(ctx, *dbPath, *out); err != nil {
+		slog.Error("build search index", "err", err)
+		return 1
+	}
+	slog.Info("search index built", "path", *out, "took", time.Since(start).Round(time.Millisecond))
+	return 0
+}
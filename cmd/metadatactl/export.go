@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"metadata-api/internal/db"
+)
+
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var (
+		dbPath        = fs.String("db", "", "path to main_database.sqlite3, or a directory of shards")
+		entity        = fs.String("entity", "tracks", "what to export: "+strings.Join(db.ExportEntities(), ", "))
+		format        = fs.String("format", "jsonl", "output format: jsonl or csv")
+		columns       = fs.String("columns", "", "comma-separated columns to include (default all)")
+		filters       = fs.String("filter", "", "comma-separated named filters, e.g. has-isrc")
+		minPopularity = fs.Int("min-popularity", 0, "only rows with at least this popularity (tracks, artists)")
+		limit         = fs.Int("limit", 0, "stop after this many rows (0 for all)")
+		out           = fs.String("out", "-", "output file, - for stdout")
+		list          = fs.Bool("list", false, "print available columns and filters for -entity and exit")
+	)
+	fs.Parse(args)
+
+	if *list {
+		fmt.Printf("columns: %s\n", strings.Join(db.ExportColumns(*entity), ", "))
+		fmt.Printf("filters: %s\n", strings.Join(db.ExportFilters(*entity), ", "))
+		return 0
+	}
+	if *dbPath == "" {
+		slog.Error("db path required")
+		return 2
+	}
+	if *format != "jsonl" && *format != "csv" {
+		slog.Error("unknown format", "format", *format)
+		return 2
+	}
+
+	database, err := db.Open(*dbPath)
+	if err != nil {
+		slog.Error("open db", "err", err)
+		return 1
+	}
+	defer database.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			slog.Error("create output", "err", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriterSize(w, 1<<20)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	spec := db.ExportSpec{
+		Entity:        *entity,
+		Columns:       splitComma(*columns),
+		Filters:       splitComma(*filters),
+		MinPopularity: *minPopularity,
+		Limit:         *limit,
+	}
+
+	var n int
+	var header func([]string) error
+	var emit func([]any) error
+	flush := bw.Flush
+	switch *format {
+	case "csv":
+		cw := csv.NewWriter(bw)
+		header = cw.Write
+		var record []string
+		emit = func(vals []any) error {
+			record = record[:0]
+			for _, v := range vals {
+				record = append(record, csvValue(v))
+			}
+			n++
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+	default:
+		var keys []string
+		header = func(cols []string) error {
+			for _, c := range cols {
+				key, _ := json.Marshal(c)
+				keys = append(keys, string(key))
+			}
+			return nil
+		}
+		// Objects are written by hand to keep keys in column order
+		emit = func(vals []any) error {
+			bw.WriteByte('{')
+			for i, v := range vals {
+				if i > 0 {
+					bw.WriteByte(',')
+				}
+				val, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				bw.WriteString(keys[i])
+				bw.WriteByte(':')
+				bw.Write(val)
+			}
+			n++
+			_, err := bw.WriteString("}\n")
+			return err
+		}
+	}
+
+	err = database.Export(ctx, spec, header, emit)
+	if ferr := flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		slog.Error("export", "err", err)
+		return 1
+	}
+	slog.Info("export complete", "entity", *entity, "rows", n)
+	return 0
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func splitComma(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+// Command metadatactl provides offline maintenance tasks for snapshot databases.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"metadata-api/internal/version"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"validate", "check integrity and foreign-key consistency of a snapshot", runValidate},
+	{"build-index", "build the FTS search sidecar and missing covering indexes", runBuildIndex},
+	{"export", "dump tracks, albums, or artists as JSON Lines or CSV", runExport},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "version" || name == "-version" || name == "--version" {
+		fmt.Println(version.String())
+		return
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+
+	if name != "help" && name != "-h" && name != "--help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: metadatactl <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "  %-12s %s\n", "version", "print version and exit")
+}
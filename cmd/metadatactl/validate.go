@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"metadata-api/internal/db"
+)
+
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	var (
+		dbPath = fs.String("db", "", "path to main_database.sqlite3, or a directory of shards")
+		quick  = fs.Bool("quick", false, "use quick_check instead of the slower integrity_check")
+		asJSON = fs.Bool("json", false, "print the report as JSON")
+	)
+	fs.Parse(args)
+
+	if *dbPath == "" {
+		slog.Error("db path required")
+		return 2
+	}
+
+	// Open also verifies that every expected table and column exists
+	database, err := db.Open(*dbPath)
+	if err != nil {
+		slog.Error("open db", "err", err)
+		return 1
+	}
+	defer database.Close()
+
+	rep, err := database.Validate(context.Background(), *quick)
+	if err != nil {
+		slog.Error("validate", "err", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		enc.Encode(rep)
+	} else {
+		for _, i := range rep.Integrity {
+			status := "ok"
+			if !i.OK {
+				status = "FAILED"
+			}
+			fmt.Printf("integrity  %-12s %s\n", i.Database, status)
+			for _, m := range i.Messages {
+				fmt.Printf("           %s\n", m)
+			}
+		}
+		for _, o := range rep.Orphans {
+			status := "ok"
+			if o.Orphans > 0 {
+				status = fmt.Sprintf("%d orphaned rows (sample rowids %v)", o.Orphans, o.Sample)
+			}
+			fmt.Printf("orphans    %-40s %s\n", o.Name, status)
+		}
+	}
+
+	if !rep.OK() {
+		fmt.Fprintln(os.Stderr, "validation failed")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/relevance"
+)
+
+func main() {
+	var (
+		dbPath    = flag.String("db", "", "path to main_database.sqlite3")
+		corpus    = flag.String("corpus", "", "path to corpus JSON (default: built-in corpus)")
+		k         = flag.Int("k", 10, "number of results scored per query")
+		threshold = flag.Float64("threshold", 0.9, "minimum mean NDCG required to pass")
+		verbose   = flag.Bool("v", false, "print per-case results as JSON")
+	)
+	flag.Parse()
+
+	if *dbPath == "" {
+		slog.Error("db path required")
+		os.Exit(1)
+	}
+
+	var (
+		cases []relevance.Case
+		err   error
+	)
+	if *corpus != "" {
+		cases, err = relevance.LoadCorpus(*corpus)
+	} else {
+		cases, err = relevance.DefaultCorpus()
+	}
+	if err != nil {
+		slog.Error("load corpus", "err", err)
+		os.Exit(1)
+	}
+
+	database, err := db.Open(*dbPath)
+	if err != nil {
+		slog.Error("open db", "err", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	rep := relevance.Run(context.Background(), database, cases, *k)
+
+	if *verbose {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+	}
+	for _, res := range rep.Results {
+		if res.Err != "" || res.NDCG < *threshold {
+			fmt.Printf("LOW  %.3f  %s %q %s\n", res.NDCG, res.Case.Kind, res.Case.Query, res.Err)
+		}
+	}
+	fmt.Printf("mean NDCG@%d: %.3f over %d cases (threshold %.3f)\n", rep.K, rep.Mean, len(rep.Results), *threshold)
+
+	if rep.Mean < *threshold {
+		database.Close()
+		os.Exit(1)
+	}
+}
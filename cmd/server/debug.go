@@ -0,0 +1,37 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"metadata-api/internal/api"
+	"metadata-api/internal/db"
+	"metadata-api/internal/version"
+)
+
+// debugServer serves pprof profiles and expvar counters on their own
+// address, kept off the public listener. Anyone who can reach it can
+// profile the process, so bind it to loopback or a private network.
+func debugServer(addr string, store db.Store, inflight *api.Inflight, latency *api.Latency) *http.Server {
+	expvar.Publish("version", expvar.Func(func() any { return version.String() }))
+	expvar.Publish("dataset_version", expvar.Func(func() any { return store.DatasetVersion() }))
+	expvar.Publish("in_flight", expvar.Func(func() any { return len(inflight.List()) }))
+	expvar.Publish("latency", expvar.Func(func() any { return latency.Snapshot() }))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// No write timeout: CPU profiles and traces stream for ?seconds=
+	return &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		ReadTimeout: 30 * time.Second,
+	}
+}
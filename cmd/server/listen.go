@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd
+const listenFDsStart = 3
+
+// systemdListeners returns the sockets passed by systemd socket activation,
+// keyed by their FileDescriptorName= (systemd defaults it to the unit name).
+// It returns nil when the process was not socket activated. The LISTEN_*
+// variables are cleared so child processes do not inherit them.
+func systemdListeners() (map[string]net.Listener, []string, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make(map[string]net.Listener, n)
+	order := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+		if _, dup := listeners[name]; dup {
+			l.Close()
+			return nil, nil, fmt.Errorf("systemd socket %s passed twice; set distinct FileDescriptorName=", name)
+		}
+		listeners[name] = l
+		order = append(order, name)
+	}
+	return listeners, order, nil
+}
+
+// activatedListeners picks the API and ACME challenge sockets out of the
+// ones passed by systemd. The socket named "acme" serves challenges; the
+// first other socket serves the API. Both are nil without socket
+// activation.
+func activatedListeners() (api, acme net.Listener, err error) {
+	listeners, order, err := systemdListeners()
+	if err != nil || listeners == nil {
+		return nil, nil, err
+	}
+	acme = listeners["acme"]
+	for _, name := range order {
+		if name == "acme" {
+			continue
+		}
+		if api == nil {
+			api = listeners[name]
+		} else {
+			slog.Warn("ignoring extra systemd socket", "name", name)
+			listeners[name].Close()
+		}
+	}
+	if api == nil {
+		return nil, nil, fmt.Errorf("systemd passed no socket for the API besides %q", "acme")
+	}
+	return api, acme, nil
+}
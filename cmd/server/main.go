@@ -2,61 +2,705 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"golang.org/x/time/rate"
+
 	"metadata-api/internal/api"
+	"metadata-api/internal/audit"
+	"metadata-api/internal/collections"
 	"metadata-api/internal/db"
+	"metadata-api/internal/images"
+	"metadata-api/internal/logging"
+	"metadata-api/internal/models"
+	"metadata-api/internal/overlay"
+	"metadata-api/internal/peers"
+	"metadata-api/internal/selftest"
+	"metadata-api/internal/snapshots"
+	"metadata-api/internal/spotify"
+	"metadata-api/internal/usage"
+	"metadata-api/internal/version"
+	"metadata-api/internal/webhooks"
 )
 
 func main() {
 	var (
-		addr   = flag.String("addr", ":8080", "listen address")
-		dbPath = flag.String("db", "", "path to main_database.sqlite3")
+		addr        = flag.String("addr", ":8080", "listen address")
+		publicURL   = flag.String("public-url", "", "scheme and host clients reach this server at, e.g. https://api.example.com, prefixed to href links (empty makes them relative)")
+		dbPath      = flag.String("db", "", "path to main_database.sqlite3, or a directory of shards")
+		showVersion = flag.Bool("version", false, "print version and exit")
+
+		logFormat  = flag.String("log-format", "text", "log format: text, logfmt, or json")
+		logLevel   = flag.String("log-level", envOr("LOG_LEVEL", "info"), "log level: debug, info, warn, or error")
+		logSample  = flag.Float64("access-log-sample", 1, "fraction of successful requests written to the access log (errors and slow requests are always logged)")
+		slowReq    = flag.Duration("slow-request", time.Second, "requests at least this slow are always access logged (0 disables)")
+		adminToken = flag.String("admin-token", "", "bearer token for /admin endpoints (empty disables them)")
+		debugAddr  = flag.String("debug-addr", "", "listen address for pprof and expvar at /debug/ (empty disables; keep it private)")
+		validate   = flag.Bool("validate-responses", false, "check JSON responses against the served OpenAPI spec and log mismatches (development; slows every request)")
+		overlayDB  = flag.String("overlay", "", "writable SQLite database of catalog corrections and additions, created if missing")
+		patches    = flag.String("patch", "", "comma-separated read-only correction databases applied over the snapshot, later ones winning")
+
+		accessLogOn = flag.Bool("access-log", true, "log one line per request, sampled by -access-log-sample")
+		requestIDs  = flag.Bool("request-ids", true, "give each request an ID, echoed in X-Request-ID and logged with it")
+		recoverOn   = flag.Bool("recover", true, "answer requests whose handler panics with a 500 and log the stack")
+		corsOrigins = flag.String("cors-origins", "", "comma-separated origins browsers may call the API from, or * for any (empty disables CORS)")
+		cacheMaxAge = flag.Duration("cache-max-age", 0, "how long CDNs and other shared caches may keep successful catalog GET responses (0 sends no Cache-Control)")
+		apiKeys     = flag.String("api-keys", "", "comma-separated API keys, or @file with one per line, one of which every request must send in X-API-Key; probes, docs, images, and admin routes are exempt (empty disables)")
+
+		spotifyID       = flag.String("spotify-client-id", envOr("SPOTIFY_CLIENT_ID", ""), "Spotify app client ID for -spotify-sync-artists and -spotify-fallback")
+		spotifySecret   = flag.String("spotify-client-secret", envOr("SPOTIFY_CLIENT_SECRET", ""), "Spotify app client secret for -spotify-sync-artists and -spotify-fallback")
+		spotifyAPI      = flag.String("spotify-api", spotify.DefaultAPI, "base URL of the Spotify Web API")
+		syncArtists     = flag.String("spotify-sync-artists", "", "comma-separated artist IDs, or @file with one per line, to keep current from the Spotify Web API (requires -overlay)")
+		syncInterval    = flag.Duration("spotify-sync-interval", 24*time.Hour, "how often -spotify-sync-artists are refreshed")
+		fallback        = flag.Bool("spotify-fallback", false, "look up tracks and ISRCs missing locally in the Spotify Web API and cache them in -overlay")
+		fallbackRate    = flag.Float64("spotify-fallback-rate", 5, "Spotify Web API calls per second allowed for -spotify-fallback")
+		fallbackTimeout = flag.Duration("spotify-fallback-timeout", 5*time.Second, "how long a lookup waits for the Spotify Web API")
+
+		selfTest       = flag.String("self-test", "", "manifest of queries to check after opening the databases")
+		selfTestStrict = flag.Bool("self-test-strict", false, "exit instead of serving when the self-test fails")
+
+		hotTables       = flag.Bool("hot-tables", false, "load artists, genres, and artist images into memory at startup")
+		artistCacheSize = flag.Int("artist-cache-size", 50000, "number of assembled artists cached across batch requests (0 disables)")
+
+		auditLog       = flag.String("audit-log", "", "append-only SQLite database recording admin changes, served at /admin/audit, created if missing (empty disables)")
+		usageDB        = flag.String("usage-db", "", "writable SQLite database of per-client request counts served at /admin/usage, created if missing (empty disables)")
+		snapshotsDir   = flag.String("snapshots-dir", "", "directory of historical snapshots served with ?snapshot=<name> and listed at /snapshots (empty disables)")
+		snapshotsOpen  = flag.Int("snapshots-open", 4, "number of -snapshots-dir snapshots kept open at once")
+		collectionsDB  = flag.String("collections-db", "", "writable SQLite database of user-curated track collections served at /collections, created if missing (empty disables)")
+		usageRetention = flag.Duration("usage-retention", 30*24*time.Hour, "how long -usage-db keeps request counts (0 keeps them forever)")
+		rateLimits     = flag.String("rate-limits", "", "YAML file with per-IP rate limits, overall and per route (default 100 req/s, burst 200)")
+		rateLimitOn    = flag.Bool("rate-limit", true, "apply the per-IP rate limits of -rate-limits")
+		trustedProxies = flag.String("trusted-proxies", "", "comma-separated proxy addresses or CIDRs whose X-Forwarded-For names the client")
+		keyConcurrency = flag.Int("key-concurrency", 0, "max in-flight requests per API key (0 disables)")
+		keyCostRate    = flag.Float64("key-cost-rate", 0, "query cost units replenished per second per API key (0 disables)")
+		keyCostBurst   = flag.Int("key-cost-burst", 400, "max query cost units an API key can spend at once")
+
+		readTimeout   = flag.Duration("read-timeout", 30*time.Second, "how long reading a request, body included, may take (0 disables)")
+		headerTimeout = flag.Duration("read-header-timeout", 0, "how long reading request headers may take (0 uses -read-timeout)")
+		idleTimeout   = flag.Duration("idle-timeout", 0, "how long a keep-alive connection may wait for its next request (0 uses -read-timeout)")
+		maxHeader     = flag.Int("max-header-bytes", http.DefaultMaxHeaderBytes, "largest request header block accepted, in bytes")
+		writeTimeout  = flag.Duration("write-timeout", 60*time.Second, "response write timeout for lookup and search routes")
+		streamTimeout = flag.Duration("stream-timeout", 30*time.Minute, "response write timeout for streaming routes")
+		streamRoutes  = flag.String("stream-routes", strings.Join(api.DefaultStreamRoutes, ","), "comma-separated paths given -stream-timeout; one ending in / covers the paths under it")
+		drainTimeout  = flag.Duration("shutdown-timeout", 10*time.Second, "how long shutdown waits for in-flight requests before cancelling their queries")
+
+		imageProxy    = flag.Bool("image-proxy", false, "serve album and artist artwork at /images/{hash}")
+		imageCacheDir = flag.String("image-cache-dir", "", "directory for cached artwork (empty proxies without caching)")
+		imageCacheMax = flag.Int64("image-cache-max-mb", 10240, "size in MB -image-cache-dir is kept under by removing the least recently served images (0 is unbounded; -image-mirror keeps every image regardless)")
+		imageUpstream = flag.String("image-upstream", images.DefaultUpstream, "base URL artwork is fetched from")
+		imageMirror   = flag.Bool("image-mirror", false, "download all artwork into -image-cache-dir in the background and serve image URLs from this server")
+		mirrorWorkers = flag.Int("image-mirror-workers", 4, "concurrent downloads for -image-mirror")
+		imageBaseURL  = flag.String("image-base-url", "/images/", "public URL prefix of /images/ used in rewritten image URLs")
+
+		omitPopularity = flag.Bool("omit-popularity", false, "strip popularity and followers from every response")
+		languageNames  = flag.Bool("language-names", false, "serve track languages as objects with the ISO 639-1 code and English and native names")
+		legacyRoles    = flag.Bool("legacy-artist-roles", false, "serve track artist_roles as plain role strings instead of objects naming the artist")
+		imagesSrcset   = flag.Bool("images-srcset", false, "add an HTML srcset string built from images to albums and artists")
+
+		tlsCert       = flag.String("tls-cert", "", "TLS certificate file (serves HTTPS on -addr)")
+		tlsKey        = flag.String("tls-key", "", "TLS private key file")
+		autocertHosts = flag.String("autocert-domains", "", "comma-separated domains to obtain Let's Encrypt certificates for (serves HTTPS on -addr)")
+		autocertCache = flag.String("autocert-cache", "", "directory where autocert stores certificates and the account key")
+		autocertEmail = flag.String("autocert-email", "", "contact email for the Let's Encrypt account")
+		autocertHTTP  = flag.String("autocert-http", ":80", "listen address for ACME HTTP challenges and HTTPS redirects (empty disables)")
+
+		peerList   = flag.String("peers", "", "comma-separated peer base URLs for cache invalidation")
+		peerSRV    = flag.String("peer-srv", "", "DNS SRV name used to discover peers")
+		peerSecret = flag.String("peer-secret", "", "shared secret for peer events")
+
+		webhookURLs   = flag.String("webhooks", "", "comma-separated URLs notified when a snapshot is loaded or reloaded")
+		webhookSecret = flag.String("webhook-secret", "", "key for the HMAC-SHA256 signature sent with webhook notifications")
 	)
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(version.String())
+		return
+	}
+
+	levelVar, err := logging.Setup(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		slog.Error("configure logging", "err", err)
+		os.Exit(1)
+	}
+	baseLevel := levelVar.Level()
+
 	if *dbPath == "" {
 		slog.Error("db path required")
 		os.Exit(1)
 	}
 
+	// Load the manifest up front so a typo fails fast instead of after warm-up
+	var manifest selftest.Manifest
+	if *selfTest != "" {
+		manifest, err = selftest.LoadManifest(*selfTest)
+		if err != nil {
+			slog.Error("load self-test manifest", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	loadStart := time.Now()
 	database, err := db.Open(*dbPath)
 	if err != nil {
 		slog.Error("open db", "err", err)
 		os.Exit(1)
 	}
-	defer database.Close()
+	snapshot := db.NewSwap(database)
+	defer snapshot.Close()
+
+	baseLogs := slog.Default()
+	slog.SetDefault(baseLogs.With("dataset_version", database.DatasetVersion()))
+
+	if !database.HasSearchIndex() {
+		slog.Warn("no search index, search falls back to LIKE scans; run `metadatactl build-index` to create one")
+	}
+	if database.HasMusicBrainz() {
+		slog.Info("musicbrainz ids available")
+	}
+	if database.HasMarkets() {
+		slog.Info("market availability data available")
+	}
 
-	handler := api.New(database)
-	rateLimiter := api.NewRateLimiter(100, 200)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	models.SrcsetEnabled.Store(*imagesSrcset)
+	models.OmitPopularity.Store(*omitPopularity)
+	models.LegacyArtistRoles.Store(*legacyRoles)
+	models.LanguageNames.Store(*languageNames)
+	models.PublicURL.Store(strings.TrimSuffix(*publicURL, "/"))
+
+	latency := api.NewLatency()
+	opts := api.Options{AdminToken: *adminToken, Latency: latency}
+	if *imageMirror && *imageCacheDir == "" {
+		slog.Error("-image-mirror requires -image-cache-dir")
+		os.Exit(1)
+	}
+	if *imageProxy || *imageMirror {
+		opts.Images = images.New(*imageCacheDir, *imageUpstream)
+		if !*imageMirror {
+			if err := opts.Images.LimitSize(*imageCacheMax << 20); err != nil {
+				slog.Error("limit image cache", "err", err)
+				os.Exit(1)
+			}
+		}
+	}
+	// prepare configures each snapshot served, at startup and on reload
+	prepare := func(d *db.DB) error {
+		if *artistCacheSize > 0 {
+			if err := d.EnableArtistCache(*artistCacheSize); err != nil {
+				return fmt.Errorf("enable artist cache: %w", err)
+			}
+		}
+		if *imageMirror {
+			d.SetImageURLRewriter(images.Rewriter(*imageBaseURL))
+		}
+		return nil
+	}
+	if err := prepare(database); err != nil {
+		slog.Error("prepare snapshot", "err", err)
+		os.Exit(1)
+	}
+	var store db.Store = snapshot
+	for _, path := range splitList(*patches) {
+		p, err := overlay.OpenPatch(path, store)
+		if err != nil {
+			slog.Error("open patch", "err", err)
+			os.Exit(1)
+		}
+		defer p.Close()
+		slog.Info("patch applied", "path", path, "entries", len(p.Entries()))
+		store = p
+	}
+	if *overlayDB != "" {
+		ov, err := overlay.Open(*overlayDB, store)
+		if err != nil {
+			slog.Error("open overlay", "err", err)
+			os.Exit(1)
+		}
+		defer ov.Close()
+		if *adminToken == "" {
+			slog.Warn("-overlay without -admin-token: corrections are served but cannot be edited")
+		}
+		slog.Info("overlay enabled", "path", *overlayDB, "entries", len(ov.Entries()))
+		store = ov
+		opts.Overlay = ov
+	}
+	if *auditLog != "" {
+		if *adminToken == "" {
+			slog.Error("-audit-log requires -admin-token")
+			os.Exit(1)
+		}
+		al, err := audit.Open(*auditLog)
+		if err != nil {
+			slog.Error("open audit log", "err", err)
+			os.Exit(1)
+		}
+		defer al.Close()
+		opts.Audit = al
+	}
+	if *usageDB != "" {
+		rec, err := usage.Open(*usageDB, *usageRetention)
+		if err != nil {
+			slog.Error("open usage db", "err", err)
+			os.Exit(1)
+		}
+		defer rec.Close()
+		opts.Usage = rec
+	}
+	if *collectionsDB != "" {
+		cs, err := collections.Open(*collectionsDB)
+		if err != nil {
+			slog.Error("open collections db", "err", err)
+			os.Exit(1)
+		}
+		defer cs.Close()
+		opts.Collections = cs
+	}
+	if *snapshotsDir != "" {
+		m, err := snapshots.New(*snapshotsDir, *snapshotsOpen, prepare)
+		if err != nil {
+			slog.Error("open snapshots", "err", err)
+			os.Exit(1)
+		}
+		defer m.Close()
+		opts.Snapshots = m
+	}
+	var syncer *spotify.Syncer
+	if *syncArtists != "" || *fallback {
+		if opts.Overlay == nil {
+			slog.Error("-spotify-sync-artists and -spotify-fallback require -overlay")
+			os.Exit(1)
+		}
+		if *spotifyID == "" || *spotifySecret == "" {
+			slog.Error("-spotify-sync-artists and -spotify-fallback require -spotify-client-id and -spotify-client-secret")
+			os.Exit(1)
+		}
+	}
+	client := spotify.NewClient(*spotifyID, *spotifySecret, *spotifyAPI, "")
+	if *syncArtists != "" {
+		ids, err := readList(*syncArtists)
+		if err != nil {
+			slog.Error("read -spotify-sync-artists", "err", err)
+			os.Exit(1)
+		}
+		syncer = spotify.NewSyncer(client, opts.Overlay, ids)
+	}
+	if *fallback {
+		store = spotify.NewFallback(client, opts.Overlay, rate.Limit(*fallbackRate), max(1, int(*fallbackRate)), *fallbackTimeout)
+		slog.Info("spotify fallback enabled", "rate", *fallbackRate)
+	}
+	handler := api.New(store, opts)
+	rateLimiter, err := newRateLimiter(*rateLimits)
+	if err != nil {
+		slog.Error("load -rate-limits", "err", err)
+		os.Exit(1)
+	}
+	mux := handler.Routes()
+	levelHandler := api.AdminAuth(*adminToken, logging.LevelHandler(levelVar))
+	mux.Handle("GET /admin/log-level", levelHandler)
+	mux.Handle("PUT /admin/log-level", levelHandler)
+
+	// SIGHUP reloads the snapshot, once the first one is warm, and so does
+	// a reload event from a peer
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	peerReload := make(chan struct{}, 1)
+
+	cluster := peers.New(peers.Config{
+		Static: splitList(*peerList),
+		SRV:    *peerSRV,
+		Secret: *peerSecret,
+	})
+	if cluster.Enabled() {
+		if *peerSecret == "" {
+			slog.Error("-peers and -peer-srv require -peer-secret")
+			os.Exit(1)
+		}
+		cluster.Subscribe(func(ev peers.Event) {
+			if ev.Type == peers.EventReload {
+				select {
+				case peerReload <- struct{}{}:
+				default:
+				}
+			}
+			// Replicas sharing the overlay database see each other's writes
+			if opts.Overlay != nil {
+				if err := opts.Overlay.Reload(ctx); err != nil {
+					slog.Error("reload overlay", "err", err)
+				}
+			}
+			snapshot.Current().PurgeCaches()
+		})
+		if opts.Overlay != nil {
+			opts.Overlay.OnChange(func(kind, id string) {
+				go cluster.Broadcast(ctx, peers.Event{Type: peers.EventInvalidate, Keys: []string{kind + "/" + id}})
+			})
+		}
+		mux.Handle("POST "+peers.EventPath, cluster)
+		cluster.Start(ctx)
+	}
+
+	var root http.Handler = mux
+	if *validate {
+		root = api.ValidateResponses(mux)
+	}
+	if opts.Snapshots != nil {
+		root = api.SelectSnapshot(opts.Snapshots, root)
+	}
+	if opts.Audit != nil {
+		root = api.Audit(opts.Audit, root)
+	}
+	if opts.Usage != nil {
+		root = api.RecordUsage(opts.Usage, root)
+		go opts.Usage.Run(ctx, 10*time.Second)
+	}
+	root = latency.Middleware(root)
+	if *keyConcurrency > 0 || *keyCostRate > 0 {
+		burst := *keyCostBurst
+		if *keyCostRate <= 0 {
+			burst = 0
+		}
+		budget := api.NewQueryBudget(*keyConcurrency, rate.Limit(*keyCostRate), burst)
+		root = budget.Middleware(root)
+	}
 
+	deadlines := api.WriteDeadlines{
+		Default: *writeTimeout,
+		Stream:  *streamTimeout,
+		Routes:  splitList(*streamRoutes),
+	}
+
+	inflight := api.NewInflight()
+	accessLog := api.AccessLog{Sample: *logSample, Slow: *slowReq}
+	keys, err := readList(*apiKeys)
+	if err != nil {
+		slog.Error("read -api-keys", "err", err)
+		os.Exit(1)
+	}
+	keyAuth, err := api.NewAPIKeys(keys)
+	if err != nil {
+		slog.Error("load -api-keys", "err", err)
+		os.Exit(1)
+	}
+	proxies, err := api.NewTrustedProxies(splitList(*trustedProxies))
+	if err != nil {
+		slog.Error("load -trusted-proxies", "err", err)
+		os.Exit(1)
+	}
+
+	chain := api.Chain{
+		{Name: "recover", Enabled: *recoverOn, Wrap: api.Recover},
+		{Name: "request-id", Enabled: *requestIDs, Wrap: api.RequestID},
+		{Name: "client-addr", Enabled: true, Wrap: proxies.Middleware},
+		{Name: "access-log", Enabled: *accessLogOn, Wrap: accessLog.Middleware},
+		{Name: "inflight", Enabled: true, Wrap: inflight.Middleware},
+		{Name: "deadlines", Enabled: true, Wrap: deadlines.Middleware},
+		{Name: "cors", Enabled: *corsOrigins != "", Wrap: api.CORS{Origins: splitList(*corsOrigins)}.Middleware},
+		{Name: "api-keys", Enabled: len(keys) > 0, Wrap: keyAuth.Middleware},
+		{Name: "rate-limit", Enabled: *rateLimitOn, Wrap: rateLimiter.Middleware},
+		{Name: "cache-control", Enabled: *cacheMaxAge > 0, Wrap: api.CacheControl{MaxAge: *cacheMaxAge}.Middleware},
+	}
+	slog.Info("middleware", "chain", chain.Names())
+
+	// WriteTimeout is enforced per route by deadlines so streaming routes can outlive it
 	srv := &http.Server{
-		Addr:         *addr,
-		Handler:      rateLimiter.Middleware(handler.Routes()),
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 60 * time.Second,
+		Addr:              *addr,
+		Handler:           chain.Then(root),
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *headerTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeader,
+	}
+
+	tlsCfg := tlsConfig{
+		certFile: *tlsCert,
+		keyFile:  *tlsKey,
+		domains:  splitList(*autocertHosts),
+		cacheDir: *autocertCache,
+		email:    *autocertEmail,
+		httpAddr: *autocertHTTP,
+	}
+	// Under systemd socket activation the unit owns the sockets and -addr
+	// and -autocert-http are ignored
+	apiListener, acmeListener, err := activatedListeners()
+	if err != nil {
+		slog.Error("socket activation", "err", err)
+		os.Exit(1)
+	}
+	listenAddr := *addr
+	if apiListener != nil {
+		listenAddr = apiListener.Addr().String()
+		if acmeListener != nil {
+			tlsCfg.httpAddr = acmeListener.Addr().String()
+		}
+	}
+
+	var challengeSrv *http.Server
+	if tlsCfg.enabled() {
+		challengeSrv, err = tlsCfg.apply(srv)
+		if err != nil {
+			slog.Error("configure tls", "err", err)
+			os.Exit(1)
+		}
+	}
+	if challengeSrv != nil {
+		go func() {
+			slog.Info("serving ACME challenges", "addr", challengeSrv.Addr)
+			var err error
+			if acmeListener != nil {
+				err = challengeSrv.Serve(acmeListener)
+			} else {
+				err = challengeSrv.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				slog.Error("acme challenge server error", "err", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	var debugSrv *http.Server
+	if *debugAddr != "" {
+		debugSrv = debugServer(*debugAddr, store, inflight, latency)
+		go func() {
+			slog.Info("serving debug endpoints", "addr", *debugAddr)
+			if err := debugSrv.ListenAndServe(); err != http.ErrServerClosed {
+				slog.Error("debug server error", "err", err)
+				os.Exit(1)
+			}
+		}()
 	}
 
 	go func() {
-		slog.Info("starting server", "addr", *addr)
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		slog.Info("starting server", "addr", listenAddr, "tls", tlsCfg.enabled(), "socket_activated", apiListener != nil,
+			"version", version.Version, "commit", version.Commit)
+		if err := tlsCfg.serve(srv, apiListener); err != http.ErrServerClosed {
 			slog.Error("server error", "err", err)
 			os.Exit(1)
 		}
 	}()
 
+	// warm loads what a snapshot needs before it serves, at startup and on
+	// reload
+	warm := func(ctx context.Context, d *db.DB) error {
+		if *hotTables {
+			if err := d.LoadHotTables(ctx); err != nil {
+				return fmt.Errorf("load hot tables: %w", err)
+			}
+		}
+		if *selfTest != "" && !runSelfTest(ctx, d, manifest) && *selfTestStrict {
+			return errors.New("self-test failed")
+		}
+		return nil
+	}
+	var notifier *webhooks.Notifier
+	if *webhookURLs != "" {
+		notifier = webhooks.New(splitList(*webhookURLs), *webhookSecret)
+	}
+	rl := &reloader{
+		path:      *dbPath,
+		swap:      snapshot,
+		prepare:   prepare,
+		warm:      warm,
+		reloading: handler.SetReloading,
+		baseLogs:  baseLogs,
+	}
+	if notifier != nil {
+		rl.loaded = func(ctx context.Context, took time.Duration) {
+			notifySnapshotLoaded(ctx, notifier, store, took)
+		}
+	}
+	// Warm caches while already listening so /healthz answers during startup;
+	// /readyz stays 503 until this finishes
+	go func() {
+		if err := warm(ctx, database); err != nil {
+			slog.Error("refusing to serve", "err", err)
+			os.Exit(1)
+		}
+		handler.SetReady(true)
+		slog.Info("ready")
+
+		go func() {
+			for {
+				// Only reloads started here are passed on, so peers
+				// don't echo them back
+				fromPeer := false
+				select {
+				case <-ctx.Done():
+					return
+				case <-hup:
+				case <-peerReload:
+					fromPeer = true
+				}
+				version := snapshot.DatasetVersion()
+				if err := rl.reload(ctx); err != nil {
+					slog.Error("reload snapshot", "err", err)
+					continue
+				}
+				if !fromPeer && cluster.Enabled() && snapshot.DatasetVersion() != version {
+					cluster.Broadcast(ctx, peers.Event{Type: peers.EventReload})
+				}
+			}
+		}()
+		if notifier != nil {
+			notifySnapshotLoaded(ctx, notifier, store, time.Since(loadStart))
+		}
+	}()
+
+	if *imageMirror {
+		go func() {
+			slog.Info("image mirror started", "dir", *imageCacheDir, "workers", *mirrorWorkers)
+			stats, err := opts.Images.Mirror(ctx, func(fn func(string) error) error {
+				return snapshot.ForEachImageURL(ctx, fn)
+			}, *mirrorWorkers)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("image mirror", "err", err)
+			}
+			slog.Info("image mirror finished", "seen", stats.Seen, "downloaded", stats.Downloaded,
+				"cached", stats.Cached, "skipped", stats.Skipped, "failed", stats.Failed)
+		}()
+	}
+
+	if syncer != nil {
+		go syncer.Run(ctx, *syncInterval)
+	}
+
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			logging.Toggle(levelVar, baseLevel)
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	slog.Info("shutting down")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	slog.Info("shutting down", "in_flight", len(inflight.List()), "timeout", *drainTimeout)
+	stop()
+	handler.SetReady(false)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
 	defer cancel()
-	srv.Shutdown(ctx)
+	if challengeSrv != nil {
+		challengeSrv.Shutdown(shutdownCtx)
+	}
+	if debugSrv != nil {
+		debugSrv.Close()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		drain(srv, inflight)
+	}
+	slog.Info("shutdown complete")
+}
+
+// drain cuts off the requests still running after the shutdown timeout:
+// their contexts are cancelled so SQLite queries stop, and their connections
+// are closed so handlers blocked on the network return. It then waits
+// briefly for the handlers to unwind before the databases are closed. Every
+// request cut off is logged.
+func drain(srv *http.Server, inflight *api.Inflight) {
+	for _, req := range inflight.List() {
+		slog.Warn("cancelling in-flight request", "request_id", req.RequestID, "method", req.Method,
+			"path", req.Path, "running_ms", time.Since(req.Started).Milliseconds())
+	}
+	inflight.Cancel()
+	srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if inflight.Wait(ctx) != nil {
+		for _, req := range inflight.List() {
+			slog.Error("abandoning request that ignored cancellation", "request_id", req.RequestID,
+				"method", req.Method, "path", req.Path)
+		}
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// runSelfTest runs the self-test manifest against s and logs the results,
+// reporting whether every check passed
+func runSelfTest(ctx context.Context, s db.Store, m selftest.Manifest) bool {
+	rep := selftest.Run(ctx, s, m)
+	for _, res := range rep.Results {
+		if res.OK {
+			slog.Debug("self-test check passed", "kind", res.Check.Kind, "name", res.Check.Name, "latency_ms", res.LatencyMs)
+		} else {
+			slog.Warn("self-test check failed", "kind", res.Check.Kind, "name", res.Check.Name,
+				"id", res.Check.ID, "query", res.Check.Query, "latency_ms", res.LatencyMs, "err", res.Err)
+		}
+	}
+	slog.Info("self-test complete", "passed", rep.Passed, "failed", rep.Failed)
+	return rep.OK()
+}
+
+// notifySnapshotLoaded tells the webhooks which snapshot is being served.
+// Counting can take minutes on a full snapshot, so it runs after the
+// instance is already ready.
+func notifySnapshotLoaded(ctx context.Context, n *webhooks.Notifier, store db.Store, took time.Duration) {
+	ev := webhooks.Event{
+		Type:           webhooks.EventSnapshotLoaded,
+		DatasetVersion: store.DatasetVersion(),
+		DurationMs:     took.Milliseconds(),
+	}
+	ev.Host, _ = os.Hostname()
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("count snapshot for webhooks", "err", err)
+	} else {
+		ev.Counts = webhooks.Counts{Tracks: stats.Tracks, Albums: stats.Albums, Artists: stats.Artists}
+	}
+	n.Send(ctx, ev)
+}
+
+// readList splits a comma-separated flag value, or reads one entry per line
+// from the file named after a leading @. Blank lines and # comments are
+// skipped.
+func readList(s string) ([]string, error) {
+	path, ok := strings.CutPrefix(s, "@")
+	if !ok {
+		return splitList(s), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, nil
 }
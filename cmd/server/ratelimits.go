@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+
+	"metadata-api/internal/api"
+)
+
+// Built-in per-IP limits, used when -rate-limits is unset or leaves them out
+const (
+	defaultRate  = 100
+	defaultBurst = 200
+)
+
+// rateLimitFile is the -rate-limits YAML file:
+//
+//	rate: 100          # requests per second per IP, for routes not listed
+//	burst: 200
+//	routes:
+//	  - route: /search/            # path prefix
+//	    rate: 5
+//	    burst: 10
+//	  - route: POST /batch/lookup  # optionally limited to one method
+//	    rate: 2
+//	    burst: 4
+//	exempt:                        # never limited
+//	  cidrs: [10.0.0.0/8, 192.0.2.7]
+//	  api_keys: [nightly-enrichment]
+type rateLimitFile struct {
+	Rate   float64 `yaml:"rate"`
+	Burst  int     `yaml:"burst"`
+	Routes []struct {
+		Route string  `yaml:"route"`
+		Rate  float64 `yaml:"rate"`
+		Burst int     `yaml:"burst"`
+	} `yaml:"routes"`
+	Exempt struct {
+		CIDRs   []string `yaml:"cidrs"`
+		APIKeys []string `yaml:"api_keys"`
+	} `yaml:"exempt"`
+}
+
+// newRateLimiter builds the per-IP rate limiter, with per-route limits
+// from the file at path if it is set
+func newRateLimiter(path string) (*api.RateLimiter, error) {
+	if path == "" {
+		return api.NewRateLimiter(defaultRate, defaultBurst), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := rateLimitFile{Rate: defaultRate, Burst: defaultBurst}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Rate <= 0 || cfg.Burst < 1 {
+		return nil, fmt.Errorf("%s: rate must be positive and burst at least 1", path)
+	}
+
+	rl := api.NewRateLimiter(rate.Limit(cfg.Rate), cfg.Burst)
+	for _, route := range cfg.Routes {
+		if route.Rate <= 0 {
+			return nil, fmt.Errorf("%s: route %q: rate must be positive", path, route.Route)
+		}
+		if err := rl.Route(route.Route, rate.Limit(route.Rate), route.Burst); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := rl.Exempt(cfg.Exempt.CIDRs, cfg.Exempt.APIKeys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rl, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"metadata-api/internal/db"
+)
+
+// reloader swaps in a fresh copy of the snapshot at -db, for SIGHUP after
+// new files were moved into place. The old snapshot serves until the new
+// one is open and warm.
+type reloader struct {
+	path      string
+	swap      *db.Swap
+	prepare   func(*db.DB) error                   // caches and URL rewriting, as at startup
+	warm      func(context.Context, *db.DB) error  // hot tables and the self-test
+	loaded    func(context.Context, time.Duration) // called after each swap
+	reloading func(bool)                           // marks /readyz not ready meanwhile
+	mu        sync.Mutex
+	baseLogs  *slog.Logger // the default logger before dataset_version was added
+}
+
+// reload opens the snapshot again and swaps it in. It does nothing when
+// the files haven't changed, and keeps serving the old snapshot when the
+// new one fails to open or warm. /readyz reports "reloading" while the new
+// snapshot warms, so balancers can prefer replicas that aren't busy.
+func (rl *reloader) reload(ctx context.Context) error {
+	if !rl.mu.TryLock() {
+		return errors.New("a reload is already running")
+	}
+	defer rl.mu.Unlock()
+
+	start := time.Now()
+	d, err := db.Open(rl.path)
+	if err != nil {
+		return err
+	}
+	if d.DatasetVersion() == rl.swap.DatasetVersion() {
+		d.Close()
+		slog.InfoContext(ctx, "snapshot unchanged, not reloading")
+		return nil
+	}
+	rl.reloading(true)
+	defer rl.reloading(false)
+	if err := rl.prepare(d); err != nil {
+		d.Close()
+		return err
+	}
+	if err := rl.warm(ctx, d); err != nil {
+		d.Close()
+		return err
+	}
+
+	rl.swap.Replace(d)
+	slog.SetDefault(rl.baseLogs.With("dataset_version", d.DatasetVersion()))
+	took := time.Since(start)
+	slog.InfoContext(ctx, "snapshot reloaded", "took", took)
+	if rl.loaded != nil {
+		rl.loaded(ctx, took)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsConfig holds the TLS flags. Static certificates and autocert are
+// mutually exclusive; with neither set the server speaks plain HTTP.
+type tlsConfig struct {
+	certFile string
+	keyFile  string
+
+	domains  []string // autocert allowlist; non-empty enables autocert
+	cacheDir string
+	email    string
+	httpAddr string // serves HTTP-01 challenges and redirects to HTTPS
+}
+
+func (c tlsConfig) enabled() bool {
+	return c.certFile != "" || len(c.domains) > 0
+}
+
+// apply configures srv for TLS. In autocert mode it also returns the plain
+// HTTP server for ACME challenges, or nil when -autocert-http is empty (the
+// TLS-ALPN challenge on the main listener is then used alone).
+func (c tlsConfig) apply(srv *http.Server) (*http.Server, error) {
+	if (c.certFile == "") != (c.keyFile == "") {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+	if c.certFile != "" && len(c.domains) > 0 {
+		return nil, errors.New("-tls-cert and -autocert-domains are mutually exclusive")
+	}
+
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(c.domains) == 0 {
+		return nil, nil
+	}
+	if c.cacheDir == "" {
+		return nil, errors.New("-autocert-domains requires -autocert-cache so certificates survive restarts")
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(c.domains...),
+		Cache:      autocert.DirCache(c.cacheDir),
+		Email:      c.email,
+	}
+	srv.TLSConfig = m.TLSConfig()
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+	if c.httpAddr == "" {
+		return nil, nil
+	}
+	return &http.Server{
+		Addr:              c.httpAddr,
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}, nil
+}
+
+// serve starts srv with or without TLS on l, or on srv.Addr when l is nil.
+// Certificates come from the files or, in autocert mode, from
+// srv.TLSConfig.
+func (c tlsConfig) serve(srv *http.Server, l net.Listener) error {
+	if len(c.domains) > 0 {
+		slog.Info("autocert enabled, certificates are obtained on first use", "domains", c.domains, "cache", c.cacheDir)
+	}
+	switch {
+	case l != nil && c.enabled():
+		return srv.ServeTLS(l, c.certFile, c.keyFile)
+	case l != nil:
+		return srv.Serve(l)
+	case c.enabled():
+		return srv.ListenAndServeTLS(c.certFile, c.keyFile)
+	default:
+		return srv.ListenAndServe()
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// AccessLog logs one line per request. Successful requests are sampled so
+// access logs don't dominate I/O on busy instances; errors and slow
+// requests are always logged, slow ones with their query parameters so
+// expensive search patterns stand out.
+type AccessLog struct {
+	Sample float64       // fraction of fast 1xx-3xx requests logged, 0 to 1
+	Slow   time.Duration // requests at least this slow are always logged; 0 disables
+}
+
+// Middleware logs requests as they finish. Place it inside RequestID so
+// lines carry the request ID.
+func (a AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		took := time.Since(start)
+
+		slow := a.Slow > 0 && took >= a.Slow
+		level := slog.LevelInfo
+		switch {
+		case sw.status >= 500:
+			level = slog.LevelError
+		case slow:
+			level = slog.LevelWarn
+		case sw.status >= 400:
+		case a.Sample <= 0 || (a.Sample < 1 && rand.Float64() >= a.Sample):
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.status),
+			slog.Int64("bytes", sw.bytes),
+			slog.Float64("duration_ms", float64(took.Microseconds())/1000),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if slow {
+			attrs = append(attrs, slog.Bool("slow", true), slog.String("query", loggedQuery(r)))
+		}
+		if level == slog.LevelInfo && sw.status < 400 && a.Sample < 1 {
+			// Lets log pipelines scale sampled counts back up
+			attrs = append(attrs, slog.Float64("sample_rate", a.Sample))
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// loggedQuery returns the request's query string with API keys masked
+func loggedQuery(r *http.Request) string {
+	q := r.URL.Query()
+	if q.Has("api_key") {
+		q.Set("api_key", "REDACTED")
+		return q.Encode()
+	}
+	return r.URL.RawQuery
+}
+
+// statusWriter records the status and size of a response. Unwrap lets
+// http.ResponseController reach the underlying writer for flushes and
+// deadlines.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// AdminAuth guards admin endpoints with a bearer token. An empty token
+// leaves admin endpoints disabled entirely. Their responses are never
+// stored by caches.
+func AdminAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if token == "" {
+			http.Error(w, "admin endpoints disabled", http.StatusNotFound)
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) admin(fn http.HandlerFunc) http.Handler {
+	return AdminAuth(h.opts.AdminToken, fn)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.db.Stats(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "stats", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Null counts are live, unlike the cached entity counts
+	resp := *stats
+	resp.NullCounts = h.db.NullCounts()
+	respond(w, r, resp)
+}
+
+// latency reports per-route latency histograms since startup
+func (h *Handler) latency(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, h.opts.Latency.Snapshot())
+}
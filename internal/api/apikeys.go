@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// keyFreePaths are the path prefixes served without an API key: probes,
+// the docs, image URLs handed out in responses, and routes guarded by the
+// admin token or the peer secret
+var keyFreePaths = []string{"/health", "/readyz", "/docs", "/openapi.yaml", "/images/", "/admin/", "/internal/"}
+
+// APIKeys requires a known API key, in the X-API-Key header or the api_key
+// query parameter, on every other request. Keys are held as hashes so
+// lookups don't compare them byte by byte.
+type APIKeys struct {
+	keys map[[sha256.Size]byte]bool
+}
+
+func NewAPIKeys(keys []string) (*APIKeys, error) {
+	k := &APIKeys{keys: make(map[[sha256.Size]byte]bool)}
+	for _, key := range keys {
+		if key == "" {
+			return nil, errors.New("empty API key")
+		}
+		k.keys[sha256.Sum256([]byte(key))] = true
+	}
+	return k, nil
+}
+
+func (k *APIKeys) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || keyFree(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The response depends on the key; ?api_key= is part of the URL anyway
+		addVary(w.Header(), "X-API-Key")
+		key := requestKey(r)
+		switch {
+		case key == "":
+			http.Error(w, "API key required", http.StatusUnauthorized)
+		case !k.keys[sha256.Sum256([]byte(key))]:
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+		default:
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), validKey{}, key)))
+		}
+	})
+}
+
+func keyFree(path string) bool {
+	for _, prefix := range keyFreePaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type validKey struct{}
+
+// validatedKey returns the API key of r if APIKeys accepted it
+func validatedKey(r *http.Request) (string, bool) {
+	key, ok := r.Context().Value(validKey{}).(string)
+	return key, ok
+}
+
+// requestKey returns the API key the request carries, if any
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("api_key")
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"metadata-api/internal/audit"
+	"metadata-api/internal/logging"
+)
+
+// maxOperatorLen caps the X-Operator header stored with an audit event
+const maxOperatorLen = 64
+
+// Audit records every admin request that changes something (anything but
+// GET, HEAD, and OPTIONS) and got past the admin token check. Like
+// Latency.Middleware it must wrap the ServeMux directly, so requests that
+// matched no route, and can't have reached an admin handler, are left out.
+func Audit(log *audit.Log, mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/admin/") || r.Method == http.MethodGet ||
+			r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		body := &hashingReader{r: r.Body, h: sha256.New()}
+		r.Body = body
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(sw, r)
+		if r.Pattern == "" || sw.status == http.StatusUnauthorized {
+			return
+		}
+		// Hash the whole body even when the handler stopped reading early
+		io.Copy(io.Discard, io.LimitReader(body, maxOverlayBody))
+
+		operator := strings.TrimSpace(r.Header.Get("X-Operator"))
+		if len(operator) > maxOperatorLen {
+			operator = operator[:maxOperatorLen]
+		}
+		err := log.Append(r.Context(), audit.Event{
+			Time:       start,
+			Operator:   operator,
+			IP:         clientAddr(r),
+			RequestID:  logging.RequestID(r.Context()),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Status:     sw.status,
+			BodySHA256: hex.EncodeToString(body.h.Sum(nil)),
+			BodySize:   body.n,
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "append audit event", "method", r.Method, "path", r.URL.Path, "err", err)
+		}
+	})
+}
+
+// hashingReader hashes and counts what is read through it
+type hashingReader struct {
+	r io.ReadCloser
+	h hash.Hash
+	n int64
+}
+
+func (b *hashingReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.h.Write(p[:n])
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *hashingReader) Close() error { return b.r.Close() }
+
+// auditEvents lists audit events newest first, filtered by ?since= (RFC
+// 3339) and ?operator=, paging back with ?before= the last seq seen
+func (h *Handler) auditEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := audit.Filter{Operator: q.Get("operator"), Limit: 100}
+	if s := q.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time, e.g. 2024-01-02T15:04:05Z", http.StatusBadRequest)
+			return
+		}
+		f.Since = t
+	}
+	if s := q.Get("before"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 1 {
+			http.Error(w, "before must be a positive seq", http.StatusBadRequest)
+			return
+		}
+		f.Before = n
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		f.Limit = n
+	}
+
+	events, err := h.opts.Audit.Events(r.Context(), f)
+	if err != nil {
+		h.dbError(w, r, "audit events", err)
+		return
+	}
+	respond(w, r, events)
+}
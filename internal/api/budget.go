@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"metadata-api/internal/models"
+)
+
+// maxBatchBody bounds how much of a batch request body is buffered to compute its cost
+const maxBatchBody = 1 << 20
+
+// QueryBudget enforces per-key concurrency and query-cost limits.
+// Callers are keyed by the API key APIKeys validated, falling back to the
+// client IP when keys aren't checked.
+type QueryBudget struct {
+	mu         sync.Mutex
+	keys       map[string]*keyBudget
+	concurrent int        // max in-flight requests per key, 0 disables
+	r          rate.Limit // cost units replenished per second
+	b          int        // max cost units that can be spent at once
+}
+
+type keyBudget struct {
+	inFlight int
+	cost     *rate.Limiter
+}
+
+// NewQueryBudget creates a budget allowing concurrent in-flight requests per key
+// and a cost bucket refilled at r units per second with capacity b.
+// A plain lookup costs 1 unit; batch requests cost one unit per item.
+func NewQueryBudget(concurrent int, r rate.Limit, b int) *QueryBudget {
+	return &QueryBudget{
+		keys:       make(map[string]*keyBudget),
+		concurrent: concurrent,
+		r:          r,
+		b:          b,
+	}
+}
+
+// budgetError is the JSON body returned when a budget is exhausted
+type budgetError struct {
+	Error        string `json:"error"`
+	Limit        int    `json:"limit"`
+	Cost         int    `json:"cost,omitempty"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+func (qb *QueryBudget) get(key string) *keyBudget {
+	kb, ok := qb.keys[key]
+	if !ok {
+		kb = &keyBudget{cost: rate.NewLimiter(qb.r, qb.b)}
+		qb.keys[key] = kb
+	}
+	return kb
+}
+
+// acquire reserves a concurrency slot and cost units for key.
+// On failure it returns the error payload to send.
+func (qb *QueryBudget) acquire(key string, cost int) *budgetError {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	kb := qb.get(key)
+	if qb.concurrent > 0 && kb.inFlight >= qb.concurrent {
+		return &budgetError{
+			Error: "too many concurrent requests for this key",
+			Limit: qb.concurrent,
+		}
+	}
+
+	if qb.b > 0 {
+		if cost > qb.b {
+			return &budgetError{
+				Error: "request cost exceeds per-key budget capacity",
+				Limit: qb.b,
+				Cost:  cost,
+			}
+		}
+		res := kb.cost.ReserveN(time.Now(), cost)
+		if delay := res.Delay(); delay > 0 {
+			res.Cancel()
+			return &budgetError{
+				Error:        "query budget exhausted for this key",
+				Limit:        qb.b,
+				Cost:         cost,
+				RetryAfterMs: delay.Milliseconds(),
+			}
+		}
+	}
+
+	kb.inFlight++
+	return nil
+}
+
+func (qb *QueryBudget) release(key string) {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	kb := qb.keys[key]
+	kb.inFlight--
+	if kb.inFlight == 0 && (qb.b == 0 || kb.cost.TokensAt(time.Now()) >= float64(qb.b)) {
+		// Idle keys with a full bucket carry no state worth keeping
+		delete(qb.keys, key)
+	}
+}
+
+// Middleware wraps an http.Handler with per-key budget enforcement
+func (qb *QueryBudget) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := apiKey(r)
+		cost := requestCost(r)
+
+		if berr := qb.acquire(key, cost); berr != nil {
+			if berr.RetryAfterMs > 0 {
+				secs := int(math.Ceil(float64(berr.RetryAfterMs) / 1000))
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+			}
+			respondStatus(w, r, http.StatusTooManyRequests, berr)
+			return
+		}
+		defer qb.release(key)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiKey returns the caller's validated API key, or its address otherwise.
+// Neither an unchecked key nor X-Forwarded-For from an untrusted client can
+// identify a caller, who could send a new one with every request for a
+// fresh budget.
+func apiKey(r *http.Request) string {
+	if key, ok := validatedKey(r); ok {
+		return key
+	}
+	return clientAddr(r)
+}
+
+// batchPaths are POST endpoints whose body lists items under the keys of
+// models.BatchLookupRequest, or under "items"
+var batchPaths = map[string]bool{
+	"/batch/lookup":         true,
+	"/lookup":               true,
+	"/lookup/albums/tracks": true,
+	"/match/batch":          true,
+}
+
+// requestCost weighs batch requests by their item count so one large
+// batch counts the same as the equivalent number of single lookups
+func requestCost(r *http.Request) int {
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/lookup/isrc") {
+		list := r.URL.Query().Get("isrcs")
+		if list == "" {
+			list = strings.TrimPrefix(r.URL.Path, "/lookup/isrc/")
+		}
+		return max(len(splitList(list)), 1)
+	}
+	if r.Method != http.MethodPost || !batchPaths[r.URL.Path] || r.Body == nil {
+		return 1
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBatchBody))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 1
+	}
+
+	var req struct {
+		models.BatchLookupRequest
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 1
+	}
+	if n := len(req.Tracks) + len(req.Artists) + len(req.Albums) + len(req.ISRCs) + len(req.Items); n > 1 {
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uncachedPaths are the path prefixes never marked cacheable: probes,
+// changeable collections, and routes behind the admin token or the peer
+// secret
+var uncachedPaths = []string{"/health", "/readyz", "/admin/", "/collections", "/internal/"}
+
+// CacheControl lets shared caches such as CDNs keep successful catalog
+// lookups for MaxAge. ?meta=true responses describe how one request was
+// served, so they are left uncached too.
+type CacheControl struct {
+	MaxAge time.Duration
+}
+
+func (c CacheControl) Middleware(next http.Handler) http.Handler {
+	value := "public, max-age=" + strconv.Itoa(int(c.MaxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead || r.URL.Query().Get("meta") == "true" ||
+			slices.ContainsFunc(uncachedPaths, func(p string) bool { return strings.HasPrefix(r.URL.Path, p) }) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&cachingWriter{ResponseWriter: w, value: value}, r)
+	})
+}
+
+// cachingWriter sets Cache-Control on 200 and 304 responses whose handler
+// didn't, so revalidated responses stay fresh as long
+type cachingWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cachingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if h := w.Header(); (code == http.StatusOK || code == http.StatusNotModified) && h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", w.value)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cachingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cachingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// addVary adds names to the Vary header, keeping it to one line without
+// repeats, since some caches only read the first
+func addVary(h http.Header, names ...string) {
+	var vary []string
+	for _, v := range append(h.Values("Vary"), names...) {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !slices.ContainsFunc(vary, func(n string) bool { return strings.EqualFold(n, name) }) {
+				vary = append(vary, name)
+			}
+		}
+	}
+	h.Set("Vary", strings.Join(vary, ", "))
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Middleware wraps a handler
+type Middleware func(http.Handler) http.Handler
+
+// Stage is a named middleware of a Chain, skipped when not Enabled
+type Stage struct {
+	Name    string
+	Enabled bool
+	Wrap    Middleware
+}
+
+// Chain composes middleware in the order requests pass through them: the
+// first stage sees a request first and its response last.
+type Chain []Stage
+
+// Then wraps h in the enabled stages
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].Enabled {
+			h = c[i].Wrap(h)
+		}
+	}
+	return h
+}
+
+// Names lists the enabled stages in order
+func (c Chain) Names() []string {
+	var names []string
+	for _, s := range c {
+		if s.Enabled {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// Recover answers requests whose handler panicked with a 500, logging the
+// panic and its stack, rather than letting net/http drop the connection.
+// A response already under way can't be replaced, so it is aborted.
+// Outside RequestID the request ID is taken from the response header.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			slog.ErrorContext(r.Context(), "handler panic", "method", r.Method, "path", r.URL.Path,
+				"request_id", w.Header().Get("X-Request-ID"), "panic", v, "stack", string(debug.Stack()))
+			if sw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// corsMethods and corsHeaders are what preflight requests may ask for
+const (
+	corsMethods = "GET, HEAD, POST, PUT, PATCH, DELETE"
+	corsHeaders = "Authorization, Content-Type, X-API-Key, X-Request-ID, X-Operator"
+)
+
+// corsExposed are the response headers beyond the CORS-safelisted ones
+// that scripts may read
+const corsExposed = "X-Request-ID, Retry-After, X-Next-Cursor, X-Search-Backend, Deprecation, Sunset, Link, ETag"
+
+// CORS lets scripts on other origins call the API from browsers
+type CORS struct {
+	Origins []string // allowed origins, such as https://app.example.com; "*" allows any
+}
+
+// Middleware adds CORS headers to responses to allowed origins and answers
+// their preflight requests itself, so those never need an API key or count
+// against rate limits
+func (c CORS) Middleware(next http.Handler) http.Handler {
+	anyOrigin := slices.Contains(c.Origins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		if !anyOrigin {
+			addVary(h, "Origin")
+		}
+		origin := r.Header.Get("Origin")
+		if origin == "" || !anyOrigin && !slices.ContainsFunc(c.Origins, func(o string) bool { return strings.EqualFold(o, origin) }) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", corsMethods)
+			h.Set("Access-Control-Allow-Headers", corsHeaders)
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", corsExposed)
+		next.ServeHTTP(w, r)
+	})
+}
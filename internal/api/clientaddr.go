@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies resolves the address of each request's client: the
+// connection's, or, on connections from one of the trusted proxies, the
+// last X-Forwarded-For entry the trusted proxies didn't add themselves.
+// Any other client could claim any address by sending the header, so rate
+// limits, budgets, usage, and the audit log all go by this address.
+type TrustedProxies struct {
+	nets []netip.Prefix
+}
+
+// NewTrustedProxies trusts X-Forwarded-For on connections from an address
+// in one of cidrs; a bare IP address trusts just that address
+func NewTrustedProxies(cidrs []string) (*TrustedProxies, error) {
+	nets, err := parsePrefixes("trusted proxy", cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return &TrustedProxies{nets: nets}, nil
+}
+
+// Middleware stores the client's address in the request context
+func (tp *TrustedProxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr := tp.resolve(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientAddrKey{}, addr)))
+	})
+}
+
+// resolve walks X-Forwarded-For from the right while the hop it came from
+// is trusted. A malformed entry ends the walk at the proxy that passed it.
+func (tp *TrustedProxies) resolve(r *http.Request) string {
+	addr, ok := remoteAddr(r)
+	if !ok {
+		return remoteHost(r)
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && containsAddr(tp.nets, addr); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		next, err := netip.ParseAddr(hop)
+		if err != nil {
+			break
+		}
+		addr = next.Unmap()
+	}
+	return addr.String()
+}
+
+type clientAddrKey struct{}
+
+// clientAddr returns the client's address as resolved by TrustedProxies,
+// or the connection's without TrustedProxies in the chain
+func clientAddr(r *http.Request) string {
+	if addr, ok := r.Context().Value(clientAddrKey{}).(string); ok {
+		return addr
+	}
+	if addr, ok := remoteAddr(r); ok {
+		return addr.String()
+	}
+	return remoteHost(r)
+}
+
+// remoteAddr parses the connection's address without the port
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(remoteHost(r))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// parsePrefixes parses CIDRs, or bare IP addresses as single addresses
+func parsePrefixes(what string, cidrs []string) ([]netip.Prefix, error) {
+	var nets []netip.Prefix
+	for _, c := range cidrs {
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(c)
+			if aerr != nil {
+				return nil, fmt.Errorf("%s %q: not an IP address or CIDR", what, c)
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		nets = append(nets, p.Masked())
+	}
+	return nets, nil
+}
+
+func containsAddr(nets []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range nets {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
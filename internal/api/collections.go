@@ -0,0 +1,369 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"metadata-api/internal/collections"
+	"metadata-api/internal/db"
+	"metadata-api/internal/models"
+)
+
+// Collection request limits
+const (
+	maxCollectionBody   = 64 << 10
+	maxCollectionAdd    = 100 // track IDs per create or add request
+	maxCollectionName   = 100 // characters
+	maxCollectionDetail = 300 // characters of description
+)
+
+// collectionRequest is the body of POST /collections and, with only
+// TrackIDs, of POST /collections/{id}/tracks
+type collectionRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	TrackIDs    []string `json:"track_ids"`
+}
+
+// collectionResponse is a collection with a page of its tracks resolved
+// from the catalog. Tracks no longer in the catalog stay in track_ids but
+// are left out of tracks.
+type collectionResponse struct {
+	collections.Collection
+	EditToken string         `json:"edit_token,omitempty"` // only when the collection is created
+	Tracks    []models.Track `json:"tracks"`
+	Limit     int            `json:"limit"`
+	Offset    int            `json:"offset"`
+}
+
+// playlistsResponse is a page of the collections holding a track
+type playlistsResponse struct {
+	TrackID       string                   `json:"track_id"`
+	PlaylistCount int                      `json:"playlist_count"` // across all pages
+	Playlists     []collections.Collection `json:"playlists"`
+	Limit         int                      `json:"limit"`
+	Offset        int                      `json:"offset"`
+}
+
+// albumPlaylistsResponse is a page of the collections holding any of an
+// album's tracks
+type albumPlaylistsResponse struct {
+	AlbumID       string                   `json:"album_id"`
+	PlaylistCount int                      `json:"playlist_count"` // across all pages
+	Playlists     []collections.Collection `json:"playlists"`
+	Limit         int                      `json:"limit"`
+	Offset        int                      `json:"offset"`
+}
+
+func (h *Handler) collectionRoutes(mux *Mux) {
+	mux.HandleFunc("GET /collections", h.listCollections)
+	mux.HandleFunc("POST /collections", h.createCollection)
+	mux.HandleFunc("GET /collections/{id}", h.getCollection)
+	mux.HandleFunc("DELETE /collections/{id}", h.deleteCollection)
+	mux.HandleFunc("POST /collections/{id}/tracks", h.addCollectionTracks)
+	mux.HandleFunc("DELETE /collections/{id}/tracks/{track_id}", h.removeCollectionTrack)
+	mux.HandleFunc("GET /lookup/track/{id}/playlists", h.trackPlaylists)
+	mux.HandleFunc("GET /lookup/album/{id}/playlists", h.albumPlaylists)
+}
+
+// listCollections lists collections most recently changed first, paged
+// with ?limit= (at most 100) and ?offset=
+func (h *Handler) listCollections(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r, 20, 100)
+	list, err := h.opts.Collections.List(r.Context(), limit, offset)
+	if err != nil {
+		h.collectionError(w, r, "list collections", err)
+		return
+	}
+	setPageLinks(w, r, limit, offset, len(list) == limit)
+	respond(w, r, list)
+}
+
+// trackPlaylists lists the collections holding a track, most recently
+// changed first, paged with ?limit= (at most 100) and ?offset=, with how
+// many there are in all
+func (h *Handler) trackPlaylists(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := db.CheckID(id); err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	limit, offset := pageParams(r, 20, 100)
+	list, err := h.opts.Collections.Containing(r.Context(), []string{id}, limit, offset)
+	if err != nil {
+		h.collectionError(w, r, "track collections", err)
+		return
+	}
+	counts, err := h.opts.Collections.Counts(r.Context(), []string{id})
+	if err != nil {
+		h.collectionError(w, r, "track collections", err)
+		return
+	}
+	setPageLinks(w, r, limit, offset, len(list) == limit)
+	// Collections change at any time, so unlike the rest of /lookup this
+	// isn't for shared caches
+	w.Header().Set("Cache-Control", "no-store")
+	respond(w, r, playlistsResponse{TrackID: id, PlaylistCount: counts[id], Playlists: list, Limit: limit, Offset: offset})
+}
+
+// albumPlaylists is trackPlaylists for the collections holding any of an
+// album's tracks. Their number is how many playlists the album appears in,
+// a measure of its local popularity.
+func (h *Handler) albumPlaylists(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := db.CheckID(id); err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	limit, offset := pageParams(r, 20, 100)
+	tracks, err := h.db.GetAlbumTracks(r.Context(), id)
+	if err != nil {
+		h.lookupError(w, r, "album tracks", "albums", id, err)
+		return
+	}
+	trackIDs := make([]string, len(tracks))
+	for i, t := range tracks {
+		trackIDs[i] = t.ID
+	}
+	list, err := h.opts.Collections.Containing(r.Context(), trackIDs, limit, offset)
+	if err != nil {
+		h.collectionError(w, r, "album collections", err)
+		return
+	}
+	count, err := h.opts.Collections.Holding(r.Context(), trackIDs)
+	if err != nil {
+		h.collectionError(w, r, "album collections", err)
+		return
+	}
+	setPageLinks(w, r, limit, offset, len(list) == limit)
+	w.Header().Set("Cache-Control", "no-store")
+	respond(w, r, albumPlaylistsResponse{AlbumID: id, PlaylistCount: count, Playlists: list, Limit: limit, Offset: offset})
+}
+
+// createCollection serves POST /collections. The response carries the
+// collection's edit_token, which is needed to change it and is not shown
+// again.
+func (h *Handler) createCollection(w http.ResponseWriter, r *http.Request) {
+	req, ok := collectionBody(w, r)
+	if !ok {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Name) > maxCollectionName {
+		http.Error(w, fmt.Sprintf("name must be at most %d characters", maxCollectionName), http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Description) > maxCollectionDetail {
+		http.Error(w, fmt.Sprintf("description must be at most %d characters", maxCollectionDetail), http.StatusBadRequest)
+		return
+	}
+	ids, ok := h.catalogTracks(w, r, req.TrackIDs)
+	if !ok {
+		return
+	}
+
+	c, token, err := h.opts.Collections.Create(r.Context(), req.Name, req.Description, ids)
+	if err != nil {
+		h.collectionError(w, r, "create collection", err)
+		return
+	}
+	resp, ok := h.resolveCollection(w, r, c, maxCollectionAdd, 0)
+	if !ok {
+		return
+	}
+	resp.EditToken = token
+	respondStatus(w, r, http.StatusCreated, resp)
+}
+
+// getCollection returns a collection with ?limit= (at most 100) of its
+// tracks from ?offset= resolved
+func (h *Handler) getCollection(w http.ResponseWriter, r *http.Request) {
+	c, err := h.opts.Collections.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.collectionError(w, r, "get collection", err)
+		return
+	}
+	limit, offset := pageParams(r, 100, 100)
+	resp, ok := h.resolveCollection(w, r, c, limit, offset)
+	if !ok {
+		return
+	}
+	setPageLinks(w, r, limit, offset, offset < len(c.TrackIDs)-limit)
+	respond(w, r, resp)
+}
+
+func (h *Handler) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.collectionEditor(w, r, id) {
+		return
+	}
+	if err := h.opts.Collections.Delete(r.Context(), id); err != nil {
+		h.collectionError(w, r, "delete collection", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addCollectionTracks appends the catalog tracks in the body's track_ids
+// that the collection doesn't hold yet, responding with the collection
+func (h *Handler) addCollectionTracks(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.collectionEditor(w, r, id) {
+		return
+	}
+	req, ok := collectionBody(w, r)
+	if !ok {
+		return
+	}
+	if len(req.TrackIDs) == 0 {
+		http.Error(w, "track_ids required", http.StatusBadRequest)
+		return
+	}
+	ids, ok := h.catalogTracks(w, r, req.TrackIDs)
+	if !ok {
+		return
+	}
+
+	c, err := h.opts.Collections.AddTracks(r.Context(), id, ids)
+	if err != nil {
+		h.collectionError(w, r, "add collection tracks", err)
+		return
+	}
+	limit, offset := pageParams(r, 100, 100)
+	resp, ok := h.resolveCollection(w, r, c, limit, offset)
+	if !ok {
+		return
+	}
+	respond(w, r, resp)
+}
+
+func (h *Handler) removeCollectionTrack(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !h.collectionEditor(w, r, id) {
+		return
+	}
+	if err := h.opts.Collections.RemoveTrack(r.Context(), id, r.PathValue("track_id")); err != nil {
+		h.collectionError(w, r, "remove collection track", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// collectionEditor reports whether the request's bearer token may change
+// the collection with id: its edit token, or the admin token. Otherwise it
+// writes a 401, 403, or 404.
+func (h *Handler) collectionEditor(w http.ResponseWriter, r *http.Request, id string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, "edit token required", http.StatusUnauthorized)
+		return false
+	}
+	if h.opts.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.AdminToken)) == 1 {
+		if _, err := h.opts.Collections.Get(r.Context(), id); err != nil {
+			h.collectionError(w, r, "get collection", err)
+			return false
+		}
+		return true
+	}
+	if err := h.opts.Collections.Authorize(r.Context(), id, token); err != nil {
+		h.collectionError(w, r, "authorize collection", err)
+		return false
+	}
+	return true
+}
+
+func collectionBody(w http.ResponseWriter, r *http.Request) (collectionRequest, bool) {
+	var req collectionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCollectionBody)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// catalogTracks checks that every ID is a catalog track, writing a 400
+// naming those that aren't. It returns the IDs without duplicates.
+func (h *Handler) catalogTracks(w http.ResponseWriter, r *http.Request, ids []string) ([]string, bool) {
+	ids = splitList(strings.Join(ids, ","))
+	if len(ids) > maxCollectionAdd {
+		http.Error(w, fmt.Sprintf("at most %d track_ids per request", maxCollectionAdd), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(ids) == 0 {
+		return nil, true
+	}
+	tracks, err := h.db.BatchLookupTracks(r.Context(), ids)
+	if err != nil {
+		h.dbError(w, r, "collection tracks", err)
+		return nil, false
+	}
+	var unknown []string
+	for _, id := range ids {
+		if tracks[id] == nil {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		http.Error(w, "unknown track IDs: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+		return nil, false
+	}
+	return ids, true
+}
+
+// resolveCollection looks up limit of the collection's tracks from offset
+func (h *Handler) resolveCollection(w http.ResponseWriter, r *http.Request, c *collections.Collection, limit, offset int) (collectionResponse, bool) {
+	resp := collectionResponse{Collection: *c, Tracks: []models.Track{}, Limit: limit, Offset: offset}
+	// Clamp before adding, so huge offsets can't overflow
+	start := min(offset, len(c.TrackIDs))
+	page := c.TrackIDs[start : start+min(limit, len(c.TrackIDs)-start)]
+	if len(page) == 0 {
+		return resp, true
+	}
+	tracks, err := h.db.BatchLookupTracks(r.Context(), page)
+	if err != nil {
+		h.dbError(w, r, "collection tracks", err)
+		return resp, false
+	}
+	for _, id := range page {
+		if t := tracks[id]; t != nil {
+			resp.Tracks = append(resp.Tracks, *t)
+		}
+	}
+	return resp, true
+}
+
+func (h *Handler) collectionError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	switch {
+	case errors.Is(err, collections.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, collections.ErrForbidden):
+		http.Error(w, "edit token does not match", http.StatusForbidden)
+	case errors.Is(err, collections.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		h.dbError(w, r, op, err)
+	}
+}
+
+// pageParams parses ?limit= and ?offset=, falling back to def and 0 for
+// missing or invalid values and capping limit at most
+func pageParams(r *http.Request, def, most int) (limit, offset int) {
+	limit = def
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = min(n, most)
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && n > 0 {
+		offset = n
+	}
+	return limit, offset
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Deprecation marks a route, or a field of its responses, as going away.
+// A deprecated route answers with Deprecation (RFC 9745), Sunset (RFC 8594),
+// and Link headers; responses with a meta block, such as JSON:API documents,
+// list the deprecations of their route as warnings. Deprecated fields are
+// only warned about, since the route itself stays.
+type Deprecation struct {
+	Route   string    `json:"route"`           // mux pattern, such as "GET /health"
+	Field   string    `json:"field,omitempty"` // response field; empty for the route itself
+	Since   time.Time `json:"since"`
+	Sunset  time.Time `json:"sunset,omitzero"` // when it stops being served, once decided
+	Link    string    `json:"link,omitempty"`  // documentation of the change
+	Message string    `json:"message"`         // what to use instead
+}
+
+// deprecations lists what is deprecated. Entries are added here, with a
+// Since of their release, before routes or fields change or go away.
+var deprecations []Deprecation
+
+// deprecationsFor returns the deprecations of the route with pattern
+func deprecationsFor(pattern string) []Deprecation {
+	var out []Deprecation
+	for _, d := range deprecations {
+		if d.Route == pattern {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// routeDeprecation returns the deprecation of the route itself
+func routeDeprecation(pattern string) (Deprecation, bool) {
+	for _, d := range deprecations {
+		if d.Route == pattern && d.Field == "" {
+			return d, true
+		}
+	}
+	return Deprecation{}, false
+}
+
+// deprecated wraps the handler of a deprecated route to send its headers
+func deprecated(d Deprecation, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+		if !d.Sunset.IsZero() {
+			h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Link != "" {
+			h.Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// warnDeprecations adds the deprecations of the request's route to the
+// meta block of body, for the formats that have one
+func warnDeprecations(r *http.Request, body any) any {
+	warnings := deprecationsFor(r.Pattern)
+	if len(warnings) == 0 {
+		return body
+	}
+	if doc, ok := body.(jsonapiDocument); ok {
+		if doc.Meta == nil {
+			doc.Meta = &jsonapiMeta{}
+		}
+		doc.Meta.Deprecations = warnings
+		return doc
+	}
+	return body
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"metadata-api/internal/version"
+)
+
+// searchETag identifies a search response before it is computed, from what
+// it depends on: the build, the dataset version (which includes the
+// overlay revision), the route, the query parameters, and the Accept
+// header when ?format= doesn't override it. q is taken as sent: search
+// ignores case, but not in AND and OR. The tag is weak because gzip is
+// applied on top. ?meta=true responses report how each request was served,
+// so they get none.
+func (h *Handler) searchETag(r *http.Request) string {
+	query := r.URL.Query()
+	if query.Get("meta") == "true" {
+		return ""
+	}
+	query.Del("api_key")
+
+	sum := sha256.New()
+	for _, part := range []string{version.String(), h.db.DatasetVersion(), r.URL.Path, query.Encode()} {
+		sum.Write([]byte(part))
+		sum.Write([]byte{0})
+	}
+	if query.Get("format") == "" {
+		sum.Write([]byte(r.Header.Get("Accept")))
+	}
+	return `W/"` + hex.EncodeToString(sum.Sum(nil)[:16]) + `"`
+}
+
+// notModified answers 304 Not Modified when the request's If-None-Match
+// lists etag, comparing weakly as RFC 9110 requires for it
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	match := r.Header.Get("If-None-Match")
+	if etag == "" || match == "" {
+		return false
+	}
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			h := w.Header()
+			h.Set("ETag", etag)
+			addNegotiationVary(h, r)
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// setETag tags a successful response with etag, if it has one
+func setETag(w http.ResponseWriter, etag string) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+}
@@ -4,54 +4,141 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	swaggerFiles "github.com/swaggo/files/v2"
+
+	"metadata-api/internal/audit"
+	"metadata-api/internal/collections"
 	"metadata-api/internal/db"
+	"metadata-api/internal/images"
 	"metadata-api/internal/models"
+	"metadata-api/internal/overlay"
+	"metadata-api/internal/snapshots"
+	"metadata-api/internal/usage"
+	"metadata-api/internal/version"
 )
 
 //go:embed openapi.yaml
-var openapiSpec embed.FS
+var openapiFS embed.FS
+
+// Options configures optional handler behavior
+type Options struct {
+	AdminToken string          // bearer token for /admin endpoints; empty disables them
+	Images     *images.Cache   // backs /images/{hash}; nil disables the image proxy
+	Overlay    *overlay.Store  // backs the /admin correction routes; nil disables them
+	Latency    *Latency        // backs /admin/latency; nil disables it
+	Usage      *usage.Recorder // backs /admin/usage; nil disables it
+	Audit      *audit.Log      // backs /admin/audit; nil disables it
+
+	Collections *collections.Store // backs /collections; nil disables them
+	Snapshots   *snapshots.Manager // backs /snapshots and ?snapshot=; nil disables them
+}
 
 type Handler struct {
-	db *db.DB
+	db   db.Store
+	opts Options
+
+	ready     atomic.Bool
+	reloading atomic.Bool
 }
 
-func New(database *db.DB) *Handler {
-	return &Handler{db: database}
+func New(database db.Store, opts Options) *Handler {
+	return &Handler{db: database, opts: opts}
 }
 
-func (h *Handler) Routes() *http.ServeMux {
-	mux := http.NewServeMux()
+// Routes registers the API's routes. Routes registered on the returned Mux
+// later are documented in the served spec too.
+func (h *Handler) Routes() *Mux {
+	mux := newMux(h.db.DatasetVersion)
 
 	mux.HandleFunc("POST /batch/lookup", h.batchLookup)
+	mux.HandleFunc("POST /lookup", h.batchLookup)
 	mux.HandleFunc("GET /lookup/isrc/{isrc}", h.lookupISRC)
+	mux.HandleFunc("GET /lookup/isrc", h.lookupISRCs)
+	mux.HandleFunc("GET /xref/isrc/{isrc}/upcs", h.isrcUPCs)
+	mux.HandleFunc("GET /xref/upc/{upc}/isrcs", h.upcISRCs)
 	mux.HandleFunc("GET /lookup/track/{id}", h.lookupTrack)
+	mux.HandleFunc("GET /lookup/track/{id}/audio-features", h.audioFeatures)
+	mux.HandleFunc("GET /lookup/track/{id}/lyrics", h.lyrics)
+	mux.HandleFunc("GET /lookup/track/{id}/artists", h.trackArtists)
+	mux.HandleFunc("GET /lookup/track/{id}/tags", h.trackTags)
+	mux.HandleFunc("GET /lookup/track/{id}/similar", h.similarTracks)
+	mux.HandleFunc("GET /lookup/track/{id}/alternatives", h.trackAlternatives)
 	mux.HandleFunc("GET /lookup/artist/{id}", h.lookupArtist)
+	mux.HandleFunc("GET /lookup/artist/{id}/languages", h.artistLanguages)
+	mux.HandleFunc("GET /lookup/artist/{id}/discography", h.discography)
+	mux.HandleFunc("GET /lookup/artist/{id}/related", h.relatedArtists)
+	mux.HandleFunc("GET /lookup/artist/{id}/tracks", h.artistTracks)
 	mux.HandleFunc("GET /lookup/album/{id}", h.lookupAlbum)
 	mux.HandleFunc("GET /lookup/album/{id}/tracks", h.albumTracks)
+	mux.HandleFunc("GET /lookup/album/{id}/artists", h.albumArtists)
+	mux.HandleFunc("POST /lookup/albums/tracks", h.batchAlbumTracks)
+	mux.HandleFunc("GET /lookup/mbid/{type}/{mbid}", h.lookupMBID)
+	h.musicBrainzRoutes(mux)
+	h.lidarrRoutes(mux)
+	if h.opts.Images != nil {
+		mux.HandleFunc("GET /images/{hash}", h.image)
+	}
+
+	mux.HandleFunc("GET /genres", h.listGenres)
+	mux.HandleFunc("GET /genres/{genre}/artists", h.genreArtists)
+	mux.HandleFunc("GET /genres/{genre}/albums", h.genreAlbums)
 	mux.HandleFunc("GET /search/artist", h.searchArtist)
 	mux.HandleFunc("GET /search/track", h.searchTrack)
+	mux.HandleFunc("POST /match/track", h.matchTrack)
+	mux.HandleFunc("POST /match/batch", h.matchBatch)
+	mux.HandleFunc("GET /radio", h.radio)
+	if h.opts.Collections != nil {
+		h.collectionRoutes(mux)
+	}
+	if h.opts.Snapshots != nil {
+		mux.HandleFunc("GET /snapshots", h.listSnapshots)
+	}
 	mux.HandleFunc("GET /health", h.health)
+	mux.HandleFunc("GET /healthz", h.healthz)
+	mux.HandleFunc("GET /readyz", h.readyz)
 
-	mux.HandleFunc("GET /openapi.yaml", h.openapiSpec)
+	mux.Handle("GET /admin/stats", h.admin(h.stats))
+	if h.opts.Latency != nil {
+		mux.Handle("GET /admin/latency", h.admin(h.latency))
+	}
+	if h.opts.Usage != nil {
+		mux.Handle("GET /admin/usage", h.admin(h.usageSummary))
+	}
+	if h.opts.Audit != nil {
+		mux.Handle("GET /admin/audit", h.admin(h.auditEvents))
+	}
+	if h.opts.Overlay != nil {
+		h.overlayRoutes(mux)
+	}
+
+	mux.HandleFunc("GET /openapi.yaml", h.openapiSpec(mux))
 	mux.HandleFunc("GET /docs", h.swaggerUI)
+	// Swagger UI assets are compiled in so /docs works without internet access
+	mux.Handle("GET /docs/assets/", docsAssets())
 	mux.HandleFunc("GET /", h.swaggerUI)
+	mux.HandleFunc("OPTIONS /", mux.options)
 
 	return mux
 }
 
-func (h *Handler) openapiSpec(w http.ResponseWriter, r *http.Request) {
-	data, err := openapiSpec.ReadFile("openapi.yaml")
-	if err != nil {
-		http.Error(w, "spec not found", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "text/yaml")
-	w.Write(data)
+// docsAssets serves the embedded Swagger UI files. Embedded files have no
+// modification time to revalidate against, so browsers are allowed to
+// cache them for a day instead of refetching the bundle on every visit.
+func docsAssets() http.Handler {
+	files := http.StripPrefix("/docs/assets/", http.FileServerFS(swaggerFiles.FS))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		files.ServeHTTP(w, r)
+	})
 }
 
 func (h *Handler) swaggerUI(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +147,9 @@ func (h *Handler) swaggerUI(w http.ResponseWriter, r *http.Request) {
 <html>
 <head>
   <title>Music Metadata API</title>
-  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+  <link rel="stylesheet" href="/docs/assets/swagger-ui.css">
+  <link rel="icon" type="image/png" href="/docs/assets/favicon-32x32.png" sizes="32x32">
+  <link rel="icon" type="image/png" href="/docs/assets/favicon-16x16.png" sizes="16x16">
   <style>
     body { margin: 0; }
     .swagger-ui .topbar { display: none; }
@@ -68,12 +157,12 @@ func (h *Handler) swaggerUI(w http.ResponseWriter, r *http.Request) {
 </head>
 <body>
   <div id="swagger-ui"></div>
-  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script src="/docs/assets/swagger-ui-bundle.js"></script>
   <script>
     SwaggerUIBundle({
       url: '/openapi.yaml',
       dom_id: '#swagger-ui',
-      presets: [SwaggerUIBundle.presets.apis, SwaggerUIBundle.SwaggerUIStandalonePreset],
+      presets: [SwaggerUIBundle.presets.apis],
       layout: 'BaseLayout'
     });
   </script>
@@ -87,15 +176,90 @@ func (h *Handler) lookupISRC(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "isrc required", http.StatusBadRequest)
 		return
 	}
+	if strings.Contains(isrc, ",") {
+		h.lookupISRCList(w, r, isrc)
+		return
+	}
+	market, ok := h.marketParam(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("best") == "true" {
+		track, err := h.db.BestISRC(r.Context(), isrc, market)
+		if err != nil {
+			h.dbError(w, r, "lookup isrc", err)
+			return
+		}
+		trackForMarket(market, track)
+		respond(w, r, track)
+		return
+	}
 
 	tracks, err := h.db.LookupISRC(r.Context(), isrc)
 	if err != nil {
-		slog.Error("lookup isrc", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		h.dbError(w, r, "lookup isrc", err)
 		return
 	}
 
-	writeJSON(w, tracks)
+	tracksForMarket(market, tracks)
+	respond(w, r, tracks)
+}
+
+// maxGetISRCs caps the comma-separated ISRC form, which is meant for small
+// batches from GET-only clients; larger ones belong in POST /batch/lookup
+const maxGetISRCs = 50
+
+// lookupISRCs serves GET /lookup/isrc?isrcs=A,B,C
+func (h *Handler) lookupISRCs(w http.ResponseWriter, r *http.Request) {
+	h.lookupISRCList(w, r, r.URL.Query().Get("isrcs"))
+}
+
+// lookupISRCList looks up a comma-separated list of ISRCs and responds with
+// the same shape as POST /batch/lookup
+func (h *Handler) lookupISRCList(w http.ResponseWriter, r *http.Request, list string) {
+	isrcs := splitList(list)
+	if len(isrcs) == 0 {
+		http.Error(w, "isrcs required", http.StatusBadRequest)
+		return
+	}
+	if len(isrcs) > maxGetISRCs {
+		http.Error(w, fmt.Sprintf("maximum %d isrcs allowed, use POST /batch/lookup for more", maxGetISRCs), http.StatusBadRequest)
+		return
+	}
+	market, ok := h.marketParam(w, r)
+	if !ok {
+		return
+	}
+
+	resp := models.BatchLookupResponse{}
+	tracks, err := h.db.BatchLookupISRCs(r.Context(), isrcs)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "batch lookup isrcs", "err", err)
+		resp.Errors = map[string]string{"isrcs": "failed to lookup some isrcs"}
+	}
+	resp.ISRCs = tracks
+	for _, ts := range tracks {
+		tracksForMarket(market, ts)
+	}
+
+	respond(w, r, resp)
+}
+
+// splitList splits a comma-separated list such as ISRCs or radio seeds,
+// dropping blanks and duplicates
+func splitList(list string) []string {
+	var items []string
+	seen := make(map[string]bool)
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		items = append(items, v)
+	}
+	return items
 }
 
 func (h *Handler) lookupTrack(w http.ResponseWriter, r *http.Request) {
@@ -105,18 +269,85 @@ func (h *Handler) lookupTrack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	market, ok := h.marketParam(w, r)
+	if !ok {
+		return
+	}
+
 	track, err := h.db.LookupTrack(r.Context(), id)
 	if err != nil {
-		slog.Error("lookup track", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		h.lookupError(w, r, "lookup track", "tracks", id, err)
 		return
 	}
-	if track == nil {
-		http.Error(w, "not found", http.StatusNotFound)
+	if r.URL.Query().Get("relink") == "true" {
+		track, err = h.relink(r.Context(), track, market)
+		if err != nil {
+			h.dbError(w, r, "relink track", err)
+			return
+		}
+	}
+	trackForMarket(market, track)
+
+	if includes(r, "audio_features") {
+		track.AudioFeatures, err = h.db.AudioFeatures(r.Context(), track.ID)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			slog.ErrorContext(r.Context(), "audio features", "err", err)
+		}
+	}
+
+	respond(w, r, track)
+}
+
+func (h *Handler) audioFeatures(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	if !h.db.HasAudioFeatures() {
+		http.Error(w, "audio features not available in this snapshot", http.StatusNotFound)
+		return
+	}
+
+	features, err := h.db.AudioFeatures(r.Context(), id)
+	if err != nil {
+		h.dbError(w, r, "audio features", err)
+		return
+	}
+
+	respond(w, r, features)
+}
+
+func (h *Handler) lyrics(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
 		return
 	}
 
-	writeJSON(w, track)
+	if !h.db.HasLyricsTable() {
+		http.Error(w, "lyrics not available in this snapshot", http.StatusNotFound)
+		return
+	}
+
+	hasLyrics, err := h.db.TrackHasLyrics(r.Context(), id)
+	if err != nil {
+		h.dbError(w, r, "track has lyrics", err)
+		return
+	}
+	if !hasLyrics {
+		http.Error(w, "track has no lyrics", http.StatusNotFound)
+		return
+	}
+
+	lyrics, err := h.db.Lyrics(r.Context(), id)
+	if err != nil {
+		h.dbError(w, r, "lyrics", err)
+		return
+	}
+
+	respond(w, r, lyrics)
 }
 
 func (h *Handler) lookupArtist(w http.ResponseWriter, r *http.Request) {
@@ -128,16 +359,112 @@ func (h *Handler) lookupArtist(w http.ResponseWriter, r *http.Request) {
 
 	artist, err := h.db.LookupArtist(r.Context(), id)
 	if err != nil {
-		slog.Error("lookup artist", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		h.lookupError(w, r, "lookup artist", "artists", id, err)
 		return
 	}
-	if artist == nil {
-		http.Error(w, "not found", http.StatusNotFound)
+
+	respond(w, r, artist)
+}
+
+func (h *Handler) relatedArtists(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	artists, err := h.db.RelatedArtists(r.Context(), id, limit)
+	if err != nil {
+		h.dbError(w, r, "related artists", err)
+		return
+	}
+
+	respond(w, r, artists)
+}
+
+func (h *Handler) artistTracks(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			offset = parsed
+		}
+	}
+
+	market, ok := h.marketParam(w, r)
+	if !ok {
 		return
 	}
 
-	writeJSON(w, artist)
+	// Same protection as global search; prolific artists have large catalogs
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tracks, err := h.db.ArtistTracks(ctx, id, q, limit, offset)
+	if errors.Is(err, db.ErrTimeout) {
+		http.Error(w, "search timeout - try a more specific query", http.StatusRequestTimeout)
+		return
+	}
+	if err != nil {
+		h.lookupError(w, r, "artist tracks", "artists", id, err)
+		return
+	}
+
+	setPageLinks(w, r, db.SearchLimit(limit), offset, len(tracks) == db.SearchLimit(limit))
+	tracksForMarket(market, tracks)
+	respond(w, r, tracks)
+}
+
+// discography pages each bucket independently with ?<group>_offset=, e.g.
+// ?singles_offset=20
+func (h *Handler) discography(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+	offsets := make(map[string]int)
+	for _, group := range db.DiscographyGroups {
+		if o := r.URL.Query().Get(group + "_offset"); o != "" {
+			if parsed, err := strconv.Atoi(o); err == nil {
+				offsets[group] = parsed
+			}
+		}
+	}
+
+	disc, err := h.db.Discography(r.Context(), id, limit, offsets)
+	if err != nil {
+		h.lookupError(w, r, "discography", "artists", id, err)
+		return
+	}
+
+	respond(w, r, disc)
 }
 
 func (h *Handler) lookupAlbum(w http.ResponseWriter, r *http.Request) {
@@ -147,18 +474,28 @@ func (h *Handler) lookupAlbum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	market, ok := h.marketParam(w, r)
+	if !ok {
+		return
+	}
+
 	album, err := h.db.LookupAlbum(r.Context(), id)
 	if err != nil {
-		slog.Error("lookup album", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		h.lookupError(w, r, "lookup album", "albums", id, err)
 		return
 	}
-	if album == nil {
-		http.Error(w, "not found", http.StatusNotFound)
-		return
+
+	if includes(r, "tracks") {
+		tracks, err := h.db.GetAlbumTracks(r.Context(), id)
+		if err != nil {
+			h.dbError(w, r, "album tracks", err)
+			return
+		}
+		album.Tracks = tracks
 	}
 
-	writeJSON(w, album)
+	albumForMarket(market, album)
+	respond(w, r, album)
 }
 
 func (h *Handler) albumTracks(w http.ResponseWriter, r *http.Request) {
@@ -168,14 +505,293 @@ func (h *Handler) albumTracks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	market, ok := h.marketParam(w, r)
+	if !ok {
+		return
+	}
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy != "" && groupBy != "disc" {
+		http.Error(w, "group_by must be disc", http.StatusBadRequest)
+		return
+	}
+
 	tracks, err := h.db.GetAlbumTracks(r.Context(), id)
 	if err != nil {
-		slog.Error("album tracks", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		h.lookupError(w, r, "album tracks", "albums", id, err)
+		return
+	}
+
+	tracksForMarket(market, tracks)
+	if groupBy == "disc" {
+		respond(w, r, models.GroupByDisc(tracks))
+		return
+	}
+	respond(w, r, tracks)
+}
+
+func (h *Handler) artistLanguages(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	languages, err := h.db.ArtistLanguages(r.Context(), id)
+	if err != nil {
+		h.lookupError(w, r, "artist languages", "artists", id, err)
 		return
 	}
 
-	writeJSON(w, tracks)
+	respond(w, r, languages)
+}
+
+func (h *Handler) trackArtists(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	artists, err := h.db.TrackArtists(r.Context(), id)
+	if err != nil {
+		h.lookupError(w, r, "track artists", "tracks", id, err)
+		return
+	}
+
+	respond(w, r, artists)
+}
+
+func (h *Handler) albumArtists(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	artists, err := h.db.AlbumArtists(r.Context(), id)
+	if err != nil {
+		h.lookupError(w, r, "album artists", "albums", id, err)
+		return
+	}
+
+	respond(w, r, artists)
+}
+
+func (h *Handler) batchAlbumTracks(w http.ResponseWriter, r *http.Request) {
+	var req models.AlbumTracksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Albums) == 0 {
+		http.Error(w, "at least one album required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Albums) > 50 {
+		http.Error(w, "maximum 50 albums allowed", http.StatusBadRequest)
+		return
+	}
+
+	albums, err := h.db.BatchAlbumTracks(r.Context(), req.Albums)
+	if err != nil {
+		h.dbError(w, r, "batch album tracks", err)
+		return
+	}
+
+	resp := models.AlbumTracksResponse{Albums: albums}
+	for _, id := range req.Albums {
+		if _, ok := albums[id]; !ok {
+			if resp.Errors == nil {
+				resp.Errors = make(map[string]string)
+			}
+			resp.Errors[id] = "not found"
+		}
+	}
+
+	respond(w, r, resp)
+}
+
+func (h *Handler) listGenres(w http.ResponseWriter, r *http.Request) {
+	genres, err := h.db.ListGenres(r.Context())
+	if err != nil {
+		h.dbError(w, r, "list genres", err)
+		return
+	}
+
+	respond(w, r, genres)
+}
+
+func (h *Handler) genreArtists(w http.ResponseWriter, r *http.Request) {
+	genre := r.PathValue("genre")
+	if genre == "" {
+		http.Error(w, "genre required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			offset = parsed
+		}
+	}
+
+	artists, err := h.db.GenreArtists(r.Context(), genre, limit, offset)
+	if err != nil {
+		h.dbError(w, r, "genre artists", err)
+		return
+	}
+	setPageLinks(w, r, db.SearchLimit(limit), offset, len(artists) == db.SearchLimit(limit))
+
+	respond(w, r, artists)
+}
+
+func (h *Handler) genreAlbums(w http.ResponseWriter, r *http.Request) {
+	genre := r.PathValue("genre")
+	if genre == "" {
+		http.Error(w, "genre required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			offset = parsed
+		}
+	}
+
+	albums, err := h.db.GenreAlbums(r.Context(), genre, limit, offset)
+	if err != nil {
+		h.dbError(w, r, "genre albums", err)
+		return
+	}
+	setPageLinks(w, r, db.SearchLimit(limit), offset, len(albums) == db.SearchLimit(limit))
+
+	respond(w, r, albums)
+}
+
+// setSearchBackend reports whether search is served by the FTS sidecar or
+// the LIKE scan fallback, so clients can tell why results are slow
+func (h *Handler) setSearchBackend(w http.ResponseWriter) {
+	backend := "fallback"
+	if h.db.HasSearchIndex() {
+		backend = "fts"
+	}
+	w.Header().Set("X-Search-Backend", backend)
+}
+
+// searchCursor parses the optional ?cursor= of a search request, writing a
+// 400 and returning false when it is malformed
+func searchCursor(w http.ResponseWriter, r *http.Request) (*db.SearchCursor, bool) {
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return nil, true
+	}
+	c, err := db.ParseSearchCursor(token)
+	if err != nil {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return nil, false
+	}
+	return c, true
+}
+
+// searchSort parses ?sort= and ?order= of a search request, writing a 400
+// and returning false when order is not asc or desc. Names sort ascending by
+// default and everything else descending; the field is checked by the db.
+func searchSort(w http.ResponseWriter, r *http.Request) (db.SearchSort, bool) {
+	sort := db.SearchSort{Field: r.URL.Query().Get("sort")}
+	switch r.URL.Query().Get("order") {
+	case "":
+		sort.Asc = sort.Field == "name"
+	case "asc":
+		sort.Asc = true
+	case "desc":
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return sort, false
+	}
+	return sort, true
+}
+
+// trackFilter parses the ?explicit=, ?year=, and ?album_type= filters of a
+// track search, writing a 400 and returning false when one is malformed.
+// year is a single year or an inclusive range such as 1990-1999.
+func trackFilter(w http.ResponseWriter, r *http.Request) (db.TrackFilter, bool) {
+	var f db.TrackFilter
+	q := r.URL.Query()
+
+	if v := q.Get("explicit"); v != "" {
+		explicit, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "explicit must be true or false", http.StatusBadRequest)
+			return f, false
+		}
+		f.Explicit = &explicit
+	}
+
+	if v := q.Get("year"); v != "" {
+		var ok bool
+		if f.YearFrom, f.YearTo, ok = db.ParseYears(v); !ok {
+			http.Error(w, "year must be YYYY or YYYY-YYYY", http.StatusBadRequest)
+			return f, false
+		}
+	}
+
+	switch v := q.Get("album_type"); v {
+	case "", "album", "single", "compilation":
+		f.AlbumType = v
+	default:
+		http.Error(w, "album_type must be album, single, or compilation", http.StatusBadRequest)
+		return f, false
+	}
+
+	if v := q.Get("language"); v != "" {
+		code, ok := models.FindLanguage(v)
+		if !ok && !isLanguageCode(v) {
+			http.Error(w, "language must be a language code or a language's English or native name", http.StatusBadRequest)
+			return f, false
+		}
+		if !ok {
+			// Codes outside ISO 639-1, like zxx for instrumentals
+			code = strings.ToLower(v)
+		}
+		f.Language = code
+	}
+	return f, true
+}
+
+// isLanguageCode reports whether s looks like an ISO 639 code
+func isLanguageCode(s string) bool {
+	if len(s) < 2 || len(s) > 3 {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// setNextCursor advertises the cursor for the next page of search results,
+// if there is one, both in X-Next-Cursor and as a Link. Cursors only lead
+// forward, so there is no prev link.
+func setNextCursor(w http.ResponseWriter, r *http.Request, next *db.SearchCursor) {
+	if next != nil {
+		w.Header().Set("X-Next-Cursor", next.String())
+		addPageLink(w, r, "next", "cursor", next.String())
+	}
 }
 
 func (h *Handler) searchArtist(w http.ResponseWriter, r *http.Request) {
@@ -198,22 +814,62 @@ func (h *Handler) searchArtist(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	sort, ok := searchSort(w, r)
+	if !ok {
+		return
+	}
+	cursor, ok := searchCursor(w, r)
+	if !ok {
+		return
+	}
+	etag := h.searchETag(r)
+	if notModified(w, r, etag) {
+		return
+	}
+
 	// Add timeout for search queries
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	artists, err := h.db.SearchArtist(ctx, q, limit)
+	h.setSearchBackend(w)
+
+	artists, next, err := h.db.SearchArtistPage(ctx, q, limit, sort, cursor)
+	if errors.Is(err, db.ErrTimeout) {
+		http.Error(w, "search timeout - try a more specific query", http.StatusRequestTimeout)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidSort) {
+		http.Error(w, "sort must be one of: "+strings.Join(db.SortFields("artist"), ", "), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidCursor) {
+		http.Error(w, "invalid cursor for this sort order", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			http.Error(w, "search timeout - try a more specific query", http.StatusRequestTimeout)
-			return
-		}
-		slog.Error("search artist", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		h.dbError(w, r, "search artist", err)
+		return
+	}
+	total, err := h.db.CountArtists(ctx, q, sort)
+	if errors.Is(err, db.ErrTimeout) {
+		http.Error(w, "search timeout - try a more specific query", http.StatusRequestTimeout)
+		return
+	}
+	if err != nil {
+		h.dbError(w, r, "count artists", err)
 		return
 	}
 
-	writeJSON(w, artists)
+	setNextCursor(w, r, next)
+	setETag(w, etag)
+	if artists == nil {
+		artists = []models.Artist{}
+	}
+	respond(w, r, models.ArtistPage{Items: artists, Total: total, Limit: db.SearchLimit(limit), Offset: cursor.Position()})
 }
 
 func (h *Handler) searchTrack(w http.ResponseWriter, r *http.Request) {
@@ -236,26 +892,94 @@ func (h *Handler) searchTrack(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	sort, ok := searchSort(w, r)
+	if !ok {
+		return
+	}
+	filter, ok := trackFilter(w, r)
+	if !ok {
+		return
+	}
+	if filter.Market, ok = h.marketParam(w, r); !ok {
+		return
+	}
+	cursor, ok := searchCursor(w, r)
+	if !ok {
+		return
+	}
+	etag := h.searchETag(r)
+	if notModified(w, r, etag) {
+		return
+	}
+
 	// Add timeout for search queries
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	tracks, err := h.db.SearchTrack(ctx, q, limit)
+	h.setSearchBackend(w)
+
+	tracks, next, err := h.db.SearchTrackPage(ctx, q, limit, sort, filter, cursor)
+	if errors.Is(err, db.ErrTimeout) {
+		http.Error(w, "search timeout - try a more specific query", http.StatusRequestTimeout)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidSort) {
+		http.Error(w, "sort must be one of: "+strings.Join(db.SortFields("track"), ", "), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidCursor) {
+		http.Error(w, "invalid cursor for this sort order", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			http.Error(w, "search timeout - try a more specific query", http.StatusRequestTimeout)
-			return
-		}
-		slog.Error("search track", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		h.dbError(w, r, "search track", err)
+		return
+	}
+	total, err := h.db.CountTracks(ctx, q, sort, filter)
+	if errors.Is(err, db.ErrTimeout) {
+		http.Error(w, "search timeout - try a more specific query", http.StatusRequestTimeout)
+		return
+	}
+	if err != nil {
+		h.dbError(w, r, "count tracks", err)
 		return
 	}
 
-	writeJSON(w, tracks)
+	setNextCursor(w, r, next)
+	setETag(w, etag)
+	tracksForMarket(filter.Market, tracks)
+	if tracks == nil {
+		tracks = []models.Track{}
+	}
+	respond(w, r, models.TrackPage{Items: tracks, Total: total, Limit: db.SearchLimit(limit), Offset: cursor.Position()})
 }
 
 func (h *Handler) health(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, map[string]string{"status": "ok"})
+	if r.URL.Query().Get("deep") != "true" {
+		respond(w, r, map[string]string{"status": "ok"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	databases := h.db.Check(ctx)
+	status := "ok"
+	for _, dbh := range databases {
+		if dbh.Status != "ok" {
+			status = "error"
+		}
+	}
+
+	code := http.StatusOK
+	if status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	respondStatus(w, r, code, map[string]any{"status": status, "version": version.Version, "databases": databases})
 }
 
 func (h *Handler) batchLookup(w http.ResponseWriter, r *http.Request) {
@@ -283,7 +1007,7 @@ func (h *Handler) batchLookup(w http.ResponseWriter, r *http.Request) {
 	if len(req.Tracks) > 0 {
 		tracks, err := h.db.BatchLookupTracks(r.Context(), req.Tracks)
 		if err != nil {
-			slog.Error("batch lookup tracks", "err", err)
+			slog.ErrorContext(r.Context(), "batch lookup tracks", "err", err)
 			resp.Errors["tracks"] = "failed to lookup some tracks"
 		}
 		resp.Tracks = tracks
@@ -292,7 +1016,7 @@ func (h *Handler) batchLookup(w http.ResponseWriter, r *http.Request) {
 	if len(req.Artists) > 0 {
 		artists, err := h.db.BatchLookupArtists(r.Context(), req.Artists)
 		if err != nil {
-			slog.Error("batch lookup artists", "err", err)
+			slog.ErrorContext(r.Context(), "batch lookup artists", "err", err)
 			resp.Errors["artists"] = "failed to lookup some artists"
 		}
 		resp.Artists = artists
@@ -301,7 +1025,7 @@ func (h *Handler) batchLookup(w http.ResponseWriter, r *http.Request) {
 	if len(req.Albums) > 0 {
 		albums, err := h.db.BatchLookupAlbums(r.Context(), req.Albums)
 		if err != nil {
-			slog.Error("batch lookup albums", "err", err)
+			slog.ErrorContext(r.Context(), "batch lookup albums", "err", err)
 			resp.Errors["albums"] = "failed to lookup some albums"
 		}
 		resp.Albums = albums
@@ -310,7 +1034,7 @@ func (h *Handler) batchLookup(w http.ResponseWriter, r *http.Request) {
 	if len(req.ISRCs) > 0 {
 		isrcs, err := h.db.BatchLookupISRCs(r.Context(), req.ISRCs)
 		if err != nil {
-			slog.Error("batch lookup isrcs", "err", err)
+			slog.ErrorContext(r.Context(), "batch lookup isrcs", "err", err)
 			resp.Errors["isrcs"] = "failed to lookup some isrcs"
 		}
 		resp.ISRCs = isrcs
@@ -321,12 +1045,70 @@ func (h *Handler) batchLookup(w http.ResponseWriter, r *http.Request) {
 		resp.Errors = nil
 	}
 
-	writeJSON(w, resp)
+	respond(w, r, resp)
+}
+
+// notFoundBody is the 404 payload returned when ID suggestions were requested
+type notFoundBody struct {
+	Error       string   `json:"error"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// notFound writes a 404 for a missing entity. With ?suggest=true it also
+// checks for existing IDs that are one common typo away (0/O, l/1, ...).
+func (h *Handler) notFound(w http.ResponseWriter, r *http.Request, table, id string) {
+	if r.URL.Query().Get("suggest") != "true" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	suggestions, err := h.db.SuggestIDs(r.Context(), table, id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "suggest ids", "err", err)
+	}
+	if suggestions == nil {
+		suggestions = []string{}
+	}
+
+	respondStatus(w, r, http.StatusNotFound, notFoundBody{Error: "not found", Suggestions: suggestions})
+}
+
+// dbError writes the response for an error from the db package, logging
+// only failures that are not the client's doing
+func (h *Handler) dbError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrInvalidID):
+		http.Error(w, "invalid id", http.StatusBadRequest)
+	case errors.Is(err, db.ErrInvalidBarcode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, db.ErrTimeout):
+		http.Error(w, "query timeout", http.StatusRequestTimeout)
+	default:
+		slog.ErrorContext(r.Context(), op, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// lookupError is dbError for a lookup of id in table, answering 404s via
+// notFound. Typos often leave an ID malformed, so with ?suggest=true an
+// invalid ID gets suggestions too.
+func (h *Handler) lookupError(w http.ResponseWriter, r *http.Request, op, table, id string, err error) {
+	if errors.Is(err, db.ErrNotFound) ||
+		errors.Is(err, db.ErrInvalidID) && r.URL.Query().Get("suggest") == "true" {
+		h.notFound(w, r, table, id)
+		return
+	}
+	h.dbError(w, r, op, err)
 }
 
-func writeJSON(w http.ResponseWriter, v any) {
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(v); err != nil {
-		slog.Error("encode json", "err", err)
+// includes reports whether name appears in the comma-separated include parameter
+func includes(r *http.Request, name string) bool {
+	for _, v := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(v) == name {
+			return true
+		}
 	}
+	return false
 }
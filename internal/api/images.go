@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"metadata-api/internal/images"
+)
+
+func (h *Handler) image(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+
+	if s := r.URL.Query().Get("size"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+		hash, err = images.Variant(hash, size)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, cached, err := h.opts.Images.Get(r.Context(), hash)
+	switch {
+	case errors.Is(err, images.ErrInvalidHash):
+		http.Error(w, "invalid image hash", http.StatusBadRequest)
+		return
+	case errors.Is(err, images.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "image proxy", "hash", hash, "err", err)
+		http.Error(w, "upstream error", http.StatusBadGateway)
+		return
+	}
+
+	cache := "miss"
+	if cached {
+		cache = "hit"
+	}
+	// Hashes are content-addressed, so responses never change
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Image-Cache", cache)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"metadata-api/internal/logging"
+)
+
+// Inflight tracks the requests currently being served so shutdown can wait
+// for them, cancel their database queries, and report what was cut off.
+type Inflight struct {
+	mu        sync.Mutex
+	next      uint64
+	reqs      map[uint64]*inflightReq
+	cancelled bool
+	idle      chan struct{} // closed when reqs becomes empty; nil while empty
+}
+
+type inflightReq struct {
+	InflightRequest
+	cancel context.CancelFunc
+}
+
+// InflightRequest describes one outstanding request
+type InflightRequest struct {
+	RequestID string
+	Method    string
+	Path      string
+	Started   time.Time
+}
+
+// NewInflight returns an empty tracker
+func NewInflight() *Inflight {
+	return &Inflight{reqs: make(map[uint64]*inflightReq)}
+}
+
+// Middleware registers each request for its duration. Its context is
+// cancelled by Cancel, which aborts any SQLite query running under it.
+// Place it inside RequestID so the ID is known.
+func (in *Inflight) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		in.mu.Lock()
+		if in.cancelled {
+			in.mu.Unlock()
+			http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		id := in.next
+		in.next++
+		in.reqs[id] = &inflightReq{
+			InflightRequest: InflightRequest{
+				RequestID: logging.RequestID(r.Context()),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Started:   time.Now(),
+			},
+			cancel: cancel,
+		}
+		if in.idle == nil {
+			in.idle = make(chan struct{})
+		}
+		in.mu.Unlock()
+
+		defer func() {
+			in.mu.Lock()
+			delete(in.reqs, id)
+			if len(in.reqs) == 0 {
+				close(in.idle)
+				in.idle = nil
+			}
+			in.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// List returns the outstanding requests, oldest first
+func (in *Inflight) List() []InflightRequest {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	out := make([]InflightRequest, 0, len(in.reqs))
+	for _, req := range in.reqs {
+		out = append(out, req.InflightRequest)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.Before(out[j].Started) })
+	return out
+}
+
+// Cancel cancels the context of every outstanding request and rejects any
+// request that arrives afterwards with 503
+func (in *Inflight) Cancel() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.cancelled = true
+	for _, req := range in.reqs {
+		req.cancel()
+	}
+}
+
+// Wait blocks until no requests are outstanding or ctx ends, returning
+// ctx.Err() in the latter case
+func (in *Inflight) Wait(ctx context.Context) error {
+	in.mu.Lock()
+	idle := in.idle
+	in.mu.Unlock()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"metadata-api/internal/models"
+)
+
+// jsonapiContentType is the JSON:API media type
+const jsonapiContentType = "application/vnd.api+json"
+
+// jsonapiDocument is a JSON:API top-level document. Data is a single
+// resource or a slice of them.
+type jsonapiDocument struct {
+	Data     any               `json:"data"`
+	Included []jsonapiResource `json:"included,omitempty"`
+	Meta     *jsonapiMeta      `json:"meta,omitempty"`
+}
+
+// jsonapiMeta is the paging of search results, the meta of ?meta=true
+// requests, and the deprecations of the route, any of which may be missing
+type jsonapiMeta struct {
+	*jsonapiPaging
+	*responseMeta
+	Deprecations []Deprecation `json:"deprecations,omitempty"`
+}
+
+// jsonapiPaging is the position of a page of search results
+type jsonapiPaging struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type jsonapiResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]any                 `json:"attributes"`
+	Relationships map[string]jsonapiRelationship `json:"relationships,omitempty"`
+	Links         map[string]string              `json:"links,omitempty"`
+}
+
+// jsonapiRelationship holds a single jsonapiIdentifier, or a slice of them
+// for to-many relationships
+type jsonapiRelationship struct {
+	Data any `json:"data"`
+}
+
+type jsonapiIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// jsonapiBuilder collects the resources related to the primary data into
+// the document's included list, each once
+type jsonapiBuilder struct {
+	primary  map[jsonapiIdentifier]bool
+	seen     map[jsonapiIdentifier]bool
+	included []jsonapiResource
+}
+
+func newJSONAPIDocument(v any) (jsonapiDocument, bool) {
+	b := &jsonapiBuilder{
+		primary: make(map[jsonapiIdentifier]bool),
+		seen:    make(map[jsonapiIdentifier]bool),
+	}
+	var items []any
+	switch v := v.(type) {
+	case *models.Track, *models.Album, *models.Artist:
+		res, _ := b.primaryResource(v)
+		return b.document(res), true
+	case []models.Track:
+		for i := range v {
+			items = append(items, &v[i])
+		}
+	case []models.Album:
+		for i := range v {
+			items = append(items, &v[i])
+		}
+	case []models.Artist:
+		for i := range v {
+			items = append(items, &v[i])
+		}
+	case models.TrackPage:
+		doc, ok := newJSONAPIDocument(v.Items)
+		doc.Meta = &jsonapiMeta{jsonapiPaging: &jsonapiPaging{v.Total, v.Limit, v.Offset}}
+		return doc, ok
+	case models.ArtistPage:
+		doc, ok := newJSONAPIDocument(v.Items)
+		doc.Meta = &jsonapiMeta{jsonapiPaging: &jsonapiPaging{v.Total, v.Limit, v.Offset}}
+		return doc, ok
+	case []any:
+		items = v
+	default:
+		return jsonapiDocument{}, false
+	}
+
+	data := make([]jsonapiResource, 0, len(items))
+	for _, item := range items {
+		res, ok := b.primaryResource(item)
+		if !ok {
+			return jsonapiDocument{}, false
+		}
+		data = append(data, res)
+	}
+	return b.document(data), true
+}
+
+// primaryResource converts v, marking it as primary data so it isn't
+// repeated in included when another primary resource refers to it
+func (b *jsonapiBuilder) primaryResource(v any) (jsonapiResource, bool) {
+	var res jsonapiResource
+	switch v := v.(type) {
+	case *models.Track:
+		b.primary[jsonapiIdentifier{"tracks", v.ID}] = true
+		res = b.track(v)
+	case *models.Album:
+		b.primary[jsonapiIdentifier{"albums", v.ID}] = true
+		res = b.album(v)
+	case *models.Artist:
+		b.primary[jsonapiIdentifier{"artists", v.ID}] = true
+		res = b.artist(v)
+	default:
+		return res, false
+	}
+	return res, true
+}
+
+func (b *jsonapiBuilder) document(data any) jsonapiDocument {
+	var included []jsonapiResource
+	for _, res := range b.included {
+		if !b.primary[jsonapiIdentifier{res.Type, res.ID}] {
+			included = append(included, res)
+		}
+	}
+	return jsonapiDocument{Data: data, Included: included}
+}
+
+func (b *jsonapiBuilder) track(t *models.Track) jsonapiResource {
+	plain := *t
+	plain.Album, plain.Artists = nil, nil
+	res := newJSONAPIResource("tracks", t.ID, plain)
+
+	rels := make(map[string]jsonapiRelationship)
+	if t.Album != nil {
+		rels["album"] = jsonapiRelationship{Data: b.include(t.Album)}
+	}
+	if t.Artists != nil {
+		rels["artists"] = jsonapiRelationship{Data: b.includeArtists(t.Artists)}
+	}
+	if len(rels) > 0 {
+		res.Relationships = rels
+	}
+	return res
+}
+
+func (b *jsonapiBuilder) album(a *models.Album) jsonapiResource {
+	plain := *a
+	plain.Artists, plain.Tracks, plain.PrimaryArtist = nil, nil, nil
+	res := newJSONAPIResource("albums", a.ID, plain)
+
+	rels := make(map[string]jsonapiRelationship)
+	if a.Artists != nil {
+		rels["artists"] = jsonapiRelationship{Data: b.includeArtists(a.Artists)}
+	}
+	if a.PrimaryArtist != nil {
+		rels["primary_artist"] = jsonapiRelationship{Data: jsonapiIdentifier{"artists", a.PrimaryArtist.ID}}
+	}
+	if a.Tracks != nil {
+		ids := make([]jsonapiIdentifier, len(a.Tracks))
+		for i := range a.Tracks {
+			ids[i] = b.include(&a.Tracks[i])
+		}
+		rels["tracks"] = jsonapiRelationship{Data: ids}
+	}
+	if len(rels) > 0 {
+		res.Relationships = rels
+	}
+	return res
+}
+
+func (b *jsonapiBuilder) artist(a *models.Artist) jsonapiResource {
+	return newJSONAPIResource("artists", a.ID, *a)
+}
+
+func (b *jsonapiBuilder) includeArtists(artists []models.Artist) []jsonapiIdentifier {
+	ids := make([]jsonapiIdentifier, len(artists))
+	for i := range artists {
+		ids[i] = b.include(&artists[i])
+	}
+	return ids
+}
+
+// include adds v to the included resources unless it is already there, and
+// returns its identifier
+func (b *jsonapiBuilder) include(v any) jsonapiIdentifier {
+	var id jsonapiIdentifier
+	switch v := v.(type) {
+	case *models.Track:
+		id = jsonapiIdentifier{"tracks", v.ID}
+	case *models.Album:
+		id = jsonapiIdentifier{"albums", v.ID}
+	case *models.Artist:
+		id = jsonapiIdentifier{"artists", v.ID}
+	}
+	if b.seen[id] {
+		return id
+	}
+	b.seen[id] = true
+
+	// Reserve the slot first so included lists parents before children
+	i := len(b.included)
+	b.included = append(b.included, jsonapiResource{})
+	switch v := v.(type) {
+	case *models.Track:
+		b.included[i] = b.track(v)
+	case *models.Album:
+		b.included[i] = b.album(v)
+	case *models.Artist:
+		b.included[i] = b.artist(v)
+	}
+	return id
+}
+
+// newJSONAPIResource makes the entity v a resource, moving its href into
+// links.self
+func newJSONAPIResource(typ, id string, v any) jsonapiResource {
+	res := jsonapiResource{Type: typ, ID: id, Attributes: attributes(v)}
+	if href, ok := res.Attributes["href"].(string); ok {
+		delete(res.Attributes, "href")
+		res.Links = map[string]string{"self": href}
+	}
+	return res
+}
+
+// attributes encodes v the way plain responses do, so serialization
+// options such as -omit-popularity apply, and drops the id, which JSON:API
+// carries beside the attributes
+func attributes(v any) map[string]any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var attrs map[string]any
+	if err := dec.Decode(&attrs); err != nil {
+		return nil
+	}
+	delete(attrs, "id")
+	return attrs
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBounds are the upper bounds, in milliseconds, of the histogram
+// buckets; a final bucket catches everything slower
+var latencyBounds = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Latency keeps a latency histogram per route pattern
+type Latency struct {
+	mu     sync.RWMutex
+	routes map[string]*histogram
+}
+
+type histogram struct {
+	count   atomic.Int64
+	sumUs   atomic.Int64
+	buckets []atomic.Int64 // len(latencyBounds)+1
+}
+
+// RouteLatency summarizes one route's histogram. Percentiles are the upper
+// bound of the bucket they fall in, so they overestimate by at most one
+// bucket.
+type RouteLatency struct {
+	Count   int64            `json:"count"`
+	MeanMs  float64          `json:"mean_ms"`
+	P50Ms   float64          `json:"p50_ms"`
+	P95Ms   float64          `json:"p95_ms"`
+	P99Ms   float64          `json:"p99_ms"`
+	Buckets map[string]int64 `json:"buckets"` // upper bound in ms ("+Inf" for the last) -> count
+}
+
+// NewLatency returns an empty set of histograms
+func NewLatency() *Latency {
+	return &Latency{routes: make(map[string]*histogram)}
+}
+
+// Middleware records how long each request takes under its route pattern.
+// It must wrap the ServeMux directly: the mux records the matched pattern
+// on the request it is handed, which outer middleware never see because
+// they pass copies down.
+func (l *Latency) Middleware(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		mux.ServeHTTP(w, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		l.observe(route, time.Since(start))
+	})
+}
+
+func (l *Latency) observe(route string, d time.Duration) {
+	l.mu.RLock()
+	h := l.routes[route]
+	l.mu.RUnlock()
+	if h == nil {
+		l.mu.Lock()
+		if h = l.routes[route]; h == nil {
+			h = &histogram{buckets: make([]atomic.Int64, len(latencyBounds)+1)}
+			l.routes[route] = h
+		}
+		l.mu.Unlock()
+	}
+
+	ms := float64(d.Microseconds()) / 1000
+	i := len(latencyBounds)
+	for j, bound := range latencyBounds {
+		if ms <= bound {
+			i = j
+			break
+		}
+	}
+	h.buckets[i].Add(1)
+	h.count.Add(1)
+	h.sumUs.Add(d.Microseconds())
+}
+
+// Snapshot summarizes every route seen so far
+func (l *Latency) Snapshot() map[string]RouteLatency {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := make(map[string]RouteLatency, len(l.routes))
+	for route, h := range l.routes {
+		counts := make([]int64, len(h.buckets))
+		s := RouteLatency{Buckets: make(map[string]int64, len(h.buckets))}
+		for i := range h.buckets {
+			counts[i] = h.buckets[i].Load()
+			s.Count += counts[i]
+			s.Buckets[bucketLabel(i)] = counts[i]
+		}
+		if s.Count > 0 {
+			s.MeanMs = math.Round(float64(h.sumUs.Load())/float64(h.count.Load())) / 1000
+		}
+		s.P50Ms = percentile(counts, s.Count, 0.50)
+		s.P95Ms = percentile(counts, s.Count, 0.95)
+		s.P99Ms = percentile(counts, s.Count, 0.99)
+		out[route] = s
+	}
+	return out
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// fraction of observations. JSON has no infinity, so the overflow bucket
+// reports the largest finite bound.
+func percentile(counts []int64, total int64, p float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p * float64(total)))
+	var seen int64
+	for i, c := range counts {
+		seen += c
+		if seen >= rank {
+			return latencyBounds[min(i, len(latencyBounds)-1)]
+		}
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+func bucketLabel(i int) string {
+	if i == len(latencyBounds) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(latencyBounds[i], 'f', -1, 64)
+}
@@ -0,0 +1,455 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"metadata-api/internal/models"
+)
+
+// The /api/v0.4 routes mimic the metadata server Lidarr reads artists and
+// albums from (SkyHook), so a Lidarr instance whose metadata source points
+// here can use the snapshot instead of the public service. Lidarr keys
+// everything by MusicBrainz ID; entities get the same IDs as on /ws/2.
+// Albums are both Lidarr's album (a release group) and its one release.
+
+// lidarrMaxAlbums bounds the albums listed per discography bucket
+const lidarrMaxAlbums = 500
+
+type lidarrArtist struct {
+	ID             string        `json:"id"`
+	OldIDs         []string      `json:"oldids"`
+	ArtistName     string        `json:"artistname"`
+	SortName       string        `json:"sortname"`
+	Disambiguation string        `json:"disambiguation"`
+	Overview       string        `json:"overview"`
+	Type           string        `json:"type"`
+	Status         string        `json:"status"`
+	Genres         []string      `json:"genres"`
+	Images         []lidarrImage `json:"images"`
+	Links          []lidarrLink  `json:"links"`
+	Rating         lidarrRating  `json:"rating"`
+	Albums         []lidarrAlbum `json:"Albums,omitempty"` // only on artist lookups
+}
+
+type lidarrAlbum struct {
+	ID              string          `json:"id"`
+	OldIDs          []string        `json:"oldids"`
+	Title           string          `json:"title"`
+	ArtistID        string          `json:"artistid,omitempty"`
+	Artists         []lidarrArtist  `json:"artists,omitempty"`
+	Disambiguation  string          `json:"disambiguation"`
+	Overview        string          `json:"overview,omitempty"`
+	Type            string          `json:"type"`
+	SecondaryTypes  []string        `json:"secondarytypes"`
+	ReleaseDate     string          `json:"releasedate,omitempty"`
+	ReleaseStatuses []string        `json:"releasestatuses"`
+	Genres          []string        `json:"genres,omitempty"`
+	Images          []lidarrImage   `json:"images,omitempty"`
+	Links           []lidarrLink    `json:"links,omitempty"`
+	Rating          *lidarrRating   `json:"rating,omitempty"`
+	Releases        []lidarrRelease `json:"releases,omitempty"` // only on album lookups and searches
+}
+
+type lidarrRelease struct {
+	ID             string         `json:"id"`
+	OldIDs         []string       `json:"oldids"`
+	Title          string         `json:"title"`
+	Status         string         `json:"status"`
+	ReleaseDate    string         `json:"releasedate,omitempty"`
+	Label          []string       `json:"label"`
+	Country        []string       `json:"country"`
+	Disambiguation string         `json:"disambiguation"`
+	Media          []lidarrMedium `json:"media"`
+	TrackCount     int            `json:"track_count"`
+	Tracks         []lidarrTrack  `json:"tracks"`
+}
+
+type lidarrMedium struct {
+	Format   string `json:"Format"`
+	Name     string `json:"Name"`
+	Position int    `json:"Position"`
+}
+
+type lidarrTrack struct {
+	ID              string   `json:"id"`
+	OldIDs          []string `json:"oldids"`
+	RecordingID     string   `json:"recordingid"`
+	OldRecordingIDs []string `json:"oldrecordingids"`
+	ArtistID        string   `json:"artistid"`
+	TrackName       string   `json:"trackname"`
+	TrackNumber     string   `json:"tracknumber"`
+	TrackPosition   int      `json:"trackposition"`
+	MediumNumber    int      `json:"mediumnumber"`
+	DurationMs      int64    `json:"durationms"`
+}
+
+type lidarrImage struct {
+	CoverType string `json:"CoverType"`
+	URL       string `json:"Url"`
+}
+
+type lidarrLink struct {
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+type lidarrRating struct {
+	Count int      `json:"Count"`
+	Value *float64 `json:"Value"`
+}
+
+// lidarrSearchResult is an entry of a type=all search, holding either an
+// artist or an album
+type lidarrSearchResult struct {
+	Score  int           `json:"score"`
+	Artist *lidarrArtist `json:"artist,omitempty"`
+	Album  *lidarrAlbum  `json:"album,omitempty"`
+}
+
+func (h *Handler) lidarrRoutes(mux *Mux) {
+	mux.HandleFunc("GET /api/v0.4/artist/{mbid}", h.lidarrGetArtist)
+	mux.HandleFunc("GET /api/v0.4/album/{mbid}", h.lidarrGetAlbum)
+	mux.HandleFunc("GET /api/v0.4/search", h.lidarrSearch)
+}
+
+// lidarrGetArtist returns an artist with their albums, singles, and
+// compilations
+func (h *Handler) lidarrGetArtist(w http.ResponseWriter, r *http.Request) {
+	mbid := r.PathValue("mbid")
+	if !mbidPattern.MatchString(mbid) {
+		http.Error(w, "invalid mbid", http.StatusBadRequest)
+		return
+	}
+	id := h.resolveMBID(r, "artist", mbid)[0]
+	artist, err := h.db.LookupArtist(r.Context(), id)
+	if err != nil {
+		h.dbError(w, r, "lidarr artist", err)
+		return
+	}
+	albums, err := h.ownAlbums(r.Context(), id)
+	if err != nil {
+		h.dbError(w, r, "lidarr artist albums", err)
+		return
+	}
+
+	resp := lidarrArtistOf(artist)
+	resp.Albums = make([]lidarrAlbum, len(albums))
+	for i := range albums {
+		resp.Albums[i] = lidarrAlbumOf(&albums[i])
+	}
+	respond(w, r, resp)
+}
+
+// lidarrGetAlbum returns an album with its artists and its release's tracks
+func (h *Handler) lidarrGetAlbum(w http.ResponseWriter, r *http.Request) {
+	mbid := r.PathValue("mbid")
+	if !mbidPattern.MatchString(mbid) {
+		http.Error(w, "invalid mbid", http.StatusBadRequest)
+		return
+	}
+	id := h.resolveMBID(r, "album", mbid)[0]
+	album, err := h.db.LookupAlbum(r.Context(), id)
+	if err != nil {
+		h.dbError(w, r, "lidarr album", err)
+		return
+	}
+	resp, err := h.lidarrFullAlbum(r.Context(), album)
+	if err != nil {
+		h.dbError(w, r, "lidarr album", err)
+		return
+	}
+	respond(w, r, resp)
+}
+
+// lidarrSearch serves ?type=artist, ?type=album, and ?type=all searches
+// for ?query=. Albums are searched among the discographies of the artists
+// matching ?artist= when given, and are otherwise the albums of the tracks
+// matching the query.
+func (h *Handler) lidarrSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("query"))
+	if len(query) < 2 {
+		http.Error(w, "query must be at least 2 characters", http.StatusBadRequest)
+		return
+	}
+	typ := q.Get("type")
+	if typ == "" {
+		typ = "artist"
+	}
+	if typ != "artist" && typ != "album" && typ != "all" {
+		http.Error(w, "type must be artist, album, or all", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var artists []lidarrArtist
+	if typ != "album" {
+		found, err := h.db.SearchArtist(ctx, query, 20)
+		if err != nil {
+			h.dbError(w, r, "lidarr search", err)
+			return
+		}
+		artists = make([]lidarrArtist, len(found))
+		for i := range found {
+			artists[i] = lidarrArtistOf(&found[i])
+		}
+	}
+	var albums []lidarrAlbum
+	if typ != "artist" {
+		found, err := h.searchAlbums(ctx, query, q.Get("artist"))
+		if err != nil {
+			h.dbError(w, r, "lidarr search", err)
+			return
+		}
+		albums = make([]lidarrAlbum, 0, len(found))
+		for i := range found {
+			a, err := h.lidarrFullAlbum(ctx, &found[i])
+			if err != nil {
+				h.dbError(w, r, "lidarr search", err)
+				return
+			}
+			albums = append(albums, a)
+		}
+	}
+
+	switch typ {
+	case "artist":
+		respond(w, r, artists)
+	case "album":
+		respond(w, r, albums)
+	default:
+		results := make([]lidarrSearchResult, 0, len(artists)+len(albums))
+		for i := range artists {
+			results = append(results, lidarrSearchResult{Score: 100, Artist: &artists[i]})
+		}
+		for i := range albums {
+			results = append(results, lidarrSearchResult{Score: 100, Album: &albums[i]})
+		}
+		respond(w, r, results)
+	}
+}
+
+// ownAlbums lists the albums, singles, and compilations of the artist with
+// id, up to lidarrMaxAlbums of each, newest first within each
+func (h *Handler) ownAlbums(ctx context.Context, id string) ([]models.Album, error) {
+	const page = 50
+	buckets := []string{"albums", "singles", "compilations"}
+	done := map[string]bool{}
+	// appears_on is never wanted, so it starts past its end
+	offsets := map[string]int{"appears_on": lidarrMaxAlbums}
+	lists := map[string][]models.Album{}
+	for len(done) < len(buckets) {
+		disc, err := h.db.Discography(ctx, id, page, offsets)
+		if err != nil {
+			return nil, err
+		}
+		pages := map[string]models.AlbumPage{"albums": disc.Albums, "singles": disc.Singles, "compilations": disc.Compilations}
+		for _, b := range buckets {
+			if done[b] {
+				continue
+			}
+			p := pages[b]
+			lists[b] = append(lists[b], p.Items...)
+			offsets[b] += len(p.Items)
+			if len(p.Items) < page || offsets[b] >= p.Total || offsets[b] >= lidarrMaxAlbums {
+				done[b] = true
+				offsets[b] = max(offsets[b], p.Total)
+			}
+		}
+	}
+	var albums []models.Album
+	for _, b := range buckets {
+		albums = append(albums, lists[b]...)
+	}
+	return albums, nil
+}
+
+// searchAlbums finds albums named like query: among the discographies of
+// the artists matching artist, or as the albums of the tracks matching
+// query
+func (h *Handler) searchAlbums(ctx context.Context, query, artist string) ([]models.Album, error) {
+	if artist == "" {
+		tracks, err := h.db.SearchTrack(ctx, query, 50)
+		if err != nil {
+			return nil, err
+		}
+		var albums []models.Album
+		seen := make(map[string]bool)
+		for _, t := range tracks {
+			if t.Album != nil && !seen[t.Album.ID] {
+				seen[t.Album.ID] = true
+				albums = append(albums, *t.Album)
+			}
+		}
+		return albums, nil
+	}
+
+	artists, err := h.db.SearchArtist(ctx, artist, 5)
+	if err != nil {
+		return nil, err
+	}
+	var albums []models.Album
+	for _, a := range artists {
+		own, err := h.ownAlbums(ctx, a.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, al := range own {
+			if strings.Contains(strings.ToLower(al.Name), strings.ToLower(query)) {
+				albums = append(albums, al)
+			}
+		}
+	}
+	return albums, nil
+}
+
+// lidarrFullAlbum describes an album with its full artists and its release
+func (h *Handler) lidarrFullAlbum(ctx context.Context, album *models.Album) (lidarrAlbum, error) {
+	artists, err := h.db.AlbumArtists(ctx, album.ID)
+	if err != nil {
+		return lidarrAlbum{}, err
+	}
+	tracks, err := h.db.GetAlbumTracks(ctx, album.ID)
+	if err != nil {
+		return lidarrAlbum{}, err
+	}
+
+	a := lidarrAlbumOf(album)
+	a.Artists = make([]lidarrArtist, len(artists))
+	for i := range artists {
+		a.Artists[i] = lidarrArtistOf(&artists[i])
+	}
+	a.Genres = orEmpty(album.Genres)
+	a.Links = spotifyLinks("album", album.ID)
+	a.Rating = &lidarrRating{}
+	a.Releases = []lidarrRelease{lidarrReleaseOf(album, tracks)}
+	return a, nil
+}
+
+func lidarrArtistOf(a *models.Artist) lidarrArtist {
+	return lidarrArtist{
+		ID:         mbidFor(a.ID, a.MBID),
+		OldIDs:     []string{},
+		ArtistName: a.Name,
+		SortName:   a.Name,
+		Status:     "active",
+		Genres:     orEmpty(a.Genres),
+		Images:     lidarrImages("Poster", a.Images),
+		Links:      spotifyLinks("artist", a.ID),
+	}
+}
+
+// lidarrAlbumOf describes an album as listed on its artist
+func lidarrAlbumOf(a *models.Album) lidarrAlbum {
+	primary, secondary := releaseGroupTypes(a.Type)
+	album := lidarrAlbum{
+		ID:              mbidFor(a.ID, a.MBID),
+		OldIDs:          []string{},
+		Title:           a.Name,
+		Type:            primary,
+		SecondaryTypes:  orEmpty(secondary),
+		ReleaseDate:     lidarrDate(a),
+		ReleaseStatuses: []string{"Official"},
+		Images:          lidarrImages("Cover", a.Images),
+	}
+	if len(a.Artists) > 0 {
+		album.ArtistID = mbidFor(a.Artists[0].ID, a.Artists[0].MBID)
+	}
+	return album
+}
+
+// lidarrReleaseOf describes an album's one release, with a medium per disc
+func lidarrReleaseOf(a *models.Album, tracks []models.Track) lidarrRelease {
+	rel := lidarrRelease{
+		ID:          mbidFor(a.ID, a.MBID),
+		OldIDs:      []string{},
+		Title:       a.Name,
+		Status:      "Official",
+		ReleaseDate: lidarrDate(a),
+		Label:       []string{},
+		Country:     []string{},
+		Media:       []lidarrMedium{},
+		TrackCount:  len(tracks),
+		Tracks:      make([]lidarrTrack, len(tracks)),
+	}
+	if a.Label != "" {
+		rel.Label = append(rel.Label, a.Label)
+	}
+	position := 0
+	for i, t := range tracks {
+		disc := max(t.DiscNum, 1)
+		if n := len(rel.Media); n == 0 || rel.Media[n-1].Position != disc {
+			rel.Media = append(rel.Media, lidarrMedium{Format: "Digital Media", Position: disc})
+			position = 0
+		}
+		position++
+		number := t.TrackNum
+		if number <= 0 {
+			number = position
+		}
+		var artistID string
+		if len(t.Artists) > 0 {
+			artistID = mbidFor(t.Artists[0].ID, t.Artists[0].MBID)
+		}
+		rel.Tracks[i] = lidarrTrack{
+			ID:              spotifyUUID(t.ID),
+			OldIDs:          []string{},
+			RecordingID:     mbidFor(t.ID, t.MBID),
+			OldRecordingIDs: []string{},
+			ArtistID:        artistID,
+			TrackName:       t.Name,
+			TrackNumber:     strconv.Itoa(number),
+			TrackPosition:   position,
+			MediumNumber:    disc,
+			DurationMs:      t.DurationMs,
+		}
+	}
+	return rel
+}
+
+// lidarrDate is an album's release date as a full date, padding dates
+// known only to the year or month with the first day
+func lidarrDate(a *models.Album) string {
+	d := models.ParseReleaseDate(a.ReleaseDate, a.ReleaseDatePrecision)
+	if d == nil {
+		return ""
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, max(d.Month, 1), max(d.Day, 1))
+}
+
+// lidarrImages lists the largest image as coverType
+func lidarrImages(coverType string, images []models.Image) []lidarrImage {
+	out := []lidarrImage{}
+	var best *models.Image
+	for i := range images {
+		if best == nil || images[i].Width > best.Width {
+			best = &images[i]
+		}
+	}
+	if best != nil {
+		out = append(out, lidarrImage{CoverType: coverType, URL: best.URL})
+	}
+	return out
+}
+
+func spotifyLinks(typ, id string) []lidarrLink {
+	l := models.LinksFor(typ, id)
+	if l.ExternalURLs == nil {
+		return []lidarrLink{}
+	}
+	return []lidarrLink{{Target: l.ExternalURLs.Spotify, Type: "spotify"}}
+}
+
+func orEmpty(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// setPageLinks advertises the neighbouring pages of an offset-paged list in
+// RFC 8288 Link headers: prev unless the page is the first, and next while
+// the list may go on. limit is the page size the list was read with. There
+// is no next page past the largest offset that can be written.
+func setPageLinks(w http.ResponseWriter, r *http.Request, limit, offset int, more bool) {
+	if offset > 0 {
+		prev := ""
+		if offset > limit {
+			prev = strconv.Itoa(offset - limit)
+		}
+		addPageLink(w, r, "prev", "offset", prev)
+	}
+	if more && offset <= math.MaxInt-limit {
+		addPageLink(w, r, "next", "offset", strconv.Itoa(max(offset, 0)+limit))
+	}
+}
+
+// addPageLink adds a Link to the request's URL with param set to value, or
+// removed when value is "". The target is relative to the request, so it
+// holds behind proxies rewriting the host.
+func addPageLink(w http.ResponseWriter, r *http.Request, rel, param, value string) {
+	u := *r.URL
+	q := u.Query()
+	if value == "" {
+		q.Del(param)
+	} else {
+		q.Set(param, value)
+	}
+	u.RawQuery = q.Encode()
+	w.Header().Add("Link", "<"+u.RequestURI()+`>; rel="`+rel+`"`)
+}
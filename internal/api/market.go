@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// marketParam parses ?market=, an ISO 3166-1 alpha-2 country code, writing
+// a 400 and returning false when it is malformed. It returns "" when the
+// parameter is absent or the snapshot has no market data, so clients that
+// always send a market keep working against snapshots without it.
+func (h *Handler) marketParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	market := strings.ToUpper(r.URL.Query().Get("market"))
+	if market == "" {
+		return "", true
+	}
+	if len(market) != 2 || market[0] < 'A' || market[0] > 'Z' || market[1] < 'A' || market[1] > 'Z' {
+		http.Error(w, "market must be an ISO 3166-1 alpha-2 country code", http.StatusBadRequest)
+		return "", false
+	}
+	if !h.db.HasMarkets() {
+		return "", true
+	}
+	return market, true
+}
+
+// trackForMarket shapes a track for a market the way the Spotify API does:
+// it gets is_playable, and available_markets is dropped from the track and
+// its album. It does nothing when market is "".
+func trackForMarket(market string, t *models.Track) {
+	if market == "" {
+		return
+	}
+	playable := slices.Contains(t.AvailableMarkets, market)
+	t.IsPlayable = &playable
+	t.AvailableMarkets = nil
+	if t.Album != nil {
+		t.Album.AvailableMarkets = nil
+	}
+}
+
+// tracksForMarket is trackForMarket for a list of tracks
+func tracksForMarket(market string, tracks []models.Track) {
+	for i := range tracks {
+		trackForMarket(market, &tracks[i])
+	}
+}
+
+// albumForMarket is trackForMarket for an album and its tracks
+func albumForMarket(market string, a *models.Album) {
+	if market == "" {
+		return
+	}
+	a.AvailableMarkets = nil
+	tracksForMarket(market, a.Tracks)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"metadata-api/internal/match"
+	"metadata-api/internal/models"
+)
+
+func (h *Handler) matchTrack(w http.ResponseWriter, r *http.Request) {
+	var req models.MatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		http.Error(w, "title required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 5
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	// Candidate queries are searches, so they get the same protection
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	candidates, err := match.Track(ctx, h.db, req, limit)
+	if err != nil {
+		if errors.Is(err, match.ErrNoTitle) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			http.Error(w, "match timeout - try a more specific title", http.StatusRequestTimeout)
+			return
+		}
+		slog.ErrorContext(r.Context(), "match track", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, models.MatchResponse{Candidates: candidates})
+}
+
+func (h *Handler) matchBatch(w http.ResponseWriter, r *http.Request) {
+	var req models.MatchBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 {
+		http.Error(w, "at least one item required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) > 50 {
+		http.Error(w, "maximum 50 items allowed", http.StatusBadRequest)
+		return
+	}
+
+	limit := 3
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	// A whole album rip runs many candidate queries
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	results, album, err := match.Batch(ctx, h.db, req.Items, limit)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			http.Error(w, "match timeout - send fewer items", http.StatusRequestTimeout)
+			return
+		}
+		slog.ErrorContext(r.Context(), "match batch", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	respond(w, r, models.MatchBatchResponse{AlbumID: album, Results: results})
+}
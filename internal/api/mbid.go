@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+
+	"metadata-api/internal/db"
+)
+
+var mbidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// lookupMBID resolves a MusicBrainz ID to the catalog entities mapped to
+// it. Several Spotify entities can share one MBID (e.g. a recording on a
+// single and on its album), so the response is always a list.
+func (h *Handler) lookupMBID(w http.ResponseWriter, r *http.Request) {
+	typ, mbid := r.PathValue("type"), r.PathValue("mbid")
+	if !slices.Contains(db.MBIDTypes, typ) {
+		http.Error(w, "type must be track, album or artist", http.StatusBadRequest)
+		return
+	}
+	if !mbidPattern.MatchString(mbid) {
+		http.Error(w, "invalid mbid", http.StatusBadRequest)
+		return
+	}
+
+	if !h.db.HasMusicBrainz() {
+		http.Error(w, "musicbrainz ids not available in this snapshot", http.StatusNotFound)
+		return
+	}
+
+	ids, err := h.db.SpotifyIDsForMBID(r.Context(), typ, mbid)
+	if err != nil {
+		h.dbError(w, r, "lookup mbid", err)
+		return
+	}
+
+	var result []any
+	switch typ {
+	case "track":
+		found, _ := h.db.BatchLookupTracks(r.Context(), ids)
+		for _, id := range ids {
+			if t, ok := found[id]; ok {
+				result = append(result, t)
+			}
+		}
+	case "album":
+		found, _ := h.db.BatchLookupAlbums(r.Context(), ids)
+		for _, id := range ids {
+			if a, ok := found[id]; ok {
+				result = append(result, a)
+			}
+		}
+	case "artist":
+		found, _ := h.db.BatchLookupArtists(r.Context(), ids)
+		for _, id := range ids {
+			if a, ok := found[id]; ok {
+				result = append(result, a)
+			}
+		}
+	}
+	if len(result) == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	respond(w, r, result)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"metadata-api/internal/db"
+)
+
+// ?meta=true wraps JSON and MessagePack responses as {data, meta}, and adds
+// the same fields to the meta of JSON:API documents, stating which snapshot
+// and code path produced the response. Other formats are unchanged.
+
+// responseMeta is the meta block of ?meta=true responses
+type responseMeta struct {
+	SnapshotVersion string  `json:"snapshot_version"`
+	QueryMs         float64 `json:"query_ms"` // from routing to encoding the response
+	Cache           string  `json:"cache"`    // "hit" or "miss"; see db.Trace.Cache
+}
+
+// metaEnvelope is a ?meta=true response in JSON or MessagePack
+type metaEnvelope struct {
+	Data any `json:"data"`
+	Meta struct {
+		responseMeta
+		Deprecations []Deprecation `json:"deprecations,omitempty"`
+	} `json:"meta"`
+}
+
+// requestMeta is what withMeta collects for a ?meta=true request
+type requestMeta struct {
+	start    time.Time
+	snapshot string
+	trace    *db.Trace
+}
+
+type metaKey struct{}
+
+// withMeta starts collecting the meta of ?meta=true requests
+func withMeta(snapshot func() string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("meta") != "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m := &requestMeta{start: time.Now(), snapshot: snapshot()}
+		ctx, trace := db.WithTrace(r.Context())
+		m.trace = trace
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, metaKey{}, m)))
+	})
+}
+
+// addMeta adds the request's meta to body as enc writes it: around it for
+// JSON and MessagePack, or into a JSON:API document's meta
+func addMeta(r *http.Request, enc *encoding, body any) any {
+	m, _ := r.Context().Value(metaKey{}).(*requestMeta)
+	if m == nil {
+		return body
+	}
+	meta := responseMeta{
+		SnapshotVersion: m.snapshot,
+		QueryMs:         float64(time.Since(m.start).Microseconds()) / 1000,
+		Cache:           m.trace.Cache(),
+	}
+	switch {
+	case enc.name == "jsonapi":
+		doc, ok := body.(jsonapiDocument)
+		if !ok {
+			return body
+		}
+		if doc.Meta == nil {
+			doc.Meta = &jsonapiMeta{}
+		}
+		doc.Meta.responseMeta = &meta
+		return doc
+	case enc.name == "json" || enc.name == "msgpack":
+		env := metaEnvelope{Data: body}
+		env.Meta.responseMeta = meta
+		env.Meta.Deprecations = deprecationsFor(r.Pattern)
+		return env
+	}
+	return body
+}
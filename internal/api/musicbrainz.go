@@ -0,0 +1,590 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/models"
+)
+
+// The /ws/2 routes answer a subset of the MusicBrainz web service
+// (https://musicbrainz.org/doc/MusicBrainz_API) from the catalog, in its
+// XML format, so tools that speak it can use this server as an alternate
+// source. Tracks are recordings and albums are releases. Their IDs are the
+// MBIDs mapped to them when the snapshot has musicbrainz_ids, and the
+// Spotify ID's 128 bits written as a UUID otherwise; those resolve here but
+// are unknown to MusicBrainz.
+
+// mbExtNamespace is bound to ns2 for the scores of search results
+const mbExtNamespace = "http://musicbrainz.org/ns/ext#-2.0"
+
+func (h *Handler) musicBrainzRoutes(mux *Mux) {
+	mux.HandleFunc("GET /ws/2/isrc/{isrc}", wsXML(h.wsISRC))
+	// {mbid...} also matches the empty ID, so /ws/2/release/?query= searches
+	// as it does on MusicBrainz
+	mux.HandleFunc("GET /ws/2/recording", wsXML(h.wsSearchRecordings))
+	mux.HandleFunc("GET /ws/2/recording/{mbid...}", wsXML(h.wsRecording))
+	mux.HandleFunc("GET /ws/2/release", wsXML(h.wsSearchReleases))
+	mux.HandleFunc("GET /ws/2/release/{mbid...}", wsXML(h.wsRelease))
+}
+
+// wsXML rejects ?fmt= other than xml, the only format served
+func wsXML(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if f := r.URL.Query().Get("fmt"); f != "" && f != "xml" {
+			wsError(w, http.StatusBadRequest, "Only fmt=xml is supported.")
+			return
+		}
+		next(w, r)
+	}
+}
+
+type mbMetadata struct {
+	XMLName       xml.Name         `xml:"http://musicbrainz.org/ns/mmd-2.0# metadata"`
+	ExtNamespace  string           `xml:"xmlns:ns2,attr,omitempty"`
+	ISRC          *mbISRC          `xml:"isrc,omitempty"`
+	Recording     *mbRecording     `xml:"recording,omitempty"`
+	Release       *mbRelease       `xml:"release,omitempty"`
+	RecordingList *mbRecordingList `xml:"recording-list,omitempty"`
+	ReleaseList   *mbReleaseList   `xml:"release-list,omitempty"`
+}
+
+type mbError struct {
+	XMLName xml.Name `xml:"error"`
+	Text    string   `xml:"text"`
+}
+
+type mbISRC struct {
+	ID         string          `xml:"id,attr"`
+	Recordings mbRecordingList `xml:"recording-list"`
+}
+
+type mbRecordingList struct {
+	Count      int           `xml:"count,attr"`
+	Offset     *int          `xml:"offset,attr,omitempty"`
+	Recordings []mbRecording `xml:"recording"`
+}
+
+type mbRecording struct {
+	ID           string          `xml:"id,attr"`
+	Score        int             `xml:"ns2:score,attr,omitempty"`
+	Title        string          `xml:"title"`
+	Length       int64           `xml:"length,omitempty"` // milliseconds
+	ArtistCredit *mbArtistCredit `xml:"artist-credit,omitempty"`
+	Releases     *mbReleaseList  `xml:"release-list,omitempty"`
+	ISRCs        *mbISRCList     `xml:"isrc-list,omitempty"`
+}
+
+type mbArtistCredit struct {
+	Names []mbNameCredit `xml:"name-credit"`
+}
+
+type mbNameCredit struct {
+	JoinPhrase string   `xml:"joinphrase,attr,omitempty"`
+	Artist     mbArtist `xml:"artist"`
+}
+
+type mbArtist struct {
+	ID       string `xml:"id,attr"`
+	Name     string `xml:"name"`
+	SortName string `xml:"sort-name"`
+}
+
+type mbISRCList struct {
+	Count int         `xml:"count,attr"`
+	ISRCs []mbISRCRef `xml:"isrc"`
+}
+
+type mbISRCRef struct {
+	ID string `xml:"id,attr"`
+}
+
+type mbReleaseList struct {
+	Count    int         `xml:"count,attr"`
+	Offset   *int        `xml:"offset,attr,omitempty"`
+	Releases []mbRelease `xml:"release"`
+}
+
+type mbRelease struct {
+	ID           string           `xml:"id,attr"`
+	Score        int              `xml:"ns2:score,attr,omitempty"`
+	Title        string           `xml:"title"`
+	Status       string           `xml:"status"`
+	ArtistCredit *mbArtistCredit  `xml:"artist-credit,omitempty"`
+	ReleaseGroup mbReleaseGroup   `xml:"release-group"`
+	Date         string           `xml:"date,omitempty"`
+	Barcode      string           `xml:"barcode,omitempty"`
+	Labels       *mbLabelInfoList `xml:"label-info-list,omitempty"`
+	Media        *mbMediumList    `xml:"medium-list,omitempty"`
+}
+
+// mbReleaseGroup shares the ID of its release, the catalog having no
+// release groups
+type mbReleaseGroup struct {
+	ID             string            `xml:"id,attr"`
+	Type           string            `xml:"type,attr,omitempty"`
+	Title          string            `xml:"title"`
+	PrimaryType    string            `xml:"primary-type,omitempty"`
+	SecondaryTypes *mbSecondaryTypes `xml:"secondary-type-list,omitempty"`
+}
+
+type mbSecondaryTypes struct {
+	Types []string `xml:"secondary-type"`
+}
+
+type mbLabelInfoList struct {
+	Count  int           `xml:"count,attr"`
+	Labels []mbLabelInfo `xml:"label-info"`
+}
+
+type mbLabelInfo struct {
+	Name string `xml:"label>name"`
+}
+
+type mbMediumList struct {
+	Count int        `xml:"count,attr"`
+	Media []mbMedium `xml:"medium"`
+}
+
+type mbMedium struct {
+	Position int         `xml:"position"`
+	Format   string      `xml:"format"`
+	Tracks   mbTrackList `xml:"track-list"`
+}
+
+type mbTrackList struct {
+	Count  int       `xml:"count,attr"`
+	Tracks []mbTrack `xml:"track"`
+}
+
+type mbTrack struct {
+	ID        string      `xml:"id,attr"`
+	Position  int         `xml:"position"`
+	Number    string      `xml:"number"`
+	Length    int64       `xml:"length,omitempty"`
+	Recording mbRecording `xml:"recording"`
+}
+
+// wsIncludes are the ?inc= subqueries served. Others are ignored rather
+// than rejected, since tools ask for more than the catalog has.
+type wsIncludes struct {
+	credits, releases, recordings, isrcs, labels bool
+}
+
+// wsIncludesOf parses ?inc=, a list separated by spaces or "+"
+func wsIncludesOf(r *http.Request) wsIncludes {
+	var inc wsIncludes
+	for _, v := range strings.FieldsFunc(r.URL.Query().Get("inc"), func(c rune) bool { return c == ' ' || c == '+' }) {
+		switch v {
+		case "artists", "artist-credits":
+			inc.credits = true
+		case "releases":
+			inc.releases = true
+		case "recordings":
+			inc.recordings = true
+		case "isrcs":
+			inc.isrcs = true
+		case "labels":
+			inc.labels = true
+		}
+	}
+	return inc
+}
+
+// wsISRC lists the recordings with an ISRC
+func (h *Handler) wsISRC(w http.ResponseWriter, r *http.Request) {
+	isrc := strings.ToUpper(r.PathValue("isrc"))
+	tracks, err := h.db.LookupISRC(r.Context(), isrc)
+	if err != nil {
+		h.wsDBError(w, r, "ws isrc", err)
+		return
+	}
+	if len(tracks) == 0 {
+		wsError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	recordings := wsRecordings(tracks, wsIncludesOf(r), 0)
+	wsRespond(w, mbMetadata{ISRC: &mbISRC{
+		ID:         isrc,
+		Recordings: mbRecordingList{Count: len(recordings), Recordings: recordings},
+	}})
+}
+
+// wsRecording looks up a recording by MBID
+func (h *Handler) wsRecording(w http.ResponseWriter, r *http.Request) {
+	mbid := r.PathValue("mbid")
+	if mbid == "" {
+		h.wsSearchRecordings(w, r)
+		return
+	}
+	if !mbidPattern.MatchString(mbid) {
+		wsError(w, http.StatusBadRequest, "Invalid mbid.")
+		return
+	}
+
+	ids := h.resolveMBID(r, "track", mbid)
+	found, err := h.db.BatchLookupTracks(r.Context(), ids)
+	if err != nil {
+		h.wsDBError(w, r, "ws recording", err)
+		return
+	}
+	var tracks []models.Track
+	for _, id := range ids {
+		if t := found[id]; t != nil {
+			tracks = append(tracks, *t)
+		}
+	}
+	if len(tracks) == 0 {
+		wsError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	recording := wsRecordingOf(tracks, wsIncludesOf(r))
+	wsRespond(w, mbMetadata{Recording: &recording})
+}
+
+// wsRelease looks up a release by MBID
+func (h *Handler) wsRelease(w http.ResponseWriter, r *http.Request) {
+	mbid := r.PathValue("mbid")
+	if mbid == "" {
+		h.wsSearchReleases(w, r)
+		return
+	}
+	if !mbidPattern.MatchString(mbid) {
+		wsError(w, http.StatusBadRequest, "Invalid mbid.")
+		return
+	}
+
+	// A release MBID mapped to several albums is the first of them
+	id := h.resolveMBID(r, "album", mbid)[0]
+	album, err := h.db.LookupAlbum(r.Context(), id)
+	if err != nil {
+		h.wsDBError(w, r, "ws release", err)
+		return
+	}
+	tracks, err := h.db.GetAlbumTracks(r.Context(), id)
+	if err != nil {
+		h.wsDBError(w, r, "ws release tracks", err)
+		return
+	}
+
+	release := wsReleaseOf(album, tracks, wsIncludesOf(r))
+	wsRespond(w, mbMetadata{Release: &release})
+}
+
+// wsSearchRecordings serves ?query=isrc:..., the only recording search
+func (h *Handler) wsSearchRecordings(w http.ResponseWriter, r *http.Request) {
+	isrc, ok := wsQueryValue(r.URL.Query().Get("query"), "isrc")
+	if !ok {
+		wsError(w, http.StatusBadRequest, "Only isrc: queries are supported.")
+		return
+	}
+	tracks, err := h.db.LookupISRC(r.Context(), strings.ToUpper(isrc))
+	if err != nil {
+		h.wsDBError(w, r, "ws recording search", err)
+		return
+	}
+
+	recordings := wsRecordings(tracks, wsIncludes{credits: true, releases: true, isrcs: true}, 100)
+	offset := 0
+	wsRespond(w, mbMetadata{
+		ExtNamespace:  mbExtNamespace,
+		RecordingList: &mbRecordingList{Count: len(recordings), Offset: &offset, Recordings: recordings},
+	})
+}
+
+// wsSearchReleases serves ?query=barcode:..., the only release search
+func (h *Handler) wsSearchReleases(w http.ResponseWriter, r *http.Request) {
+	barcode, ok := wsQueryValue(r.URL.Query().Get("query"), "barcode")
+	if !ok {
+		wsError(w, http.StatusBadRequest, "Only barcode: queries are supported.")
+		return
+	}
+	upcTracks, err := h.db.UPCTracks(r.Context(), barcode)
+	if err != nil {
+		h.wsDBError(w, r, "ws release search", err)
+		return
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, t := range upcTracks {
+		if !seen[t.AlbumID] {
+			seen[t.AlbumID] = true
+			ids = append(ids, t.AlbumID)
+		}
+	}
+
+	releases := []mbRelease{}
+	if len(ids) > 0 {
+		albums, err := h.db.BatchLookupAlbums(r.Context(), ids)
+		if err != nil {
+			h.wsDBError(w, r, "ws release search", err)
+			return
+		}
+		tracks, err := h.db.BatchAlbumTracks(r.Context(), ids)
+		if err != nil {
+			h.wsDBError(w, r, "ws release search", err)
+			return
+		}
+		for _, id := range ids {
+			if a := albums[id]; a != nil {
+				release := wsReleaseOf(a, tracks[id], wsIncludes{credits: true, labels: true})
+				release.Score = 100
+				releases = append(releases, release)
+			}
+		}
+	}
+	offset := 0
+	wsRespond(w, mbMetadata{
+		ExtNamespace: mbExtNamespace,
+		ReleaseList:  &mbReleaseList{Count: len(releases), Offset: &offset, Releases: releases},
+	})
+}
+
+// resolveMBID returns the Spotify IDs of the entities of typ with mbid:
+// the ones mapped to it, or the one it was derived from
+func (h *Handler) resolveMBID(r *http.Request, typ, mbid string) []string {
+	if h.db.HasMusicBrainz() {
+		if ids, err := h.db.SpotifyIDsForMBID(r.Context(), typ, mbid); err == nil && len(ids) > 0 {
+			return ids
+		}
+	}
+	return []string{uuidSpotifyID(mbid)}
+}
+
+// wsRecordings groups tracks into recordings by MBID, scoring each
+func wsRecordings(tracks []models.Track, inc wsIncludes, score int) []mbRecording {
+	var order []string
+	byID := make(map[string][]models.Track)
+	for _, t := range tracks {
+		id := mbidFor(t.ID, t.MBID)
+		if _, ok := byID[id]; !ok {
+			order = append(order, id)
+		}
+		byID[id] = append(byID[id], t)
+	}
+	recordings := make([]mbRecording, len(order))
+	for i, id := range order {
+		recordings[i] = wsRecordingOf(byID[id], inc)
+		recordings[i].Score = score
+	}
+	return recordings
+}
+
+// wsRecordingOf describes the tracks of one recording by the first, with
+// the releases and ISRCs of all of them
+func wsRecordingOf(tracks []models.Track, inc wsIncludes) mbRecording {
+	t := tracks[0]
+	rec := mbRecording{ID: mbidFor(t.ID, t.MBID), Title: t.Name, Length: t.DurationMs}
+	if inc.credits {
+		rec.ArtistCredit = wsArtistCredit(t.Artists)
+	}
+	if inc.releases {
+		rec.Releases = &mbReleaseList{Releases: []mbRelease{}}
+		seen := make(map[string]bool)
+		for _, t := range tracks {
+			if t.Album != nil && !seen[t.Album.ID] {
+				seen[t.Album.ID] = true
+				rec.Releases.Releases = append(rec.Releases.Releases, wsReleaseOf(t.Album, nil, wsIncludes{}))
+			}
+		}
+		rec.Releases.Count = len(rec.Releases.Releases)
+	}
+	if inc.isrcs {
+		rec.ISRCs = &mbISRCList{ISRCs: []mbISRCRef{}}
+		seen := make(map[string]bool)
+		for _, t := range tracks {
+			if t.ISRC != "" && !seen[t.ISRC] {
+				seen[t.ISRC] = true
+				rec.ISRCs.ISRCs = append(rec.ISRCs.ISRCs, mbISRCRef{ID: t.ISRC})
+			}
+		}
+		rec.ISRCs.Count = len(rec.ISRCs.ISRCs)
+	}
+	return rec
+}
+
+// wsReleaseOf describes an album, with a medium per disc when its tracks
+// are given
+func wsReleaseOf(a *models.Album, tracks []models.Track, inc wsIncludes) mbRelease {
+	id := mbidFor(a.ID, a.MBID)
+	rel := mbRelease{
+		ID:           id,
+		Title:        a.Name,
+		Status:       "Official",
+		ReleaseGroup: mbReleaseGroup{ID: id, Title: a.Name},
+		Date:         a.ReleaseDate,
+		Barcode:      a.UPC,
+	}
+	primary, secondary := releaseGroupTypes(a.Type)
+	rel.ReleaseGroup.PrimaryType, rel.ReleaseGroup.Type = primary, primary
+	if len(secondary) > 0 {
+		rel.ReleaseGroup.SecondaryTypes = &mbSecondaryTypes{Types: secondary}
+		rel.ReleaseGroup.Type = secondary[0]
+	}
+	if inc.credits {
+		rel.ArtistCredit = wsArtistCredit(a.Artists)
+	}
+	if inc.labels && a.Label != "" {
+		rel.Labels = &mbLabelInfoList{Count: 1, Labels: []mbLabelInfo{{Name: a.Label}}}
+	}
+	if tracks != nil {
+		rel.Media = wsMedia(tracks, inc)
+	}
+	return rel
+}
+
+// releaseGroupTypes maps an album type to MusicBrainz release group types
+func releaseGroupTypes(albumType string) (primary string, secondary []string) {
+	switch albumType {
+	case "album":
+		return "Album", nil
+	case "single":
+		return "Single", nil
+	case "compilation":
+		return "Album", []string{"Compilation"}
+	}
+	return "", nil
+}
+
+// wsMedia groups an album's tracks, in disc and track order, into media.
+// Their tracks are listed with ?inc=recordings and only counted otherwise.
+func wsMedia(tracks []models.Track, inc wsIncludes) *mbMediumList {
+	list := &mbMediumList{Media: []mbMedium{}}
+	for _, t := range tracks {
+		disc := max(t.DiscNum, 1)
+		if n := len(list.Media); n == 0 || list.Media[n-1].Position != disc {
+			list.Media = append(list.Media, mbMedium{Position: disc, Format: "Digital Media"})
+		}
+		m := &list.Media[len(list.Media)-1]
+		m.Tracks.Count++
+		if inc.recordings {
+			number := t.TrackNum
+			if number <= 0 {
+				number = m.Tracks.Count
+			}
+			m.Tracks.Tracks = append(m.Tracks.Tracks, mbTrack{
+				ID:        spotifyUUID(t.ID),
+				Position:  m.Tracks.Count,
+				Number:    strconv.Itoa(number),
+				Length:    t.DurationMs,
+				Recording: wsRecordingOf([]models.Track{t}, wsIncludes{credits: inc.credits, isrcs: inc.isrcs}),
+			})
+		}
+	}
+	list.Count = len(list.Media)
+	return list
+}
+
+// wsArtistCredit credits artists as MusicBrainz writes it: "A, B & C"
+func wsArtistCredit(artists []models.Artist) *mbArtistCredit {
+	if len(artists) == 0 {
+		return nil
+	}
+	credit := &mbArtistCredit{Names: make([]mbNameCredit, len(artists))}
+	for i, a := range artists {
+		credit.Names[i].Artist = mbArtist{ID: mbidFor(a.ID, a.MBID), Name: a.Name, SortName: a.Name}
+		switch {
+		case i == len(artists)-2:
+			credit.Names[i].JoinPhrase = " & "
+		case i < len(artists)-2:
+			credit.Names[i].JoinPhrase = ", "
+		}
+	}
+	return credit
+}
+
+// wsQueryValue returns the value of a query of the form field:value, also
+// accepting the field:(value) and field:"value" forms tools send
+func wsQueryValue(query, field string) (string, bool) {
+	v, ok := strings.CutPrefix(strings.TrimSpace(query), field+":")
+	if !ok {
+		return "", false
+	}
+	v = strings.Trim(strings.ReplaceAll(v, `\`, ""), `()" `)
+	return v, v != ""
+}
+
+func wsRespond(w http.ResponseWriter, v mbMetadata) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	encodeXML(w, v)
+}
+
+// wsError writes an error document as MusicBrainz does
+func wsError(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	encodeXML(w, mbError{Text: text})
+}
+
+// wsDBError is dbError answering with MusicBrainz error documents
+func (h *Handler) wsDBError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		wsError(w, http.StatusNotFound, "Not Found")
+	case errors.Is(err, db.ErrInvalidID):
+		wsError(w, http.StatusBadRequest, "Invalid id.")
+	case errors.Is(err, db.ErrInvalidBarcode):
+		wsError(w, http.StatusBadRequest, "Invalid barcode.")
+	case errors.Is(err, db.ErrTimeout):
+		wsError(w, http.StatusRequestTimeout, "Query timeout.")
+	default:
+		slog.ErrorContext(r.Context(), op, "err", err)
+		wsError(w, http.StatusInternalServerError, "Internal error.")
+	}
+}
+
+// mbidFor is the MBID of a catalog entity: the one mapped to it, or its
+// Spotify ID as a UUID
+func mbidFor(spotifyID, mbid string) string {
+	if mbid != "" {
+		return mbid
+	}
+	return spotifyUUID(spotifyID)
+}
+
+// spotifyBase62 is the digit order of Spotify IDs, unlike the base62 of
+// collection IDs
+const spotifyBase62 = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// spotifyUUID writes the 128-bit number a Spotify ID encodes in base62 as a
+// UUID. It returns "" for strings that aren't such a number.
+func spotifyUUID(id string) string {
+	n, base := new(big.Int), big.NewInt(62)
+	for _, c := range id {
+		i := strings.IndexRune(spotifyBase62, c)
+		if i < 0 {
+			return ""
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(i)))
+	}
+	if n.BitLen() > 128 {
+		return ""
+	}
+	var b [16]byte
+	s := hex.EncodeToString(n.FillBytes(b[:]))
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// uuidSpotifyID is the inverse of spotifyUUID
+func uuidSpotifyID(uuid string) string {
+	b, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if err != nil || len(b) != 16 {
+		return ""
+	}
+	n, base, digit := new(big.Int).SetBytes(b), big.NewInt(62), new(big.Int)
+	id := make([]byte, 22) // 62^22 > 2^128
+	for i := len(id) - 1; i >= 0; i-- {
+		n.DivMod(n, base, digit)
+		id[i] = spotifyBase62[digit.Int64()]
+	}
+	return string(id)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"metadata-api/internal/overlay"
+)
+
+// maxOverlayBody caps a single correction or addition
+const maxOverlayBody = 1 << 20
+
+func (h *Handler) overlayRoutes(mux *Mux) {
+	mux.Handle("GET /admin/overlay", h.admin(h.overlayEntries))
+	for _, kind := range overlay.Kinds {
+		mux.Handle("POST /admin/"+kind, h.admin(h.overlayAdd(kind)))
+		mux.Handle("PUT /admin/"+kind+"/{id}", h.admin(h.overlayCorrect(kind)))
+		mux.Handle("DELETE /admin/"+kind+"/{id}", h.admin(h.overlayDelete(kind)))
+	}
+}
+
+// overlayEntries lists every correction and addition
+func (h *Handler) overlayEntries(w http.ResponseWriter, r *http.Request) {
+	entries := h.opts.Overlay.Entries()
+	if entries == nil {
+		entries = []overlay.Entry{}
+	}
+	respond(w, r, entries)
+}
+
+// overlayAdd serves POST /admin/{kind}, adding an entity that is missing
+// from the snapshot. It responds 201 with the entity as lookups now serve it.
+func (h *Handler) overlayAdd(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := overlayBody(w, r)
+		if !ok {
+			return
+		}
+		id, err := h.opts.Overlay.Add(r.Context(), kind, body)
+		if err != nil {
+			h.overlayError(w, r, "overlay add", err)
+			return
+		}
+		h.overlayResult(w, r, kind, id, http.StatusCreated)
+	}
+}
+
+// overlayCorrect serves PUT /admin/{kind}/{id}, overriding the fields in
+// the body. It responds with the corrected entity.
+func (h *Handler) overlayCorrect(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := overlayBody(w, r)
+		if !ok {
+			return
+		}
+		id := r.PathValue("id")
+		if err := h.opts.Overlay.Correct(r.Context(), kind, id, body); err != nil {
+			h.overlayError(w, r, "overlay correct", err)
+			return
+		}
+		h.overlayResult(w, r, kind, id, http.StatusOK)
+	}
+}
+
+// overlayDelete serves DELETE /admin/{kind}/{id}, reverting a correction
+// or withdrawing an addition
+func (h *Handler) overlayDelete(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.opts.Overlay.Delete(r.Context(), kind, r.PathValue("id")); err != nil {
+			h.overlayError(w, r, "overlay delete", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func overlayBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOverlayBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return body, true
+}
+
+func (h *Handler) overlayResult(w http.ResponseWriter, r *http.Request, kind, id string, code int) {
+	var v any
+	var err error
+	switch kind {
+	case overlay.Tracks:
+		v, err = h.db.LookupTrack(r.Context(), id)
+	case overlay.Albums:
+		v, err = h.db.LookupAlbum(r.Context(), id)
+	default:
+		v, err = h.db.LookupArtist(r.Context(), id)
+	}
+	if err != nil {
+		h.dbError(w, r, "overlay result", err)
+		return
+	}
+	respondStatus(w, r, code, v)
+}
+
+func (h *Handler) overlayError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	switch {
+	case errors.Is(err, overlay.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, overlay.ErrExists):
+		http.Error(w, "already exists; use PUT to correct it", http.StatusConflict)
+	default:
+		h.dbError(w, r, op, err)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// playlist is a track list as media players read it, for the m3u and xspf
+// formats
+type playlist struct {
+	title   string
+	entries []playlistEntry
+}
+
+type playlistEntry struct {
+	location   string // the preview URL, or the track's Spotify page without one
+	identifier string // Spotify URI
+	info       string // Spotify page
+	title      string
+	creator    string // artist names, comma-separated
+	album      string
+	trackNum   int
+	durationMs int64
+}
+
+// newPlaylist reports false for anything but a list of tracks: track
+// lists, album track lists (also grouped by disc), albums with tracks,
+// search pages, recommendations, and collections
+func newPlaylist(v any) (any, bool) {
+	switch v := v.(type) {
+	case []models.Track:
+		return playlistOf("", v), true
+	case models.TrackPage:
+		return playlistOf("", v.Items), true
+	case []models.Disc:
+		var tracks []models.Track
+		for _, d := range v {
+			tracks = append(tracks, d.Tracks...)
+		}
+		return playlistOf("", tracks), true
+	case *models.Album:
+		if len(v.Tracks) == 0 {
+			return nil, false
+		}
+		p := playlistOf(v.Name, v.Tracks)
+		for i := range p.entries {
+			if p.entries[i].album == "" {
+				p.entries[i].album = v.Name
+			}
+		}
+		return p, true
+	case []models.SimilarTrack:
+		tracks := make([]models.Track, len(v))
+		for i, s := range v {
+			tracks[i] = s.Track
+		}
+		return playlistOf("", tracks), true
+	case *models.Radio:
+		return playlistOf("", v.Tracks), true
+	case collectionResponse:
+		return playlistOf(v.Name, v.Tracks), true
+	}
+	return nil, false
+}
+
+func playlistOf(title string, tracks []models.Track) *playlist {
+	p := &playlist{title: title, entries: make([]playlistEntry, len(tracks))}
+	for i, t := range tracks {
+		l := models.LinksFor("track", t.ID)
+		e := playlistEntry{
+			location:   t.PreviewURL,
+			identifier: l.URI,
+			title:      t.Name,
+			trackNum:   t.TrackNum,
+			durationMs: t.DurationMs,
+		}
+		if l.ExternalURLs != nil {
+			e.info = l.ExternalURLs.Spotify
+		}
+		if e.location == "" {
+			e.location = e.info
+		}
+		names := make([]string, len(t.Artists))
+		for j, a := range t.Artists {
+			names[j] = a.Name
+		}
+		e.creator = strings.Join(names, ", ")
+		if t.Album != nil {
+			e.album = t.Album.Name
+		}
+		p.entries[i] = e
+	}
+	return p
+}
+
+// encodeM3U writes an extended M3U playlist. Players show the #EXTINF
+// duration and "artist - title"; #EXTALB carries the album.
+func encodeM3U(w io.Writer, v any) error {
+	p := v.(*playlist)
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if p.title != "" {
+		fmt.Fprintf(&b, "#PLAYLIST:%s\n", m3uText(p.title))
+	}
+	for _, e := range p.entries {
+		name := e.title
+		if e.creator != "" {
+			name = e.creator + " - " + e.title
+		}
+		seconds := (e.durationMs + 500) / 1000
+		if e.durationMs == 0 {
+			seconds = -1 // unknown
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n", seconds, m3uText(name))
+		if e.album != "" {
+			fmt.Fprintf(&b, "#EXTALB:%s\n", m3uText(e.album))
+		}
+		b.WriteString(e.location + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// m3uText keeps a value on its line
+func m3uText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// xspfPlaylist is an XSPF (XML Shareable Playlist Format) version 1
+// document
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version int         `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location,omitempty"`
+	Identifier string `xml:"identifier,omitempty"`
+	Title      string `xml:"title,omitempty"`
+	Creator    string `xml:"creator,omitempty"`
+	Album      string `xml:"album,omitempty"`
+	TrackNum   int    `xml:"trackNum,omitempty"`
+	Duration   int64  `xml:"duration,omitempty"` // milliseconds
+	Info       string `xml:"info,omitempty"`
+}
+
+func encodeXSPF(w io.Writer, v any) error {
+	p := v.(*playlist)
+	doc := xspfPlaylist{Version: 1, Title: p.title, Tracks: make([]xspfTrack, len(p.entries))}
+	for i, e := range p.entries {
+		doc.Tracks[i] = xspfTrack{
+			Location:   e.location,
+			Identifier: e.identifier,
+			Title:      e.title,
+			Creator:    e.creator,
+			Album:      e.album,
+			TrackNum:   e.trackNum,
+			Duration:   e.durationMs,
+			Info:       e.info,
+		}
+	}
+	return encodeXML(w, doc)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// SetReady marks the instance as able to serve traffic. main sets this once
+// databases are open and caches are warmed.
+func (h *Handler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// SetReloading marks the instance as mid-swap so /readyz reports not ready
+func (h *Handler) SetReloading(reloading bool) {
+	h.reloading.Store(reloading)
+}
+
+// healthz reports that the process is alive and serving HTTP
+func (h *Handler) healthz(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, map[string]string{"status": "ok"})
+}
+
+// readyz reports whether traffic should be routed to this instance
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	reason := ""
+	switch {
+	case h.reloading.Load():
+		reason = "reloading"
+	case !h.ready.Load():
+		reason = "warming up"
+	default:
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		if err := h.db.Ping(ctx); err != nil {
+			reason = "database unavailable"
+		}
+	}
+
+	if reason != "" {
+		respondStatus(w, r, http.StatusServiceUnavailable, map[string]string{"status": "not ready", "reason": reason})
+		return
+	}
+	respond(w, r, map[string]string{"status": "ready"})
+}
@@ -1,39 +1,147 @@
 package api
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
 	"sync"
 
 	"golang.org/x/time/rate"
 )
 
-// RateLimiter provides per-IP rate limiting with generous limits
+// RateLimiter provides per-IP rate limiting with generous limits. Routes
+// can be given their own limits, so expensive requests like searches are
+// throttled harder than ID lookups.
 type RateLimiter struct {
-	visitors map[string]*rate.Limiter
-	mu       sync.RWMutex
+	mu     sync.Mutex
+	limits []*routeLimit // most specific first; the last is the default
+
+	// Exempt clients bypass every limit. Keys are held as hashes, like
+	// APIKeys, and addresses are the client's as TrustedProxies resolves it.
+	exemptNets []netip.Prefix
+	exemptKeys map[[sha256.Size]byte]bool
+}
+
+// routeLimit is the limit for requests matching a method (any if empty)
+// and path prefix, with a token bucket per IP
+type routeLimit struct {
+	method   string
+	prefix   string
 	r        rate.Limit // requests per second
 	b        int        // burst size
+	visitors map[string]*rate.Limiter
 }
 
 // NewRateLimiter creates a new rate limiter with generous limits
 // Default: 100 requests per second with burst of 200
 func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
 	return &RateLimiter{
-		visitors: make(map[string]*rate.Limiter),
-		r:        r,
-		b:        b,
+		limits: []*routeLimit{{prefix: "/", r: r, b: b, visitors: make(map[string]*rate.Limiter)}},
+	}
+}
+
+// Route sets the limit for requests matching route, a path prefix
+// optionally preceded by a method ("/search/", "POST /batch/"). Requests
+// are limited only by the most specific matching route: the longest
+// prefix, with routes naming a method before those that don't. Each route
+// has its own bucket per IP, separate from the default one.
+func (rl *RateLimiter) Route(route string, r rate.Limit, b int) error {
+	method, prefix, ok := strings.Cut(route, " ")
+	if !ok {
+		method, prefix = "", route
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("rate limit route %q: path must start with /", route)
+	}
+	if b < 1 {
+		return fmt.Errorf("rate limit route %q: burst must be at least 1", route)
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for _, l := range rl.limits {
+		if l.method == method && l.prefix == prefix {
+			l.r, l.b = r, b
+			clear(l.visitors)
+			return nil
+		}
+	}
+	rl.limits = append(rl.limits, &routeLimit{method: method, prefix: prefix, r: r, b: b, visitors: make(map[string]*rate.Limiter)})
+	slices.SortStableFunc(rl.limits, func(a, b *routeLimit) int {
+		if n := len(b.prefix) - len(a.prefix); n != 0 {
+			return n
+		}
+		return len(b.method) - len(a.method)
+	})
+	return nil
+}
+
+// Exempt lets requests from an address in one of cidrs, or carrying one of
+// keys as their API key, bypass every limit, for internal batch jobs. A
+// bare IP address in cidrs exempts just that address. Addresses are the
+// connection's, unless it comes from one of the TrustedProxies.
+// Exempt requests still pass through everything behind the limiter, so
+// they are logged and counted like any other.
+func (rl *RateLimiter) Exempt(cidrs, keys []string) error {
+	nets, err := parsePrefixes("rate limit exemption", cidrs)
+	if err != nil {
+		return err
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.exemptNets = append(rl.exemptNets, nets...)
+	for _, k := range keys {
+		if k == "" {
+			return fmt.Errorf("rate limit exemption: empty API key")
+		}
+		if rl.exemptKeys == nil {
+			rl.exemptKeys = make(map[[sha256.Size]byte]bool)
+		}
+		rl.exemptKeys[sha256.Sum256([]byte(k))] = true
 	}
+	return nil
 }
 
-// getVisitor returns the rate limiter for a given IP
-func (rl *RateLimiter) getVisitor(ip string) *rate.Limiter {
+// exempt reports whether r bypasses the limiter
+func (rl *RateLimiter) exempt(r *http.Request) bool {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
+	if len(rl.exemptKeys) > 0 {
+		if key := requestKey(r); key != "" && rl.exemptKeys[sha256.Sum256([]byte(key))] {
+			return true
+		}
+	}
+	if len(rl.exemptNets) > 0 {
+		addr, err := netip.ParseAddr(clientAddr(r))
+		return err == nil && containsAddr(rl.exemptNets, addr)
+	}
+	return false
+}
 
-	limiter, exists := rl.visitors[ip]
+// match returns the most specific limit for r
+func (rl *RateLimiter) match(r *http.Request) *routeLimit {
+	for _, l := range rl.limits {
+		if (l.method == "" || l.method == r.Method) && strings.HasPrefix(r.URL.Path, l.prefix) {
+			return l
+		}
+	}
+	return rl.limits[len(rl.limits)-1]
+}
+
+// getVisitor returns the rate limiter for a given IP under the limit
+// matching r
+func (rl *RateLimiter) getVisitor(r *http.Request, ip string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l := rl.match(r)
+	limiter, exists := l.visitors[ip]
 	if !exists {
-		limiter = rate.NewLimiter(rl.r, rl.b)
-		rl.visitors[ip] = limiter
+		limiter = rate.NewLimiter(l.r, l.b)
+		l.visitors[ip] = limiter
 	}
 
 	return limiter
@@ -42,13 +150,11 @@ func (rl *RateLimiter) getVisitor(ip string) *rate.Limiter {
 // Middleware wraps an http.Handler with rate limiting
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get IP from X-Forwarded-For or RemoteAddr
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
+		if rl.exempt(r) {
+			next.ServeHTTP(w, r)
+			return
 		}
-
-		limiter := rl.getVisitor(ip)
+		limiter := rl.getVisitor(r, clientAddr(r))
 		if !limiter.Allow() {
 			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
 			return
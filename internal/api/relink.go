@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"metadata-api/internal/models"
+)
+
+// trackAlternatives lists the IDs of the other releases of a track's
+// recording, the tracks sharing its ISRC: regional and re-release
+// duplicates, any of which ?relink=true on /lookup/track/{id} resolves
+func (h *Handler) trackAlternatives(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	track, err := h.db.LookupTrack(r.Context(), id)
+	if err != nil {
+		h.lookupError(w, r, "track alternatives", "tracks", id, err)
+		return
+	}
+
+	out := models.TrackAlternatives{ID: track.ID, ISRC: track.ISRC, Alternatives: []string{}}
+	if track.ISRC != "" {
+		tracks, err := h.db.LookupISRC(r.Context(), track.ISRC)
+		if err != nil {
+			h.dbError(w, r, "track alternatives", err)
+			return
+		}
+		for _, t := range tracks {
+			if t.ID != track.ID {
+				out.Alternatives = append(out.Alternatives, t.ID)
+			}
+		}
+	}
+
+	respond(w, r, out)
+}
+
+// relink returns the release of t's recording a relinked lookup serves:
+// the best one for market as ?best=true on /lookup/isrc picks it, with
+// linked_from pointing back at t. t itself is kept unless that release is
+// available in market where t is not, or is more popular.
+func (h *Handler) relink(ctx context.Context, t *models.Track, market string) (*models.Track, error) {
+	if t.ISRC == "" {
+		return t, nil
+	}
+	best, err := h.db.BestISRC(ctx, t.ISRC, market)
+	if err != nil {
+		return nil, err
+	}
+	better := available(best, market) && !available(t, market) ||
+		available(best, market) == available(t, market) && best.Popularity > t.Popularity
+	if best.ID == t.ID || !better {
+		return t, nil
+	}
+	best.LinkedFrom = &models.LinkedFrom{ID: t.ID}
+	return best, nil
+}
+
+// available reports whether t can be played in market; every track can
+// without one
+func available(t *models.Track, market string) bool {
+	return market == "" || slices.Contains(t.AvailableMarkets, market)
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minGzipSize is the smallest body worth compressing; below it the gzip
+// framing costs about as much as it saves
+const minGzipSize = 1024
+
+// encoding is one response format. Adding a format means adding an entry
+// to encodings; handlers only ever call respond.
+type encoding struct {
+	name        string   // the ?format= value selecting it
+	mediaTypes  []string // Accept media types it serves; the first is sent as Content-Type
+	contentType string   // Content-Type header, when it differs from mediaTypes[0]
+
+	// prepare converts a handler's value into what encode writes, and
+	// reports false for values the format can't represent
+	prepare func(v any) (any, bool)
+	encode  func(w io.Writer, v any) error
+}
+
+var encodings = []encoding{
+	{
+		name:       "json",
+		mediaTypes: []string{"application/json"},
+		prepare:    asIs,
+		encode:     encodeJSON,
+	},
+	{
+		name:       "jsonapi",
+		mediaTypes: []string{jsonapiContentType},
+		prepare:    func(v any) (any, bool) { return newJSONAPIDocument(v) },
+		encode:     encodeJSON,
+	},
+	{
+		name:        "xml",
+		mediaTypes:  []string{"application/xml", "text/xml"},
+		contentType: "application/xml; charset=utf-8",
+		prepare:     newXMLDocument,
+		encode:      encodeXML,
+	},
+	{
+		name:       "msgpack",
+		mediaTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+		prepare:    asIs,
+		encode:     encodeMsgpack,
+	},
+	{
+		name:        "m3u",
+		mediaTypes:  []string{"audio/x-mpegurl", "audio/mpegurl"},
+		contentType: "audio/x-mpegurl; charset=utf-8",
+		prepare:     newPlaylist,
+		encode:      encodeM3U,
+	},
+	{
+		name:        "xspf",
+		mediaTypes:  []string{"application/xspf+xml"},
+		contentType: "application/xspf+xml; charset=utf-8",
+		prepare:     newPlaylist,
+		encode:      encodeXSPF,
+	},
+	// Tag maps are JSON; these only pick one of a track's tag sets, so
+	// they have no media type of their own
+	{
+		name:        "id3",
+		contentType: "application/json",
+		prepare:     id3Tags,
+		encode:      encodeJSON,
+	},
+	{
+		name:        "vorbis",
+		contentType: "application/json",
+		prepare:     vorbisTags,
+		encode:      encodeJSON,
+	},
+}
+
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+var gzipPool = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// respond writes v with status 200 in the format the request negotiates
+func respond(w http.ResponseWriter, r *http.Request, v any) {
+	respondStatus(w, r, http.StatusOK, v)
+}
+
+// addNegotiationVary names the request headers respondStatus picks the
+// representation by. ?format= takes precedence, so then the body doesn't
+// depend on Accept.
+func addNegotiationVary(h http.Header, r *http.Request) {
+	if r.URL.Query().Get("format") == "" {
+		addVary(h, "Accept")
+	}
+	addVary(h, "Accept-Encoding")
+}
+
+// respondStatus writes v with code in the format selected by ?format= or,
+// without it, the Accept header, falling back to JSON for anything the
+// chosen format can't represent. Formats with a meta block carry the
+// deprecations of the route, and ?meta=true adds one to JSON. Bodies are gzipped when the client
+// accepts it and they are large enough to benefit.
+func respondStatus(w http.ResponseWriter, r *http.Request, code int, v any) {
+	enc, body, err := negotiate(r, v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body = addMeta(r, enc, warnDeprecations(r, body))
+
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufPool.Put(buf)
+	if err := enc.encode(buf, body); err != nil {
+		slog.ErrorContext(r.Context(), "encode response", "format", enc.name, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	addNegotiationVary(h, r)
+	h.Set("Content-Type", enc.contentTypeHeader())
+	data := buf.Bytes()
+	if len(data) >= minGzipSize && acceptsGzip(r) {
+		zbuf := bufPool.Get().(*bytes.Buffer)
+		zbuf.Reset()
+		defer bufPool.Put(zbuf)
+		zw := gzipPool.Get().(*gzip.Writer)
+		zw.Reset(zbuf)
+		zw.Write(data)
+		zw.Close()
+		gzipPool.Put(zw)
+		data = zbuf.Bytes()
+		h.Set("Content-Encoding", "gzip")
+	}
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// negotiate picks the encoding for v and returns the value to encode
+func negotiate(r *http.Request, v any) (*encoding, any, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		for i := range encodings {
+			if encodings[i].name == name {
+				return prepared(&encodings[i], v)
+			}
+		}
+		names := make([]string, len(encodings))
+		for i, enc := range encodings {
+			names[i] = enc.name
+		}
+		return nil, nil, errors.New("format must be one of " + strings.Join(names, ", "))
+	}
+
+	for _, mt := range acceptedTypes(r.Header.Get("Accept")) {
+		// Browsers prefer text/html and list application/xml just below
+		// it; they get JSON, which they render more usefully
+		if mt == "*/*" || mt == "application/*" || mt == "text/html" {
+			break
+		}
+		for i := range encodings {
+			if !slices.Contains(encodings[i].mediaTypes, mt) {
+				continue
+			}
+			if body, ok := encodings[i].prepare(v); ok {
+				return &encodings[i], body, nil
+			}
+		}
+	}
+	return &encodings[0], v, nil
+}
+
+// prepared converts v for enc, or for JSON if enc can't represent it
+func prepared(enc *encoding, v any) (*encoding, any, error) {
+	if body, ok := enc.prepare(v); ok {
+		return enc, body, nil
+	}
+	return &encodings[0], v, nil
+}
+
+// acceptedTypes lists the media types in an Accept header, most preferred
+// first, leaving out those with q=0
+func acceptedTypes(accept string) []string {
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var types []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			types = append(types, accepted{mt, q})
+		}
+	}
+	slices.SortStableFunc(types, func(a, b accepted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	out := make([]string, len(types))
+	for i, t := range types {
+		out[i] = t.mediaType
+	}
+	return out
+}
+
+// acceptsGzip reports whether Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(q, 64); err != nil || f == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (e *encoding) contentTypeHeader() string {
+	if e.contentType != "" {
+		return e.contentType
+	}
+	return e.mediaTypes[0]
+}
+
+func asIs(v any) (any, bool) { return v, true }
+
+func encodeJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func encodeXML(w io.Writer, v any) error {
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
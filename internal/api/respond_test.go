@@ -0,0 +1,60 @@
+package api
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"metadata-api/internal/models"
+)
+
+func TestOmitPopularityFormats(t *testing.T) {
+	artist := models.Artist{ID: "1dfeR4HaWDbWqFHLkxsg1d", Name: "Queen", Followers: 1000, Popularity: 90}
+	track := models.Track{
+		ID:         "4u7EnebtmKWzUH433cf5Qv",
+		Name:       "Bohemian Rhapsody",
+		Popularity: 80,
+		Album:      &models.Album{ID: "6i6folBtxKV28WX3msQ4FE", Name: "A Night at the Opera", Artists: []models.Artist{artist}},
+		Artists:    []models.Artist{artist},
+	}
+	values := map[string]any{
+		"track":   &track,
+		"artist":  &artist,
+		"page":    models.TrackPage{Items: []models.Track{track}, Total: 1, Limit: 20},
+		"similar": []models.SimilarTrack{{Score: 0.9, PopularityScore: 0.8, Track: track}},
+	}
+	formats := map[string]string{
+		"json":    "application/json",
+		"xml":     "application/xml",
+		"jsonapi": jsonapiContentType,
+		"msgpack": "application/msgpack",
+	}
+
+	prev := models.OmitPopularity.Load()
+	t.Cleanup(func() { models.OmitPopularity.Store(prev) })
+	for _, omit := range []bool{false, true} {
+		models.OmitPopularity.Store(omit)
+		for format, accept := range formats {
+			for name, v := range values {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("Accept", accept)
+				w := httptest.NewRecorder()
+				respond(w, r, v)
+				if w.Code != 200 {
+					t.Fatalf("%s as %s: status %d: %s", name, format, w.Code, w.Body)
+				}
+
+				// Field names appear verbatim in every format, as JSON
+				// and msgpack keys and as XML attributes
+				body := w.Body.Bytes()
+				carries := bytes.Contains(body, []byte("popularity")) || bytes.Contains(body, []byte("followers"))
+				switch {
+				case omit && carries:
+					t.Errorf("%s as %s with -omit-popularity carries popularity: %q", name, format, body)
+				case !omit && !carries:
+					t.Errorf("%s as %s without -omit-popularity carries no popularity: %q", name, format, body)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"metadata-api/internal/similar"
+)
+
+// similarTracks recommends tracks to play alongside a track. The
+// ?artist_weight=, ?genre_weight=, ?popularity_weight=, ?duration_weight=,
+// and ?playlist_weight= parameters override the default weights one by
+// one; the last only counts with collections.
+func (h *Handler) similarTracks(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	weights := similar.DefaultWeights
+	for _, p := range []struct {
+		name   string
+		weight *float64
+	}{
+		{"artist_weight", &weights.Artist},
+		{"genre_weight", &weights.Genre},
+		{"popularity_weight", &weights.Popularity},
+		{"duration_weight", &weights.Duration},
+		{"playlist_weight", &weights.Playlists},
+	} {
+		v := r.URL.Query().Get(p.name)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(f >= 0 && f <= 100) {
+			http.Error(w, p.name+" must be a number from 0 to 100", http.StatusBadRequest)
+			return
+		}
+		*p.weight = f
+	}
+
+	// Candidates come from whole artist catalogs, so they get the same
+	// protection as search
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var playlists similar.PlaylistCounts
+	if h.opts.Collections != nil {
+		playlists = h.opts.Collections.Counts
+	}
+	tracks, err := similar.Tracks(ctx, h.db, id, weights, playlists, limit)
+	if errors.Is(err, similar.ErrNoWeight) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.lookupError(w, r, "similar tracks", "tracks", id, err)
+		return
+	}
+
+	respond(w, r, tracks)
+}
+
+// radio blends recommendations from up to five comma-separated
+// ?seed_artists=, ?seed_tracks=, and ?seed_genres=, optionally bounded by
+// ?min_popularity= and ?max_popularity= and aimed at ?target_popularity=
+func (h *Handler) radio(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	seeds := similar.Seeds{
+		Artists: splitList(q.Get("seed_artists")),
+		Tracks:  splitList(q.Get("seed_tracks")),
+		Genres:  splitList(q.Get("seed_genres")),
+	}
+	for _, p := range []struct {
+		name string
+		dst  **int
+	}{
+		{"target_popularity", &seeds.Target},
+		{"min_popularity", &seeds.Min},
+		{"max_popularity", &seeds.Max},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 100 {
+			http.Error(w, p.name+" must be between 0 and 100", http.StatusBadRequest)
+			return
+		}
+		*p.dst = &n
+	}
+	if seeds.Min != nil && seeds.Max != nil && *seeds.Min > *seeds.Max {
+		http.Error(w, "min_popularity must not be above max_popularity", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	radio, err := similar.Radio(ctx, h.db, seeds, limit)
+	if errors.Is(err, similar.ErrSeeds) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.dbError(w, r, "radio", err)
+		return
+	}
+	respond(w, r, radio)
+}
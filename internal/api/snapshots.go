@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/snapshots"
+)
+
+// SelectSnapshot serves requests with ?snapshot=<name> from that historical
+// snapshot instead of the current one. The snapshot stays open until the
+// request is done. Like RecordUsage it wraps the ServeMux.
+func SelectSnapshot(m *snapshots.Manager, mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("snapshot")
+		if name == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		d, release, err := m.Acquire(name)
+		switch {
+		case errors.Is(err, snapshots.ErrNotFound), errors.Is(err, snapshots.ErrInvalid):
+			http.Error(w, "snapshot not found", http.StatusNotFound)
+			return
+		case errors.Is(err, snapshots.ErrNotReady):
+			http.Error(w, "snapshot is being written", http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "open snapshot", "snapshot", name, "err", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		defer release()
+		mux.ServeHTTP(w, r.WithContext(db.WithSnapshot(r.Context(), d)))
+	})
+}
+
+// listSnapshots lists the historical snapshots ?snapshot= accepts
+func (h *Handler) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	names, err := h.opts.Snapshots.List()
+	if err != nil {
+		h.dbError(w, r, "list snapshots", err)
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+	respond(w, r, map[string][]string{"snapshots": names})
+}
@@ -0,0 +1,593 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"metadata-api/internal/audit"
+	"metadata-api/internal/collections"
+	"metadata-api/internal/models"
+	"metadata-api/internal/overlay"
+	"metadata-api/internal/usage"
+	"metadata-api/internal/version"
+)
+
+// Mux is the API's ServeMux. It records every pattern registered on it,
+// including routes added after Routes returns, so the served OpenAPI spec
+// documents exactly the routes this instance has.
+type Mux struct {
+	*http.ServeMux
+
+	mu       sync.Mutex
+	patterns []string
+
+	snapshot func() string // the dataset version, for ?meta=true
+}
+
+func newMux(snapshot func() string) *Mux {
+	return &Mux{ServeMux: http.NewServeMux(), snapshot: snapshot}
+}
+
+// Handle registers handler for pattern, sending the deprecation headers
+// of deprecated routes and collecting the meta of ?meta=true requests
+func (m *Mux) Handle(pattern string, handler http.Handler) {
+	m.record(pattern)
+	if d, ok := routeDeprecation(pattern); ok {
+		handler = deprecated(d, handler)
+	}
+	m.ServeMux.Handle(pattern, withMeta(m.snapshot, handler))
+}
+
+func (m *Mux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
+}
+
+func (m *Mux) record(pattern string) {
+	m.mu.Lock()
+	m.patterns = append(m.patterns, pattern)
+	m.mu.Unlock()
+}
+
+// allowMethods are the methods OPTIONS probes for. HEAD is allowed
+// wherever GET is: the ServeMux routes it to GET patterns.
+var allowMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// options answers OPTIONS for any path with the methods registered for it.
+// The docs page served for every unmatched GET doesn't count.
+func (m *Mux) options(w http.ResponseWriter, r *http.Request) {
+	var allow []string
+	for _, method := range allowMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := m.Handler(probe); pattern != "" && (pattern != "GET /" || r.URL.Path == "/") {
+			allow = append(allow, method)
+		}
+	}
+	if len(allow) == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Allow", strings.Join(append(allow, http.MethodOptions), ", "))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Mux) routes() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.patterns)
+}
+
+// specSchemas are the component schemas reflected from the types the
+// handlers encode. Hand-written schemas in openapi.yaml with the same name
+// only contribute descriptions, examples, and other documentation.
+var specSchemas = map[string]reflect.Type{
+	"Track":              reflect.TypeFor[models.Track](),
+	"Album":              reflect.TypeFor[models.Album](),
+	"Artist":             reflect.TypeFor[models.Artist](),
+	"Image":              reflect.TypeFor[models.Image](),
+	"ArtistRole":         reflect.TypeFor[models.ArtistRole](),
+	"Language":           reflect.TypeFor[models.Language](),
+	"ReleaseDate":        reflect.TypeFor[models.ReleaseDate](),
+	"ExternalURLs":       reflect.TypeFor[models.ExternalURLs](),
+	"Genre":              reflect.TypeFor[models.Genre](),
+	"LanguageCount":      reflect.TypeFor[models.LanguageCount](),
+	"Discography":        reflect.TypeFor[models.Discography](),
+	"AlbumPage":          reflect.TypeFor[models.AlbumPage](),
+	"ArtistPage":         reflect.TypeFor[models.ArtistPage](),
+	"TrackPage":          reflect.TypeFor[models.TrackPage](),
+	"Disc":               reflect.TypeFor[models.Disc](),
+	"Release":            reflect.TypeFor[models.Release](),
+	"ISRCReleases":       reflect.TypeFor[models.ISRCReleases](),
+	"ReleaseTrack":       reflect.TypeFor[models.ReleaseTrack](),
+	"UPCTracks":          reflect.TypeFor[models.UPCTracks](),
+	"AudioFeatures":      reflect.TypeFor[models.AudioFeatures](),
+	"Lyrics":             reflect.TypeFor[models.Lyrics](),
+	"Stats":              reflect.TypeFor[models.Stats](),
+	"MatchRequest":       reflect.TypeFor[models.MatchRequest](),
+	"MatchCandidate":     reflect.TypeFor[models.MatchCandidate](),
+	"LinkedFrom":         reflect.TypeFor[models.LinkedFrom](),
+	"TrackAlternatives":  reflect.TypeFor[models.TrackAlternatives](),
+	"TrackTags":          reflect.TypeFor[models.TrackTags](),
+	"SimilarTrack":       reflect.TypeFor[models.SimilarTrack](),
+	"Radio":              reflect.TypeFor[models.Radio](),
+	"RadioSeed":          reflect.TypeFor[models.RadioSeed](),
+	"NotFound":           reflect.TypeFor[notFoundBody](),
+	"BudgetError":        reflect.TypeFor[budgetError](),
+	"RouteLatency":       reflect.TypeFor[RouteLatency](),
+	"OverlayEntry":       reflect.TypeFor[overlay.Entry](),
+	"UsageSummary":       reflect.TypeFor[usage.Summary](),
+	"Usage":              reflect.TypeFor[usage.Usage](),
+	"AuditEvent":         reflect.TypeFor[audit.Event](),
+	"Collection":         reflect.TypeFor[collections.Collection](),
+	"CollectionDetail":   reflect.TypeFor[collectionResponse](),
+	"CollectionRequest":  reflect.TypeFor[collectionRequest](),
+	"TrackPlaylists":     reflect.TypeFor[playlistsResponse](),
+	"AlbumPlaylists":     reflect.TypeFor[albumPlaylistsResponse](),
+	"LidarrArtist":       reflect.TypeFor[lidarrArtist](),
+	"LidarrAlbum":        reflect.TypeFor[lidarrAlbum](),
+	"LidarrSearchResult": reflect.TypeFor[lidarrSearchResult](),
+}
+
+// specHidden are path prefixes left out of the spec: the docs themselves
+// and cluster-internal routes
+var specHidden = []string{"/docs", "/openapi.yaml", "/internal/"}
+
+// docKeys are the schema keywords copied from hand-written schemas onto
+// reflected ones
+var docKeys = []string{"description", "example", "enum", "format", "default", "pattern", "nullable", "required", "minimum", "maximum"}
+
+// openapiSpec serves the spec generated from the embedded openapi.yaml and
+// the routes registered on mux. It is built on first request, after main
+// has finished registering routes.
+func (h *Handler) openapiSpec(mux *Mux) http.HandlerFunc {
+	var (
+		once sync.Once
+		data []byte
+		err  error
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { data, err = buildSpec(mux.routes()) })
+		if err != nil {
+			http.Error(w, "spec not available", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/yaml")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}
+}
+
+// buildSpec merges the hand-written prose in openapi.yaml with what the
+// code defines: operations for routes that aren't registered are dropped,
+// registered routes without documentation get a stub, model schemas are
+// reflected from Go types, and every operation lists the error responses
+// the middleware can produce.
+func buildSpec(routes []string) ([]byte, error) {
+	doc, err := specDocument(routes)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encode openapi spec: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// specDocument builds the spec buildSpec encodes
+func specDocument(routes []string) (*yaml.Node, error) {
+	src, err := openapiFS.ReadFile("openapi.yaml")
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi.yaml: %w", err)
+	}
+	root := doc.Content[0]
+
+	info := mapEnsure(root, "info")
+	mapSet(info, "version", scalar(version.Version))
+
+	components := mapEnsure(root, "components")
+	buildSchemas(mapEnsure(components, "schemas"))
+	buildErrorResponses(mapEnsure(components, "responses"))
+	buildPaths(mapEnsure(root, "paths"), routes)
+	return &doc, nil
+}
+
+// buildPaths reconciles documented operations with the registered routes
+func buildPaths(paths *yaml.Node, routes []string) {
+	registered := make(map[string]bool)
+	for _, route := range routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || path == "/" || hiddenPath(path) {
+			continue
+		}
+		method = strings.ToLower(method)
+		path = strings.ReplaceAll(path, "...}", "}")
+		registered[method+" "+path] = true
+
+		item := mapEnsure(paths, path)
+		op := mapGet(item, method)
+		if op == nil {
+			op = stubOperation(method, path)
+			mapSet(item, method, op)
+		}
+		addErrorResponses(op, path)
+		if _, ok := routeDeprecation(route); ok {
+			mapSet(op, "deprecated", boolNode(true))
+		}
+	}
+
+	for i := 0; i < len(paths.Content); i += 2 {
+		path, item := paths.Content[i].Value, paths.Content[i+1]
+		for j := 0; j < len(item.Content); j += 2 {
+			method := item.Content[j].Value
+			if isMethod(method) && !registered[method+" "+path] {
+				item.Content = slices.Delete(item.Content, j, j+2)
+				j -= 2
+			}
+		}
+		if !hasOperation(item) {
+			paths.Content = slices.Delete(paths.Content, i, i+2)
+			i -= 2
+		}
+	}
+}
+
+// stubOperation documents a route that openapi.yaml doesn't describe yet
+func stubOperation(method, path string) *yaml.Node {
+	op := mapNode(
+		"summary", scalar(strings.ToUpper(method)+" "+path),
+		"tags", seqNode(scalar(pathTag(path))),
+	)
+	var params []*yaml.Node
+	for _, seg := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(seg, "{"); ok {
+			params = append(params, mapNode(
+				"name", scalar(strings.TrimSuffix(name, "}")),
+				"in", scalar("path"),
+				"required", boolNode(true),
+				"schema", mapNode("type", scalar("string")),
+			))
+		}
+	}
+	if len(params) > 0 {
+		mapSet(op, "parameters", seqNode(params...))
+	}
+	if strings.HasPrefix(path, "/admin/") {
+		mapSet(op, "security", seqNode(mapNode("adminToken", seqNode())))
+	}
+	mapSet(op, "responses", mapNode(`"200"`, mapNode("description", scalar("OK"))))
+	return op
+}
+
+// addErrorResponses adds the errors any operation can return, leaving
+// responses openapi.yaml already documents alone
+func addErrorResponses(op *yaml.Node, path string) {
+	responses := mapEnsure(op, "responses")
+	if strings.HasPrefix(path, "/admin/") && mapGet(responses, "401") == nil {
+		mapSet(responses, "401", mapNode("description", scalar("Missing or invalid admin token")))
+	}
+	for _, r := range []struct{ code, name string }{{"429", "RateLimited"}, {"500", "InternalError"}} {
+		if mapGet(responses, r.code) == nil {
+			mapSet(responses, r.code, refNode("#/components/responses/"+r.name))
+		}
+	}
+}
+
+// buildErrorResponses defines the shared error responses. Most errors are
+// plain text; an exhausted per-key budget answers with a BudgetError.
+func buildErrorResponses(responses *yaml.Node) {
+	text := mapNode("text/plain", mapNode("schema", mapNode("type", scalar("string"))))
+	mapSet(responses, "RateLimited", mapNode(
+		"description", scalar("Rate limit or per-key budget exhausted"),
+		"headers", mapNode("Retry-After", mapNode(
+			"description", scalar("Seconds to wait before retrying"),
+			"schema", mapNode("type", scalar("integer")),
+		)),
+		"content", mapNode(
+			"text/plain", mapNode("schema", mapNode("type", scalar("string"))),
+			"application/json", mapNode("schema", refNode("#/components/schemas/BudgetError")),
+		),
+	))
+	mapSet(responses, "InternalError", mapNode(
+		"description", scalar("Internal error"),
+		"content", text,
+	))
+}
+
+// buildSchemas replaces the registered schemas with ones reflected from
+// their Go types, keeping the hand-written documentation
+func buildSchemas(schemas *yaml.Node) {
+	names := make([]string, 0, len(specSchemas))
+	for name := range specSchemas {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		gen := schemaFor(specSchemas[name], false)
+		hand := mapGet(schemas, name)
+		if hand != nil {
+			mergeDocs(gen, hand)
+		}
+		adjustSchema(name, gen, hand)
+		mapSet(schemas, name, gen)
+	}
+}
+
+// adjustSchema applies the serialization options from models, which change
+// the encoded fields through MarshalJSON rather than struct tags
+func adjustSchema(name string, gen, hand *yaml.Node) {
+	props := mapGet(gen, "properties")
+	if props == nil {
+		return
+	}
+	if (name == "Album" || name == "Artist") && models.SrcsetEnabled.Load() {
+		srcset := mapNode("type", scalar("string"))
+		if p := mapGet(mapGet(hand, "properties"), "images_srcset"); p != nil {
+			srcset = p
+		}
+		mapSet(props, "images_srcset", srcset)
+	}
+	if models.OmitPopularity.Load() {
+		mapDelete(props, "popularity")
+		mapDelete(props, "followers")
+		mapDelete(props, "popularity_score")
+	}
+	if name == "Track" && models.LanguageNames.Load() {
+		mapSet(props, "languages", mapNode("type", scalar("array"), "items", refNode("#/components/schemas/Language")))
+	}
+	if name == "Track" && models.LegacyArtistRoles.Load() {
+		mapSet(props, "artist_roles", mapNode("type", scalar("array"), "items", mapNode("type", scalar("string"))))
+	}
+}
+
+// schemaFor reflects a JSON schema for t. Registered struct types other
+// than the one being defined become references.
+func schemaFor(t reflect.Type, ref bool) *yaml.Node {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if ref {
+		for name, st := range specSchemas {
+			if st == t {
+				return refNode("#/components/schemas/" + name)
+			}
+		}
+	}
+
+	switch {
+	case t == reflect.TypeFor[time.Time]():
+		return mapNode("type", scalar("string"), "format", scalar("date-time"))
+	case t == reflect.TypeFor[json.RawMessage]():
+		return mapNode()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return mapNode("type", scalar("string"))
+	case reflect.Bool:
+		return mapNode("type", scalar("boolean"))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return mapNode("type", scalar("integer"))
+	case reflect.Float32, reflect.Float64:
+		return mapNode("type", scalar("number"))
+	case reflect.Slice, reflect.Array:
+		return mapNode("type", scalar("array"), "items", schemaFor(t.Elem(), true))
+	case reflect.Map:
+		return mapNode("type", scalar("object"), "additionalProperties", schemaFor(t.Elem(), true))
+	case reflect.Struct:
+		props := mapNode()
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if f.Anonymous && f.Tag.Get("json") == "" {
+				// encoding/json promotes an untagged embedded struct's fields
+				if ep := mapGet(schemaFor(f.Type, false), "properties"); ep != nil {
+					for j := 0; j < len(ep.Content); j += 2 {
+						mapSet(props, ep.Content[j].Value, ep.Content[j+1])
+					}
+				}
+				continue
+			}
+			name, ok := jsonName(f)
+			if !ok {
+				continue
+			}
+			mapSet(props, name, fieldSchema(f))
+		}
+		return mapNode("type", scalar("object"), "properties", props)
+	}
+	return mapNode()
+}
+
+// fieldSchema reflects the schema of a struct field. Pointers that aren't
+// omitted when nil are encoded as null, so they are nullable; a nullable
+// reference is wrapped in allOf, since siblings of $ref are ignored.
+func fieldSchema(f reflect.StructField) *yaml.Node {
+	s := schemaFor(f.Type, true)
+	_, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if f.Type.Kind() != reflect.Pointer || strings.Contains(opts, "omitempty") || strings.Contains(opts, "omitzero") {
+		return s
+	}
+	if mapGet(s, "$ref") != nil {
+		return mapNode("nullable", boolNode(true), "allOf", seqNode(s))
+	}
+	mapSet(s, "nullable", boolNode(true))
+	return s
+}
+
+// jsonName returns the name encoding/json gives field f, or false if it
+// isn't encoded
+func jsonName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+// mergeDocs copies documentation keywords from hand onto gen, descending
+// into properties, items, and additionalProperties
+func mergeDocs(gen, hand *yaml.Node) {
+	if gen == nil || hand == nil || gen.Kind != yaml.MappingNode || hand.Kind != yaml.MappingNode {
+		return
+	}
+	if mapGet(gen, "$ref") != nil {
+		// Siblings of $ref other than description are ignored by tools
+		if d := mapGet(hand, "description"); d != nil {
+			mapSet(gen, "description", d)
+		}
+		return
+	}
+	for _, key := range docKeys {
+		if v := mapGet(hand, key); v != nil && mapGet(gen, key) == nil {
+			mapSet(gen, key, v)
+		}
+	}
+	if gp, hp := mapGet(gen, "properties"), mapGet(hand, "properties"); gp != nil && hp != nil {
+		for i := 0; i < len(gp.Content); i += 2 {
+			mergeDocs(gp.Content[i+1], mapGet(hp, gp.Content[i].Value))
+		}
+	}
+	mergeDocs(mapGet(gen, "items"), mapGet(hand, "items"))
+	mergeDocs(mapGet(gen, "additionalProperties"), mapGet(hand, "additionalProperties"))
+}
+
+func hiddenPath(path string) bool {
+	for _, prefix := range specHidden {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathTag groups stub operations by their first path segment
+func pathTag(path string) string {
+	seg, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if seg == "" {
+		return "System"
+	}
+	r := []rune(seg)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+func isMethod(key string) bool {
+	switch key {
+	case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+		return true
+	}
+	return false
+}
+
+func hasOperation(item *yaml.Node) bool {
+	for i := 0; i < len(item.Content); i += 2 {
+		if isMethod(item.Content[i].Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// YAML node helpers. Working on nodes rather than maps keeps the key order
+// of openapi.yaml in the served spec.
+
+func scalar(v string) *yaml.Node {
+	if unquoted, ok := strings.CutPrefix(v, `"`); ok {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.DoubleQuotedStyle, Value: strings.TrimSuffix(unquoted, `"`)}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+}
+
+func boolNode(b bool) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(b)}
+}
+
+func refNode(ref string) *yaml.Node {
+	return mapNode("$ref", scalar(`"`+ref+`"`))
+}
+
+func seqNode(items ...*yaml.Node) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: items}
+	if len(items) == 0 || items[0].Kind == yaml.ScalarNode {
+		n.Style = yaml.FlowStyle
+	}
+	return n
+}
+
+// mapNode builds a mapping from alternating keys and value nodes
+func mapNode(kv ...any) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i < len(kv); i += 2 {
+		mapSet(n, kv[i].(string), kv[i+1].(*yaml.Node))
+	}
+	return n
+}
+
+func mapGet(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	key = strings.Trim(key, `"`)
+	for i := 0; i < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func mapSet(n *yaml.Node, key string, v *yaml.Node) {
+	k := strings.Trim(key, `"`)
+	for i := 0; i < len(n.Content); i += 2 {
+		if n.Content[i].Value == k {
+			n.Content[i+1] = v
+			return
+		}
+	}
+	n.Content = append(n.Content, scalar(key), v)
+}
+
+func mapDelete(n *yaml.Node, key string) {
+	for i := 0; i < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = slices.Delete(n.Content, i, i+2)
+			return
+		}
+	}
+}
+
+// mapEnsure returns the mapping under key, creating it if needed
+func mapEnsure(n *yaml.Node, key string) *yaml.Node {
+	if v := mapGet(n, key); v != nil {
+		return v
+	}
+	v := mapNode()
+	mapSet(n, key, v)
+	return v
+}
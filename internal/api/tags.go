@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"metadata-api/internal/models"
+)
+
+// trackTags maps a track to the tags a tagger writes: both ID3v2.4 frames
+// and Vorbis comments, or with ?format=id3 or ?format=vorbis just one of
+// them as a flat map
+func (h *Handler) trackTags(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+
+	track, err := h.db.LookupTrack(r.Context(), id)
+	if err != nil {
+		h.lookupError(w, r, "track tags", "tracks", id, err)
+		return
+	}
+
+	respond(w, r, models.TagsFor(track))
+}
+
+// id3Tags and vorbisTags prepare the id3 and vorbis formats, which only
+// apply to tags
+func id3Tags(v any) (any, bool) {
+	tags, ok := v.(models.TrackTags)
+	return tags.ID3, ok
+}
+
+func vorbisTags(v any) (any, bool) {
+	tags, ok := v.(models.TrackTags)
+	return tags.Vorbis, ok
+}
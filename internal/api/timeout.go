@@ -0,0 +1,44 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WriteDeadlines applies per-route write deadlines instead of a single
+// server-wide WriteTimeout, so streaming routes can run for minutes while
+// lookups keep a tight bound. The server's WriteTimeout should be left at 0.
+type WriteDeadlines struct {
+	Default time.Duration // applied to every route not in Routes
+	Stream  time.Duration // applied to streaming routes
+	Routes  []string      // streaming paths; one ending in / covers the paths under it, as in ServeMux
+}
+
+// DefaultStreamRoutes are the routes that run long by design: batch
+// lookups and matching, which take hundreds of IDs or tags at once, and
+// collections, which export up to a thousand tracks as playlists
+var DefaultStreamRoutes = []string{"/batch/", "/lookup", "/lookup/albums/tracks", "/match/batch", "/collections/"}
+
+func (wd WriteDeadlines) timeoutFor(path string) time.Duration {
+	for _, route := range wd.Routes {
+		if path == route || strings.HasSuffix(route, "/") && strings.HasPrefix(path, route) {
+			return wd.Stream
+		}
+	}
+	return wd.Default
+}
+
+// Middleware sets the write deadline for each request based on its route
+func (wd WriteDeadlines) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d := wd.timeoutFor(r.URL.Path); d > 0 {
+			rc := http.NewResponseController(w)
+			if err := rc.SetWriteDeadline(time.Now().Add(d)); err != nil {
+				slog.ErrorContext(r.Context(), "set write deadline", "err", err, "path", r.URL.Path)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"metadata-api/internal/usage"
+)
+
+// maxUsageWindow bounds ?window= on /admin/usage
+const maxUsageWindow = 90 * 24 * time.Hour
+
+// RecordUsage counts each request under its client and route pattern.
+// Like Latency.Middleware it must wrap the ServeMux directly to see the
+// matched pattern.
+func RecordUsage(rec *usage.Recorder, mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(sw, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		rec.Record(usageClient(r), route, sw.status, start)
+	})
+}
+
+// usageClient identifies the caller as "key:" and a fingerprint of its API
+// key, so the usage database holds no usable keys, or as "ip:" and its
+// address. Only keys APIKeys accepted count: any other key could be made
+// up, charging usage to someone else's fingerprint or filling the database
+// with clients. The 128-bit fingerprint keeps distinct keys apart.
+func usageClient(r *http.Request) string {
+	key, ok := validatedKey(r)
+	if !ok {
+		return "ip:" + clientAddr(r)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:16])
+}
+
+// usageSummary reports requests per client and route over ?window=
+// (default 24h), listing the ?limit= busiest of each (default 50)
+func (h *Handler) usageSummary(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	window := 24 * time.Hour
+	if s := q.Get("window"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < time.Minute || d > maxUsageWindow {
+			http.Error(w, "window must be a duration between 1m and 2160h, e.g. 24h", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	limit := 50
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	summary, err := h.opts.Usage.Summarize(r.Context(), window, limit)
+	if err != nil {
+		h.dbError(w, r, "usage summary", err)
+		return
+	}
+	respond(w, r, summary)
+}
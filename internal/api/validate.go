@@ -0,0 +1,324 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Response validation limits
+const (
+	maxValidatedBody = 8 << 20 // larger bodies are passed through unchecked
+	maxMismatches    = 20      // per response
+)
+
+// ValidateResponses checks the JSON bodies of responses against the spec
+// served at /openapi.yaml and logs where they disagree. It is meant for
+// development: every response is buffered and decoded a second time.
+// Each mismatch is logged once per route. Like Latency.Middleware it must
+// wrap the ServeMux directly to see the matched route.
+func ValidateResponses(mux *Mux) http.Handler {
+	var (
+		once sync.Once
+		spec *yaml.Node
+		seen sync.Map // route and mismatch already logged
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			var err error
+			if spec, err = specDocument(mux.routes()); err != nil {
+				slog.Error("response validation disabled", "err", err)
+			}
+		})
+		if spec == nil {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &capturingWriter{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(cw, r)
+		if r.Pattern == "" || cw.overflow {
+			return
+		}
+
+		mismatches := validateResponse(spec.Content[0], r, cw.status, cw.Header(), cw.body.Bytes())
+		for _, m := range mismatches {
+			if _, logged := seen.LoadOrStore(r.Pattern+"\x00"+m, true); !logged {
+				slog.WarnContext(r.Context(), "response does not match spec", "route", r.Pattern, "status", cw.status, "mismatch", m)
+			}
+		}
+	})
+}
+
+// capturingWriter keeps a copy of the body it writes, up to
+// maxValidatedBody
+type capturingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool
+}
+
+func (w *capturingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	if !w.overflow {
+		if w.body.Len()+len(b) > maxValidatedBody {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// validateResponse lists how a response to r differs from the operation
+// documenting it. Bodies are only checked where the spec has a schema for
+// their media type; an undocumented success status is a mismatch too.
+func validateResponse(root *yaml.Node, r *http.Request, status int, h http.Header, body []byte) []string {
+	method, path, _ := strings.Cut(r.Pattern, " ")
+	if method == "" || method == http.MethodHead {
+		method = http.MethodGet
+	}
+	op := mapGet(mapGet(mapGet(root, "paths"), strings.ReplaceAll(path, "...}", "}")), strings.ToLower(method))
+	if op == nil {
+		return nil
+	}
+	resp := mapGet(mapGet(op, "responses"), strconv.Itoa(status))
+	if resp == nil {
+		resp = mapGet(mapGet(op, "responses"), "default")
+	}
+	if resp == nil {
+		if status < 300 {
+			return []string{fmt.Sprintf("status %d is not documented", status)}
+		}
+		return nil
+	}
+	resp = resolveRef(root, resp)
+
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return nil
+	}
+	content := mapGet(resp, "content")
+	if content == nil {
+		return nil
+	}
+	schema := mapGet(mapGet(content, mediaType), "schema")
+	if schema == nil {
+		return []string{fmt.Sprintf("%s is not documented for status %d", mediaType, status)}
+	}
+
+	if h.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return []string{"body is not valid gzip"}
+		}
+		if body, err = io.ReadAll(zr); err != nil {
+			return []string{"body is not valid gzip"}
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []string{"body is not valid JSON"}
+	}
+	// ?meta=true envelopes aren't part of the spec; their data is
+	if env, ok := v.(map[string]any); ok && r.URL.Query().Get("meta") == "true" {
+		v = env["data"]
+	}
+
+	s := &schemaValidator{root: root}
+	s.validate(schema, v, "$")
+	return s.mismatches
+}
+
+// schemaValidator checks values against the OpenAPI 3.0 subset the spec
+// uses: $ref, type, nullable, enum, properties, required,
+// additionalProperties, items, and allOf, oneOf, and anyOf, the last two
+// both passing when any alternative does. Object properties the schema
+// doesn't list are mismatches unless it allows additionalProperties.
+type schemaValidator struct {
+	root       *yaml.Node
+	mismatches []string
+}
+
+func (s *schemaValidator) fail(at, format string, args ...any) {
+	if len(s.mismatches) < maxMismatches {
+		s.mismatches = append(s.mismatches, at+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (s *schemaValidator) validate(schema *yaml.Node, v any, at string) {
+	schema = resolveRef(s.root, schema)
+	if schema == nil || schema.Kind != yaml.MappingNode {
+		return
+	}
+	if v == nil && scalarValue(mapGet(schema, "nullable")) == "true" {
+		return
+	}
+
+	for _, sub := range seqItems(mapGet(schema, "allOf")) {
+		s.validate(sub, v, at)
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alts := seqItems(mapGet(schema, key)); len(alts) > 0 && !s.anyValid(alts, v, at) {
+			s.fail(at, "matches none of %s", key)
+		}
+	}
+
+	typ := scalarValue(mapGet(schema, "type"))
+	if v == nil {
+		if typ != "" {
+			s.fail(at, "null, want %s", typ)
+		}
+		return
+	}
+	if typ != "" && !hasType(v, typ) {
+		s.fail(at, "%s, want %s", jsonType(v), typ)
+		return
+	}
+	if enum := seqItems(mapGet(schema, "enum")); len(enum) > 0 {
+		want := fmt.Sprint(v)
+		if !slices.ContainsFunc(enum, func(n *yaml.Node) bool { return n.Value == want }) {
+			s.fail(at, "%q is not in the enum", want)
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		s.validateObject(schema, v, at)
+	case []any:
+		if items := mapGet(schema, "items"); items != nil {
+			for i, item := range v {
+				s.validate(items, item, fmt.Sprintf("%s[%d]", at, i))
+			}
+		}
+	}
+}
+
+func (s *schemaValidator) validateObject(schema *yaml.Node, v map[string]any, at string) {
+	props := mapGet(schema, "properties")
+	for _, name := range seqItems(mapGet(schema, "required")) {
+		if _, ok := v[name.Value]; !ok {
+			s.fail(at, "required property %q is missing", name.Value)
+		}
+	}
+	extra := mapGet(schema, "additionalProperties")
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if p := mapGet(props, name); p != nil {
+			s.validate(p, v[name], at+"."+name)
+			continue
+		}
+		switch {
+		case extra != nil && extra.Kind == yaml.MappingNode:
+			s.validate(extra, v[name], at+"."+name)
+		case extra != nil && extra.Value == "true":
+		case props != nil || extra != nil:
+			s.fail(at, "property %q is not documented", name)
+		}
+	}
+}
+
+// anyValid reports whether v passes any of the schemas alts
+func (s *schemaValidator) anyValid(alts []*yaml.Node, v any, at string) bool {
+	for _, alt := range alts {
+		trial := &schemaValidator{root: s.root}
+		trial.validate(alt, v, at)
+		if len(trial.mismatches) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRef follows local $refs such as #/components/schemas/Track
+func resolveRef(root, n *yaml.Node) *yaml.Node {
+	for range 16 {
+		ref := scalarValue(mapGet(n, "$ref"))
+		if ref == "" {
+			return n
+		}
+		n = root
+		for _, seg := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			n = mapGet(n, seg)
+		}
+	}
+	return nil
+}
+
+func hasType(v any, typ string) bool {
+	switch typ {
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	}
+	return jsonType(v) == typ
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+func scalarValue(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
+
+func seqItems(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
@@ -0,0 +1,402 @@
+package api
+
+import (
+	"encoding/xml"
+
+	"metadata-api/internal/models"
+)
+
+// The XML schema is defined separately from the JSON models so it stays
+// stable for XML consumers as the JSON responses grow. Entities are
+// elements named after their type with the Spotify ID as the id attribute;
+// lists are wrapped in an element named after the plural.
+
+type xmlTrack struct {
+	XMLName          xml.Name          `xml:"track"`
+	ID               string            `xml:"id,attr"`
+	URI              string            `xml:"uri,attr,omitempty"`
+	Href             string            `xml:"href,attr,omitempty"`
+	Name             string            `xml:"name"`
+	ISRC             string            `xml:"isrc,omitempty"`
+	DurationMs       int64             `xml:"duration_ms"`
+	Explicit         bool              `xml:"explicit"`
+	TrackNumber      int               `xml:"track_number"`
+	DiscNumber       int               `xml:"disc_number"`
+	Popularity       *int              `xml:"popularity,omitempty"`
+	PreviewURL       string            `xml:"preview_url,omitempty"`
+	OriginalTitle    string            `xml:"original_title,omitempty"`
+	VersionTitle     string            `xml:"version_title,omitempty"`
+	HasLyrics        *bool             `xml:"has_lyrics,omitempty"`
+	Languages        *xmlStrings       `xml:"languages,omitempty"`
+	ArtistRoles      *xmlArtistRoles   `xml:"artist_roles,omitempty"`
+	MBID             string            `xml:"mbid,omitempty"`
+	AvailableMarkets *xmlMarkets       `xml:"available_markets,omitempty"`
+	IsPlayable       *bool             `xml:"is_playable,omitempty"`
+	LinkedFrom       *xmlLinkedFrom    `xml:"linked_from,omitempty"`
+	Album            *xmlAlbum         `xml:"album,omitempty"`
+	Artists          *xmlArtists       `xml:"artists,omitempty"`
+	AudioFeatures    *xmlAudioFeatures `xml:"audio_features,omitempty"`
+}
+
+type xmlLinkedFrom struct {
+	ID   string `xml:"id,attr"`
+	URI  string `xml:"uri,attr,omitempty"`
+	Href string `xml:"href,attr,omitempty"`
+}
+
+type xmlAlbum struct {
+	XMLName          xml.Name       `xml:"album"`
+	ID               string         `xml:"id,attr"`
+	URI              string         `xml:"uri,attr,omitempty"`
+	Href             string         `xml:"href,attr,omitempty"`
+	Name             string         `xml:"name"`
+	Type             string         `xml:"type"`
+	Label            string         `xml:"label"`
+	ReleaseDate      xmlReleaseDate `xml:"release_date"`
+	UPC              string         `xml:"upc,omitempty"`
+	TotalTracks      int            `xml:"total_tracks"`
+	Copyright        string         `xml:"copyright,omitempty"`
+	CopyrightP       string         `xml:"copyright_p,omitempty"`
+	Genres           *xmlStrings    `xml:"genres,omitempty"`
+	Images           *xmlImages     `xml:"images,omitempty"`
+	ImagesSrcset     string         `xml:"images_srcset,omitempty"`
+	PrimaryArtist    *xmlArtistRef  `xml:"primary_artist,omitempty"`
+	Artists          *xmlArtists    `xml:"artists,omitempty"`
+	Languages        *xmlLanguages  `xml:"languages,omitempty"`
+	Tracks           *xmlTracks     `xml:"tracks,omitempty"`
+	MBID             string         `xml:"mbid,omitempty"`
+	AvailableMarkets *xmlMarkets    `xml:"available_markets,omitempty"`
+}
+
+type xmlArtist struct {
+	XMLName      xml.Name    `xml:"artist"`
+	ID           string      `xml:"id,attr"`
+	URI          string      `xml:"uri,attr,omitempty"`
+	Href         string      `xml:"href,attr,omitempty"`
+	Name         string      `xml:"name"`
+	Followers    *int64      `xml:"followers,omitempty"`
+	Popularity   *int        `xml:"popularity,omitempty"`
+	Genres       *xmlStrings `xml:"genres,omitempty"`
+	Images       *xmlImages  `xml:"images,omitempty"`
+	ImagesSrcset string      `xml:"images_srcset,omitempty"`
+	MBID         string      `xml:"mbid,omitempty"`
+}
+
+type xmlTracks struct {
+	XMLName xml.Name `xml:"tracks"`
+	xmlPaging
+	Tracks []xmlTrack `xml:"track"`
+}
+
+type xmlAlbums struct {
+	XMLName xml.Name   `xml:"albums"`
+	Albums  []xmlAlbum `xml:"album"`
+}
+
+type xmlArtists struct {
+	XMLName xml.Name `xml:"artists"`
+	xmlPaging
+	Artists []xmlArtist `xml:"artist"`
+}
+
+// xmlPaging is set on the track and artist lists of search results. The
+// fields are pointers, not the embedding, since encoding/xml panics on an
+// embedded nil pointer with attributes.
+type xmlPaging struct {
+	Total  *int `xml:"total,attr,omitempty"`
+	Limit  *int `xml:"limit,attr,omitempty"`
+	Offset *int `xml:"offset,attr,omitempty"`
+}
+
+// xmlResults holds the mixed entities of an MBID lookup
+type xmlResults struct {
+	XMLName xml.Name `xml:"results"`
+	Items   []any
+}
+
+// List wrappers are pointers in their parents and nil when empty:
+// encoding/xml writes the parent of an "a>b" path even when the slice is
+// empty and omitempty is set.
+
+type xmlStrings struct {
+	Items []xmlString
+}
+
+type xmlString struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type xmlImages struct {
+	Images []xmlImage `xml:"image"`
+}
+
+type xmlLanguages struct {
+	Languages []xmlLanguage `xml:"language"`
+}
+
+type xmlArtistRoles struct {
+	Roles []xmlArtistRole `xml:"role"`
+}
+
+// xmlArtistRole keeps the role as the element text, as it was before roles
+// were resolved to artists
+type xmlArtistRole struct {
+	ArtistID string `xml:"artist_id,attr,omitempty"`
+	Name     string `xml:"name,attr,omitempty"`
+	Role     string `xml:",chardata"`
+}
+
+type xmlArtistRef struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:",chardata"`
+}
+
+type xmlReleaseDate struct {
+	Precision string `xml:"precision,attr,omitempty"`
+	Year      int    `xml:"year,attr,omitempty"`
+	Month     int    `xml:"month,attr,omitempty"`
+	Day       int    `xml:"day,attr,omitempty"`
+	Date      string `xml:",chardata"`
+}
+
+type xmlImage struct {
+	URL    string `xml:"url,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+type xmlLanguage struct {
+	Tracks   int    `xml:"tracks,attr"`
+	Language string `xml:",chardata"`
+}
+
+// xmlMarkets is a pointer in its parents so an empty list, meaning
+// available nowhere, is still written
+type xmlMarkets struct {
+	Markets []string `xml:"market"`
+}
+
+type xmlAudioFeatures struct {
+	Danceability     float64 `xml:"danceability"`
+	Energy           float64 `xml:"energy"`
+	Key              int     `xml:"key"`
+	Loudness         float64 `xml:"loudness"`
+	Mode             int     `xml:"mode"`
+	Speechiness      float64 `xml:"speechiness"`
+	Acousticness     float64 `xml:"acousticness"`
+	Instrumentalness float64 `xml:"instrumentalness"`
+	Liveness         float64 `xml:"liveness"`
+	Valence          float64 `xml:"valence"`
+	Tempo            float64 `xml:"tempo"`
+	TimeSignature    int     `xml:"time_signature"`
+}
+
+// newXMLDocument converts tracks, albums, and artists to their XML schema
+func newXMLDocument(v any) (any, bool) {
+	switch v := v.(type) {
+	case *models.Track:
+		return xmlTrackFrom(v), true
+	case *models.Album:
+		return xmlAlbumFrom(v), true
+	case *models.Artist:
+		return xmlArtistFrom(v), true
+	case []models.Track:
+		return xmlTracksFrom(v), true
+	case []models.Album:
+		out := &xmlAlbums{Albums: make([]xmlAlbum, len(v))}
+		for i := range v {
+			out.Albums[i] = *xmlAlbumFrom(&v[i])
+		}
+		return out, true
+	case []models.Artist:
+		return xmlArtistsFrom(v), true
+	case models.TrackPage:
+		out := xmlTracksFrom(v.Items)
+		out.xmlPaging = xmlPaging{&v.Total, &v.Limit, &v.Offset}
+		return out, true
+	case models.ArtistPage:
+		out := xmlArtistsFrom(v.Items)
+		out.xmlPaging = xmlPaging{&v.Total, &v.Limit, &v.Offset}
+		return out, true
+	case []any:
+		out := &xmlResults{Items: make([]any, 0, len(v))}
+		for _, item := range v {
+			doc, ok := newXMLDocument(item)
+			if !ok {
+				return nil, false
+			}
+			out.Items = append(out.Items, doc)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func xmlTrackFrom(t *models.Track) *xmlTrack {
+	out := &xmlTrack{
+		ID:            t.ID,
+		Name:          t.Name,
+		ISRC:          t.ISRC,
+		DurationMs:    t.DurationMs,
+		Explicit:      t.Explicit,
+		TrackNumber:   t.TrackNum,
+		DiscNumber:    t.DiscNum,
+		PreviewURL:    t.PreviewURL,
+		OriginalTitle: t.OriginalTitle,
+		VersionTitle:  t.VersionTitle,
+		HasLyrics:     t.HasLyrics,
+		Languages:     newXMLStrings("language", t.Languages),
+		ArtistRoles:   xmlArtistRolesFrom(t.ArtistRoles),
+		MBID:          t.MBID,
+		IsPlayable:    t.IsPlayable,
+	}
+	l := models.LinksFor("track", t.ID)
+	out.URI, out.Href = l.URI, l.Href
+	if !models.OmitPopularity.Load() {
+		out.Popularity = &t.Popularity
+	}
+	if t.AvailableMarkets != nil {
+		out.AvailableMarkets = &xmlMarkets{Markets: t.AvailableMarkets}
+	}
+	if t.LinkedFrom != nil {
+		l := models.LinksFor("track", t.LinkedFrom.ID)
+		out.LinkedFrom = &xmlLinkedFrom{ID: t.LinkedFrom.ID, URI: l.URI, Href: l.Href}
+	}
+	if t.Album != nil {
+		out.Album = xmlAlbumFrom(t.Album)
+	}
+	if t.Artists != nil {
+		out.Artists = xmlArtistsFrom(t.Artists)
+	}
+	if f := t.AudioFeatures; f != nil {
+		out.AudioFeatures = &xmlAudioFeatures{
+			Danceability:     f.Danceability,
+			Energy:           f.Energy,
+			Key:              f.Key,
+			Loudness:         f.Loudness,
+			Mode:             f.Mode,
+			Speechiness:      f.Speechiness,
+			Acousticness:     f.Acousticness,
+			Instrumentalness: f.Instrumentalness,
+			Liveness:         f.Liveness,
+			Valence:          f.Valence,
+			Tempo:            f.Tempo,
+			TimeSignature:    f.TimeSignature,
+		}
+	}
+	return out
+}
+
+func xmlArtistRolesFrom(roles []models.ArtistRole) *xmlArtistRoles {
+	if len(roles) == 0 {
+		return nil
+	}
+	out := &xmlArtistRoles{Roles: make([]xmlArtistRole, len(roles))}
+	for i, r := range roles {
+		out.Roles[i] = xmlArtistRole{ArtistID: r.ArtistID, Name: r.Name, Role: r.Role}
+	}
+	return out
+}
+
+func xmlTracksFrom(tracks []models.Track) *xmlTracks {
+	out := &xmlTracks{Tracks: make([]xmlTrack, len(tracks))}
+	for i := range tracks {
+		out.Tracks[i] = *xmlTrackFrom(&tracks[i])
+	}
+	return out
+}
+
+func xmlAlbumFrom(a *models.Album) *xmlAlbum {
+	out := &xmlAlbum{
+		ID:          a.ID,
+		Name:        a.Name,
+		Type:        a.Type,
+		Label:       a.Label,
+		ReleaseDate: xmlReleaseDate{Precision: a.ReleaseDatePrecision, Date: a.ReleaseDate},
+		UPC:         a.UPC,
+		TotalTracks: a.TotalTracks,
+		Copyright:   a.CopyrightC,
+		CopyrightP:  a.CopyrightP,
+		Genres:      newXMLStrings("genre", a.Genres),
+		Images:      xmlImagesFrom(a.Images),
+		MBID:        a.MBID,
+	}
+	l := models.LinksFor("album", a.ID)
+	out.URI, out.Href = l.URI, l.Href
+	if d := models.ParseReleaseDate(a.ReleaseDate, a.ReleaseDatePrecision); d != nil {
+		out.ReleaseDate.Year, out.ReleaseDate.Month, out.ReleaseDate.Day = d.Year, d.Month, d.Day
+	}
+	if models.SrcsetEnabled.Load() {
+		out.ImagesSrcset = models.Srcset(a.Images)
+	}
+	if a.PrimaryArtist != nil {
+		out.PrimaryArtist = &xmlArtistRef{ID: a.PrimaryArtist.ID, Name: a.PrimaryArtist.Name}
+	}
+	if a.Artists != nil {
+		out.Artists = xmlArtistsFrom(a.Artists)
+	}
+	if len(a.Languages) > 0 {
+		out.Languages = &xmlLanguages{}
+		for _, l := range a.Languages {
+			out.Languages.Languages = append(out.Languages.Languages, xmlLanguage{Tracks: l.Tracks, Language: l.Language})
+		}
+	}
+	if a.Tracks != nil {
+		out.Tracks = xmlTracksFrom(a.Tracks)
+	}
+	if a.AvailableMarkets != nil {
+		out.AvailableMarkets = &xmlMarkets{Markets: a.AvailableMarkets}
+	}
+	return out
+}
+
+func xmlArtistFrom(a *models.Artist) *xmlArtist {
+	out := &xmlArtist{
+		ID:     a.ID,
+		Name:   a.Name,
+		Genres: newXMLStrings("genre", a.Genres),
+		Images: xmlImagesFrom(a.Images),
+		MBID:   a.MBID,
+	}
+	l := models.LinksFor("artist", a.ID)
+	out.URI, out.Href = l.URI, l.Href
+	if !models.OmitPopularity.Load() {
+		out.Followers, out.Popularity = &a.Followers, &a.Popularity
+	}
+	if models.SrcsetEnabled.Load() {
+		out.ImagesSrcset = models.Srcset(a.Images)
+	}
+	return out
+}
+
+func xmlArtistsFrom(artists []models.Artist) *xmlArtists {
+	out := &xmlArtists{Artists: make([]xmlArtist, len(artists))}
+	for i := range artists {
+		out.Artists[i] = *xmlArtistFrom(&artists[i])
+	}
+	return out
+}
+
+func xmlImagesFrom(images []models.Image) *xmlImages {
+	if len(images) == 0 {
+		return nil
+	}
+	out := &xmlImages{Images: make([]xmlImage, len(images))}
+	for i, img := range images {
+		out.Images[i] = xmlImage{URL: img.URL, Width: img.Width, Height: img.Height}
+	}
+	return out
+}
+
+// newXMLStrings wraps each value in an element called name
+func newXMLStrings(name string, values []string) *xmlStrings {
+	if len(values) == 0 {
+		return nil
+	}
+	out := &xmlStrings{Items: make([]xmlString, len(values))}
+	for i, v := range values {
+		out.Items[i] = xmlString{XMLName: xml.Name{Local: name}, Value: v}
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"metadata-api/internal/models"
+)
+
+// isrcUPCs maps a recording to its releases: the UPCs of the albums with a
+// track with the ISRC
+func (h *Handler) isrcUPCs(w http.ResponseWriter, r *http.Request) {
+	isrc := r.PathValue("isrc")
+	if isrc == "" {
+		http.Error(w, "isrc required", http.StatusBadRequest)
+		return
+	}
+
+	tracks, err := h.db.LookupISRC(r.Context(), isrc)
+	if err != nil {
+		h.dbError(w, r, "isrc upcs", err)
+		return
+	}
+
+	respond(w, r, models.ISRCReleases{ISRC: isrc, UPCs: models.ReleasesOf(tracks)})
+}
+
+// upcISRCs lists the ISRCs and positions of the tracks of the albums with
+// a UPC, the inverse of isrcUPCs
+func (h *Handler) upcISRCs(w http.ResponseWriter, r *http.Request) {
+	upc := r.PathValue("upc")
+	if upc == "" {
+		http.Error(w, "upc required", http.StatusBadRequest)
+		return
+	}
+
+	tracks, err := h.db.UPCTracks(r.Context(), upc)
+	if err != nil {
+		h.dbError(w, r, "upc isrcs", err)
+		return
+	}
+
+	respond(w, r, models.UPCTracks{UPC: upc, ISRCs: tracks})
+}
@@ -0,0 +1,138 @@
+// Package audit keeps an append-only record of admin operations: who made
+// each change, what it was, and when, with a hash of the request body. It
+// lets operators sharing an admin token see who did what.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// The triggers make the table append-only for anything going through
+// SQLite, including the sqlite3 shell
+const schema = `
+	CREATE TABLE IF NOT EXISTS events (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		time TEXT NOT NULL,
+		operator TEXT NOT NULL,
+		ip TEXT NOT NULL,
+		request_id TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		body_sha256 TEXT NOT NULL,
+		body_size INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS events_time ON events (time);
+	CREATE TRIGGER IF NOT EXISTS events_no_update BEFORE UPDATE ON events
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+	CREATE TRIGGER IF NOT EXISTS events_no_delete BEFORE DELETE ON events
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;`
+
+// Event is one admin operation
+type Event struct {
+	Seq        int64     `json:"seq"`
+	Time       time.Time `json:"time"`
+	Operator   string    `json:"operator"` // from X-Operator; self-reported, so read it alongside ip
+	IP         string    `json:"ip"`       // the client's address, which it can't choose
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"` // including the query string
+	Status     int       `json:"status"`
+	BodySHA256 string    `json:"body_sha256"` // hex; the hash of an empty body for requests without one
+	BodySize   int64     `json:"body_size"`
+}
+
+// Log appends events to a SQLite database
+type Log struct {
+	conn *sql.DB
+}
+
+// Open opens or creates the audit database at path
+func Open(path string) (*Log, error) {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	conn.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	for _, stmt := range []string{`PRAGMA journal_mode = WAL`, schema} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("init audit log: %w", err)
+		}
+	}
+	return &Log{conn: conn}, nil
+}
+
+// Append records e, ignoring its Seq
+func (l *Log) Append(ctx context.Context, e Event) error {
+	_, err := l.conn.ExecContext(ctx, `
+		INSERT INTO events (time, operator, ip, request_id, method, path, status, body_sha256, body_size)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UTC().Format(time.RFC3339Nano), e.Operator, e.IP, e.RequestID,
+		e.Method, e.Path, e.Status, e.BodySHA256, e.BodySize)
+	return err
+}
+
+// Filter selects events; zero fields match everything
+type Filter struct {
+	Since    time.Time
+	Operator string
+	Before   int64 // only events with a lower Seq, for paging back through the log
+	Limit    int
+}
+
+// Events returns the events matching f, newest first
+func (l *Log) Events(ctx context.Context, f Filter) ([]Event, error) {
+	var where []string
+	var args []any
+	if !f.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, f.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if f.Operator != "" {
+		where = append(where, "operator = ?")
+		args = append(args, f.Operator)
+	}
+	if f.Before > 0 {
+		where = append(where, "seq < ?")
+		args = append(args, f.Before)
+	}
+	query := `SELECT seq, time, operator, ip, request_id, method, path, status, body_sha256, body_size FROM events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY seq DESC LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := l.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		var at string
+		if err := rows.Scan(&e.Seq, &at, &e.Operator, &e.IP, &e.RequestID, &e.Method, &e.Path, &e.Status, &e.BodySHA256, &e.BodySize); err != nil {
+			return nil, err
+		}
+		if e.Time, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Close closes the database
+func (l *Log) Close() error {
+	return l.conn.Close()
+}
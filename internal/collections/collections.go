@@ -0,0 +1,448 @@
+// Package collections keeps user-curated lists of catalog tracks, such as
+// playlists, in a small writable SQLite database next to the read-only
+// snapshot. Collections hold track IDs only; their metadata is resolved
+// from the catalog when a collection is read.
+//
+// Anyone can read a collection by ID. Changing one takes the edit token
+// returned when it was created, so a collection can be shared read-only by
+// passing on just its ID.
+package collections
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// MaxTracks is the most tracks a collection holds
+const MaxTracks = 1000
+
+var (
+	// ErrNotFound means there is no collection with the ID, or the track
+	// is not in it
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden means the edit token doesn't match the collection's
+	ErrForbidden = errors.New("edit token does not match")
+	// ErrTooLarge means a collection would hold more than MaxTracks tracks
+	ErrTooLarge = fmt.Errorf("a collection holds at most %d tracks", MaxTracks)
+)
+
+const schema = `
+	CREATE TABLE IF NOT EXISTS collections (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL,
+		token_sha256 TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS collection_tracks (
+		collection_id TEXT NOT NULL REFERENCES collections (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		track_id TEXT NOT NULL,
+		added_at TEXT NOT NULL,
+		PRIMARY KEY (collection_id, track_id)
+	);
+	CREATE INDEX IF NOT EXISTS collection_tracks_position ON collection_tracks (collection_id, position);
+	CREATE INDEX IF NOT EXISTS collection_tracks_track ON collection_tracks (track_id);`
+
+// Collection is a named, ordered list of track IDs
+type Collection struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	TrackCount  int       `json:"track_count"`
+	TrackIDs    []string  `json:"track_ids,omitempty"` // in the order they were added; not set by List
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Store keeps collections in a SQLite database
+type Store struct {
+	conn *sql.DB
+}
+
+// Open opens or creates the collections database at path
+func Open(path string) (*Store, error) {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open collections: %w", err)
+	}
+	// Writes are small; one connection avoids SQLITE_BUSY
+	conn.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	for _, stmt := range []string{`PRAGMA journal_mode = WAL`, `PRAGMA foreign_keys = ON`, schema} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("init collections: %w", err)
+		}
+	}
+	return &Store{conn: conn}, nil
+}
+
+// Create adds a collection holding trackIDs and returns it with the token
+// needed to change it. The token is only stored hashed, so it can't be
+// recovered later.
+func (s *Store) Create(ctx context.Context, name, description string, trackIDs []string) (*Collection, string, error) {
+	if len(trackIDs) > MaxTracks {
+		return nil, "", ErrTooLarge
+	}
+	id, token := randomID(), randomToken()
+	now := timestamp()
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO collections (id, name, description, token_sha256, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, id, name, description, hashToken(token), now, now)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := insertTracks(ctx, tx, id, 0, trackIDs, now); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+
+	c, err := s.Get(ctx, id)
+	return c, token, err
+}
+
+// Get returns the collection with id and its track IDs
+func (s *Store) Get(ctx context.Context, id string) (*Collection, error) {
+	c := &Collection{ID: id}
+	var created, updated string
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT name, description, created_at, updated_at FROM collections WHERE id = ?`, id,
+	).Scan(&c.Name, &c.Description, &created, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("collection %q: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.setTimes(created, updated); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT track_id FROM collection_tracks WHERE collection_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	c.TrackIDs = []string{}
+	for rows.Next() {
+		var trackID string
+		if err := rows.Scan(&trackID); err != nil {
+			return nil, err
+		}
+		c.TrackIDs = append(c.TrackIDs, trackID)
+	}
+	c.TrackCount = len(c.TrackIDs)
+	return c, rows.Err()
+}
+
+// List returns up to limit collections from offset, most recently updated
+// first, without their track IDs
+func (s *Store) List(ctx context.Context, limit, offset int) ([]Collection, error) {
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT c.id, c.name, c.description, c.created_at, c.updated_at,
+		       (SELECT COUNT(*) FROM collection_tracks t WHERE t.collection_id = c.id)
+		FROM collections c
+		ORDER BY c.updated_at DESC, c.id
+		LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanCollections(rows)
+}
+
+// Containing returns up to limit of the collections holding any of the
+// tracks with trackIDs from offset, most recently updated first, without
+// their track IDs
+func (s *Store) Containing(ctx context.Context, trackIDs []string, limit, offset int) ([]Collection, error) {
+	if len(trackIDs) == 0 {
+		return []Collection{}, nil
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT c.id, c.name, c.description, c.created_at, c.updated_at,
+		       (SELECT COUNT(*) FROM collection_tracks t WHERE t.collection_id = c.id)
+		FROM collections c
+		WHERE c.id IN (SELECT collection_id FROM collection_tracks WHERE track_id IN (`+params(len(trackIDs))+`))
+		ORDER BY c.updated_at DESC, c.id
+		LIMIT ? OFFSET ?`, append(anys(trackIDs), limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanCollections(rows)
+}
+
+// Holding returns how many collections hold any of the tracks with
+// trackIDs, such as an album's: how many playlists the album appears in
+func (s *Store) Holding(ctx context.Context, trackIDs []string) (int, error) {
+	if len(trackIDs) == 0 {
+		return 0, nil
+	}
+	var n int
+	err := s.conn.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT collection_id) FROM collection_tracks
+		WHERE track_id IN (`+params(len(trackIDs))+`)`, anys(trackIDs)...).Scan(&n)
+	return n, err
+}
+
+// Counts returns how many collections hold each of the tracks with
+// trackIDs, leaving out tracks in none. Being added to collections is a
+// sign of local interest, which similar-track ranking weighs.
+func (s *Store) Counts(ctx context.Context, trackIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(trackIDs) == 0 {
+		return counts, nil
+	}
+	rows, err := s.conn.QueryContext(ctx, `
+		SELECT track_id, COUNT(*) FROM collection_tracks
+		WHERE track_id IN (`+params(len(trackIDs))+`)
+		GROUP BY track_id`, anys(trackIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
+
+// params returns n comma-separated placeholders
+func params(n int) string {
+	return "?" + strings.Repeat(",?", n-1)
+}
+
+func anys(ids []string) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// scanCollections reads the rows of List and Containing
+func scanCollections(rows *sql.Rows) ([]Collection, error) {
+	defer rows.Close()
+	out := []Collection{}
+	for rows.Next() {
+		var c Collection
+		var created, updated string
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &created, &updated, &c.TrackCount); err != nil {
+			return nil, err
+		}
+		if err := c.setTimes(created, updated); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Authorize returns ErrForbidden unless token is the edit token of the
+// collection with id
+func (s *Store) Authorize(ctx context.Context, id, token string) error {
+	var want string
+	err := s.conn.QueryRowContext(ctx, `SELECT token_sha256 FROM collections WHERE id = ?`, id).Scan(&want)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("collection %q: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(want)) != 1 {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AddTracks appends the tracks with trackIDs that the collection doesn't
+// hold yet and returns the updated collection
+func (s *Store) AddTracks(ctx context.Context, id string, trackIDs []string) (*Collection, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM collections WHERE id = ?)`, id).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("collection %q: %w", id, ErrNotFound)
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT track_id FROM collection_tracks WHERE collection_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[string]bool)
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		held[t] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for _, t := range trackIDs {
+		if !held[t] {
+			held[t] = true
+			added = append(added, t)
+		}
+	}
+	if len(held) > MaxTracks {
+		return nil, ErrTooLarge
+	}
+	if len(added) > 0 {
+		// Positions only order tracks, so gaps left by removals are fine
+		// as long as new ones come after every existing one
+		var next int
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(position) + 1, 0) FROM collection_tracks WHERE collection_id = ?`, id,
+		).Scan(&next)
+		if err != nil {
+			return nil, err
+		}
+		now := timestamp()
+		if err := insertTracks(ctx, tx, id, next, added, now); err != nil {
+			return nil, err
+		}
+		if err := touch(ctx, tx, id, now); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	// Release the only connection before reading the collection back
+	tx.Rollback()
+	return s.Get(ctx, id)
+}
+
+// RemoveTrack takes the track with trackID out of the collection
+func (s *Store) RemoveTrack(ctx context.Context, id, trackID string) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM collection_tracks WHERE collection_id = ? AND track_id = ?`, id, trackID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("track %q in collection %q: %w", trackID, id, ErrNotFound)
+	}
+	if err := touch(ctx, tx, id, timestamp()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete deletes the collection with id and its tracks
+func (s *Store) Delete(ctx context.Context, id string) error {
+	res, err := s.conn.ExecContext(ctx, `DELETE FROM collections WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("collection %q: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.conn.Close()
+}
+
+func insertTracks(ctx context.Context, tx *sql.Tx, id string, position int, trackIDs []string, now string) error {
+	for i, t := range trackIDs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO collection_tracks (collection_id, position, track_id, added_at)
+			VALUES (?, ?, ?, ?)`, id, position+i, t, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func touch(ctx context.Context, tx *sql.Tx, id, now string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE collections SET updated_at = ? WHERE id = ?`, now, id)
+	return err
+}
+
+// timeLayout is fixed-width, unlike time.RFC3339Nano, so stored times sort
+// as strings
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+func timestamp() string {
+	return time.Now().UTC().Format(timeLayout)
+}
+
+func (c *Collection) setTimes(created, updated string) error {
+	var err error
+	if c.CreatedAt, err = time.Parse(timeLayout, created); err != nil {
+		return err
+	}
+	c.UpdatedAt, err = time.Parse(timeLayout, updated)
+	return err
+}
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// randomID returns a random 22-character base62 ID, the shape of catalog
+// IDs
+func randomID() string {
+	b := make([]byte, 22)
+	rand.Read(b)
+	for i := range b {
+		b[i] = base62[int(b[i])%len(base62)]
+	}
+	return string(b)
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// albumGenresTable is an optional table of genres per album (album_rowid,
+// genre). Without it, albums take the genres of their credited artists.
+const albumGenresTable = "album_genres"
+
+// batchGetAlbumGenres returns the genres of each album, from album_genres
+// when the snapshot has it and otherwise from the album's credited artists,
+// the genres most of them share first
+func (d *DB) batchGetAlbumGenres(ctx context.Context, albumRowIDs map[int64]bool) (map[int64][]string, error) {
+	if len(albumRowIDs) == 0 {
+		return make(map[int64][]string), nil
+	}
+
+	placeholders := make([]string, 0, len(albumRowIDs))
+	args := make([]interface{}, 0, len(albumRowIDs))
+	for rowid := range albumRowIDs {
+		placeholders = append(placeholders, "?")
+		args = append(args, rowid)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT aa.album_rowid, g.genre
+		FROM artist_albums aa
+		JOIN artist_genres g ON g.artist_rowid = aa.artist_rowid
+		WHERE aa.album_rowid IN (%s) AND aa.index_in_album IS NOT NULL
+		GROUP BY aa.album_rowid, g.genre
+		ORDER BY aa.album_rowid, COUNT(*) DESC, MIN(aa.index_in_album), g.genre
+	`, strings.Join(placeholders, ","))
+	if d.hasAlbumGenres {
+		query = fmt.Sprintf(`
+			SELECT album_rowid, genre FROM `+albumGenresTable+`
+			WHERE album_rowid IN (%s) ORDER BY album_rowid, rowid
+		`, strings.Join(placeholders, ","))
+	}
+
+	rows, err := d.main.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64][]string)
+	for rows.Next() {
+		var rowid int64
+		var genre string
+		if err := rows.Scan(&rowid, &genre); err != nil {
+			return nil, err
+		}
+		result[rowid] = append(result[rowid], genre)
+	}
+	return result, rows.Err()
+}
+
+// GenreAlbums returns the albums in a genre, newest first. Without
+// album_genres, an album is in a genre when one of its credited artists is.
+func (d *DB) GenreAlbums(ctx context.Context, genre string, limit, offset int) ([]models.Album, error) {
+	if d.shards != nil {
+		return d.shards.genreAlbums(ctx, genre, limit, offset)
+	}
+
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	match := `al.rowid IN (
+		SELECT aa.album_rowid FROM artist_genres g
+		JOIN artist_albums aa ON aa.artist_rowid = g.artist_rowid
+		WHERE g.genre = ? AND aa.index_in_album IS NOT NULL)`
+	if d.hasAlbumGenres {
+		match = `al.rowid IN (SELECT album_rowid FROM ` + albumGenresTable + ` WHERE genre = ?)`
+	}
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT al.id, al.name, al.album_type, al.label, al.release_date, al.release_date_precision,
+		       al.external_id_upc, al.total_tracks, al.copyright_c, al.copyright_p, al.rowid
+		FROM albums al
+		WHERE `+match+`
+		ORDER BY al.release_date DESC, al.rowid DESC
+		LIMIT ? OFFSET ?
+	`, genre, limit, offset)
+	if err != nil {
+		return nil, queryError(ctx, "genre albums", err)
+	}
+	defer rows.Close()
+
+	var albums []models.Album
+	var rowIDs []int64
+	albumRowIDs := make(map[int64]bool)
+	for rows.Next() {
+		var as albumScan
+		var rowid int64
+		if err := rows.Scan(scanArgs(as.dest(), []any{&rowid})...); err != nil {
+			return nil, queryError(ctx, "scan album", err)
+		}
+		albums = append(albums, as.album(&d.nulls))
+		rowIDs = append(rowIDs, rowid)
+		albumRowIDs[rowid] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "genre albums", err)
+	}
+
+	albumImages, err := d.batchGetAlbumImages(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album images", "err", err)
+	}
+	albumArtists, artistRowIDs, err := d.batchGetAlbumArtists(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album artists", "err", err)
+	}
+	albumGenres, err := d.batchGetAlbumGenres(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album genres", "err", err)
+	}
+	assemble := d.artistAssembler(ctx, artistRowIDs)
+
+	refs := mbidRefs{}
+	markets := newMarketRefs()
+	for i, rowid := range rowIDs {
+		a := &albums[i]
+		a.Images = albumImages[rowid]
+		a.Genres = albumGenres[rowid]
+		if artists, ok := albumArtists[rowid]; ok {
+			a.SetArtists(assemble(artists))
+		}
+		refs.album(a)
+		markets.album(a)
+	}
+	d.attachMBIDs(ctx, refs)
+	d.attachMarkets(ctx, markets)
+	return albums, nil
+}
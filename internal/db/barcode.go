@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gtinLength is the length of a GTIN-14, which every retail barcode
+// becomes when padded with leading zeros
+const gtinLength = 14
+
+// minBarcodeLength is the length of an EAN-8, the shortest barcode
+const minBarcodeLength = 8
+
+// barcodeForms returns the spellings a barcode may be stored under. UPC-A,
+// EAN-13 (including JAN), EAN-8, and GTIN-14 all name the same product once
+// padded to 14 digits, so a UPC-A is the EAN-13 with a leading zero, and
+// snapshots hold UPCs as 12, 13, or 14 digits. Spaces and hyphens are
+// dropped, and codes missing leading zeros are accepted. It returns
+// ErrInvalidBarcode for anything but 8 to 14 digits ending in a matching
+// check digit.
+func barcodeForms(code string) ([]string, error) {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(code)
+	if len(digits) < minBarcodeLength || len(digits) > gtinLength || strings.Trim(digits, "0123456789") != "" {
+		return nil, fmt.Errorf("%q: %w: want 8 to 14 digits", code, ErrInvalidBarcode)
+	}
+	gtin := strings.Repeat("0", gtinLength-len(digits)) + digits
+	if want := checkDigit(gtin[:gtinLength-1]); gtin[gtinLength-1] != want {
+		return nil, fmt.Errorf("%q: %w: check digit should be %c", code, ErrInvalidBarcode, want)
+	}
+
+	// No product has an all-zero code, and nothing shorter than an EAN-8
+	// is stored
+	short := strings.TrimLeft(gtin, "0")
+	if short == "" {
+		return nil, fmt.Errorf("%q: %w: all zeros", code, ErrInvalidBarcode)
+	}
+	forms := make([]string, 0, gtinLength-minBarcodeLength+1)
+	for n := max(len(short), minBarcodeLength); n <= gtinLength; n++ {
+		forms = append(forms, gtin[gtinLength-n:])
+	}
+	return forms, nil
+}
+
+// checkDigit computes the GTIN check digit of body, whose digits are
+// weighted 3 and 1 alternately from the right
+func checkDigit(body string) byte {
+	sum := 0
+	for i := range len(body) {
+		d := int(body[len(body)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
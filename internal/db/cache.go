@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"metadata-api/internal/models"
+)
+
+// artistCacheKey includes the dataset version so entries from a previous
+// snapshot are never served after the underlying files change
+type artistCacheKey struct {
+	version string
+	rowid   int64
+}
+
+// EnableArtistCache keeps up to size fully assembled artists (with genres
+// and images) across requests. Popular artists appear in a large fraction
+// of batch lookups, so this skips most of their sub-queries.
+func (d *DB) EnableArtistCache(size int) error {
+	if d.shards != nil {
+		return d.shards.each(func(_ int, s *DB) error { return s.EnableArtistCache(max(size/len(d.shards.dbs), 1)) })
+	}
+	cache, err := lru.New[artistCacheKey, models.Artist](size)
+	if err != nil {
+		return fmt.Errorf("artist cache: %w", err)
+	}
+	d.artistCache = cache
+	return nil
+}
+
+// PurgeCaches drops every cached object
+func (d *DB) PurgeCaches() {
+	if d.shards != nil {
+		d.shards.each(func(_ int, s *DB) error { s.PurgeCaches(); return nil })
+		return
+	}
+	if d.artistCache != nil {
+		d.artistCache.Purge()
+	}
+}
+
+// DatasetVersion identifies the snapshot currently being served
+func (d *DB) DatasetVersion() string {
+	return d.version
+}
+
+// datasetVersion derives a version string from the main database file's
+// size and modification time
+func datasetVersion(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%x-%x", info.ModTime().Unix(), info.Size())
+}
+
+func (d *DB) cachedArtist(ctx context.Context, rowid int64) (models.Artist, bool) {
+	if d.artistCache == nil {
+		traceCache(ctx, false)
+		return models.Artist{}, false
+	}
+	a, ok := d.artistCache.Get(artistCacheKey{version: d.version, rowid: rowid})
+	traceCache(ctx, ok)
+	return a, ok
+}
+
+func (d *DB) cacheArtist(rowid int64, a models.Artist) {
+	if d.artistCache != nil {
+		d.artistCache.Add(artistCacheKey{version: d.version, rowid: rowid}, a)
+	}
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// ArtistTracks returns tracks credited to the artist, most popular first.
+// A non-empty query restricts the results to track names containing it;
+// filtering through track_artists first keeps the scan to one catalog
+// instead of the whole tracks table.
+func (d *DB) ArtistTracks(ctx context.Context, id, query string, limit, offset int) ([]models.Track, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) ([]models.Track, error) { return s.ArtistTracks(ctx, id, query, limit, offset) })
+	}
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rowid, err := d.rowID(ctx, "artist", id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
+		       t.track_number, t.disc_number, t.popularity, t.preview_url,
+		       a.id, a.name, a.album_type, a.label, a.release_date, a.release_date_precision,
+		       a.external_id_upc, a.total_tracks, a.copyright_c, a.copyright_p, a.rowid
+		FROM track_artists ta
+		JOIN tracks t ON t.rowid = ta.track_rowid
+		JOIN albums a ON t.album_rowid = a.rowid
+		WHERE ta.artist_rowid = ? AND (? = '' OR t.name LIKE ? COLLATE NOCASE)
+		ORDER BY t.popularity DESC, t.rowid
+		LIMIT ? OFFSET ?
+	`, rowid, query, "%"+query+"%", limit, offset)
+	if err != nil {
+		return nil, queryError(ctx, "artist tracks", err)
+	}
+	defer rows.Close()
+
+	tracks := []models.Track{}
+	for rows.Next() {
+		t, err := d.scanTrackWithAlbum(ctx, rows)
+		if err != nil {
+			return nil, queryError(ctx, "artist tracks", err)
+		}
+		tracks = append(tracks, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "artist tracks", err)
+	}
+	d.attachTrackMarkets(ctx, tracks)
+	return tracks, nil
+}
+
+// rowID resolves the catalog ID of a track, album, or artist to its rowid
+func (d *DB) rowID(ctx context.Context, kind, id string) (int64, error) {
+	if err := CheckID(id); err != nil {
+		return 0, err
+	}
+
+	var rowid int64
+	err := d.main.QueryRowContext(ctx, `SELECT rowid FROM `+kind+`s WHERE id = ?`, id).Scan(&rowid)
+	if err == sql.ErrNoRows {
+		return 0, notFound(kind, id)
+	}
+	if err != nil {
+		return 0, queryError(ctx, "resolve "+kind, err)
+	}
+	return rowid, nil
+}
+
+// BatchAlbumTracks returns the tracks of each album, keyed by album ID, in
+// the same shape as GetAlbumTracks. Artists and track_files data are fetched
+// once for all albums instead of per track. Unknown albums are absent from
+// the result; known albums without tracks map to an empty list.
+func (d *DB) BatchAlbumTracks(ctx context.Context, albumIDs []string) (map[string][]models.Track, error) {
+	if d.shards != nil {
+		return batch(d.shards, albumIDs, func(s *DB, ids []string) (map[string][]models.Track, error) { return s.BatchAlbumTracks(ctx, ids) })
+	}
+	result := make(map[string][]models.Track)
+	if len(albumIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := make([]string, len(albumIDs))
+	args := make([]any, len(albumIDs))
+	for i, id := range albumIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	// 1. Resolve album IDs to rowids
+	rows, err := d.main.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, rowid FROM albums WHERE id IN (%s)
+	`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, queryError(ctx, "batch album tracks", err)
+	}
+	albumIDByRowID := make(map[int64]string)
+	for rows.Next() {
+		var id string
+		var rowid int64
+		if err := rows.Scan(&id, &rowid); err != nil {
+			rows.Close()
+			return nil, queryError(ctx, "scan album", err)
+		}
+		albumIDByRowID[rowid] = id
+		result[id] = []models.Track{}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "batch album tracks", err)
+	}
+	if len(albumIDByRowID) == 0 {
+		return result, nil
+	}
+
+	// 2. Fetch every track of those albums in one query
+	placeholders = placeholders[:0]
+	args = args[:0]
+	for rowid := range albumIDByRowID {
+		placeholders = append(placeholders, "?")
+		args = append(args, rowid)
+	}
+	rows, err = d.main.QueryContext(ctx, fmt.Sprintf(`
+		SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
+		       t.track_number, t.disc_number, t.popularity, t.preview_url, t.album_rowid
+		FROM tracks t
+		WHERE t.album_rowid IN (%s)
+		ORDER BY t.album_rowid, t.disc_number, t.track_number
+	`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, queryError(ctx, "batch album tracks", err)
+	}
+	defer rows.Close()
+
+	type albumTrack struct {
+		track      models.Track
+		albumRowID int64
+	}
+	var tracks []albumTrack
+	var trackIDs []string
+	for rows.Next() {
+		var ts trackScan
+		var albumRowID int64
+		if err := rows.Scan(scanArgs(ts.dest(), []any{&albumRowID})...); err != nil {
+			return nil, queryError(ctx, "scan track", err)
+		}
+		t := ts.track(&d.nulls)
+		tracks = append(tracks, albumTrack{track: t, albumRowID: albumRowID})
+		trackIDs = append(trackIDs, t.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 3. Batch fetch track artists with their genres and images
+	trackArtists, artistRowIDs, err := d.batchGetTrackArtists(ctx, trackIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get track artists", "err", err)
+	}
+	assemble := d.artistAssembler(ctx, artistRowIDs)
+
+	// 4. Batch fetch track_files enrichment
+	trackFilesData, err := d.batchEnrichTrackFiles(ctx, trackIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch enrich track files", "err", err)
+	}
+
+	for _, at := range tracks {
+		t := at.track
+		if artists, ok := trackArtists[t.ID]; ok {
+			t.Artists = assemble(artists)
+		}
+		if tf, ok := trackFilesData[t.ID]; ok {
+			t.HasLyrics = tf.HasLyrics
+			t.OriginalTitle = tf.OriginalTitle
+			t.VersionTitle = tf.VersionTitle
+			t.Languages = tf.Languages
+			t.ArtistRoles = models.NewArtistRoles(tf.ArtistRoles, t.Artists)
+		}
+		albumID := albumIDByRowID[at.albumRowID]
+		result[albumID] = append(result[albumID], t)
+	}
+	for _, tracks := range result {
+		d.attachTrackMarkets(ctx, tracks)
+	}
+	return result, nil
+}
+
+// TrackArtists returns the full artists credited on a track
+func (d *DB) TrackArtists(ctx context.Context, id string) ([]models.Artist, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) ([]models.Artist, error) { return s.TrackArtists(ctx, id) })
+	}
+	if _, err := d.rowID(ctx, "track", id); err != nil {
+		return nil, err
+	}
+
+	artists, err := d.getTrackArtists(ctx, id)
+	if err != nil {
+		return nil, queryError(ctx, "track artists", err)
+	}
+	if artists == nil {
+		artists = []models.Artist{}
+	}
+	return artists, nil
+}
+
+// AlbumArtists returns the full album artists in credit order
+func (d *DB) AlbumArtists(ctx context.Context, id string) ([]models.Artist, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) ([]models.Artist, error) { return s.AlbumArtists(ctx, id) })
+	}
+	rowid, err := d.rowID(ctx, "album", id)
+	if err != nil {
+		return nil, err
+	}
+
+	artists, err := d.getAlbumArtists(ctx, rowid)
+	if err != nil {
+		return nil, queryError(ctx, "album artists", err)
+	}
+	if artists == nil {
+		artists = []models.Artist{}
+	}
+	return artists, nil
+}
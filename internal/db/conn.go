@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+
+	"metadata-api/internal/logging"
+)
+
+// conn wraps a database handle so every query carries a /* req:<id> */
+// comment with the originating request ID. Slow-query logs and SQLite
+// tracing can then be correlated back to HTTP requests. At debug level
+// every statement is logged with its duration.
+type conn struct {
+	*sql.DB
+	name string // which database, for logs
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := c.DB.QueryContext(ctx, annotate(ctx, query), args...)
+	c.logQuery(ctx, start, query, args, err)
+	return rows, err
+}
+
+func (c *conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := c.DB.QueryRowContext(ctx, annotate(ctx, query), args...)
+	c.logQuery(ctx, start, query, args, row.Err())
+	return row
+}
+
+// maxLoggedArgs keeps batch lookups with thousands of IDs readable
+const maxLoggedArgs = 10
+
+// logQuery logs a statement at debug level. The duration runs until the
+// first row is ready; reading the rest isn't included.
+func (c *conn) logQuery(ctx context.Context, start time.Time, query string, args []any, err error) {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []any{
+		"db", c.name,
+		"query", strings.Join(strings.Fields(query), " "),
+		"args", args[:min(len(args), maxLoggedArgs)],
+		"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if len(args) > maxLoggedArgs {
+		attrs = append(attrs, "args_total", len(args))
+	}
+	if err != nil {
+		attrs = append(attrs, "err", err)
+	}
+	slog.DebugContext(ctx, "sql", attrs...)
+}
+
+// annotate prefixes query with the request ID from ctx. IDs may come from
+// client headers, so anything outside a conservative charset is dropped
+// rather than risk terminating the comment.
+func annotate(ctx context.Context, query string) string {
+	id := logging.RequestID(ctx)
+	if id == "" || !safeCommentID(id) {
+		return query
+	}
+	return "/* req:" + id + " */ " + query
+}
+
+func safeCommentID(id string) bool {
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
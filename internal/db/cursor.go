@@ -0,0 +1,224 @@
+package db
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidCursor means a search cursor was not produced by this
+	// server or belongs to a different sort order
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort means a search was asked to sort by an unknown field
+	ErrInvalidSort = errors.New("invalid sort")
+	// ErrInvalidQuery means a search query uses a qualifier the search
+	// doesn't support or a malformed year
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// sortCandidates caps how many index matches are re-sorted when a search
+// served from the FTS sidecar is ordered by anything but its rank column
+const sortCandidates = 2000
+
+// SearchSort orders search results, descending unless Asc is set. An empty
+// Field is the default order: popularity for tracks and followers for
+// artists.
+type SearchSort struct {
+	Field string
+	Asc   bool
+}
+
+// SearchCursor marks the last result of a search page. Results are ordered
+// by the sort key and then rowid, so the next page is everything strictly
+// after this pair and can be found without re-reading the earlier pages.
+type SearchCursor struct {
+	Sort   string `json:"s"`
+	Asc    bool   `json:"a,omitempty"`
+	Key    string `json:"k"`
+	RowID  int64  `json:"r"`
+	Offset int    `json:"o,omitempty"` // results before the page the cursor starts
+}
+
+// Position is how many results precede the page c starts, 0 for the first
+// page (a nil c)
+func (c *SearchCursor) Position() int {
+	if c == nil {
+		return 0
+	}
+	return c.Offset
+}
+
+// SearchLimit is the page size a search asked for limit returns
+func SearchLimit(limit int) int {
+	if limit <= 0 || limit > 50 {
+		return 20
+	}
+	return limit
+}
+
+// String encodes the cursor as an opaque URL-safe token
+func (c SearchCursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseSearchCursor decodes a token returned by SearchCursor.String
+func ParseSearchCursor(token string) (*SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c SearchCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// sortKey is a column results can be ordered by. NULLs are mapped to a
+// sentinel so keyset comparisons work.
+type sortKey struct {
+	expr    string
+	numeric bool
+}
+
+// searchSpec names the columns a search ranks and filters on, in the FTS
+// sidecar and in the main database
+type searchSpec struct {
+	kind    string // track or artist
+	fts     string // FTS5 table in the sidecar
+	ftsRank string // rank column in the FTS table, matching the default sort
+	column  string // name column in the main query
+	rank    string // main query column of the default sort
+	sorts   map[string]sortKey
+	fields  map[string]string // query qualifiers to the fields they match
+}
+
+var (
+	artistSearch = searchSpec{
+		kind: "artist", fts: "artists_fts", ftsRank: "followers", column: "name", rank: "followers",
+		sorts: map[string]sortKey{
+			"followers":  {`COALESCE(followers_total, -1)`, true},
+			"popularity": {`COALESCE(popularity, -1)`, true},
+			"name":       {`COALESCE(name, '') COLLATE NOCASE`, false},
+		},
+		fields: map[string]string{"name": "name", "artist": "name"},
+	}
+	trackSearch = searchSpec{
+		kind: "track", fts: "tracks_fts", ftsRank: "popularity", column: "t.name", rank: "popularity",
+		sorts: map[string]sortKey{
+			"popularity":   {`COALESCE(t.popularity, -1)`, true},
+			"name":         {`COALESCE(t.name, '') COLLATE NOCASE`, false},
+			"release_date": {`COALESCE(a.release_date, '')`, false},
+			"duration":     {`COALESCE(t.duration_ms, -1)`, true},
+		},
+		fields: map[string]string{"name": "name", "track": "name", "artist": "artist", "album": "album", "year": "year"},
+	}
+)
+
+// SortFields returns the fields track or artist search can be sorted by
+func SortFields(kind string) []string {
+	spec := trackSearch
+	if kind == "artist" {
+		spec = artistSearch
+	}
+	fields := make([]string, 0, len(spec.sorts))
+	for f := range spec.sorts {
+		fields = append(fields, f)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// rowid returns the rowid column matching s.column's table alias
+func (s searchSpec) rowid() string {
+	if i := strings.IndexByte(s.column, '.'); i >= 0 {
+		return s.column[:i+1] + "rowid"
+	}
+	return "rowid"
+}
+
+// resolve fills in the default sort and checks the field and cursor
+func (s searchSpec) resolve(sort SearchSort, c *SearchCursor) (SearchSort, sortKey, error) {
+	if sort.Field == "" {
+		sort.Field = s.rank
+	}
+	key, ok := s.sorts[sort.Field]
+	if !ok {
+		return sort, key, fmt.Errorf("%w: %q", ErrInvalidSort, sort.Field)
+	}
+	if c != nil && (c.Sort != sort.Field || c.Asc != sort.Asc) {
+		return sort, key, ErrInvalidCursor
+	}
+	return sort, key, nil
+}
+
+// orderBy is the ORDER BY clause cursors depend on
+func (s searchSpec) orderBy(sort SearchSort, key sortKey) string {
+	dir := ` DESC`
+	if sort.Asc {
+		dir = ` ASC`
+	}
+	return key.expr + dir + `, ` + s.rowid() + dir
+}
+
+// nextCursor returns the cursor for the page after c whose results are at
+// marks, or nil when the page was short and the results are exhausted
+func nextCursor(c *SearchCursor, marks []SearchCursor, limit int) *SearchCursor {
+	if len(marks) < limit {
+		return nil
+	}
+	next := &marks[len(marks)-1]
+	next.Offset = c.Position() + len(marks)
+	return next
+}
+
+// compare orders two cursor keys of k the way SQLite orders its expression
+func (k sortKey) compare(a, b string) int {
+	if k.numeric {
+		x, _ := strconv.ParseInt(a, 10, 64)
+		y, _ := strconv.ParseInt(b, 10, 64)
+		return cmp.Compare(x, y)
+	}
+	if strings.HasSuffix(k.expr, "COLLATE NOCASE") {
+		// NOCASE only folds ASCII letters
+		return strings.Compare(asciiLower(a), asciiLower(b))
+	}
+	return strings.Compare(a, b)
+}
+
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// after returns a condition selecting rows ordered after c, or "" for the
+// first page
+func after(expr, rowid string, numeric, asc bool, c *SearchCursor) (string, []any, error) {
+	if c == nil {
+		return "", nil, nil
+	}
+	var v any = c.Key
+	if numeric {
+		n, err := strconv.ParseInt(c.Key, 10, 64)
+		if err != nil {
+			return "", nil, ErrInvalidCursor
+		}
+		v = n
+	}
+	cmp := ` < `
+	if asc {
+		cmp = ` > `
+	}
+	return ` AND (` + expr + cmp + `? OR (` + expr + ` = ? AND ` + rowid + cmp + `?))`, []any{v, v, c.RowID}, nil
+}
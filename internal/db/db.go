@@ -4,10 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
 
 	"metadata-api/internal/models"
 
@@ -15,11 +23,36 @@ import (
 )
 
 type DB struct {
-	main       *sql.DB
-	trackFiles *sql.DB
+	shards *shardSet // non-nil when opened on a directory of shards
+
+	main       *conn
+	trackFiles *conn
+	search     *conn // nil unless a current search_index.sqlite3 sidecar exists
+	mbids      *conn // main, the musicbrainz.sqlite3 sidecar, or nil
+
+	mainPath       string
+	trackFilesPath string
+
+	hasAudioFeatures bool
+	hasLyrics        bool
+	hasAlbumMarkets  bool
+	hasTrackMarkets  bool
+	hasAlbumGenres   bool
+
+	hot atomic.Pointer[hotTables] // nil until LoadHotTables completes
+
+	version     string
+	stats       statsCache
+	nulls       nullCounts
+	artistCache *lru.Cache[artistCacheKey, models.Artist] // nil unless EnableArtistCache was called
+	imageURL    func(string) string                       // nil unless SetImageURLRewriter was called
 }
 
 func Open(dbPath string) (*DB, error) {
+	if info, err := os.Stat(dbPath); err == nil && info.IsDir() {
+		return openShards(dbPath)
+	}
+
 	// Conservative PRAGMAs for NAS: 64MB cache, 1GB mmap
 	pragmas := "?mode=ro&_journal_mode=off&_cache_size=-65536&_mmap_size=1073741824&_query_only=true"
 
@@ -38,15 +71,102 @@ func Open(dbPath string) (*DB, error) {
 	}
 	trackFiles.SetMaxOpenConns(8)
 
-	return &DB{main: main, trackFiles: trackFiles}, nil
+	d := &DB{
+		main:           &conn{main, "main"},
+		trackFiles:     &conn{trackFiles, "track_files"},
+		mainPath:       dbPath,
+		trackFilesPath: trackFilesPath,
+		version:        datasetVersion(dbPath),
+	}
+
+	// Optional tables vary between snapshots
+	d.hasAudioFeatures, err = tableExists(context.Background(), main, "audio_features")
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("inspect main db: %w", err)
+	}
+	for table, has := range map[string]*bool{
+		albumMarketsTable: &d.hasAlbumMarkets,
+		trackMarketsTable: &d.hasTrackMarkets,
+		albumGenresTable:  &d.hasAlbumGenres,
+	} {
+		*has, err = tableExists(context.Background(), main, table)
+		if err != nil {
+			d.Close()
+			return nil, fmt.Errorf("inspect main db: %w", err)
+		}
+	}
+	d.hasLyrics, err = tableExists(context.Background(), trackFiles, "lyrics")
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("inspect track_files db: %w", err)
+	}
+
+	if err := d.validateSchema(context.Background()); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	if err := d.openSearchIndex(context.Background(), pragmas); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	if err := d.openMusicBrainz(context.Background(), pragmas); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
 }
 
 func (d *DB) Close() error {
+	if d.shards != nil {
+		return d.shards.close()
+	}
+	if d.search != nil {
+		d.search.Close()
+	}
+	if d.mbids != nil && d.mbids != d.main {
+		d.mbids.Close()
+	}
 	d.trackFiles.Close()
 	return d.main.Close()
 }
 
+// LookupISRC returns every track with the ISRC, most popular first. An
+// unknown ISRC yields an empty list rather than ErrNotFound.
 func (d *DB) LookupISRC(ctx context.Context, isrc string) ([]models.Track, error) {
+	return d.lookupISRC(ctx, isrc, "", -1)
+}
+
+// BestISRC returns the most popular track with the ISRC, preferring one
+// available in market when market is set and the snapshot has market data.
+// It returns ErrNotFound when no track matches.
+func (d *DB) BestISRC(ctx context.Context, isrc, market string) (*models.Track, error) {
+	tracks, err := d.lookupISRC(ctx, isrc, market, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, notFound("isrc", isrc)
+	}
+	return &tracks[0], nil
+}
+
+// lookupISRC returns up to limit tracks with the ISRC (all when negative),
+// ranking those available in market first
+func (d *DB) lookupISRC(ctx context.Context, isrc, market string, limit int) ([]models.Track, error) {
+	if d.shards != nil {
+		return d.shards.lookupISRC(ctx, isrc, market, limit)
+	}
+
+	order := `t.popularity DESC`
+	args := []any{isrc}
+	if market != "" && d.HasMarkets() {
+		order = d.marketPredicate("t", "a") + ` DESC, ` + order
+		args = append(args, market)
+	}
 	rows, err := d.main.QueryContext(ctx, `
 		SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
 		       t.track_number, t.disc_number, t.popularity, t.preview_url,
@@ -55,25 +175,39 @@ func (d *DB) LookupISRC(ctx context.Context, isrc string) ([]models.Track, error
 		FROM tracks t
 		JOIN albums a ON t.album_rowid = a.rowid
 		WHERE t.external_id_isrc = ?
-		ORDER BY t.popularity DESC
-	`, isrc)
+		ORDER BY `+order+`
+		LIMIT ?
+	`, append(args, limit)...)
 	if err != nil {
-		return nil, fmt.Errorf("query isrc: %w", err)
+		return nil, queryError(ctx, "lookup isrc", err)
 	}
 	defer rows.Close()
 
-	var tracks []models.Track
+	tracks := []models.Track{}
 	for rows.Next() {
 		t, err := d.scanTrackWithAlbum(ctx, rows)
 		if err != nil {
-			return nil, err
+			return nil, queryError(ctx, "lookup isrc", err)
 		}
 		tracks = append(tracks, *t)
 	}
-	return tracks, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "lookup isrc", err)
+	}
+
+	d.attachTrackMBIDs(ctx, tracks)
+	d.attachTrackMarkets(ctx, tracks)
+	return tracks, nil
 }
 
 func (d *DB) LookupTrack(ctx context.Context, id string) (*models.Track, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) (*models.Track, error) { return s.LookupTrack(ctx, id) })
+	}
+	if err := CheckID(id); err != nil {
+		return nil, err
+	}
+
 	rows, err := d.main.QueryContext(ctx, `
 		SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
 		       t.track_number, t.disc_number, t.popularity, t.preview_url,
@@ -84,49 +218,55 @@ func (d *DB) LookupTrack(ctx context.Context, id string) (*models.Track, error)
 		WHERE t.id = ?
 	`, id)
 	if err != nil {
-		return nil, fmt.Errorf("query track: %w", err)
+		return nil, queryError(ctx, "lookup track", err)
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
-		return nil, nil
+		if err := rows.Err(); err != nil {
+			return nil, queryError(ctx, "lookup track", err)
+		}
+		return nil, notFound("track", id)
+	}
+	t, err := d.scanTrackWithAlbum(ctx, rows)
+	if err != nil {
+		return nil, queryError(ctx, "lookup track", err)
 	}
-	return d.scanTrackWithAlbum(ctx, rows)
+
+	refs := mbidRefs{}
+	refs.track(t)
+	d.attachMBIDs(ctx, refs)
+	markets := newMarketRefs()
+	markets.track(t)
+	d.attachMarkets(ctx, markets)
+	return t, nil
 }
 
-func (d *DB) scanTrackWithAlbum(ctx context.Context, rows *sql.Rows) (*models.Track, error) {
-	var t models.Track
-	var alb models.Album
-	var isrcNull, upcNull, copyCNull, copyPNull, previewNull sql.NullString
+// scanTrackWithAlbum scans a track joined with its album; extra receives
+// any columns selected after the album rowid
+func (d *DB) scanTrackWithAlbum(ctx context.Context, rows *sql.Rows, extra ...any) (*models.Track, error) {
+	var ts trackScan
+	var as albumScan
 	var albumRowID int64
 
-	err := rows.Scan(
-		&t.ID, &t.Name, &isrcNull, &t.DurationMs, &t.Explicit,
-		&t.TrackNum, &t.DiscNum, &t.Popularity, &previewNull,
-		&alb.ID, &alb.Name, &alb.Type, &alb.Label, &alb.ReleaseDate, &alb.ReleaseDatePrecision,
-		&upcNull, &alb.TotalTracks, &copyCNull, &copyPNull, &albumRowID,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("scan track: %w", err)
+	if err := rows.Scan(scanArgs(ts.dest(), as.dest(), []any{&albumRowID}, extra)...); err != nil {
+		return nil, queryError(ctx, "scan track", err)
 	}
 
-	t.ISRC = isrcNull.String
-	t.PreviewURL = previewNull.String
-	alb.UPC = upcNull.String
-	alb.CopyrightC = copyCNull.String
-	alb.CopyrightP = copyPNull.String
+	t := ts.track(&d.nulls)
+	alb := as.album(&d.nulls)
 
 	albumImages, err := d.getAlbumImages(ctx, albumRowID)
 	if err != nil {
-		slog.Error("get album images", "err", err, "rowid", albumRowID)
+		slog.ErrorContext(ctx, "get album images", "err", err, "rowid", albumRowID)
 	}
 	alb.Images = albumImages
 
 	albumArtists, err := d.getAlbumArtists(ctx, albumRowID)
 	if err != nil {
-		slog.Error("get album artists", "err", err, "rowid", albumRowID)
+		slog.ErrorContext(ctx, "get album artists", "err", err, "rowid", albumRowID)
 	}
-	alb.Artists = albumArtists
+	alb.SetArtists(albumArtists)
 
 	t.Album = &alb
 
@@ -162,89 +302,136 @@ func (d *DB) enrichTrackFromFiles(ctx context.Context, t *models.Track) {
 		json.Unmarshal([]byte(langJSON.String), &t.Languages)
 	}
 	if rolesJSON.String != "" {
-		json.Unmarshal([]byte(rolesJSON.String), &t.ArtistRoles)
+		var roles []string
+		json.Unmarshal([]byte(rolesJSON.String), &roles)
+		t.ArtistRoles = models.NewArtistRoles(roles, t.Artists)
 	}
 }
 
 func (d *DB) LookupArtist(ctx context.Context, id string) (*models.Artist, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) (*models.Artist, error) { return s.LookupArtist(ctx, id) })
+	}
+	if err := CheckID(id); err != nil {
+		return nil, err
+	}
+
+	if hot := d.hot.Load(); hot != nil {
+		rowid, ok := hot.artistRowIDs[id]
+		if !ok {
+			return nil, notFound("artist", id)
+		}
+		a, _ := hot.artist(rowid)
+		traceCache(ctx, true)
+		d.attachMBIDs(ctx, mbidRefs{"artist": {a.ID: {&a.MBID}}})
+		return &a, nil
+	}
+
 	row := d.main.QueryRowContext(ctx, `
 		SELECT id, name, followers_total, popularity, rowid FROM artists WHERE id = ?
 	`, id)
 
-	var a models.Artist
+	var as artistScan
 	var rowid int64
-	err := row.Scan(&a.ID, &a.Name, &a.Followers, &a.Popularity, &rowid)
+	err := row.Scan(scanArgs(as.dest(), []any{&rowid})...)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, notFound("artist", id)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("scan artist: %w", err)
+		return nil, queryError(ctx, "lookup artist", err)
 	}
 
+	a := as.artist(&d.nulls)
+	traceCache(ctx, false)
+
 	a.Genres, _ = d.getArtistGenres(ctx, rowid)
 	images, err := d.getArtistImages(ctx, rowid)
 	if err != nil {
-		slog.Error("get artist images", "err", err, "rowid", rowid)
+		slog.ErrorContext(ctx, "get artist images", "err", err, "rowid", rowid)
 	}
 	a.Images = images
 
+	d.attachMBIDs(ctx, mbidRefs{"artist": {a.ID: {&a.MBID}}})
 	return &a, nil
 }
 
 func (d *DB) LookupAlbum(ctx context.Context, id string) (*models.Album, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) (*models.Album, error) { return s.LookupAlbum(ctx, id) })
+	}
+	if err := CheckID(id); err != nil {
+		return nil, err
+	}
+
 	row := d.main.QueryRowContext(ctx, `
 		SELECT id, name, album_type, label, release_date, release_date_precision,
 		       external_id_upc, total_tracks, copyright_c, copyright_p, rowid
 		FROM albums WHERE id = ?
 	`, id)
 
-	var a models.Album
-	var upcNull, copyCNull, copyPNull sql.NullString
+	var as albumScan
 	var rowid int64
 
-	err := row.Scan(&a.ID, &a.Name, &a.Type, &a.Label, &a.ReleaseDate, &a.ReleaseDatePrecision,
-		&upcNull, &a.TotalTracks, &copyCNull, &copyPNull, &rowid)
+	err := row.Scan(scanArgs(as.dest(), []any{&rowid})...)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, notFound("album", id)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("scan album: %w", err)
+		return nil, queryError(ctx, "lookup album", err)
 	}
 
-	a.UPC = upcNull.String
-	a.CopyrightC = copyCNull.String
-	a.CopyrightP = copyPNull.String
+	a := as.album(&d.nulls)
 	a.Images, _ = d.getAlbumImages(ctx, rowid)
-	a.Artists, _ = d.getAlbumArtists(ctx, rowid)
+	artists, _ := d.getAlbumArtists(ctx, rowid)
+	a.SetArtists(artists)
+	a.Languages, err = d.albumLanguages(ctx, rowid)
+	if err != nil {
+		slog.ErrorContext(ctx, "album languages", "err", err, "rowid", rowid)
+	}
+	genres, err := d.batchGetAlbumGenres(ctx, map[int64]bool{rowid: true})
+	if err != nil {
+		slog.ErrorContext(ctx, "album genres", "err", err, "rowid", rowid)
+	}
+	a.Genres = genres[rowid]
 
+	refs := mbidRefs{}
+	refs.album(&a)
+	d.attachMBIDs(ctx, refs)
+	markets := newMarketRefs()
+	markets.album(&a)
+	d.attachMarkets(ctx, markets)
 	return &a, nil
 }
 
+// GetAlbumTracks returns an album's tracks in disc and track order
 func (d *DB) GetAlbumTracks(ctx context.Context, albumID string) ([]models.Track, error) {
+	if d.shards != nil {
+		return route(d.shards, albumID, func(s *DB) ([]models.Track, error) { return s.GetAlbumTracks(ctx, albumID) })
+	}
+	albumRowID, err := d.rowID(ctx, "album", albumID)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := d.main.QueryContext(ctx, `
-		SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
-		       t.track_number, t.disc_number, t.popularity, t.preview_url
-		FROM tracks t
-		JOIN albums a ON t.album_rowid = a.rowid
-		WHERE a.id = ?
-		ORDER BY t.disc_number, t.track_number
-	`, albumID)
+		SELECT id, name, external_id_isrc, duration_ms, explicit,
+		       track_number, disc_number, popularity, preview_url
+		FROM tracks
+		WHERE album_rowid = ?
+		ORDER BY disc_number, track_number
+	`, albumRowID)
 	if err != nil {
-		return nil, fmt.Errorf("get album tracks: %w", err)
+		return nil, queryError(ctx, "get album tracks", err)
 	}
 	defer rows.Close()
 
-	var tracks []models.Track
+	tracks := []models.Track{}
 	for rows.Next() {
-		var t models.Track
-		var isrcNull, previewNull sql.NullString
-		err := rows.Scan(&t.ID, &t.Name, &isrcNull, &t.DurationMs, &t.Explicit,
-			&t.TrackNum, &t.DiscNum, &t.Popularity, &previewNull)
-		if err != nil {
-			return nil, fmt.Errorf("scan track: %w", err)
+		var ts trackScan
+		if err := rows.Scan(ts.dest()...); err != nil {
+			return nil, queryError(ctx, "scan track", err)
 		}
-		t.ISRC = isrcNull.String
-		t.PreviewURL = previewNull.String
+		t := ts.track(&d.nulls)
 
 		artists, _ := d.getTrackArtists(ctx, t.ID)
 		t.Artists = artists
@@ -253,71 +440,225 @@ func (d *DB) GetAlbumTracks(ctx context.Context, albumID string) ([]models.Track
 
 		tracks = append(tracks, t)
 	}
-	return tracks, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "get album tracks", err)
+	}
+
+	d.attachTrackMBIDs(ctx, tracks)
+	d.attachTrackMarkets(ctx, tracks)
+	return tracks, nil
 }
 
 func (d *DB) SearchArtist(ctx context.Context, query string, limit int) ([]models.Artist, error) {
-	if limit <= 0 || limit > 50 {
-		limit = 20
+	artists, _, err := d.SearchArtistPage(ctx, query, limit, SearchSort{}, nil)
+	return artists, err
+}
+
+// SearchArtistPage returns the page of artist search results in the given
+// order after c (the first page when c is nil) and the cursor for the next
+// page, which is nil once the results are exhausted
+func (d *DB) SearchArtistPage(ctx context.Context, query string, limit int, sort SearchSort, c *SearchCursor) ([]models.Artist, *SearchCursor, error) {
+	limit = SearchLimit(limit)
+	if d.shards != nil {
+		return d.shards.searchArtistPage(ctx, query, limit, sort, c)
+	}
+	artists, marks, err := d.searchArtists(ctx, query, limit, sort, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return artists, nextCursor(c, marks, limit), nil
+}
+
+// searchArtists returns a page of artist search results and, for each, the
+// cursor marking its position in the sort order
+func (d *DB) searchArtists(ctx context.Context, query string, limit int, sort SearchSort, c *SearchCursor) ([]models.Artist, []SearchCursor, error) {
+	sort, key, err := artistSearch.resolve(sort, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	q, err := artistSearch.parse(query)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Use case-insensitive substring search with LIMIT for safety
+	where, args, err := d.searchFilter(ctx, artistSearch, q, limit, sort, c)
+	if err != nil {
+		return nil, nil, queryError(ctx, "search artist", err)
+	}
 	rows, err := d.main.QueryContext(ctx, `
-		SELECT id, name, followers_total, popularity, rowid FROM artists
-		WHERE name LIKE ? COLLATE NOCASE
-		ORDER BY followers_total DESC
+		SELECT id, name, followers_total, popularity, rowid, `+key.expr+` FROM artists
+		WHERE `+where+`
+		ORDER BY `+artistSearch.orderBy(sort, key)+`
 		LIMIT ?
-	`, "%"+query+"%", limit)
+	`, append(args, limit)...)
 	if err != nil {
-		return nil, fmt.Errorf("search artist: %w", err)
+		return nil, nil, queryError(ctx, "search artist", err)
 	}
 	defer rows.Close()
 
 	var artists []models.Artist
+	var marks []SearchCursor
 	for rows.Next() {
-		var a models.Artist
-		var rowid int64
-		if err := rows.Scan(&a.ID, &a.Name, &a.Followers, &a.Popularity, &rowid); err != nil {
-			return nil, fmt.Errorf("scan artist: %w", err)
+		var as artistScan
+		mark := SearchCursor{Sort: sort.Field, Asc: sort.Asc}
+		if err := rows.Scan(scanArgs(as.dest(), []any{&mark.RowID, &mark.Key})...); err != nil {
+			return nil, nil, queryError(ctx, "scan artist", err)
 		}
-		a.Genres, _ = d.getArtistGenres(ctx, rowid)
-		a.Images, _ = d.getArtistImages(ctx, rowid)
+		a := as.artist(&d.nulls)
+		a.Genres, _ = d.getArtistGenres(ctx, mark.RowID)
+		a.Images, _ = d.getArtistImages(ctx, mark.RowID)
 		artists = append(artists, a)
+		marks = append(marks, mark)
 	}
-	return artists, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, nil, queryError(ctx, "search artist", err)
+	}
+	return artists, marks, nil
 }
 
 func (d *DB) SearchTrack(ctx context.Context, query string, limit int) ([]models.Track, error) {
-	if limit <= 0 || limit > 50 {
-		limit = 20
+	tracks, _, err := d.SearchTrackPage(ctx, query, limit, SearchSort{}, TrackFilter{}, nil)
+	return tracks, err
+}
+
+// SearchTrackPage returns the page of track search results matching filter
+// in the given order after c (the first page when c is nil) and the cursor
+// for the next page, which is nil once the results are exhausted
+func (d *DB) SearchTrackPage(ctx context.Context, query string, limit int, sort SearchSort, filter TrackFilter, c *SearchCursor) ([]models.Track, *SearchCursor, error) {
+	limit = SearchLimit(limit)
+	if d.shards != nil {
+		return d.shards.searchTrackPage(ctx, query, limit, sort, filter, c)
+	}
+	tracks, marks, err := d.searchTracks(ctx, query, limit, sort, filter, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tracks, nextCursor(c, marks, limit), nil
+}
+
+// searchTracks returns a page of track search results and, for each, the
+// cursor marking its position in the sort order
+func (d *DB) searchTracks(ctx context.Context, query string, limit int, sort SearchSort, filter TrackFilter, c *SearchCursor) ([]models.Track, []SearchCursor, error) {
+	sort, key, err := trackSearch.resolve(sort, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	q, err := trackSearch.parse(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !d.HasMarkets() {
+		filter.Market = ""
+	}
+
+	// The index knows nothing about the filtered columns, so take enough
+	// candidates from it that a filtered page can still be filled
+	candidates := limit
+	if !filter.empty() {
+		candidates = sortCandidates
 	}
 
 	// Use case-insensitive substring search with LIMIT for safety
+	where, args, err := d.searchFilter(ctx, trackSearch, q, candidates, sort, c)
+	if err != nil {
+		return nil, nil, queryError(ctx, "search track", err)
+	}
+	filterWhere, filterArgs := filter.where(d.marketPredicate("t", "a"))
+	where += filterWhere
+	args = append(args, filterArgs...)
+	if filter.Language != "" {
+		ids, err := d.tracksInLanguage(ctx, where, args, trackSearch.orderBy(sort, key), candidates, limit, filter.Language)
+		if err != nil {
+			return nil, nil, queryError(ctx, "search track", err)
+		}
+		if len(ids) == 0 {
+			return nil, nil, nil
+		}
+		where += ` AND t.id IN (` + strings.Repeat("?,", len(ids)-1) + `?)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
 	rows, err := d.main.QueryContext(ctx, `
 		SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
 		       t.track_number, t.disc_number, t.popularity, t.preview_url,
 		       a.id, a.name, a.album_type, a.label, a.release_date, a.release_date_precision,
-		       a.external_id_upc, a.total_tracks, a.copyright_c, a.copyright_p, a.rowid
+		       a.external_id_upc, a.total_tracks, a.copyright_c, a.copyright_p, a.rowid,
+		       t.rowid, `+key.expr+`
 		FROM tracks t
 		JOIN albums a ON t.album_rowid = a.rowid
-		WHERE t.name LIKE ? COLLATE NOCASE
-		ORDER BY t.popularity DESC
+		WHERE `+where+`
+		ORDER BY `+trackSearch.orderBy(sort, key)+`
 		LIMIT ?
-	`, "%"+query+"%", limit)
+	`, append(args, limit)...)
 	if err != nil {
-		return nil, fmt.Errorf("search track: %w", err)
+		return nil, nil, queryError(ctx, "search track", err)
 	}
 	defer rows.Close()
 
 	var tracks []models.Track
+	var marks []SearchCursor
 	for rows.Next() {
-		t, err := d.scanTrackWithAlbum(ctx, rows)
+		mark := SearchCursor{Sort: sort.Field, Asc: sort.Asc}
+		t, err := d.scanTrackWithAlbum(ctx, rows, &mark.RowID, &mark.Key)
 		if err != nil {
-			return nil, err
+			return nil, nil, queryError(ctx, "search track", err)
 		}
 		tracks = append(tracks, *t)
+		marks = append(marks, mark)
 	}
-	return tracks, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, nil, queryError(ctx, "search track", err)
+	}
+	d.attachTrackMarkets(ctx, tracks)
+	return tracks, marks, nil
+}
+
+// tracksInLanguage returns, in search order, the IDs of the first limit of
+// up to candidates tracks matching where that are performed in language.
+// Languages are in track_files, which the search query can't join, so the
+// candidates are checked there in one batch first.
+func (d *DB) tracksInLanguage(ctx context.Context, where string, args []any, orderBy string, candidates, limit int, language string) ([]string, error) {
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT t.id
+		FROM tracks t
+		JOIN albums a ON t.album_rowid = a.rowid
+		WHERE `+where+`
+		ORDER BY `+orderBy+`
+		LIMIT ?
+	`, append(args, candidates)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	files, err := d.batchEnrichTrackFiles(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	matched := ids[:0]
+	for _, id := range ids {
+		if slices.ContainsFunc(files[id].Languages, func(l string) bool { return strings.EqualFold(l, language) }) {
+			matched = append(matched, id)
+			if len(matched) == limit {
+				break
+			}
+		}
+	}
+	return matched, nil
 }
 
 func (d *DB) getTrackArtists(ctx context.Context, trackID string) ([]models.Artist, error) {
@@ -329,17 +670,18 @@ func (d *DB) getTrackArtists(ctx context.Context, trackID string) ([]models.Arti
 		WHERE t.id = ?
 	`, trackID)
 	if err != nil {
-		return nil, fmt.Errorf("get track artists: %w", err)
+		return nil, queryError(ctx, "get track artists", err)
 	}
 	defer rows.Close()
 
 	var artists []models.Artist
 	for rows.Next() {
-		var a models.Artist
+		var as artistScan
 		var rowid int64
-		if err := rows.Scan(&a.ID, &a.Name, &a.Followers, &a.Popularity, &rowid); err != nil {
-			return nil, fmt.Errorf("scan artist: %w", err)
+		if err := rows.Scan(scanArgs(as.dest(), []any{&rowid})...); err != nil {
+			return nil, queryError(ctx, "scan artist", err)
 		}
+		a := as.artist(&d.nulls)
 		a.Genres, _ = d.getArtistGenres(ctx, rowid)
 		a.Images, _ = d.getArtistImages(ctx, rowid)
 		artists = append(artists, a)
@@ -357,18 +699,19 @@ func (d *DB) getAlbumArtists(ctx context.Context, albumRowID int64) ([]models.Ar
 		ORDER BY idx
 	`, albumRowID)
 	if err != nil {
-		return nil, fmt.Errorf("get album artists: %w", err)
+		return nil, queryError(ctx, "get album artists", err)
 	}
 	defer rows.Close()
 
 	var artists []models.Artist
 	for rows.Next() {
-		var a models.Artist
+		var as artistScan
 		var rowid int64
 		var idx int
-		if err := rows.Scan(&a.ID, &a.Name, &a.Followers, &a.Popularity, &rowid, &idx); err != nil {
-			return nil, fmt.Errorf("scan artist: %w", err)
+		if err := rows.Scan(scanArgs(as.dest(), []any{&rowid, &idx})...); err != nil {
+			return nil, queryError(ctx, "scan artist", err)
 		}
+		a := as.artist(&d.nulls)
 		a.Genres, _ = d.getArtistGenres(ctx, rowid)
 		a.Images, _ = d.getArtistImages(ctx, rowid)
 		artists = append(artists, a)
@@ -377,11 +720,15 @@ func (d *DB) getAlbumArtists(ctx context.Context, albumRowID int64) ([]models.Ar
 }
 
 func (d *DB) getArtistGenres(ctx context.Context, artistRowID int64) ([]string, error) {
+	if hot := d.hot.Load(); hot != nil {
+		return hot.genres[artistRowID], nil
+	}
+
 	rows, err := d.main.QueryContext(ctx, `
 		SELECT genre FROM artist_genres WHERE artist_rowid = ?
 	`, artistRowID)
 	if err != nil {
-		return nil, fmt.Errorf("get artist genres: %w", err)
+		return nil, queryError(ctx, "get artist genres", err)
 	}
 	defer rows.Close()
 
@@ -389,7 +736,7 @@ func (d *DB) getArtistGenres(ctx context.Context, artistRowID int64) ([]string,
 	for rows.Next() {
 		var g string
 		if err := rows.Scan(&g); err != nil {
-			return nil, fmt.Errorf("scan genre: %w", err)
+			return nil, queryError(ctx, "scan genre", err)
 		}
 		genres = append(genres, g)
 	}
@@ -402,125 +749,269 @@ func (d *DB) getAlbumImages(ctx context.Context, albumRowID int64) ([]models.Ima
 		WHERE album_rowid = ? ORDER BY width DESC
 	`, albumRowID)
 	if err != nil {
-		return nil, fmt.Errorf("get album images: %w", err)
+		return nil, queryError(ctx, "get album images", err)
 	}
 	defer rows.Close()
 
 	var images []models.Image
 	for rows.Next() {
-		var img models.Image
-		if err := rows.Scan(&img.URL, &img.Width, &img.Height); err != nil {
-			return nil, fmt.Errorf("scan image: %w", err)
+		var is imageScan
+		if err := rows.Scan(is.dest()...); err != nil {
+			return nil, queryError(ctx, "scan image", err)
 		}
-		images = append(images, img)
+		images = append(images, d.image(&is, "album_images"))
 	}
 	return images, rows.Err()
 }
 
 func (d *DB) getArtistImages(ctx context.Context, artistRowID int64) ([]models.Image, error) {
+	if hot := d.hot.Load(); hot != nil {
+		return hot.artistImages[artistRowID], nil
+	}
+
 	rows, err := d.main.QueryContext(ctx, `
 		SELECT url, width, height FROM artist_images
 		WHERE artist_rowid = ? ORDER BY width DESC
 	`, artistRowID)
 	if err != nil {
-		return nil, fmt.Errorf("get artist images: %w", err)
+		return nil, queryError(ctx, "get artist images", err)
 	}
 	defer rows.Close()
 
 	var images []models.Image
 	for rows.Next() {
-		var img models.Image
-		if err := rows.Scan(&img.URL, &img.Width, &img.Height); err != nil {
-			return nil, fmt.Errorf("scan image: %w", err)
+		var is imageScan
+		if err := rows.Scan(is.dest()...); err != nil {
+			return nil, queryError(ctx, "scan image", err)
 		}
-		images = append(images, img)
+		images = append(images, d.image(&is, "artist_images"))
 	}
 	return images, rows.Err()
 }
 
-func (d *DB) BatchLookupTracks(ctx context.Context, ids []string) (map[string]*models.Track, error) {
-	result := make(map[string]*models.Track)
-
-	for _, id := range ids {
-		track, err := d.LookupTrack(ctx, id)
-		if err != nil {
-			slog.Error("batch lookup track", "id", id, "err", err)
+// lookupBatchSize bounds the IN lists of batch lookups. One batch request
+// fits in a single chunk; larger internal batches take several queries.
+const lookupBatchSize = 500
+
+// lookupChunks splits keys into IN lists of at most lookupBatchSize,
+// leaving out duplicates
+func lookupChunks(keys []string) [][]any {
+	var chunks [][]any
+	seen := make(map[string]bool, len(keys))
+	var chunk []any
+	for _, k := range keys {
+		if seen[k] {
 			continue
 		}
-		if track != nil {
-			result[id] = track
+		seen[k] = true
+		chunk = append(chunk, k)
+		if len(chunk) == lookupBatchSize {
+			chunks = append(chunks, chunk)
+			chunk = nil
 		}
 	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
 
-	return result, nil
+// validIDs returns the well-formed IDs in ids
+func validIDs(ids []string) []string {
+	var valid []string
+	for _, id := range ids {
+		if CheckID(id) == nil {
+			valid = append(valid, id)
+		}
+	}
+	return valid
 }
 
+// BatchLookupTracks looks up each ID, leaving unknown and malformed IDs out
+// of the result. On other failures it returns the partial result with the
+// last error.
+func (d *DB) BatchLookupTracks(ctx context.Context, ids []string) (map[string]*models.Track, error) {
+	if d.shards != nil {
+		return batch(d.shards, ids, func(s *DB, ids []string) (map[string]*models.Track, error) { return s.BatchLookupTracks(ctx, ids) })
+	}
+
+	tracks, err := d.batchTracks(ctx, "t.id", validIDs(ids))
+	result := make(map[string]*models.Track, len(tracks))
+	for i := range tracks {
+		result[tracks[i].ID] = &tracks[i]
+	}
+	return result, err
+}
+
+// BatchLookupArtists looks up each ID, leaving unknown and malformed IDs out
+// of the result. On other failures it returns the partial result with the
+// last error.
 func (d *DB) BatchLookupArtists(ctx context.Context, ids []string) (map[string]*models.Artist, error) {
-	result := make(map[string]*models.Artist)
+	if d.shards != nil {
+		return batch(d.shards, ids, func(s *DB, ids []string) (map[string]*models.Artist, error) { return s.BatchLookupArtists(ctx, ids) })
+	}
 
-	for _, id := range ids {
-		artist, err := d.LookupArtist(ctx, id)
+	result := make(map[string]*models.Artist)
+	refs := mbidRefs{}
+	if hot := d.hot.Load(); hot != nil {
+		for _, id := range validIDs(ids) {
+			rowid, ok := hot.artistRowIDs[id]
+			if !ok {
+				continue
+			}
+			a, _ := hot.artist(rowid)
+			result[id] = &a
+			refs.artist(&a)
+		}
+		traceCache(ctx, true)
+		d.attachMBIDs(ctx, refs)
+		return result, nil
+	}
+
+	var awrs []artistWithRowID
+	rowIDs := make(map[int64]bool)
+	var failed error
+	for _, chunk := range lookupChunks(validIDs(ids)) {
+		rows, err := d.main.QueryContext(ctx, `
+			SELECT id, name, followers_total, popularity, rowid FROM artists
+			WHERE id IN (`+placeholders(len(chunk))+`)
+		`, chunk...)
 		if err != nil {
-			slog.Error("batch lookup artist", "id", id, "err", err)
+			slog.ErrorContext(ctx, "batch lookup artists", "err", err)
+			failed = queryError(ctx, "batch lookup artists", err)
 			continue
 		}
-		if artist != nil {
-			result[id] = artist
+		for rows.Next() {
+			var as artistScan
+			var a artistWithRowID
+			if err := rows.Scan(scanArgs(as.dest(), []any{&a.rowid})...); err != nil {
+				failed = queryError(ctx, "scan artist", err)
+				break
+			}
+			a.Artist = as.artist(&d.nulls)
+			awrs = append(awrs, a)
+			rowIDs[a.rowid] = true
+		}
+		if err := rows.Err(); err != nil {
+			failed = queryError(ctx, "batch lookup artists", err)
 		}
+		rows.Close()
 	}
 
-	return result, nil
+	artists := d.artistAssembler(ctx, rowIDs)(awrs)
+	for i := range artists {
+		result[artists[i].ID] = &artists[i]
+		refs.artist(&artists[i])
+	}
+	d.attachMBIDs(ctx, refs)
+	return result, failed
 }
 
+// BatchLookupAlbums looks up each ID, leaving unknown and malformed IDs out
+// of the result. On other failures it returns the partial result with the
+// last error.
 func (d *DB) BatchLookupAlbums(ctx context.Context, ids []string) (map[string]*models.Album, error) {
-	result := make(map[string]*models.Album)
+	if d.shards != nil {
+		return batch(d.shards, ids, func(s *DB, ids []string) (map[string]*models.Album, error) { return s.BatchLookupAlbums(ctx, ids) })
+	}
 
-	for _, id := range ids {
-		album, err := d.LookupAlbum(ctx, id)
+	var albums []*models.Album
+	albumRowIDs := make(map[int64]bool)
+	rowIDOf := make(map[*models.Album]int64)
+	var failed error
+	for _, chunk := range lookupChunks(validIDs(ids)) {
+		rows, err := d.main.QueryContext(ctx, `
+			SELECT id, name, album_type, label, release_date, release_date_precision,
+			       external_id_upc, total_tracks, copyright_c, copyright_p, rowid
+			FROM albums WHERE id IN (`+placeholders(len(chunk))+`)
+		`, chunk...)
 		if err != nil {
-			slog.Error("batch lookup album", "id", id, "err", err)
+			slog.ErrorContext(ctx, "batch lookup albums", "err", err)
+			failed = queryError(ctx, "batch lookup albums", err)
 			continue
 		}
-		if album != nil {
-			result[id] = album
+		for rows.Next() {
+			var as albumScan
+			var rowid int64
+			if err := rows.Scan(scanArgs(as.dest(), []any{&rowid})...); err != nil {
+				failed = queryError(ctx, "scan album", err)
+				break
+			}
+			a := as.album(&d.nulls)
+			albums = append(albums, &a)
+			albumRowIDs[rowid] = true
+			rowIDOf[&a] = rowid
 		}
+		if err := rows.Err(); err != nil {
+			failed = queryError(ctx, "batch lookup albums", err)
+		}
+		rows.Close()
 	}
 
-	return result, nil
+	result := make(map[string]*models.Album, len(albums))
+	if len(albums) == 0 {
+		return result, failed
+	}
+
+	albumImages, err := d.batchGetAlbumImages(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album images", "err", err)
+	}
+	albumArtists, artistRowIDs, err := d.batchGetAlbumArtists(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album artists", "err", err)
+	}
+	assemble := d.artistAssembler(ctx, artistRowIDs)
+	languages, err := d.batchAlbumLanguages(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch album languages", "err", err)
+	}
+	genres, err := d.batchGetAlbumGenres(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album genres", "err", err)
+	}
+
+	refs := mbidRefs{}
+	markets := newMarketRefs()
+	for _, a := range albums {
+		rowid := rowIDOf[a]
+		a.Images = albumImages[rowid]
+		if artists, ok := albumArtists[rowid]; ok {
+			a.SetArtists(assemble(artists))
+		}
+		a.Languages = languages[rowid]
+		a.Genres = genres[rowid]
+		refs.album(a)
+		markets.album(a)
+		result[a.ID] = a
+	}
+	d.attachMBIDs(ctx, refs)
+	d.attachMarkets(ctx, markets)
+	return result, failed
 }
 
 func (d *DB) BatchLookupISRCs(ctx context.Context, isrcs []string) (map[string][]models.Track, error) {
-	if len(isrcs) == 0 {
-		return make(map[string][]models.Track), nil
+	if d.shards != nil {
+		return d.shards.batchLookupISRCs(ctx, isrcs)
 	}
 
-	// Build placeholders for IN clause
-	placeholders := make([]string, len(isrcs))
-	args := make([]interface{}, len(isrcs))
-	for i, isrc := range isrcs {
-		placeholders[i] = "?"
-		args[i] = isrc
+	tracks, err := d.batchTracks(ctx, "t.external_id_isrc", isrcs)
+	if err != nil && len(tracks) == 0 {
+		return nil, err
 	}
-	inClause := strings.Join(placeholders, ",")
-
-	// 1. Fetch all tracks + albums in one query
-	query := fmt.Sprintf(`
-		SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
-		       t.track_number, t.disc_number, t.popularity, t.preview_url, t.rowid,
-		       a.id, a.name, a.album_type, a.label, a.release_date, a.release_date_precision,
-		       a.external_id_upc, a.total_tracks, a.copyright_c, a.copyright_p, a.rowid
-		FROM tracks t
-		JOIN albums a ON t.album_rowid = a.rowid
-		WHERE t.external_id_isrc IN (%s)
-		ORDER BY t.external_id_isrc, t.popularity DESC
-	`, inClause)
-
-	rows, err := d.main.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("batch query isrcs: %w", err)
+	result := make(map[string][]models.Track)
+	for _, t := range tracks {
+		result[t.ISRC] = append(result[t.ISRC], t)
 	}
-	defer rows.Close()
+	return result, err
+}
 
+// batchTracks returns the tracks whose column is one of keys, fully
+// assembled, most popular first for each key. The tracks and their albums
+// come from one query per lookupBatchSize keys, and everything they embed
+// from one more per table. On failure it returns the tracks it could read
+// with the last error.
+func (d *DB) batchTracks(ctx context.Context, column string, keys []string) ([]models.Track, error) {
 	type trackInfo struct {
 		track      models.Track
 		albumRowID int64
@@ -530,58 +1021,69 @@ func (d *DB) BatchLookupISRCs(ctx context.Context, isrcs []string) (map[string][
 	var trackInfos []trackInfo
 	albumRowIDs := make(map[int64]bool)
 	trackIDs := make([]string, 0)
-
-	for rows.Next() {
-		var t models.Track
-		var alb models.Album
-		var isrcNull, upcNull, copyCNull, copyPNull, previewNull sql.NullString
-		var albumRowID, trackRowID int64
-
-		err := rows.Scan(
-			&t.ID, &t.Name, &isrcNull, &t.DurationMs, &t.Explicit,
-			&t.TrackNum, &t.DiscNum, &t.Popularity, &previewNull, &trackRowID,
-			&alb.ID, &alb.Name, &alb.Type, &alb.Label, &alb.ReleaseDate, &alb.ReleaseDatePrecision,
-			&upcNull, &alb.TotalTracks, &copyCNull, &copyPNull, &albumRowID,
-		)
+	var failed error
+
+	// 1. Fetch the tracks and their albums
+	for _, chunk := range lookupChunks(keys) {
+		rows, err := d.main.QueryContext(ctx, `
+			SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
+			       t.track_number, t.disc_number, t.popularity, t.preview_url, t.rowid,
+			       a.id, a.name, a.album_type, a.label, a.release_date, a.release_date_precision,
+			       a.external_id_upc, a.total_tracks, a.copyright_c, a.copyright_p, a.rowid
+			FROM tracks t
+			JOIN albums a ON t.album_rowid = a.rowid
+			WHERE `+column+` IN (`+placeholders(len(chunk))+`)
+			ORDER BY `+column+`, t.popularity DESC
+		`, chunk...)
 		if err != nil {
-			return nil, fmt.Errorf("scan track: %w", err)
+			slog.ErrorContext(ctx, "batch query tracks", "err", err)
+			failed = queryError(ctx, "batch query tracks", err)
+			continue
 		}
+		for rows.Next() {
+			var ts trackScan
+			var as albumScan
+			var albumRowID, trackRowID int64
+
+			if err := rows.Scan(scanArgs(ts.dest(), []any{&trackRowID}, as.dest(), []any{&albumRowID})...); err != nil {
+				failed = queryError(ctx, "scan track", err)
+				break
+			}
 
-		t.ISRC = isrcNull.String
-		t.PreviewURL = previewNull.String
-		alb.UPC = upcNull.String
-		alb.CopyrightC = copyCNull.String
-		alb.CopyrightP = copyPNull.String
-		t.Album = &alb
+			t := ts.track(&d.nulls)
+			alb := as.album(&d.nulls)
+			t.Album = &alb
 
-		trackInfos = append(trackInfos, trackInfo{track: t, albumRowID: albumRowID, trackRowID: trackRowID})
-		albumRowIDs[albumRowID] = true
-		trackIDs = append(trackIDs, t.ID)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+			trackInfos = append(trackInfos, trackInfo{track: t, albumRowID: albumRowID, trackRowID: trackRowID})
+			albumRowIDs[albumRowID] = true
+			trackIDs = append(trackIDs, t.ID)
+		}
+		if err := rows.Err(); err != nil {
+			failed = queryError(ctx, "batch query tracks", err)
+		}
+		rows.Close()
 	}
 
 	if len(trackInfos) == 0 {
-		return make(map[string][]models.Track), nil
+		return nil, failed
 	}
 
 	// 2. Batch fetch album images
 	albumImages, err := d.batchGetAlbumImages(ctx, albumRowIDs)
 	if err != nil {
-		slog.Error("batch get album images", "err", err)
+		slog.ErrorContext(ctx, "batch get album images", "err", err)
 	}
 
 	// 3. Batch fetch album artists (and their artist rowids)
 	albumArtists, artistRowIDs, err := d.batchGetAlbumArtists(ctx, albumRowIDs)
 	if err != nil {
-		slog.Error("batch get album artists", "err", err)
+		slog.ErrorContext(ctx, "batch get album artists", "err", err)
 	}
 
 	// 4. Batch fetch track artists (and their artist rowids)
 	trackArtists, trackArtistRowIDs, err := d.batchGetTrackArtists(ctx, trackIDs)
 	if err != nil {
-		slog.Error("batch get track artists", "err", err)
+		slog.ErrorContext(ctx, "batch get track artists", "err", err)
 	}
 
 	// Merge artist rowids
@@ -589,24 +1091,17 @@ func (d *DB) BatchLookupISRCs(ctx context.Context, isrcs []string) (map[string][
 		artistRowIDs[rowid] = true
 	}
 
-	// 5. Batch fetch artist genres and images
-	artistGenres, err := d.batchGetArtistGenres(ctx, artistRowIDs)
-	if err != nil {
-		slog.Error("batch get artist genres", "err", err)
-	}
-	artistImages, err := d.batchGetArtistImages(ctx, artistRowIDs)
-	if err != nil {
-		slog.Error("batch get artist images", "err", err)
-	}
+	// 5. Batch fetch artist genres and images for artists not already cached
+	assemble := d.artistAssembler(ctx, artistRowIDs)
 
 	// 6. Batch fetch track_files enrichment
 	trackFilesData, err := d.batchEnrichTrackFiles(ctx, trackIDs)
 	if err != nil {
-		slog.Error("batch enrich track files", "err", err)
+		slog.ErrorContext(ctx, "batch enrich track files", "err", err)
 	}
 
 	// Assemble results
-	result := make(map[string][]models.Track)
+	tracks := make([]models.Track, len(trackInfos))
 	for i := range trackInfos {
 		ti := &trackInfos[i]
 
@@ -615,20 +1110,12 @@ func (d *DB) BatchLookupISRCs(ctx context.Context, isrcs []string) (map[string][
 
 		// Attach album artists with genres/images
 		if artists, ok := albumArtists[ti.albumRowID]; ok {
-			for j := range artists {
-				artists[j].Genres = artistGenres[artists[j].rowid]
-				artists[j].Images = artistImages[artists[j].rowid]
-			}
-			ti.track.Album.Artists = toArtists(artists)
+			ti.track.Album.SetArtists(assemble(artists))
 		}
 
 		// Attach track artists with genres/images
 		if artists, ok := trackArtists[ti.track.ID]; ok {
-			for j := range artists {
-				artists[j].Genres = artistGenres[artists[j].rowid]
-				artists[j].Images = artistImages[artists[j].rowid]
-			}
-			ti.track.Artists = toArtists(artists)
+			ti.track.Artists = assemble(artists)
 		}
 
 		// Attach track_files enrichment
@@ -637,13 +1124,81 @@ func (d *DB) BatchLookupISRCs(ctx context.Context, isrcs []string) (map[string][
 			ti.track.OriginalTitle = tf.OriginalTitle
 			ti.track.VersionTitle = tf.VersionTitle
 			ti.track.Languages = tf.Languages
-			ti.track.ArtistRoles = tf.ArtistRoles
+			ti.track.ArtistRoles = models.NewArtistRoles(tf.ArtistRoles, ti.track.Artists)
 		}
 
-		result[ti.track.ISRC] = append(result[ti.track.ISRC], ti.track)
+		tracks[i] = ti.track
 	}
 
-	return result, nil
+	d.attachTrackMBIDs(ctx, tracks)
+	d.attachTrackMarkets(ctx, tracks)
+	return tracks, failed
+}
+
+// artistAssembler batch-fetches genres and images for the given artists,
+// skipping any already in the artist cache, and returns a function that
+// fills them into artistWithRowID lists. Newly assembled artists are cached
+// unless a batch query failed, so partial results are never cached.
+func (d *DB) artistAssembler(ctx context.Context, artistRowIDs map[int64]bool) func([]artistWithRowID) []models.Artist {
+	assemble, err := d.tryArtistAssembler(ctx, artistRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "assemble artists", "err", err)
+	}
+	return assemble
+}
+
+// assembleArtists fills in the genres and images of awrs like
+// artistAssembler, for routes that return artists alone: those fail
+// rather than serve artists without them
+func (d *DB) assembleArtists(ctx context.Context, awrs []artistWithRowID) ([]models.Artist, error) {
+	rowIDs := make(map[int64]bool, len(awrs))
+	for _, a := range awrs {
+		rowIDs[a.rowid] = true
+	}
+	assemble, err := d.tryArtistAssembler(ctx, rowIDs)
+	if err != nil {
+		return nil, err
+	}
+	return assemble(awrs), nil
+}
+
+// tryArtistAssembler is artistAssembler, also returning why genres or
+// images are missing
+func (d *DB) tryArtistAssembler(ctx context.Context, artistRowIDs map[int64]bool) (func([]artistWithRowID) []models.Artist, error) {
+	cachedArtists := make(map[int64]models.Artist)
+	uncached := make(map[int64]bool)
+	for rowid := range artistRowIDs {
+		if a, ok := d.cachedArtist(ctx, rowid); ok {
+			cachedArtists[rowid] = a
+		} else {
+			uncached[rowid] = true
+		}
+	}
+
+	artistGenres, genresErr := d.batchGetArtistGenres(ctx, uncached)
+	artistImages, imagesErr := d.batchGetArtistImages(ctx, uncached)
+	cacheable := genresErr == nil && imagesErr == nil
+
+	assemble := func(awrs []artistWithRowID) []models.Artist {
+		artists := make([]models.Artist, len(awrs))
+		for j, a := range awrs {
+			if cached, ok := cachedArtists[a.rowid]; ok {
+				artists[j] = cached
+				continue
+			}
+			a.Genres = artistGenres[a.rowid]
+			a.Images = artistImages[a.rowid]
+			artists[j] = a.Artist
+			if cacheable {
+				cachedArtists[a.rowid] = a.Artist
+				d.cacheArtist(a.rowid, a.Artist)
+			}
+		}
+		return artists
+	}
+	return assemble, errors.Join(
+		queryError(ctx, "batch get artist genres", genresErr),
+		queryError(ctx, "batch get artist images", imagesErr))
 }
 
 // artistWithRowID holds artist data plus rowid for later lookups
@@ -652,14 +1207,6 @@ type artistWithRowID struct {
 	rowid int64
 }
 
-func toArtists(awrs []artistWithRowID) []models.Artist {
-	artists := make([]models.Artist, len(awrs))
-	for i, a := range awrs {
-		artists[i] = a.Artist
-	}
-	return artists
-}
-
 func (d *DB) batchGetAlbumImages(ctx context.Context, albumRowIDs map[int64]bool) (map[int64][]models.Image, error) {
 	if len(albumRowIDs) == 0 {
 		return make(map[int64][]models.Image), nil
@@ -686,11 +1233,11 @@ func (d *DB) batchGetAlbumImages(ctx context.Context, albumRowIDs map[int64]bool
 	result := make(map[int64][]models.Image)
 	for rows.Next() {
 		var rowid int64
-		var img models.Image
-		if err := rows.Scan(&rowid, &img.URL, &img.Width, &img.Height); err != nil {
+		var is imageScan
+		if err := rows.Scan(scanArgs([]any{&rowid}, is.dest())...); err != nil {
 			return nil, err
 		}
-		result[rowid] = append(result[rowid], img)
+		result[rowid] = append(result[rowid], d.image(&is, "album_images"))
 	}
 	return result, rows.Err()
 }
@@ -726,11 +1273,13 @@ func (d *DB) batchGetAlbumArtists(ctx context.Context, albumRowIDs map[int64]boo
 	artistRowIDs := make(map[int64]bool)
 	for rows.Next() {
 		var albumRowID int64
+		var as artistScan
 		var a artistWithRowID
 		var idx int
-		if err := rows.Scan(&albumRowID, &a.ID, &a.Name, &a.Followers, &a.Popularity, &a.rowid, &idx); err != nil {
+		if err := rows.Scan(scanArgs([]any{&albumRowID}, as.dest(), []any{&a.rowid, &idx})...); err != nil {
 			return nil, nil, err
 		}
+		a.Artist = as.artist(&d.nulls)
 		result[albumRowID] = append(result[albumRowID], a)
 		artistRowIDs[a.rowid] = true
 	}
@@ -767,10 +1316,12 @@ func (d *DB) batchGetTrackArtists(ctx context.Context, trackIDs []string) (map[s
 	artistRowIDs := make(map[int64]bool)
 	for rows.Next() {
 		var trackID string
+		var as artistScan
 		var a artistWithRowID
-		if err := rows.Scan(&trackID, &a.ID, &a.Name, &a.Followers, &a.Popularity, &a.rowid); err != nil {
+		if err := rows.Scan(scanArgs([]any{&trackID}, as.dest(), []any{&a.rowid})...); err != nil {
 			return nil, nil, err
 		}
+		a.Artist = as.artist(&d.nulls)
 		result[trackID] = append(result[trackID], a)
 		artistRowIDs[a.rowid] = true
 	}
@@ -781,6 +1332,15 @@ func (d *DB) batchGetArtistGenres(ctx context.Context, artistRowIDs map[int64]bo
 	if len(artistRowIDs) == 0 {
 		return make(map[int64][]string), nil
 	}
+	if hot := d.hot.Load(); hot != nil {
+		result := make(map[int64][]string, len(artistRowIDs))
+		for rowid := range artistRowIDs {
+			if genres, ok := hot.genres[rowid]; ok {
+				result[rowid] = genres
+			}
+		}
+		return result, nil
+	}
 
 	placeholders := make([]string, 0, len(artistRowIDs))
 	args := make([]interface{}, 0, len(artistRowIDs))
@@ -815,6 +1375,15 @@ func (d *DB) batchGetArtistImages(ctx context.Context, artistRowIDs map[int64]bo
 	if len(artistRowIDs) == 0 {
 		return make(map[int64][]models.Image), nil
 	}
+	if hot := d.hot.Load(); hot != nil {
+		result := make(map[int64][]models.Image, len(artistRowIDs))
+		for rowid := range artistRowIDs {
+			if images, ok := hot.artistImages[rowid]; ok {
+				result[rowid] = images
+			}
+		}
+		return result, nil
+	}
 
 	placeholders := make([]string, 0, len(artistRowIDs))
 	args := make([]interface{}, 0, len(artistRowIDs))
@@ -837,11 +1406,11 @@ func (d *DB) batchGetArtistImages(ctx context.Context, artistRowIDs map[int64]bo
 	result := make(map[int64][]models.Image)
 	for rows.Next() {
 		var rowid int64
-		var img models.Image
-		if err := rows.Scan(&rowid, &img.URL, &img.Width, &img.Height); err != nil {
+		var is imageScan
+		if err := rows.Scan(scanArgs([]any{&rowid}, is.dest())...); err != nil {
 			return nil, err
 		}
-		result[rowid] = append(result[rowid], img)
+		result[rowid] = append(result[rowid], d.image(&is, "artist_images"))
 	}
 	return result, rows.Err()
 }
@@ -851,7 +1420,7 @@ type trackFileData struct {
 	OriginalTitle string
 	VersionTitle  string
 	Languages     []string
-	ArtistRoles   []string
+	ArtistRoles   []string // as stored, in artist order
 }
 
 func (d *DB) batchEnrichTrackFiles(ctx context.Context, trackIDs []string) (map[string]trackFileData, error) {
@@ -905,3 +1474,67 @@ func (d *DB) batchEnrichTrackFiles(ctx context.Context, trackIDs []string) (map[
 	}
 	return result, rows.Err()
 }
+
+func (d *DB) RelatedArtists(ctx context.Context, id string, limit int) ([]models.Artist, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) ([]models.Artist, error) { return s.RelatedArtists(ctx, id, limit) })
+	}
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	rowid, err := d.rowID(ctx, "artist", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pull a wider candidate pool ordered by genre overlap, then re-rank in Go
+	// so follower count acts as a weight rather than a tiebreaker.
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT a.id, a.name, a.followers_total, a.popularity, a.rowid, COUNT(*) AS shared
+		FROM artist_genres g
+		JOIN artist_genres o ON o.genre = g.genre AND o.artist_rowid != g.artist_rowid
+		JOIN artists a ON a.rowid = o.artist_rowid
+		WHERE g.artist_rowid = ?
+		GROUP BY o.artist_rowid
+		ORDER BY shared DESC, a.followers_total DESC
+		LIMIT ?
+	`, rowid, limit*10)
+	if err != nil {
+		return nil, queryError(ctx, "related artists", err)
+	}
+	defer rows.Close()
+
+	type candidate struct {
+		artistWithRowID
+		score float64
+	}
+
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		var as artistScan
+		var shared int
+		if err := rows.Scan(scanArgs(as.dest(), []any{&c.rowid, &shared})...); err != nil {
+			return nil, queryError(ctx, "scan artist", err)
+		}
+		c.Artist = as.artist(&d.nulls)
+		c.score = float64(shared) * math.Log10(float64(c.Followers)+10)
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "related artists", err)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	awrs := make([]artistWithRowID, len(candidates))
+	for i, c := range candidates {
+		awrs[i] = c.artistWithRowID
+	}
+	return d.assembleArtists(ctx, awrs)
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+
+	"metadata-api/internal/models"
+)
+
+// DiscographyGroups are the buckets of an artist's discography, in response
+// order
+var DiscographyGroups = []string{"albums", "singles", "compilations", "appears_on"}
+
+// discographyGroup buckets an artist_albums row. The artist appears on a
+// release without being one of its credited artists when index_in_album is
+// NULL; singles and EPs share the single album type.
+const discographyGroup = `
+	CASE
+		WHEN aa.index_in_album IS NULL THEN 'appears_on'
+		WHEN al.album_type = 'single' THEN 'singles'
+		WHEN al.album_type = 'compilation' THEN 'compilations'
+		ELSE 'albums'
+	END`
+
+// Discography returns an artist's releases bucketed into DiscographyGroups,
+// newest first. Each bucket returns up to limit albums starting at its entry
+// in offsets.
+func (d *DB) Discography(ctx context.Context, id string, limit int, offsets map[string]int) (*models.Discography, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) (*models.Discography, error) { return s.Discography(ctx, id, limit, offsets) })
+	}
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+
+	rowid, err := d.rowID(ctx, "artist", id)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int)
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT `+discographyGroup+` AS grp, COUNT(*)
+		FROM artist_albums aa
+		JOIN albums al ON al.rowid = aa.album_rowid
+		WHERE aa.artist_rowid = ?
+		GROUP BY grp
+	`, rowid)
+	if err != nil {
+		return nil, queryError(ctx, "discography", err)
+	}
+	for rows.Next() {
+		var group string
+		var n int
+		if err := rows.Scan(&group, &n); err != nil {
+			rows.Close()
+			return nil, queryError(ctx, "discography", err)
+		}
+		totals[group] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "discography", err)
+	}
+
+	var disc models.Discography
+	pages := map[string]*models.AlbumPage{
+		"albums":       &disc.Albums,
+		"singles":      &disc.Singles,
+		"compilations": &disc.Compilations,
+		"appears_on":   &disc.AppearsOn,
+	}
+
+	type albumRow struct {
+		page  *models.AlbumPage
+		rowid int64
+		index int
+	}
+	var albums []albumRow
+	albumRowIDs := make(map[int64]bool)
+
+	for _, group := range DiscographyGroups {
+		page := pages[group]
+		page.Items = []models.Album{}
+		page.Total = totals[group]
+		page.Limit = limit
+		page.Offset = max(offsets[group], 0)
+		if page.Offset >= page.Total {
+			continue
+		}
+
+		rows, err := d.main.QueryContext(ctx, `
+			SELECT al.id, al.name, al.album_type, al.label, al.release_date, al.release_date_precision,
+			       al.external_id_upc, al.total_tracks, al.copyright_c, al.copyright_p, al.rowid
+			FROM artist_albums aa
+			JOIN albums al ON al.rowid = aa.album_rowid
+			WHERE aa.artist_rowid = ? AND `+discographyGroup+` = ?
+			ORDER BY al.release_date DESC, al.rowid DESC
+			LIMIT ? OFFSET ?
+		`, rowid, group, limit, page.Offset)
+		if err != nil {
+			return nil, queryError(ctx, "discography", err)
+		}
+		for rows.Next() {
+			var as albumScan
+			var albumRowID int64
+			if err := rows.Scan(scanArgs(as.dest(), []any{&albumRowID})...); err != nil {
+				rows.Close()
+				return nil, queryError(ctx, "scan album", err)
+			}
+			page.Items = append(page.Items, as.album(&d.nulls))
+			albums = append(albums, albumRow{page: page, rowid: albumRowID, index: len(page.Items) - 1})
+			albumRowIDs[albumRowID] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, queryError(ctx, "discography", err)
+		}
+	}
+
+	albumImages, err := d.batchGetAlbumImages(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album images", "err", err)
+	}
+	albumArtists, artistRowIDs, err := d.batchGetAlbumArtists(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album artists", "err", err)
+	}
+	albumGenres, err := d.batchGetAlbumGenres(ctx, albumRowIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "batch get album genres", "err", err)
+	}
+	assemble := d.artistAssembler(ctx, artistRowIDs)
+
+	refs := mbidRefs{}
+	markets := newMarketRefs()
+	for _, ar := range albums {
+		a := &ar.page.Items[ar.index]
+		a.Images = albumImages[ar.rowid]
+		a.Genres = albumGenres[ar.rowid]
+		if artists, ok := albumArtists[ar.rowid]; ok {
+			a.SetArtists(assemble(artists))
+		}
+		refs.album(a)
+		markets.album(a)
+	}
+	d.attachMBIDs(ctx, refs)
+	d.attachMarkets(ctx, markets)
+	return &disc, nil
+}
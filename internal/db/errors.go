@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Errors returned by DB methods, wrapped with the failing operation. Test
+// for them with errors.Is.
+var (
+	// ErrNotFound means the requested entity (or the optional table that
+	// would hold it) does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidID means an ID is not a 22-character base62 catalog ID, so
+	// it cannot exist
+	ErrInvalidID = errors.New("invalid id")
+	// ErrInvalidBarcode means a UPC or EAN is malformed or fails its check
+	// digit, so no album can have it
+	ErrInvalidBarcode = errors.New("invalid barcode")
+	// ErrStorage wraps any failure reading the SQLite files
+	ErrStorage = errors.New("storage error")
+	// ErrTimeout means the query was abandoned because its context ended
+	ErrTimeout = errors.New("query timeout")
+)
+
+// queryError classifies err from operation op as ErrTimeout when ctx has
+// ended and ErrStorage otherwise. Errors that are already classified are
+// returned unchanged, so it is safe to apply at every level.
+func queryError(ctx context.Context, op string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrInvalidID), errors.Is(err, ErrInvalidBarcode),
+		errors.Is(err, ErrStorage), errors.Is(err, ErrTimeout),
+		errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrInvalidSort), errors.Is(err, ErrInvalidQuery):
+		return err
+	case ctx.Err() != nil, errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return fmt.Errorf("%s: %w: %w", op, ErrTimeout, err)
+	default:
+		return fmt.Errorf("%s: %w: %w", op, ErrStorage, err)
+	}
+}
+
+// notFound returns ErrNotFound for the entity of kind with id
+func notFound(kind, id string) error {
+	return fmt.Errorf("%s %q: %w", kind, id, ErrNotFound)
+}
+
+// CheckID returns ErrInvalidID unless id is a 22-character base62 string
+func CheckID(id string) error {
+	if len(id) != idLength {
+		return fmt.Errorf("%q: %w", id, ErrInvalidID)
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return fmt.Errorf("%q: %w", id, ErrInvalidID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type exportColumn struct {
+	name string
+	expr string
+}
+
+type exportEntity struct {
+	from    string
+	columns []exportColumn
+	filters map[string]string
+	// popularity is the column min-popularity filters on, if any
+	popularity string
+}
+
+// exportEntities describes what `metadatactl export` can dump. Column names
+// follow the API's JSON field names; filters are fixed SQL conditions so
+// user input never reaches the query text.
+var exportEntities = map[string]exportEntity{
+	"tracks": {
+		from: `tracks t JOIN albums a ON a.rowid = t.album_rowid`,
+		columns: []exportColumn{
+			{"id", "t.id"},
+			{"name", "t.name"},
+			{"isrc", "t.external_id_isrc"},
+			{"duration_ms", "t.duration_ms"},
+			{"explicit", "t.explicit"},
+			{"track_number", "t.track_number"},
+			{"disc_number", "t.disc_number"},
+			{"popularity", "t.popularity"},
+			{"preview_url", "t.preview_url"},
+			{"album_id", "a.id"},
+			{"album_name", "a.name"},
+			{"release_date", "a.release_date"},
+			{"artists", `(SELECT group_concat(ar.name, '; ') FROM track_artists ta
+				JOIN artists ar ON ar.rowid = ta.artist_rowid WHERE ta.track_rowid = t.rowid)`},
+		},
+		filters: map[string]string{
+			"has-isrc":     `t.external_id_isrc IS NOT NULL AND t.external_id_isrc != ''`,
+			"explicit":     `t.explicit = 1`,
+			"not-explicit": `t.explicit = 0`,
+		},
+		popularity: "t.popularity",
+	},
+	"albums": {
+		from: `albums a`,
+		columns: []exportColumn{
+			{"id", "a.id"},
+			{"name", "a.name"},
+			{"type", "a.album_type"},
+			{"label", "a.label"},
+			{"release_date", "a.release_date"},
+			{"release_date_precision", "a.release_date_precision"},
+			{"upc", "a.external_id_upc"},
+			{"total_tracks", "a.total_tracks"},
+			{"copyright", "a.copyright_c"},
+			{"copyright_p", "a.copyright_p"},
+			{"artists", `(SELECT group_concat(ar.name, '; ') FROM artist_albums aa
+				JOIN artists ar ON ar.rowid = aa.artist_rowid WHERE aa.album_rowid = a.rowid)`},
+		},
+		filters: map[string]string{
+			"has-upc": `a.external_id_upc IS NOT NULL AND a.external_id_upc != ''`,
+		},
+	},
+	"artists": {
+		from: `artists ar`,
+		columns: []exportColumn{
+			{"id", "ar.id"},
+			{"name", "ar.name"},
+			{"followers", "ar.followers_total"},
+			{"popularity", "ar.popularity"},
+			{"genres", `(SELECT group_concat(g.genre, '; ') FROM artist_genres g WHERE g.artist_rowid = ar.rowid)`},
+		},
+		filters: map[string]string{
+			"has-genres": `EXISTS (SELECT 1 FROM artist_genres g WHERE g.artist_rowid = ar.rowid)`,
+		},
+		popularity: "ar.popularity",
+	},
+}
+
+// ExportSpec selects what Export dumps
+type ExportSpec struct {
+	Entity        string   // tracks, albums, or artists
+	Columns       []string // empty means all columns
+	Filters       []string // named filters, see ExportFilters
+	MinPopularity int
+	Limit         int // 0 means no limit
+}
+
+// ExportEntities lists the entities Export accepts
+func ExportEntities() []string {
+	names := make([]string, 0, len(exportEntities))
+	for name := range exportEntities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExportColumns lists the columns available for entity, in output order
+func ExportColumns(entity string) []string {
+	var names []string
+	for _, c := range exportEntities[entity].columns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// ExportFilters lists the named filters available for entity
+func ExportFilters(entity string) []string {
+	var names []string
+	for name := range exportEntities[entity].filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export streams rows matching spec to emit in rowid order. header receives
+// the column names once before the first row. Values are the raw SQLite
+// values: nil, int64, float64, or string.
+func (d *DB) Export(ctx context.Context, spec ExportSpec, header func([]string) error, emit func([]any) error) error {
+	if d.shards != nil {
+		return d.shards.export(ctx, spec, header, emit)
+	}
+
+	ent, ok := exportEntities[spec.Entity]
+	if !ok {
+		return fmt.Errorf("unknown entity %q (want one of %s)", spec.Entity, strings.Join(ExportEntities(), ", "))
+	}
+
+	cols := ent.columns
+	if len(spec.Columns) > 0 {
+		cols = nil
+		for _, name := range spec.Columns {
+			i := -1
+			for j, c := range ent.columns {
+				if c.name == name {
+					i = j
+					break
+				}
+			}
+			if i < 0 {
+				return fmt.Errorf("unknown %s column %q (want %s)", spec.Entity, name, strings.Join(ExportColumns(spec.Entity), ", "))
+			}
+			cols = append(cols, ent.columns[i])
+		}
+	}
+
+	var where []string
+	var args []any
+	for _, name := range spec.Filters {
+		cond, ok := ent.filters[name]
+		if !ok {
+			return fmt.Errorf("unknown %s filter %q (want %s)", spec.Entity, name, strings.Join(ExportFilters(spec.Entity), ", "))
+		}
+		where = append(where, cond)
+	}
+	if spec.MinPopularity > 0 {
+		if ent.popularity == "" {
+			return fmt.Errorf("%s have no popularity to filter on", spec.Entity)
+		}
+		where = append(where, ent.popularity+` >= ?`)
+		args = append(args, spec.MinPopularity)
+	}
+
+	names := make([]string, len(cols))
+	exprs := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+		exprs[i] = c.expr
+	}
+
+	// The first table alias in from is the entity itself
+	alias := strings.Fields(ent.from)[1]
+	query := `SELECT ` + strings.Join(exprs, ", ") + ` FROM ` + ent.from
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY ` + alias + `.rowid`
+	if spec.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, spec.Limit)
+	}
+
+	rows, err := d.main.QueryContext(ctx, query, args...)
+	if err != nil {
+		return queryError(ctx, "export "+spec.Entity, err)
+	}
+	defer rows.Close()
+
+	if err := header(names); err != nil {
+		return err
+	}
+
+	vals := make([]any, len(cols))
+	dest := make([]any, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return queryError(ctx, "scan "+spec.Entity, err)
+		}
+		for i, v := range vals {
+			if b, ok := v.([]byte); ok {
+				vals[i] = string(b)
+			}
+		}
+		if err := emit(vals); err != nil {
+			return err
+		}
+	}
+	return queryError(ctx, "export "+spec.Entity, rows.Err())
+}
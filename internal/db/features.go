@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"metadata-api/internal/models"
+)
+
+// tableExists reports whether the named table is present in conn
+func tableExists(ctx context.Context, conn *sql.DB, name string) (bool, error) {
+	var n int
+	err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?
+	`, name).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// HasAudioFeatures reports whether the snapshot ships an audio_features table
+func (d *DB) HasAudioFeatures() bool {
+	if d.shards != nil {
+		return d.shards.any((*DB).HasAudioFeatures)
+	}
+	return d.hasAudioFeatures
+}
+
+// AudioFeatures returns the audio features for a track. It returns
+// ErrNotFound when the snapshot has no audio_features table or no row for
+// the track.
+func (d *DB) AudioFeatures(ctx context.Context, trackID string) (*models.AudioFeatures, error) {
+	if d.shards != nil {
+		return route(d.shards, trackID, func(s *DB) (*models.AudioFeatures, error) { return s.AudioFeatures(ctx, trackID) })
+	}
+	if !d.hasAudioFeatures {
+		return nil, fmt.Errorf("audio_features table: %w", ErrNotFound)
+	}
+	if err := CheckID(trackID); err != nil {
+		return nil, err
+	}
+
+	row := d.main.QueryRowContext(ctx, `
+		SELECT danceability, energy, key, loudness, mode, speechiness, acousticness,
+		       instrumentalness, liveness, valence, tempo, time_signature
+		FROM audio_features WHERE track_id = ?
+	`, trackID)
+
+	var f models.AudioFeatures
+	err := row.Scan(&f.Danceability, &f.Energy, &f.Key, &f.Loudness, &f.Mode, &f.Speechiness,
+		&f.Acousticness, &f.Instrumentalness, &f.Liveness, &f.Valence, &f.Tempo, &f.TimeSignature)
+	if err == sql.ErrNoRows {
+		return nil, notFound("audio features for track", trackID)
+	}
+	if err != nil {
+		return nil, queryError(ctx, "scan audio features", err)
+	}
+	return &f, nil
+}
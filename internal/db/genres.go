@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+
+	"metadata-api/internal/models"
+)
+
+func (d *DB) ListGenres(ctx context.Context) ([]models.Genre, error) {
+	if d.shards != nil {
+		return d.shards.listGenres(ctx)
+	}
+
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT genre, COUNT(*) AS artist_count
+		FROM artist_genres
+		GROUP BY genre
+		ORDER BY artist_count DESC, genre
+	`)
+	if err != nil {
+		return nil, queryError(ctx, "list genres", err)
+	}
+	defer rows.Close()
+
+	var genres []models.Genre
+	for rows.Next() {
+		var g models.Genre
+		if err := rows.Scan(&g.Name, &g.ArtistCount); err != nil {
+			return nil, queryError(ctx, "scan genre", err)
+		}
+		genres = append(genres, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "list genres", err)
+	}
+	return genres, nil
+}
+
+func (d *DB) GenreArtists(ctx context.Context, genre string, limit, offset int) ([]models.Artist, error) {
+	if d.shards != nil {
+		return d.shards.genreArtists(ctx, genre, limit, offset)
+	}
+
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT a.id, a.name, a.followers_total, a.popularity, a.rowid
+		FROM artist_genres g
+		JOIN artists a ON a.rowid = g.artist_rowid
+		WHERE g.genre = ?
+		ORDER BY a.followers_total DESC
+		LIMIT ? OFFSET ?
+	`, genre, limit, offset)
+	if err != nil {
+		return nil, queryError(ctx, "genre artists", err)
+	}
+	defer rows.Close()
+
+	var awrs []artistWithRowID
+	for rows.Next() {
+		var as artistScan
+		var a artistWithRowID
+		if err := rows.Scan(scanArgs(as.dest(), []any{&a.rowid})...); err != nil {
+			return nil, queryError(ctx, "scan artist", err)
+		}
+		a.Artist = as.artist(&d.nulls)
+		awrs = append(awrs, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "genre artists", err)
+	}
+	return d.assembleArtists(ctx, awrs)
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"metadata-api/internal/models"
+)
+
+// Check pings both databases, runs SELECT 1, and verifies their primary
+// tables are non-empty. It is cheap enough to call from health probes.
+func (d *DB) Check(ctx context.Context) map[string]models.DatabaseHealth {
+	if d.shards != nil {
+		return d.shards.check(ctx)
+	}
+	return map[string]models.DatabaseHealth{
+		"main":        checkDB(ctx, d.main, d.mainPath, "tracks"),
+		"track_files": checkDB(ctx, d.trackFiles, d.trackFilesPath, "track_files"),
+	}
+}
+
+func checkDB(ctx context.Context, c *conn, path, table string) models.DatabaseHealth {
+	start := time.Now()
+	h := models.DatabaseHealth{Status: "ok"}
+
+	fail := func(err error) models.DatabaseHealth {
+		h.Status = "error"
+		h.Error = err.Error()
+		h.LatencyMs = time.Since(start).Milliseconds()
+		return h
+	}
+
+	// An open handle keeps working after the file is unlinked, so check the path too
+	if _, err := os.Stat(path); err != nil {
+		return fail(fmt.Errorf("stat: %w", err))
+	}
+	if err := c.PingContext(ctx); err != nil {
+		return fail(fmt.Errorf("ping: %w", err))
+	}
+
+	var one int
+	if err := c.QueryRowContext(ctx, `SELECT 1`).Scan(&one); err != nil {
+		return fail(fmt.Errorf("select 1: %w", err))
+	}
+
+	// MAX(rowid) reads a single b-tree page instead of counting every row
+	var maxRowID sql.NullInt64
+	if err := c.QueryRowContext(ctx, fmt.Sprintf(`SELECT MAX(rowid) FROM %s`, table)).Scan(&maxRowID); err != nil {
+		return fail(fmt.Errorf("row check: %w", err))
+	}
+	if maxRowID.Int64 <= 0 {
+		return fail(fmt.Errorf("table %s is empty", table))
+	}
+
+	h.MaxRowID = maxRowID.Int64
+	h.LatencyMs = time.Since(start).Milliseconds()
+	return h
+}
+
+// Ping verifies both database handles can reach their files
+func (d *DB) Ping(ctx context.Context) error {
+	if d.shards != nil {
+		return d.shards.each(func(_ int, s *DB) error { return s.Ping(ctx) })
+	}
+	if err := d.main.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping main db: %w", err)
+	}
+	if err := d.trackFiles.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping track_files db: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"metadata-api/internal/models"
+)
+
+// hotTables holds small, frequently joined tables in memory so per-lookup
+// artist/genre/image sub-queries don't hit SQLite. It is built once by
+// LoadHotTables and never mutated afterwards.
+type hotTables struct {
+	artistRowIDs map[string]int64
+	artists      map[int64]models.Artist
+	genres       map[int64][]string
+	artistImages map[int64][]models.Image
+}
+
+// LoadHotTables reads artists, artist genres, and artist images into memory.
+// Lookups consult these maps before falling back to SQLite. The tracks and
+// albums tables stay on disk. It is safe to call while serving requests;
+// lookups switch over once loading completes.
+func (d *DB) LoadHotTables(ctx context.Context) error {
+	if d.shards != nil {
+		return d.shards.each(func(_ int, s *DB) error { return s.LoadHotTables(ctx) })
+	}
+
+	start := time.Now()
+	hot := &hotTables{
+		artistRowIDs: make(map[string]int64),
+		artists:      make(map[int64]models.Artist),
+		genres:       make(map[int64][]string),
+		artistImages: make(map[int64][]models.Image),
+	}
+
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT rowid, id, name, followers_total, popularity FROM artists
+	`)
+	if err != nil {
+		return fmt.Errorf("load artists: %w", err)
+	}
+	for rows.Next() {
+		var as artistScan
+		var rowid int64
+		if err := rows.Scan(scanArgs([]any{&rowid}, as.dest())...); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan artist: %w", err)
+		}
+		a := as.artist(&d.nulls)
+		hot.artists[rowid] = a
+		hot.artistRowIDs[a.ID] = rowid
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load artists: %w", err)
+	}
+
+	rows, err = d.main.QueryContext(ctx, `SELECT artist_rowid, genre FROM artist_genres`)
+	if err != nil {
+		return fmt.Errorf("load artist genres: %w", err)
+	}
+	for rows.Next() {
+		var rowid int64
+		var genre string
+		if err := rows.Scan(&rowid, &genre); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan genre: %w", err)
+		}
+		hot.genres[rowid] = append(hot.genres[rowid], genre)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load artist genres: %w", err)
+	}
+
+	rows, err = d.main.QueryContext(ctx, `
+		SELECT artist_rowid, url, width, height FROM artist_images
+		ORDER BY artist_rowid, width DESC
+	`)
+	if err != nil {
+		return fmt.Errorf("load artist images: %w", err)
+	}
+	for rows.Next() {
+		var rowid int64
+		var is imageScan
+		if err := rows.Scan(scanArgs([]any{&rowid}, is.dest())...); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan image: %w", err)
+		}
+		hot.artistImages[rowid] = append(hot.artistImages[rowid], d.image(&is, "artist_images"))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load artist images: %w", err)
+	}
+
+	d.hot.Store(hot)
+	slog.InfoContext(ctx, "loaded hot tables",
+		"artists", len(hot.artists),
+		"artists_with_genres", len(hot.genres),
+		"artists_with_images", len(hot.artistImages),
+		"took", time.Since(start))
+	return nil
+}
+
+// artist returns a fully populated artist from memory
+func (h *hotTables) artist(rowid int64) (models.Artist, bool) {
+	a, ok := h.artists[rowid]
+	if !ok {
+		return a, false
+	}
+	a.Genres = h.genres[rowid]
+	a.Images = h.artistImages[rowid]
+	return a, true
+}
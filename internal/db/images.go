@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"metadata-api/internal/models"
+)
+
+// SetImageURLRewriter makes every image URL in results pass through fn, e.g.
+// to point at a local mirror. Call it before serving; cached artists and hot
+// tables keep the URLs they were built with.
+func (d *DB) SetImageURLRewriter(fn func(string) string) {
+	if d.shards != nil {
+		d.shards.each(func(_ int, s *DB) error { s.SetImageURLRewriter(fn); return nil })
+		return
+	}
+	d.imageURL = fn
+}
+
+// image converts a scanned image row, applying the URL rewriter if set
+func (d *DB) image(s *imageScan, table string) models.Image {
+	img := s.image(&d.nulls, table)
+	if d.imageURL != nil && img.URL != "" {
+		img.URL = d.imageURL(img.URL)
+	}
+	return img
+}
+
+// ForEachImageURL calls fn with the URL of every album and artist image,
+// reading in rowid batches so no single statement holds the snapshot open
+// for the whole walk. Stops at the first error fn returns.
+func (d *DB) ForEachImageURL(ctx context.Context, fn func(url string) error) error {
+	if d.shards != nil {
+		for _, s := range d.shards.dbs {
+			if err := s.ForEachImageURL(ctx, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	const batch = 10000
+	for _, table := range []string{"album_images", "artist_images"} {
+		var last int64
+		for {
+			rows, err := d.main.QueryContext(ctx, fmt.Sprintf(`
+				SELECT rowid, url FROM %s WHERE rowid > ? AND url IS NOT NULL ORDER BY rowid LIMIT ?
+			`, table), last, batch)
+			if err != nil {
+				return queryError(ctx, "list "+table, err)
+			}
+
+			var urls []string
+			for rows.Next() {
+				var url string
+				if err := rows.Scan(&last, &url); err != nil {
+					rows.Close()
+					return queryError(ctx, "scan "+table, err)
+				}
+				urls = append(urls, url)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return queryError(ctx, "list "+table, err)
+			}
+
+			for _, url := range urls {
+				if err := fn(url); err != nil {
+					return err
+				}
+			}
+			if len(urls) < batch {
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// languageBatchSize bounds the track_files IN lists, since an artist can
+// have thousands of tracks
+const languageBatchSize = 500
+
+// ArtistLanguages returns the languages of performance across the tracks
+// credited to the artist, with the number of tracks in each
+func (d *DB) ArtistLanguages(ctx context.Context, id string) ([]models.LanguageCount, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) ([]models.LanguageCount, error) { return s.ArtistLanguages(ctx, id) })
+	}
+	rowid, err := d.rowID(ctx, "artist", id)
+	if err != nil {
+		return nil, err
+	}
+
+	trackIDs, err := d.trackIDs(ctx, `
+		SELECT DISTINCT t.id FROM track_artists ta
+		JOIN tracks t ON t.rowid = ta.track_rowid
+		WHERE ta.artist_rowid = ?
+	`, rowid)
+	if err != nil {
+		return nil, queryError(ctx, "artist languages", err)
+	}
+
+	counts, err := d.languageCounts(ctx, trackIDs)
+	if err != nil {
+		return nil, queryError(ctx, "artist languages", err)
+	}
+	if counts == nil {
+		counts = []models.LanguageCount{}
+	}
+	return counts, nil
+}
+
+// albumLanguages returns the languages of performance across an album's
+// tracks
+func (d *DB) albumLanguages(ctx context.Context, albumRowID int64) ([]models.LanguageCount, error) {
+	trackIDs, err := d.trackIDs(ctx, `SELECT id FROM tracks WHERE album_rowid = ?`, albumRowID)
+	if err != nil {
+		return nil, err
+	}
+	return d.languageCounts(ctx, trackIDs)
+}
+
+func (d *DB) trackIDs(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := d.main.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// batchAlbumLanguages returns the languages of performance across the
+// tracks of each album
+func (d *DB) batchAlbumLanguages(ctx context.Context, albumRowIDs map[int64]bool) (map[int64][]models.LanguageCount, error) {
+	result := make(map[int64][]models.LanguageCount)
+	if len(albumRowIDs) == 0 {
+		return result, nil
+	}
+	args := make([]any, 0, len(albumRowIDs))
+	for rowid := range albumRowIDs {
+		args = append(args, rowid)
+	}
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT album_rowid, id FROM tracks WHERE album_rowid IN (`+placeholders(len(args))+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	albumTracks := make(map[int64][]string)
+	var trackIDs []string
+	for rows.Next() {
+		var rowid int64
+		var id string
+		if err := rows.Scan(&rowid, &id); err != nil {
+			return nil, err
+		}
+		albumTracks[rowid] = append(albumTracks[rowid], id)
+		trackIDs = append(trackIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	langs, err := d.trackLanguages(ctx, trackIDs)
+	if err != nil {
+		return nil, err
+	}
+	for rowid, ids := range albumTracks {
+		if counts := countLanguages(langs, ids); counts != nil {
+			result[rowid] = counts
+		}
+	}
+	return result, nil
+}
+
+// languageCounts counts the tracks per language of performance, most
+// common first. A track sung in several languages counts once for each.
+func (d *DB) languageCounts(ctx context.Context, trackIDs []string) ([]models.LanguageCount, error) {
+	langs, err := d.trackLanguages(ctx, trackIDs)
+	if err != nil {
+		return nil, err
+	}
+	return countLanguages(langs, trackIDs), nil
+}
+
+// trackLanguages returns the languages of performance of each track that
+// has them, without duplicates
+func (d *DB) trackLanguages(ctx context.Context, trackIDs []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for start := 0; start < len(trackIDs); start += languageBatchSize {
+		batch := trackIDs[start:min(start+languageBatchSize, len(trackIDs))]
+
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			placeholders[i] = "?"
+			args[i] = id
+		}
+
+		rows, err := d.trackFiles.QueryContext(ctx, fmt.Sprintf(`
+			SELECT track_id, language_of_performance FROM track_files
+			WHERE track_id IN (%s) AND language_of_performance IS NOT NULL
+		`, strings.Join(placeholders, ",")), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id, langJSON string
+			if err := rows.Scan(&id, &langJSON); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			var langs []string
+			json.Unmarshal([]byte(langJSON), &langs)
+			seen := make(map[string]bool, len(langs))
+			for _, l := range langs {
+				if l != "" && !seen[l] {
+					seen[l] = true
+					result[id] = append(result[id], l)
+				}
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// countLanguages counts the tracks among trackIDs per language in langs,
+// most common first, or returns nil when none has a language
+func countLanguages(langs map[string][]string, trackIDs []string) []models.LanguageCount {
+	counts := make(map[string]int)
+	for _, id := range trackIDs {
+		for _, l := range langs[id] {
+			counts[l]++
+		}
+	}
+
+	if len(counts) == 0 {
+		return nil
+	}
+	result := make([]models.LanguageCount, 0, len(counts))
+	for l, n := range counts {
+		result = append(result, models.LanguageCount{Language: l, Tracks: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Tracks != result[j].Tracks {
+			return result[i].Tracks > result[j].Tracks
+		}
+		return result[i].Language < result[j].Language
+	})
+	return result
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// HasLyricsTable reports whether track_files ships a lyrics table
+func (d *DB) HasLyricsTable() bool {
+	if d.shards != nil {
+		return d.shards.any((*DB).HasLyricsTable)
+	}
+	return d.hasLyrics
+}
+
+// TrackHasLyrics returns the has_lyrics flag from track_files, or
+// ErrNotFound when the track has no track_files row.
+func (d *DB) TrackHasLyrics(ctx context.Context, trackID string) (bool, error) {
+	if d.shards != nil {
+		return route(d.shards, trackID, func(s *DB) (bool, error) { return s.TrackHasLyrics(ctx, trackID) })
+	}
+	if err := CheckID(trackID); err != nil {
+		return false, err
+	}
+
+	var hasLyrics sql.NullInt64
+	err := d.trackFiles.QueryRowContext(ctx, `
+		SELECT has_lyrics FROM track_files WHERE track_id = ?
+	`, trackID).Scan(&hasLyrics)
+	if err == sql.ErrNoRows {
+		return false, notFound("track_files row for track", trackID)
+	}
+	if err != nil {
+		return false, queryError(ctx, "query has_lyrics", err)
+	}
+	return hasLyrics.Int64 == 1, nil
+}
+
+// Lyrics returns plain and synced lyrics for a track. It returns
+// ErrNotFound when the lyrics table is absent or has no row for the track.
+func (d *DB) Lyrics(ctx context.Context, trackID string) (*models.Lyrics, error) {
+	if d.shards != nil {
+		return route(d.shards, trackID, func(s *DB) (*models.Lyrics, error) { return s.Lyrics(ctx, trackID) })
+	}
+	if !d.hasLyrics {
+		return nil, fmt.Errorf("lyrics table: %w", ErrNotFound)
+	}
+	if err := CheckID(trackID); err != nil {
+		return nil, err
+	}
+
+	var plain, lrc sql.NullString
+	err := d.trackFiles.QueryRowContext(ctx, `
+		SELECT plain_lyrics, synced_lyrics FROM lyrics WHERE track_id = ?
+	`, trackID).Scan(&plain, &lrc)
+	if err == sql.ErrNoRows {
+		return nil, notFound("lyrics for track", trackID)
+	}
+	if err != nil {
+		return nil, queryError(ctx, "scan lyrics", err)
+	}
+
+	l := &models.Lyrics{
+		TrackID: trackID,
+		Plain:   plain.String,
+		LRC:     lrc.String,
+		Synced:  parseLRC(lrc.String),
+	}
+	if l.Plain == "" && len(l.Synced) > 0 {
+		lines := make([]string, len(l.Synced))
+		for i, line := range l.Synced {
+			lines[i] = line.Text
+		}
+		l.Plain = strings.Join(lines, "\n")
+	}
+	return l, nil
+}
+
+// parseLRC parses "[mm:ss.xx] text" lines, skipping metadata tags like [ar:...]
+func parseLRC(lrc string) []models.LyricLine {
+	var out []models.LyricLine
+	for _, raw := range strings.Split(lrc, "\n") {
+		raw = strings.TrimSpace(raw)
+		if !strings.HasPrefix(raw, "[") {
+			continue
+		}
+		end := strings.IndexByte(raw, ']')
+		if end < 0 {
+			continue
+		}
+		ms, ok := parseLRCTime(raw[1:end])
+		if !ok {
+			continue
+		}
+		out = append(out, models.LyricLine{StartMs: ms, Text: strings.TrimSpace(raw[end+1:])})
+	}
+	return out
+}
+
+func parseLRCTime(s string) (int64, bool) {
+	min, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, false
+	}
+	m, err := strconv.Atoi(min)
+	if err != nil {
+		return 0, false
+	}
+	sec, err := strconv.ParseFloat(rest, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(m)*60000 + int64(math.Round(sec*1000)), true
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// Snapshots that carry availability data ship either or both of these
+// tables, each holding one row per ISO 3166-1 alpha-2 market. Tracks
+// without rows of their own inherit their album's markets when only
+// album_markets is present.
+const (
+	albumMarketsTable = "album_markets" // album_rowid, market
+	trackMarketsTable = "track_markets" // track_rowid, market
+)
+
+// HasMarkets reports whether the snapshot carries availability data
+func (d *DB) HasMarkets() bool {
+	if d.shards != nil {
+		return d.shards.any((*DB).HasMarkets)
+	}
+	return d.hasAlbumMarkets || d.hasTrackMarkets
+}
+
+// marketPredicate returns a condition that the track aliased t (on the
+// album aliased a) is available in the market bound to its placeholder
+func (d *DB) marketPredicate(t, a string) string {
+	if d.hasTrackMarkets {
+		return `EXISTS (SELECT 1 FROM ` + trackMarketsTable + ` m WHERE m.track_rowid = ` + t + `.rowid AND m.market = ?)`
+	}
+	return `EXISTS (SELECT 1 FROM ` + albumMarketsTable + ` m WHERE m.album_rowid = ` + a + `.rowid AND m.market = ?)`
+}
+
+// marketRefs collects the tracks and albums in a response, by ID, so their
+// available markets can be filled in with one query per table
+type marketRefs struct {
+	tracks map[string][]*models.Track
+	albums map[string][]*models.Album
+}
+
+func newMarketRefs() marketRefs {
+	return marketRefs{tracks: make(map[string][]*models.Track), albums: make(map[string][]*models.Album)}
+}
+
+func (r marketRefs) track(t *models.Track) {
+	if slices.Contains(r.tracks[t.ID], t) {
+		return
+	}
+	r.tracks[t.ID] = append(r.tracks[t.ID], t)
+	if t.Album != nil {
+		r.album(t.Album)
+	}
+}
+
+func (r marketRefs) album(a *models.Album) {
+	if slices.Contains(r.albums[a.ID], a) {
+		return
+	}
+	r.albums[a.ID] = append(r.albums[a.ID], a)
+	for i := range a.Tracks {
+		r.track(&a.Tracks[i])
+	}
+}
+
+// attachMarkets fills AvailableMarkets on the collected entities. Like
+// MBIDs this is best-effort: a failed query is logged and leaves the
+// fields empty.
+func (d *DB) attachMarkets(ctx context.Context, refs marketRefs) {
+	if !d.HasMarkets() {
+		return
+	}
+
+	if d.hasAlbumMarkets && len(refs.albums) > 0 {
+		err := collectMarkets(ctx, d, `
+			SELECT al.id, m.market FROM `+albumMarketsTable+` m
+			JOIN albums al ON al.rowid = m.album_rowid
+			WHERE al.id IN (%s)
+			ORDER BY m.market
+		`, refs.albums, func(a *models.Album, market string) {
+			a.AvailableMarkets = append(a.AvailableMarkets, market)
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "album markets", "err", err)
+		}
+	}
+
+	if len(refs.tracks) > 0 {
+		query := `
+			SELECT t.id, m.market FROM ` + trackMarketsTable + ` m
+			JOIN tracks t ON t.rowid = m.track_rowid
+			WHERE t.id IN (%s)
+			ORDER BY m.market
+		`
+		if !d.hasTrackMarkets {
+			query = `
+				SELECT t.id, m.market FROM ` + albumMarketsTable + ` m
+				JOIN tracks t ON t.album_rowid = m.album_rowid
+				WHERE t.id IN (%s)
+				ORDER BY m.market
+			`
+		}
+		err := collectMarkets(ctx, d, query, refs.tracks, func(t *models.Track, market string) {
+			t.AvailableMarkets = append(t.AvailableMarkets, market)
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "track markets", "err", err)
+		}
+	}
+
+	// An entity without rows is available nowhere, which is not the same as
+	// unknown, so report it as an empty list
+	for _, ts := range refs.tracks {
+		for _, t := range ts {
+			if t.AvailableMarkets == nil {
+				t.AvailableMarkets = []string{}
+			}
+		}
+	}
+	for _, as := range refs.albums {
+		for _, a := range as {
+			if a.AvailableMarkets == nil && d.hasAlbumMarkets {
+				a.AvailableMarkets = []string{}
+			}
+		}
+	}
+}
+
+// collectMarkets runs query, which selects (id, market) pairs for the IDs
+// substituted into its IN clause, and passes each market to add for every
+// entity with that ID
+func collectMarkets[E any](ctx context.Context, d *DB, query string, byID map[string][]*E, add func(*E, string)) error {
+	placeholders := make([]string, 0, len(byID))
+	args := make([]any, 0, len(byID))
+	for id := range byID {
+		placeholders = append(placeholders, "?")
+		args = append(args, id)
+	}
+
+	rows, err := d.main.QueryContext(ctx, fmt.Sprintf(query, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, market string
+		if err := rows.Scan(&id, &market); err != nil {
+			return err
+		}
+		for _, e := range byID[id] {
+			add(e, market)
+		}
+	}
+	return rows.Err()
+}
+
+// attachTrackMarkets is attachMarkets for a list of tracks
+func (d *DB) attachTrackMarkets(ctx context.Context, tracks []models.Track) {
+	if !d.HasMarkets() {
+		return
+	}
+	refs := newMarketRefs()
+	for i := range tracks {
+		refs.track(&tracks[i])
+	}
+	d.attachMarkets(ctx, refs)
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// MatchQuery narrows the candidate tracks for fuzzy matching
+type MatchQuery struct {
+	TitleTerm  string // substring every candidate name must contain
+	ArtistTerm string // substring of a credited artist's name; empty for any
+	MinMs      int64  // duration window; both zero disables it
+	MaxMs      int64
+	Limit      int
+}
+
+// MatchCandidates returns tracks that could match q, most popular first,
+// with album and artists filled in. With an artist term the search starts
+// from the matching artists' catalogs through track_artists, so it stays
+// cheap for common titles; it falls back to a title-only search when no
+// credited artist matches.
+func (d *DB) MatchCandidates(ctx context.Context, q MatchQuery) ([]models.Track, error) {
+	if d.shards != nil {
+		return d.shards.matchCandidates(ctx, q)
+	}
+	if q.Limit <= 0 || q.Limit > 100 {
+		q.Limit = 50
+	}
+
+	var durWhere string
+	var durArgs []any
+	if q.MinMs > 0 || q.MaxMs > 0 {
+		durWhere = ` AND t.duration_ms BETWEEN ? AND ?`
+		durArgs = []any{q.MinMs, q.MaxMs}
+	}
+
+	if q.ArtistTerm != "" {
+		where, args, err := d.searchFilter(ctx, artistSearch, nameQuery(q.ArtistTerm), 20, SearchSort{}, nil)
+		if err != nil {
+			return nil, queryError(ctx, "match artists", err)
+		}
+		artistRowIDs, err := d.rowIDs(ctx, `
+			SELECT rowid FROM artists WHERE `+where+` ORDER BY followers_total DESC LIMIT 20
+		`, args...)
+		if err != nil {
+			return nil, queryError(ctx, "match artists", err)
+		}
+
+		if len(artistRowIDs) > 0 {
+			placeholders := make([]string, len(artistRowIDs))
+			args := make([]any, 0, len(artistRowIDs)+4)
+			for i, id := range artistRowIDs {
+				placeholders[i] = "?"
+				args = append(args, id)
+			}
+			args = append(args, "%"+q.TitleTerm+"%")
+			args = append(args, durArgs...)
+			args = append(args, q.Limit)
+
+			tracks, err := d.matchTracks(ctx, `
+				FROM track_artists ta
+				JOIN tracks t ON t.rowid = ta.track_rowid
+				JOIN albums a ON t.album_rowid = a.rowid
+				WHERE ta.artist_rowid IN (`+strings.Join(placeholders, ",")+`)
+				  AND t.name LIKE ? COLLATE NOCASE`+durWhere+`
+				GROUP BY t.rowid
+			`, args)
+			if err != nil || len(tracks) > 0 {
+				return tracks, err
+			}
+		}
+	}
+
+	where, args, err := d.searchFilter(ctx, trackSearch, nameQuery(q.TitleTerm), q.Limit, SearchSort{}, nil)
+	if err != nil {
+		return nil, queryError(ctx, "match tracks", err)
+	}
+	args = append(args, durArgs...)
+	args = append(args, q.Limit)
+	return d.matchTracks(ctx, `
+		FROM tracks t
+		JOIN albums a ON t.album_rowid = a.rowid
+		WHERE `+where+durWhere, args)
+}
+
+func (d *DB) matchTracks(ctx context.Context, from string, args []any) ([]models.Track, error) {
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT t.id, t.name, t.external_id_isrc, t.duration_ms, t.explicit,
+		       t.track_number, t.disc_number, t.popularity, t.preview_url,
+		       a.id, a.name, a.album_type, a.label, a.release_date, a.release_date_precision,
+		       a.external_id_upc, a.total_tracks, a.copyright_c, a.copyright_p, a.rowid
+		`+from+`
+		ORDER BY t.popularity DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, queryError(ctx, "match tracks", err)
+	}
+	defer rows.Close()
+
+	var tracks []models.Track
+	for rows.Next() {
+		t, err := d.scanTrackWithAlbum(ctx, rows)
+		if err != nil {
+			return nil, queryError(ctx, "match tracks", err)
+		}
+		tracks = append(tracks, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "match tracks", err)
+	}
+	return tracks, nil
+}
+
+// rowIDs runs a query selecting a single integer column
+func (d *DB) rowIDs(ctx context.Context, query string, args ...any) ([]int64, error) {
+	rows, err := d.main.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// MusicBrainzFile is the optional sidecar holding the musicbrainz_ids
+// mapping when it is not shipped inside main_database.sqlite3:
+//
+//	CREATE TABLE musicbrainz_ids (type TEXT, spotify_id TEXT, mbid TEXT)
+//
+// type is one of MBIDTypes. A Spotify ID may map to several MBIDs and the
+// other way round; responses carry the first mapping for each ID.
+const MusicBrainzFile = "musicbrainz.sqlite3"
+
+// MBIDTypes are the entity types in musicbrainz_ids and in
+// GET /lookup/mbid/{type}/{mbid}
+var MBIDTypes = []string{"track", "album", "artist"}
+
+// openMusicBrainz finds the musicbrainz_ids table, preferring the main
+// database over the sidecar. Neither being present is not an error.
+func (d *DB) openMusicBrainz(ctx context.Context, pragmas string) error {
+	ok, err := tableExists(ctx, d.main.DB, "musicbrainz_ids")
+	if err != nil {
+		return fmt.Errorf("inspect main db: %w", err)
+	}
+	if ok {
+		d.mbids = d.main
+		return nil
+	}
+
+	path := filepath.Join(filepath.Dir(d.mainPath), MusicBrainzFile)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	m, err := sql.Open("sqlite", path+pragmas)
+	if err != nil {
+		return fmt.Errorf("open musicbrainz db: %w", err)
+	}
+	m.SetMaxOpenConns(4)
+
+	ok, err = tableExists(ctx, m, "musicbrainz_ids")
+	if err != nil {
+		m.Close()
+		return fmt.Errorf("inspect musicbrainz db: %w", err)
+	}
+	if !ok {
+		m.Close()
+		return fmt.Errorf("%s has no musicbrainz_ids table", path)
+	}
+
+	d.mbids = &conn{m, "musicbrainz"}
+	return nil
+}
+
+// HasMusicBrainz reports whether a musicbrainz_ids mapping is available
+func (d *DB) HasMusicBrainz() bool {
+	if d.shards != nil {
+		return d.shards.any((*DB).HasMusicBrainz)
+	}
+	return d.mbids != nil
+}
+
+// SpotifyIDsForMBID returns the Spotify IDs of the given type mapped to
+// mbid, in mapping order. It returns ErrNotFound when there is no mapping
+// table or no mapping for mbid.
+func (d *DB) SpotifyIDsForMBID(ctx context.Context, typ, mbid string) ([]string, error) {
+	if d.shards != nil {
+		return d.shards.spotifyIDsForMBID(ctx, typ, mbid)
+	}
+	if d.mbids == nil {
+		return nil, fmt.Errorf("musicbrainz_ids table: %w", ErrNotFound)
+	}
+
+	rows, err := d.mbids.QueryContext(ctx, `
+		SELECT spotify_id FROM musicbrainz_ids WHERE type = ? AND mbid = ? ORDER BY rowid
+	`, typ, strings.ToLower(mbid))
+	if err != nil {
+		return nil, queryError(ctx, "query mbid", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, queryError(ctx, "scan mbid", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "query mbid", err)
+	}
+	if len(ids) == 0 {
+		return nil, notFound(typ+" mbid", mbid)
+	}
+	return ids, nil
+}
+
+// mbidRefs collects the MBID fields of a response tree, keyed by type and
+// Spotify ID, so they can be filled with one query per type
+type mbidRefs map[string]map[string][]*string
+
+func (r mbidRefs) add(typ, id string, field *string) {
+	if r[typ] == nil {
+		r[typ] = make(map[string][]*string)
+	}
+	r[typ][id] = append(r[typ][id], field)
+}
+
+func (r mbidRefs) track(t *models.Track) {
+	r.add("track", t.ID, &t.MBID)
+	if t.Album != nil {
+		r.album(t.Album)
+	}
+	for i := range t.Artists {
+		r.artist(&t.Artists[i])
+	}
+}
+
+func (r mbidRefs) album(a *models.Album) {
+	r.add("album", a.ID, &a.MBID)
+	for i := range a.Artists {
+		r.artist(&a.Artists[i])
+	}
+	for i := range a.Tracks {
+		r.track(&a.Tracks[i])
+	}
+}
+
+func (r mbidRefs) artist(a *models.Artist) {
+	r.add("artist", a.ID, &a.MBID)
+}
+
+// attachMBIDs fills the collected MBID fields. Lookups are best-effort: a
+// failed query leaves the fields empty.
+func (d *DB) attachMBIDs(ctx context.Context, refs mbidRefs) {
+	if d.mbids == nil {
+		return
+	}
+
+	for typ, byID := range refs {
+		placeholders := make([]string, 0, len(byID))
+		args := make([]any, 0, len(byID)+1)
+		args = append(args, typ)
+		for id := range byID {
+			placeholders = append(placeholders, "?")
+			args = append(args, id)
+		}
+
+		rows, err := d.mbids.QueryContext(ctx, fmt.Sprintf(`
+			SELECT spotify_id, mbid FROM musicbrainz_ids
+			WHERE type = ? AND spotify_id IN (%s)
+			ORDER BY rowid
+		`, strings.Join(placeholders, ",")), args...)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+			var id, mbid string
+			if rows.Scan(&id, &mbid) != nil {
+				break
+			}
+			for _, field := range byID[id] {
+				if *field == "" {
+					*field = mbid
+				}
+			}
+		}
+		rows.Close()
+	}
+}
+
+// attachTrackMBIDs is attachMBIDs for a list of tracks
+func (d *DB) attachTrackMBIDs(ctx context.Context, tracks []models.Track) {
+	if d.mbids == nil {
+		return
+	}
+	refs := mbidRefs{}
+	for i := range tracks {
+		refs.track(&tracks[i])
+	}
+	d.attachMBIDs(ctx, refs)
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"sync/atomic"
+
+	"metadata-api/internal/models"
+)
+
+// nullCounts tracks how often a column that should always be populated came
+// back NULL. Such rows are served with zero values instead of failing the
+// whole request, and the counters show which fields a dump is missing.
+type nullCounts struct {
+	m sync.Map // field -> *atomic.Int64
+}
+
+func (n *nullCounts) inc(field string) {
+	v, _ := n.m.LoadOrStore(field, new(atomic.Int64))
+	v.(*atomic.Int64).Add(1)
+}
+
+func (n *nullCounts) snapshot() map[string]int64 {
+	out := make(map[string]int64)
+	n.m.Range(func(k, v any) bool {
+		out[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return out
+}
+
+// NullCounts returns, per table.column, how many NULLs were replaced with
+// defaults since startup
+func (d *DB) NullCounts() map[string]int64 {
+	if d.shards != nil {
+		return d.shards.nullCounts()
+	}
+	return d.nulls.snapshot()
+}
+
+func (n *nullCounts) str(field string, v sql.NullString) string {
+	if !v.Valid {
+		n.inc(field)
+	}
+	return v.String
+}
+
+func (n *nullCounts) int64(field string, v sql.NullInt64) int64 {
+	if !v.Valid {
+		n.inc(field)
+	}
+	return v.Int64
+}
+
+func (n *nullCounts) int(field string, v sql.NullInt64) int {
+	return int(n.int64(field, v))
+}
+
+func (n *nullCounts) bool(field string, v sql.NullBool) bool {
+	if !v.Valid {
+		n.inc(field)
+	}
+	return v.Bool
+}
+
+// trackScan holds nullable scan targets for the standard track columns:
+// id, name, external_id_isrc, duration_ms, explicit, track_number,
+// disc_number, popularity, preview_url
+type trackScan struct {
+	id, name, isrc, preview          sql.NullString
+	duration, trackNum, discNum, pop sql.NullInt64
+	explicit                         sql.NullBool
+}
+
+func (s *trackScan) dest() []any {
+	return []any{&s.id, &s.name, &s.isrc, &s.duration, &s.explicit,
+		&s.trackNum, &s.discNum, &s.pop, &s.preview}
+}
+
+func (s *trackScan) track(n *nullCounts) models.Track {
+	return models.Track{
+		ID:         n.str("tracks.id", s.id),
+		Name:       n.str("tracks.name", s.name),
+		ISRC:       s.isrc.String,
+		DurationMs: n.int64("tracks.duration_ms", s.duration),
+		Explicit:   n.bool("tracks.explicit", s.explicit),
+		TrackNum:   n.int("tracks.track_number", s.trackNum),
+		DiscNum:    n.int("tracks.disc_number", s.discNum),
+		Popularity: n.int("tracks.popularity", s.pop),
+		PreviewURL: s.preview.String,
+	}
+}
+
+// albumScan holds nullable scan targets for the standard album columns:
+// id, name, album_type, label, release_date, release_date_precision,
+// external_id_upc, total_tracks, copyright_c, copyright_p
+type albumScan struct {
+	id, name, typ, label, date, precision sql.NullString
+	upc, copyC, copyP                     sql.NullString
+	totalTracks                           sql.NullInt64
+}
+
+func (s *albumScan) dest() []any {
+	return []any{&s.id, &s.name, &s.typ, &s.label, &s.date, &s.precision,
+		&s.upc, &s.totalTracks, &s.copyC, &s.copyP}
+}
+
+func (s *albumScan) album(n *nullCounts) models.Album {
+	return models.Album{
+		ID:                   n.str("albums.id", s.id),
+		Name:                 n.str("albums.name", s.name),
+		Type:                 n.str("albums.album_type", s.typ),
+		Label:                n.str("albums.label", s.label),
+		ReleaseDate:          n.str("albums.release_date", s.date),
+		ReleaseDatePrecision: n.str("albums.release_date_precision", s.precision),
+		UPC:                  s.upc.String,
+		TotalTracks:          n.int("albums.total_tracks", s.totalTracks),
+		CopyrightC:           s.copyC.String,
+		CopyrightP:           s.copyP.String,
+	}
+}
+
+// artistScan holds nullable scan targets for id, name, followers_total, popularity
+type artistScan struct {
+	id, name              sql.NullString
+	followers, popularity sql.NullInt64
+}
+
+func (s *artistScan) dest() []any {
+	return []any{&s.id, &s.name, &s.followers, &s.popularity}
+}
+
+func (s *artistScan) artist(n *nullCounts) models.Artist {
+	return models.Artist{
+		ID:         n.str("artists.id", s.id),
+		Name:       n.str("artists.name", s.name),
+		Followers:  n.int64("artists.followers_total", s.followers),
+		Popularity: n.int("artists.popularity", s.popularity),
+	}
+}
+
+// imageScan holds nullable scan targets for url, width, height
+type imageScan struct {
+	url           sql.NullString
+	width, height sql.NullInt64
+}
+
+func (s *imageScan) dest() []any {
+	return []any{&s.url, &s.width, &s.height}
+}
+
+func (s *imageScan) image(n *nullCounts, table string) models.Image {
+	return models.Image{
+		URL:    n.str(table+".url", s.url),
+		Width:  n.int(table+".width", s.width),
+		Height: n.int(table+".height", s.height),
+	}
+}
+
+// scanArgs concatenates scan destinations
+func scanArgs(groups ...[]any) []any {
+	var out []any
+	for _, g := range groups {
+		out = append(out, g...)
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// requiredSchema lists the tables and columns queries depend on, per database
+var requiredSchema = map[string]map[string][]string{
+	"main": {
+		"tracks": {"id", "name", "external_id_isrc", "duration_ms", "explicit", "track_number",
+			"disc_number", "popularity", "preview_url", "album_rowid"},
+		"albums": {"id", "name", "album_type", "label", "release_date", "release_date_precision",
+			"external_id_upc", "total_tracks", "copyright_c", "copyright_p"},
+		"artists":       {"id", "name", "followers_total", "popularity"},
+		"track_artists": {"track_rowid", "artist_rowid"},
+		"artist_albums": {"artist_rowid", "album_rowid", "index_in_album"},
+		"artist_genres": {"artist_rowid", "genre"},
+		"album_images":  {"album_rowid", "url", "width", "height"},
+		"artist_images": {"artist_rowid", "url", "width", "height"},
+	},
+	"track_files": {
+		"track_files": {"track_id", "has_lyrics", "original_title", "version_title",
+			"language_of_performance", "artist_roles"},
+	},
+}
+
+// optionalSchema lists tables that enable extra features when present
+var optionalSchema = map[string]map[string][]string{
+	"main": {
+		"audio_features": {"track_id", "danceability", "energy", "key", "loudness", "mode",
+			"speechiness", "acousticness", "instrumentalness", "liveness", "valence", "tempo",
+			"time_signature"},
+		albumGenresTable: {"album_rowid", "genre"},
+	},
+	"track_files": {
+		"lyrics": {"track_id", "plain_lyrics", "synced_lyrics"},
+	},
+}
+
+// columns returns the column names of table, or nil if it does not exist
+func columns(ctx context.Context, c *conn, table string) (map[string]bool, error) {
+	rows, err := c.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols map[string]bool
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if cols == nil {
+			cols = make(map[string]bool)
+		}
+		cols[name] = true
+	}
+	return cols, rows.Err()
+}
+
+// missing returns "table" or "table.column" entries absent from c
+func missing(ctx context.Context, c *conn, schema map[string][]string) ([]string, error) {
+	var out []string
+	for table, want := range schema {
+		cols, err := columns(ctx, c, table)
+		if err != nil {
+			return nil, fmt.Errorf("inspect %s: %w", table, err)
+		}
+		if cols == nil {
+			out = append(out, table)
+			continue
+		}
+		for _, col := range want {
+			if !cols[col] {
+				out = append(out, table+"."+col)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// validateSchema fails with a list of every missing table and column, so a
+// wrong or truncated snapshot is caught at startup instead of as "no such
+// column" errors at request time. Optional tables that are present but
+// incomplete are disabled with a warning.
+func (d *DB) validateSchema(ctx context.Context) error {
+	conns := map[string]*conn{"main": d.main, "track_files": d.trackFiles}
+
+	var problems []string
+	for _, name := range []string{"main", "track_files"} {
+		miss, err := missing(ctx, conns[name], requiredSchema[name])
+		if err != nil {
+			return fmt.Errorf("%s db: %w", name, err)
+		}
+		for _, m := range miss {
+			problems = append(problems, name+":"+m)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("schema mismatch, missing %s", strings.Join(problems, ", "))
+	}
+
+	features := map[string]*bool{
+		"audio_features": &d.hasAudioFeatures,
+		"lyrics":         &d.hasLyrics,
+		albumGenresTable: &d.hasAlbumGenres,
+	}
+	for name, tables := range optionalSchema {
+		for table, cols := range tables {
+			enabled := features[table]
+			if !*enabled {
+				continue
+			}
+			miss, err := missing(ctx, conns[name], map[string][]string{table: cols})
+			if err != nil {
+				return fmt.Errorf("%s db: %w", name, err)
+			}
+			if len(miss) > 0 {
+				slog.WarnContext(ctx, "optional table incomplete, feature disabled", "table", table, "missing", miss)
+				*enabled = false
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// countLimit caps totals counted by scanning the main database, which
+// would otherwise cost as much again as the search. Totals above it are
+// reported as countLimit+1, a lower bound.
+const countLimit = 10000
+
+// CountArtists returns how many artists a search for query in the given
+// order can page through, up to countLimit+1 without the search index
+func (d *DB) CountArtists(ctx context.Context, query string, sort SearchSort) (int, error) {
+	if d.shards != nil {
+		return d.shards.count(func(d *DB) (int, error) { return d.CountArtists(ctx, query, sort) })
+	}
+	q, err := artistSearch.parse(query)
+	if err != nil {
+		return 0, err
+	}
+	if n, ok, err := d.countIndexed(ctx, artistSearch, q, sort, TrackFilter{}); ok || err != nil {
+		return n, err
+	}
+
+	where, args, err := d.searchFilter(ctx, artistSearch, q, sortCandidates, sort, nil)
+	if err != nil {
+		return 0, queryError(ctx, "count artists", err)
+	}
+	n, err := d.countScanned(ctx, `artists`, where, args)
+	if err != nil {
+		return 0, queryError(ctx, "count artists", err)
+	}
+	return n, nil
+}
+
+// CountTracks returns how many tracks matching filter a search for query
+// in the given order can page through. Served from the search index with a
+// filter, only the best sortCandidates matches are counted, as they are the
+// candidates a page is filtered from; languages are always counted that
+// way, since checking them takes a track_files lookup per track. Counted
+// without the index, totals stop at countLimit+1.
+func (d *DB) CountTracks(ctx context.Context, query string, sort SearchSort, filter TrackFilter) (int, error) {
+	if d.shards != nil {
+		return d.shards.count(func(d *DB) (int, error) { return d.CountTracks(ctx, query, sort, filter) })
+	}
+	if !d.HasMarkets() {
+		filter.Market = ""
+	}
+	q, err := trackSearch.parse(query)
+	if err != nil {
+		return 0, err
+	}
+	if n, ok, err := d.countIndexed(ctx, trackSearch, q, sort, filter); ok || err != nil {
+		return n, err
+	}
+
+	sort, key, err := trackSearch.resolve(sort, nil)
+	if err != nil {
+		return 0, err
+	}
+	where, args, err := d.searchFilter(ctx, trackSearch, q, sortCandidates, sort, nil)
+	if err != nil {
+		return 0, queryError(ctx, "count tracks", err)
+	}
+	filterWhere, filterArgs := filter.where(d.marketPredicate("t", "a"))
+	where += filterWhere
+	args = append(args, filterArgs...)
+	if filter.Language != "" {
+		ids, err := d.tracksInLanguage(ctx, where, args, trackSearch.orderBy(sort, key), sortCandidates, sortCandidates, filter.Language)
+		if err != nil {
+			return 0, queryError(ctx, "count tracks", err)
+		}
+		return len(ids), nil
+	}
+
+	n, err := d.countScanned(ctx, `tracks t JOIN albums a ON t.album_rowid = a.rowid`, where, args)
+	if err != nil {
+		return 0, queryError(ctx, "count tracks", err)
+	}
+	return n, nil
+}
+
+// countScanned counts the rows of from matching where in the main
+// database, stopping after countLimit+1
+func (d *DB) countScanned(ctx context.Context, from, where string, args []any) (int, error) {
+	var n int
+	err := d.main.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM (
+			SELECT 1 FROM `+from+`
+			WHERE `+where+`
+			LIMIT ?)`, append(args, countLimit+1)...).Scan(&n)
+	return n, err
+}
+
+// countIndexed counts the matches of an unfiltered search by name in its
+// default order straight from the search index, reporting false when the
+// search is anything else or there is no index. Other orders and queries
+// only reach the best sortCandidates matches, which are counted in the main
+// database instead.
+func (d *DB) countIndexed(ctx context.Context, spec searchSpec, q *queryNode, sort SearchSort, filter TrackFilter) (int, bool, error) {
+	sort, _, err := spec.resolve(sort, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	if d.search == nil || !filter.empty() || !q.nameOnly() || sort.Field != spec.rank || sort.Asc {
+		return 0, false, nil
+	}
+	match, args := q.nameFilter(`name LIKE ?`)
+	var n int
+	err = d.search.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, spec.fts, match), args...).Scan(&n)
+	if err != nil {
+		return 0, false, queryError(ctx, "count "+spec.fts, err)
+	}
+	return n, true, nil
+}
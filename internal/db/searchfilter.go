@@ -0,0 +1,66 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TrackFilter narrows track search results. The zero value matches
+// everything.
+type TrackFilter struct {
+	Explicit  *bool  // explicit or clean tracks only
+	YearFrom  int    // first release year, inclusive
+	YearTo    int    // last release year, inclusive
+	AlbumType string // album, single, or compilation
+	Market    string // available in this market; ignored without market data
+	Language  string // performed in this language code; matched against track_files, not by where
+}
+
+func (f TrackFilter) empty() bool {
+	return f.Explicit == nil && f.YearFrom == 0 && f.YearTo == 0 && f.AlbumType == "" && f.Market == "" && f.Language == ""
+}
+
+// where returns the predicates for f, each starting with AND. market is
+// the availability predicate from marketPredicate.
+func (f TrackFilter) where(market string) (string, []any) {
+	var where string
+	var args []any
+	if f.Explicit != nil {
+		where += ` AND COALESCE(t.explicit, 0) = ?`
+		args = append(args, *f.Explicit)
+	}
+	// release_date is YYYY, YYYY-MM, or YYYY-MM-DD, so years compare as
+	// string prefixes
+	if f.YearFrom > 0 {
+		where += ` AND a.release_date >= ?`
+		args = append(args, strconv.Itoa(f.YearFrom))
+	}
+	if f.YearTo > 0 {
+		where += ` AND a.release_date < ?`
+		args = append(args, strconv.Itoa(f.YearTo+1))
+	}
+	if f.AlbumType != "" {
+		where += ` AND a.album_type = ?`
+		args = append(args, f.AlbumType)
+	}
+	if f.Market != "" {
+		where += ` AND ` + market
+		args = append(args, f.Market)
+	}
+	return where, args
+}
+
+// ParseYears parses a release year, YYYY, or an inclusive range of them,
+// YYYY-YYYY
+func ParseYears(s string) (from, to int, ok bool) {
+	fromText, toText, isRange := strings.Cut(s, "-")
+	if !isRange {
+		toText = fromText
+	}
+	from, err1 := strconv.Atoi(fromText)
+	to, err2 := strconv.Atoi(toText)
+	if err1 != nil || err2 != nil || from < 1000 || to > 9999 || from > to {
+		return 0, 0, false
+	}
+	return from, to, true
+}
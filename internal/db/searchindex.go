@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SearchIndexFile is the sidecar database built by `metadatactl build-index`.
+// It lives next to main_database.sqlite3 and holds FTS5 tables for search.
+const SearchIndexFile = "search_index.sqlite3"
+
+// coveringIndexes are the lookups the serving path relies on. Snapshots
+// usually ship most of them under their own names, so an index is only
+// created when no existing index starts with the same columns.
+var coveringIndexes = []struct {
+	table   string
+	columns []string
+}{
+	{"tracks", []string{"id"}},
+	{"tracks", []string{"external_id_isrc", "popularity"}},
+	{"tracks", []string{"album_rowid", "disc_number", "track_number"}},
+	{"albums", []string{"id"}},
+	{"artists", []string{"id"}},
+	{"track_artists", []string{"track_rowid", "artist_rowid"}},
+	{"track_artists", []string{"artist_rowid", "track_rowid"}},
+	{"artist_albums", []string{"album_rowid", "artist_rowid"}},
+	{"artist_albums", []string{"artist_rowid", "album_rowid"}},
+	{"artist_genres", []string{"artist_rowid", "genre"}},
+	{"artist_genres", []string{"genre", "artist_rowid"}},
+	{"album_images", []string{"album_rowid", "width"}},
+	{"artist_images", []string{"artist_rowid", "width"}},
+}
+
+// EnsureIndexes creates any missing covering indexes in the database at
+// path, which must be writable. It returns the names of the indexes created.
+func EnsureIndexes(ctx context.Context, path string) ([]string, error) {
+	w, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer w.Close()
+
+	var created []string
+	for _, ix := range coveringIndexes {
+		exists, err := hasIndexPrefix(ctx, w, ix.table, ix.columns)
+		if err != nil {
+			return created, fmt.Errorf("inspect indexes on %s: %w", ix.table, err)
+		}
+		if exists {
+			continue
+		}
+		name := "idx_" + ix.table + "_" + strings.Join(ix.columns, "_")
+		stmt := fmt.Sprintf(`CREATE INDEX %s ON %s(%s)`, name, ix.table, strings.Join(ix.columns, ", "))
+		if _, err := w.ExecContext(ctx, stmt); err != nil {
+			return created, fmt.Errorf("create %s: %w", name, err)
+		}
+		created = append(created, name)
+	}
+
+	if len(created) > 0 {
+		if _, err := w.ExecContext(ctx, `ANALYZE`); err != nil {
+			return created, fmt.Errorf("analyze: %w", err)
+		}
+	}
+	return created, nil
+}
+
+// hasIndexPrefix reports whether table has an index whose leading columns
+// are exactly columns
+func hasIndexPrefix(ctx context.Context, w *sql.DB, table string, columns []string) (bool, error) {
+	rows, err := w.QueryContext(ctx, `SELECT name FROM pragma_index_list(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return false, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, name := range names {
+		rows, err := w.QueryContext(ctx, `SELECT name FROM pragma_index_info(?) ORDER BY seqno`, name)
+		if err != nil {
+			return false, err
+		}
+		var cols []string
+		for rows.Next() {
+			var col sql.NullString
+			if err := rows.Scan(&col); err != nil {
+				rows.Close()
+				return false, err
+			}
+			cols = append(cols, col.String)
+		}
+		rows.Close()
+		if len(cols) >= len(columns) && strings.Join(cols[:len(columns)], ",") == strings.Join(columns, ",") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BuildSearchIndex writes a sidecar FTS5 database for the snapshot at
+// mainPath to outPath. The trigram tokenizer keeps the substring semantics
+// of the LIKE-based search while letting SQLite use the index. The file is
+// built under a temporary name and renamed into place when complete.
+func BuildSearchIndex(ctx context.Context, mainPath, outPath string) error {
+	tmp := outPath + ".tmp"
+	os.Remove(tmp)
+
+	w, err := sql.Open("sqlite", tmp+"?_journal_mode=off&_synchronous=off")
+	if err != nil {
+		return fmt.Errorf("open %s: %w", tmp, err)
+	}
+	// ATTACH is per-connection, so pin everything to one
+	w.SetMaxOpenConns(1)
+	defer os.Remove(tmp)
+	defer w.Close()
+
+	src := strings.ReplaceAll(mainPath, "'", "''")
+	stmts := []string{
+		`ATTACH DATABASE '` + src + `' AS snap`,
+		`CREATE TABLE index_meta (key TEXT PRIMARY KEY, value TEXT)`,
+		`CREATE VIRTUAL TABLE artists_fts USING fts5(name, followers UNINDEXED, tokenize='trigram')`,
+		`INSERT INTO artists_fts(rowid, name, followers)
+		 SELECT rowid, name, followers_total FROM snap.artists WHERE name IS NOT NULL`,
+		`CREATE VIRTUAL TABLE tracks_fts USING fts5(name, popularity UNINDEXED, tokenize='trigram')`,
+		`INSERT INTO tracks_fts(rowid, name, popularity)
+		 SELECT rowid, name, popularity FROM snap.tracks WHERE name IS NOT NULL`,
+		`INSERT INTO artists_fts(artists_fts) VALUES ('optimize')`,
+		`INSERT INTO tracks_fts(tracks_fts) VALUES ('optimize')`,
+		`DETACH DATABASE snap`,
+	}
+	for _, stmt := range stmts {
+		if _, err := w.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("build search index: %w", err)
+		}
+	}
+	if _, err := w.ExecContext(ctx, `INSERT INTO index_meta VALUES ('dataset_version', ?)`, datasetVersion(mainPath)); err != nil {
+		return fmt.Errorf("build search index: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, outPath); err != nil {
+		return fmt.Errorf("install search index: %w", err)
+	}
+	return nil
+}
+
+// openSearchIndex opens the sidecar next to the main database if there is
+// one built for this dataset version. A missing or stale sidecar is not an
+// error; search then uses LIKE scans against the snapshot.
+func (d *DB) openSearchIndex(ctx context.Context, pragmas string) error {
+	path := filepath.Join(filepath.Dir(d.mainPath), SearchIndexFile)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	s, err := sql.Open("sqlite", path+pragmas)
+	if err != nil {
+		return fmt.Errorf("open search index: %w", err)
+	}
+	s.SetMaxOpenConns(8)
+
+	var version string
+	err = s.QueryRowContext(ctx, `SELECT value FROM index_meta WHERE key = 'dataset_version'`).Scan(&version)
+	if err != nil {
+		s.Close()
+		return fmt.Errorf("read search index: %w", err)
+	}
+	if version != d.version {
+		slog.Warn("ignoring stale search index", "path", path, "index_version", version)
+		s.Close()
+		return nil
+	}
+
+	d.search = &conn{s, "search_index"}
+	return nil
+}
+
+// HasSearchIndex reports whether search is served from the FTS5 sidecar
+func (d *DB) HasSearchIndex() bool {
+	if d.shards != nil {
+		return d.shards.any((*DB).HasSearchIndex)
+	}
+	return d.search != nil
+}
+
+// searchRowIDs returns the rowids of the best-ranked rows in an FTS table
+// whose name matches match, a predicate from queryNode.nameFilter. cond and
+// args restrict the rank further.
+func (d *DB) searchRowIDs(ctx context.Context, spec searchSpec, match string, matchArgs []any, cond string, args []any, limit int) ([]int64, error) {
+	rows, err := d.search.QueryContext(ctx, fmt.Sprintf(`
+		SELECT rowid FROM %s WHERE %s%s ORDER BY COALESCE(%s, -1) DESC, rowid DESC LIMIT ?
+	`, spec.fts, match, cond, spec.ftsRank), append(append(matchArgs, args...), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// searchFilter returns the WHERE clause selecting rows matching q and
+// that sort after c when it is non-nil. With a sidecar the rowids matching
+// q by name come from the FTS table, and only the rest of q is checked in
+// the main database; otherwise it is a LIKE scan on spec.column. The index
+// is ranked by the default sort, so for any other order, and for queries
+// the index can't check on its own, the best sortCandidates matches are
+// fetched.
+func (d *DB) searchFilter(ctx context.Context, spec searchSpec, q *queryNode, limit int, sort SearchSort, c *SearchCursor) (string, []any, error) {
+	sort, key, err := spec.resolve(sort, c)
+	if err != nil {
+		return "", nil, err
+	}
+	cond, condArgs, err := after(key.expr, spec.rowid(), key.numeric, sort.Asc, c)
+	if err != nil {
+		return "", nil, err
+	}
+	match, matchArgs := q.nameFilter(`name LIKE ?`)
+	if d.search == nil || match == "" {
+		where, args, err := q.where(d.queryTerm(ctx, spec))
+		if err != nil {
+			return "", nil, err
+		}
+		return where + cond, append(args, condArgs...), nil
+	}
+
+	var ftsCond string
+	var ftsArgs []any
+	if sort.Field == spec.rank && !sort.Asc {
+		ftsCond, ftsArgs, _ = after(`COALESCE(`+spec.ftsRank+`, -1)`, "rowid", true, false, c)
+	} else {
+		limit = sortCandidates
+	}
+	if !q.nameOnly() {
+		limit = sortCandidates
+	}
+	ids, err := d.searchRowIDs(ctx, spec, match, matchArgs, ftsCond, ftsArgs, limit)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(ids) == 0 {
+		return `0`, nil, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids), len(ids)+len(condArgs))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	where := spec.rowid() + ` IN (` + strings.Join(placeholders, ",") + `)`
+	if !q.nameOnly() {
+		rest, restArgs, err := q.where(d.queryTerm(ctx, spec))
+		if err != nil {
+			return "", nil, err
+		}
+		where += ` AND ` + rest
+		args = append(args, restArgs...)
+	}
+	return where + cond, append(args, condArgs...), nil
+}
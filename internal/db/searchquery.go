@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// queryQualifiers are the field prefixes a search query understands, as in
+// artist:radiohead. Any other word with a colon is plain text.
+var queryQualifiers = []string{"track", "artist", "album", "year"}
+
+// queryNode is a parsed search query: a term matching one field, or terms
+// joined by AND or OR. AND binds tighter than OR.
+//
+//	bohemian rhapsody               name contains "bohemian rhapsody"
+//	"under pressure" artist:queen   and an artist's name contains "queen"
+//	creep OR karma police           name contains "creep" or "karma police"
+//	album:"ok computer" year:1997   album name and release year
+//
+// Unquoted words next to each other form one phrase, so a query without
+// quotes, qualifiers, or operators is a single substring as it always was.
+// AND and OR are operators only in capitals and between two terms.
+type queryNode struct {
+	op    string       // AND or OR joining terms; "" for a term
+	terms []*queryNode // for AND and OR
+	field string       // a term's field: name, artist, album, or year
+	value string       // a term's text, or a year range for year
+}
+
+// nameQuery is a query for a name containing s, without any syntax
+func nameQuery(s string) *queryNode {
+	return &queryNode{field: "name", value: s}
+}
+
+// queryToken is a term or operator of a search query. Bare tokens are
+// unquoted, unqualified words, which join their bare neighbours into one
+// phrase spanning start to end of the query.
+type queryToken struct {
+	op         string
+	field      string
+	value      string
+	bare       bool
+	start, end int
+}
+
+// parse parses a search query for s, returning ErrInvalidQuery for
+// qualifiers s doesn't support and malformed years
+func (s searchSpec) parse(query string) (*queryNode, error) {
+	toks := tokenizeQuery(query)
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("%w: no search terms", ErrInvalidQuery)
+	}
+
+	// An operator needs a term on each side; otherwise it is a word
+	for i := range toks {
+		if toks[i].op != "" && (i == 0 || i == len(toks)-1 || toks[i-1].op != "" || toks[i+1].op != "") {
+			toks[i].op, toks[i].field, toks[i].value, toks[i].bare = "", "name", query[toks[i].start:toks[i].end], true
+		}
+	}
+
+	or := &queryNode{op: "OR"}
+	and := &queryNode{op: "AND"}
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.op == "OR":
+			or.terms = append(or.terms, and.simplify())
+			and = &queryNode{op: "AND"}
+			continue
+		case t.op == "AND":
+			continue
+		case t.bare:
+			for i+1 < len(toks) && toks[i+1].bare {
+				i++
+			}
+			t.value = query[t.start:toks[i].end]
+		}
+
+		field, ok := s.fields[t.field]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: is not supported by %s search", ErrInvalidQuery, t.field, s.kind)
+		}
+		if field == "year" {
+			if _, _, ok := ParseYears(t.value); !ok {
+				return nil, fmt.Errorf("%w: year: must be YYYY or YYYY-YYYY", ErrInvalidQuery)
+			}
+		}
+		and.terms = append(and.terms, &queryNode{field: field, value: t.value})
+	}
+	or.terms = append(or.terms, and.simplify())
+	return or.simplify(), nil
+}
+
+// simplify replaces a node joining a single term by the term
+func (n *queryNode) simplify() *queryNode {
+	if len(n.terms) == 1 {
+		return n.terms[0]
+	}
+	return n
+}
+
+// tokenizeQuery splits a query at whitespace outside quotes
+func tokenizeQuery(query string) []queryToken {
+	var toks []queryToken
+	for i := 0; i < len(query); {
+		if isQuerySpace(query[i]) {
+			i++
+			continue
+		}
+		t := queryToken{start: i, end: i}
+		for t.end < len(query) && !isQuerySpace(query[t.end]) {
+			t.end++
+		}
+		word := query[i:t.end]
+		qualifier, rest, qualified := strings.Cut(word, ":")
+		qualifier = strings.ToLower(qualifier)
+		switch {
+		case word == "AND" || word == "OR":
+			t.op = word
+		case word[0] == '"':
+			t.field = "name"
+			t.value, t.end = quotedPhrase(query, i)
+		case qualified && rest != "" && slices.Contains(queryQualifiers, qualifier):
+			t.field, t.value = qualifier, rest
+			if rest[0] == '"' {
+				t.value, t.end = quotedPhrase(query, i+len(qualifier)+1)
+			}
+		default:
+			t.field, t.value, t.bare = "name", word, true
+		}
+		if t.op != "" || strings.TrimSpace(t.value) != "" {
+			toks = append(toks, t)
+		}
+		i = t.end
+	}
+	return toks
+}
+
+// quotedPhrase returns the text of the phrase quoted at query[i] and where
+// it ends. An unclosed quote runs to the end of the query.
+func quotedPhrase(query string, i int) (string, int) {
+	j := strings.IndexByte(query[i+1:], '"')
+	if j < 0 {
+		return query[i+1:], len(query)
+	}
+	return query[i+1 : i+1+j], i + j + 2
+}
+
+func isQuerySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// nameOnly reports whether n only matches names, which the FTS sidecar
+// can evaluate on its own
+func (n *queryNode) nameOnly() bool {
+	if n.op == "" {
+		return n.field == "name"
+	}
+	for _, t := range n.terms {
+		if !t.nameOnly() {
+			return false
+		}
+	}
+	return true
+}
+
+// nameFilter renders what every match of n satisfies by its name alone,
+// with match as the predicate for one name pattern, or "" when n doesn't
+// narrow names down. For a nameOnly n it is all of n.
+func (n *queryNode) nameFilter(match string) (string, []any) {
+	if n.op == "" {
+		if n.field != "name" {
+			return "", nil
+		}
+		return match, []any{"%" + n.value + "%"}
+	}
+	var parts []string
+	var args []any
+	for _, t := range n.terms {
+		part, partArgs := t.nameFilter(match)
+		if part == "" {
+			if n.op == "OR" {
+				return "", nil
+			}
+			continue
+		}
+		parts = append(parts, part)
+		args = append(args, partArgs...)
+	}
+	switch len(parts) {
+	case 0:
+		return "", nil
+	case 1:
+		return parts[0], args
+	}
+	return `(` + strings.Join(parts, ` `+n.op+` `) + `)`, args
+}
+
+// where renders n as a predicate, with term rendering each of its terms
+func (n *queryNode) where(term func(field, value string) (string, []any, error)) (string, []any, error) {
+	if n.op == "" {
+		return term(n.field, n.value)
+	}
+	parts := make([]string, len(n.terms))
+	var args []any
+	for i, t := range n.terms {
+		part, partArgs, err := t.where(term)
+		if err != nil {
+			return "", nil, err
+		}
+		parts[i] = part
+		args = append(args, partArgs...)
+	}
+	return `(` + strings.Join(parts, ` `+n.op+` `) + `)`, args, nil
+}
+
+// queryTerm renders the terms of a search for spec on the main database.
+// With the sidecar, artist names are matched in its artists table, taking
+// the sortCandidates most followed artists.
+func (d *DB) queryTerm(ctx context.Context, spec searchSpec) func(field, value string) (string, []any, error) {
+	return func(field, value string) (string, []any, error) {
+		pattern := "%" + value + "%"
+		switch field {
+		case "album":
+			return `a.name LIKE ? COLLATE NOCASE`, []any{pattern}, nil
+		case "year":
+			// release_date is YYYY, YYYY-MM, or YYYY-MM-DD, so years
+			// compare as string prefixes
+			from, to, _ := ParseYears(value)
+			return `(a.release_date >= ? AND a.release_date < ?)`, []any{strconv.Itoa(from), strconv.Itoa(to + 1)}, nil
+		case "artist":
+			if d.search == nil {
+				return `t.rowid IN (
+					SELECT ta.track_rowid FROM track_artists ta
+					JOIN artists ar ON ar.rowid = ta.artist_rowid
+					WHERE ar.name LIKE ? COLLATE NOCASE)`, []any{pattern}, nil
+			}
+			ids, err := d.searchRowIDs(ctx, artistSearch, `name LIKE ?`, []any{pattern}, "", nil, sortCandidates)
+			if err != nil {
+				return "", nil, err
+			}
+			if len(ids) == 0 {
+				return `0`, nil, nil
+			}
+			args := make([]any, len(ids))
+			for i, id := range ids {
+				args[i] = id
+			}
+			return `t.rowid IN (SELECT track_rowid FROM track_artists WHERE artist_rowid IN (` + placeholders(len(ids)) + `))`, args, nil
+		}
+		return spec.column + ` LIKE ? COLLATE NOCASE`, []any{pattern}, nil
+	}
+}
@@ -0,0 +1,807 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"metadata-api/internal/models"
+)
+
+// A sharded snapshot is a directory with one subdirectory per shard, each
+// laid out like an ordinary snapshot: a main database plus its track_files
+// and optional sidecars. Shards must be self-contained, so the albums and
+// artists a shard's tracks reference are stored in that shard too, even if
+// that duplicates them in others.
+//
+// The optional ShardManifestFile assigns each shard a range of catalog IDs,
+// e.g.
+//
+//	{"shards": [{"dir": "a", "to": "8"}, {"dir": "b", "from": "8"}]}
+//
+// A range includes from and excludes to, and an omitted bound is open. IDs
+// compare bytewise, so 0-9 sort before A-Z before a-z. Lookups by ID go
+// straight to the owning shard, and search drops copies found outside it.
+// Without a manifest, or for an ID no range covers, every shard is asked and
+// the first hit in directory order wins; search can then only drop copies
+// that land on the same page, so shards sharing entities need a manifest.
+const (
+	ShardManifestFile = "shards.json"
+	shardMainFile     = "main_database.sqlite3"
+)
+
+type shardManifest struct {
+	Shards []shardRange `json:"shards"`
+}
+
+type shardRange struct {
+	Dir  string `json:"dir"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (r shardRange) contains(id string) bool {
+	return id >= r.From && (r.To == "" || id < r.To)
+}
+
+// shardSet is the set of open shards behind a DB opened on a directory
+type shardSet struct {
+	dbs    []*DB
+	names  []string
+	ranges []shardRange // parallel to dbs; nil without a manifest
+}
+
+// openShards opens every shard of the sharded snapshot in dir
+func openShards(dir string) (*DB, error) {
+	ranges, err := readShardManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if ranges != nil {
+		for _, r := range ranges {
+			names = append(names, r.Dir)
+		}
+	} else {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("open shards: %w", err)
+		}
+		for _, e := range entries {
+			if _, err := os.Stat(filepath.Join(dir, e.Name(), shardMainFile)); e.IsDir() && err == nil {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("open shards: no %s in any subdirectory of %s", shardMainFile, dir)
+	}
+
+	s := &shardSet{names: names, ranges: ranges}
+	h := fnv.New64a()
+	for _, name := range names {
+		d, err := Open(filepath.Join(dir, name, shardMainFile))
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("open shard %s: %w", name, err)
+		}
+		s.dbs = append(s.dbs, d)
+		fmt.Fprintf(h, "%s=%s;", name, d.version)
+	}
+
+	return &DB{
+		shards:   s,
+		mainPath: dir,
+		version:  fmt.Sprintf("%x", h.Sum64()),
+	}, nil
+}
+
+// readShardManifest returns the ranges in dir's manifest, or nil when there
+// is none. Overlapping ranges are rejected since an ID would have two
+// owners; gaps are allowed and fall back to asking every shard.
+func readShardManifest(dir string) ([]shardRange, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, ShardManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read shard manifest: %w", err)
+	}
+	var m shardManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parse shard manifest: %w", err)
+	}
+	if len(m.Shards) == 0 {
+		return nil, fmt.Errorf("shard manifest %s lists no shards", filepath.Join(dir, ShardManifestFile))
+	}
+
+	sorted := slices.Clone(m.Shards)
+	slices.SortFunc(sorted, func(a, b shardRange) int { return strings.Compare(a.From, b.From) })
+	for i, r := range sorted {
+		if r.Dir == "" || r.Dir != filepath.Base(r.Dir) {
+			return nil, fmt.Errorf("shard manifest: invalid dir %q", r.Dir)
+		}
+		if r.To != "" && r.To <= r.From {
+			return nil, fmt.Errorf("shard manifest: %s has an empty range", r.Dir)
+		}
+		if i > 0 && (sorted[i-1].To == "" || sorted[i-1].To > r.From) {
+			return nil, fmt.Errorf("shard manifest: %s and %s overlap", sorted[i-1].Dir, r.Dir)
+		}
+	}
+	return m.Shards, nil
+}
+
+func (s *shardSet) close() error {
+	var errs []error
+	for _, d := range s.dbs {
+		errs = append(errs, d.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// owner returns the index of the shard whose range holds id, or -1 when
+// every shard has to be asked
+func (s *shardSet) owner(id string) int {
+	for i, r := range s.ranges {
+		if r.contains(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// each runs fn on every shard concurrently and returns the first error in
+// shard order
+func (s *shardSet) each(fn func(i int, d *DB) error) error {
+	errs := make([]error, len(s.dbs))
+	var wg sync.WaitGroup
+	for i, d := range s.dbs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i, d)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// any reports whether has holds for some shard
+func (s *shardSet) any(has func(*DB) bool) bool {
+	return slices.ContainsFunc(s.dbs, has)
+}
+
+// partition splits ids by owning shard. IDs without an owner go to every
+// shard.
+func (s *shardSet) partition(ids []string) [][]string {
+	parts := make([][]string, len(s.dbs))
+	for _, id := range ids {
+		if i := s.owner(id); i >= 0 {
+			parts[i] = append(parts[i], id)
+			continue
+		}
+		for i := range parts {
+			parts[i] = append(parts[i], id)
+		}
+	}
+	return parts
+}
+
+// route runs fn on the shard owning id. Without an owner it runs on every
+// shard and returns the first result in shard order that isn't ErrNotFound.
+func route[T any](s *shardSet, id string, fn func(*DB) (T, error)) (T, error) {
+	if i := s.owner(id); i >= 0 {
+		return fn(s.dbs[i])
+	}
+
+	results := make([]T, len(s.dbs))
+	errs := make([]error, len(s.dbs))
+	s.each(func(i int, d *DB) error {
+		results[i], errs[i] = fn(d)
+		return nil
+	})
+	for i, err := range errs {
+		if err == nil {
+			return results[i], nil
+		}
+	}
+	for _, err := range errs {
+		if !errors.Is(err, ErrNotFound) {
+			return results[0], err
+		}
+	}
+	return results[0], errs[0]
+}
+
+// batch runs fn on every shard with the IDs it owns and merges the results.
+// An ID found in several shards keeps the first shard's value.
+func batch[V any](s *shardSet, ids []string, fn func(*DB, []string) (map[string]V, error)) (map[string]V, error) {
+	parts := s.partition(ids)
+	results := make([]map[string]V, len(s.dbs))
+	err := s.each(func(i int, d *DB) error {
+		if len(parts[i]) == 0 {
+			return nil
+		}
+		var err error
+		results[i], err = fn(d, parts[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]V)
+	for _, m := range results {
+		for k, v := range m {
+			if _, ok := merged[k]; !ok {
+				merged[k] = v
+			}
+		}
+	}
+	return merged, nil
+}
+
+// gather runs fn on every shard and concatenates the results in shard
+// order
+func gather[T any](s *shardSet, fn func(*DB) ([]T, error)) ([]T, error) {
+	results := make([][]T, len(s.dbs))
+	err := s.each(func(i int, d *DB) error {
+		var err error
+		results[i], err = fn(d)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat(results...), nil
+}
+
+// dedupe drops every element after the first with the same key, in place
+func dedupe[T any](items []T, key func(T) string) []T {
+	seen := make(map[string]bool, len(items))
+	return slices.DeleteFunc(items, func(t T) bool {
+		k := key(t)
+		if seen[k] {
+			return true
+		}
+		seen[k] = true
+		return false
+	})
+}
+
+// Rowids are per shard, so search cursors carry a global rowid that
+// interleaves them: shard i's rowid r becomes r*n + i. Ordering by the sort
+// key and then the global rowid keeps each shard's own order, so a cursor
+// translates back to a bound on every shard's rowids.
+
+func (s *shardSet) globalRowID(i int, rowid int64) int64 {
+	return rowid*int64(len(s.dbs)) + int64(i)
+}
+
+// shardCursor translates a global cursor to shard i, such that the shard's
+// rows after it are exactly those whose global rowid sorts after c's
+func (s *shardSet) shardCursor(i int, c *SearchCursor) *SearchCursor {
+	if c == nil {
+		return nil
+	}
+	local := *c
+	n, g := int64(len(s.dbs)), c.RowID-int64(i)
+	local.RowID = floorDiv(g, n)
+	if !c.Asc && local.RowID*n != g {
+		// Descending pages want rowids strictly below g/n
+		local.RowID++
+	}
+	return &local
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// shardSearch runs a search on every shard and merges the pages in sort
+// order. Results are only final up to the last one of the earliest-ending
+// full shard page, since that shard may have more before the others' later
+// results. Copies of an entity outside its owning shard, and duplicates
+// without a manifest, are dropped, so the shards are asked again from that
+// point until the page is full or they run out.
+func shardSearch[T any](s *shardSet, spec searchSpec, sort SearchSort, limit int, c *SearchCursor, id func(T) string, search func(d *DB, c *SearchCursor) ([]T, []SearchCursor, error)) ([]T, *SearchCursor, error) {
+	sort, key, err := spec.resolve(sort, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	order := func(a, b SearchCursor) int {
+		c := cmp.Or(key.compare(a.Key, b.Key), cmp.Compare(a.RowID, b.RowID))
+		if !sort.Asc {
+			c = -c
+		}
+		return c
+	}
+
+	type hit struct {
+		item  T
+		shard int
+		mark  SearchCursor
+	}
+	position := c.Position()
+	var items []T
+	seen := make(map[string]bool)
+	for {
+		pages := make([][]T, len(s.dbs))
+		marks := make([][]SearchCursor, len(s.dbs))
+		err := s.each(func(i int, d *DB) error {
+			var err error
+			pages[i], marks[i], err = search(d, s.shardCursor(i, c))
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var hits []hit
+		var frontier *SearchCursor
+		for i := range pages {
+			for j, item := range pages[i] {
+				mark := marks[i][j]
+				mark.RowID = s.globalRowID(i, mark.RowID)
+				hits = append(hits, hit{item, i, mark})
+			}
+			if len(pages[i]) == limit {
+				if last := hits[len(hits)-1].mark; frontier == nil || order(last, *frontier) < 0 {
+					frontier = &last
+				}
+			}
+		}
+		slices.SortFunc(hits, func(a, b hit) int { return order(a.mark, b.mark) })
+
+		for _, h := range hits {
+			if frontier != nil && order(h.mark, *frontier) > 0 {
+				break
+			}
+			k := id(h.item)
+			if o := s.owner(k); seen[k] || (o >= 0 && o != h.shard) {
+				continue
+			}
+			seen[k] = true
+			items = append(items, h.item)
+			if len(items) == limit {
+				h.mark.Offset = position + limit
+				return items, &h.mark, nil
+			}
+		}
+		if frontier == nil {
+			return items, nil, nil
+		}
+		c = frontier
+	}
+}
+
+func (s *shardSet) searchArtistPage(ctx context.Context, query string, limit int, sort SearchSort, c *SearchCursor) ([]models.Artist, *SearchCursor, error) {
+	return shardSearch(s, artistSearch, sort, limit, c, func(a models.Artist) string { return a.ID },
+		func(d *DB, c *SearchCursor) ([]models.Artist, []SearchCursor, error) {
+			return d.searchArtists(ctx, query, limit, sort, c)
+		})
+}
+
+func (s *shardSet) searchTrackPage(ctx context.Context, query string, limit int, sort SearchSort, filter TrackFilter, c *SearchCursor) ([]models.Track, *SearchCursor, error) {
+	return shardSearch(s, trackSearch, sort, limit, c, func(t models.Track) string { return t.ID },
+		func(d *DB, c *SearchCursor) ([]models.Track, []SearchCursor, error) {
+			return d.searchTracks(ctx, query, limit, sort, filter, c)
+		})
+}
+
+// count sums a search count over the shards. Entities copied into shards
+// other than their owner are counted once per copy.
+func (s *shardSet) count(fn func(*DB) (int, error)) (int, error) {
+	counts := make([]int, len(s.dbs))
+	err := s.each(func(i int, d *DB) error {
+		var err error
+		counts[i], err = fn(d)
+		return err
+	})
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total, err
+}
+
+// rankTracks orders tracks gathered from several shards the way a single
+// database would: available in market first when it is set, then most
+// popular. A track duplicated across shards is kept once.
+func rankTracks(tracks []models.Track, market string) []models.Track {
+	tracks = dedupe(tracks, func(t models.Track) string { return t.ID })
+	slices.SortStableFunc(tracks, func(a, b models.Track) int {
+		if market != "" {
+			if c := cmp.Compare(b2i(slices.Contains(b.AvailableMarkets, market)), b2i(slices.Contains(a.AvailableMarkets, market))); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(b.Popularity, a.Popularity)
+	})
+	return tracks
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *shardSet) lookupISRC(ctx context.Context, isrc, market string, limit int) ([]models.Track, error) {
+	tracks, err := gather(s, func(d *DB) ([]models.Track, error) { return d.lookupISRC(ctx, isrc, market, limit) })
+	if err != nil {
+		return nil, err
+	}
+	tracks = rankTracks(tracks, market)
+	if limit >= 0 {
+		tracks = tracks[:min(len(tracks), limit)]
+	}
+	return append([]models.Track{}, tracks...), nil
+}
+
+func (s *shardSet) batchLookupISRCs(ctx context.Context, isrcs []string) (map[string][]models.Track, error) {
+	results := make([]map[string][]models.Track, len(s.dbs))
+	err := s.each(func(i int, d *DB) error {
+		var err error
+		results[i], err = d.BatchLookupISRCs(ctx, isrcs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string][]models.Track)
+	for _, m := range results {
+		for isrc, tracks := range m {
+			merged[isrc] = append(merged[isrc], tracks...)
+		}
+	}
+	for isrc, tracks := range merged {
+		merged[isrc] = rankTracks(tracks, "")
+	}
+	return merged, nil
+}
+
+func (s *shardSet) matchCandidates(ctx context.Context, q MatchQuery) ([]models.Track, error) {
+	if q.Limit <= 0 || q.Limit > 100 {
+		q.Limit = 50
+	}
+	tracks, err := gather(s, func(d *DB) ([]models.Track, error) { return d.MatchCandidates(ctx, q) })
+	if err != nil {
+		return nil, err
+	}
+	tracks = rankTracks(tracks, "")
+	return tracks[:min(len(tracks), q.Limit)], nil
+}
+
+func (s *shardSet) radioCandidates(ctx context.Context, artistIDs, genres []string, limit int) ([]models.Track, error) {
+	tracks, err := gather(s, func(d *DB) ([]models.Track, error) { return d.RadioCandidates(ctx, artistIDs, genres, limit) })
+	if err != nil {
+		return nil, err
+	}
+	tracks = rankTracks(tracks, "")
+	return tracks[:min(len(tracks), limit)], nil
+}
+
+func (s *shardSet) spotifyIDsForMBID(ctx context.Context, typ, mbid string) ([]string, error) {
+	ids, err := gather(s, func(d *DB) ([]string, error) {
+		ids, err := d.SpotifyIDsForMBID(ctx, typ, mbid)
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return ids, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, notFound(typ+" mbid", mbid)
+	}
+	return dedupe(ids, func(id string) string { return id }), nil
+}
+
+func (s *shardSet) suggestIDs(ctx context.Context, table, id string) ([]string, error) {
+	ids, err := gather(s, func(d *DB) ([]string, error) { return d.SuggestIDs(ctx, table, id) })
+	if err != nil {
+		return nil, err
+	}
+	return dedupe(ids, func(id string) string { return id }), nil
+}
+
+// listGenres sums each genre's artist count over the shards. Artists stored
+// in several shards are counted once per shard.
+// listGenres counts each artist once per genre, however many shards hold a
+// copy of it
+func (s *shardSet) listGenres(ctx context.Context) ([]models.Genre, error) {
+	counts := make(map[string]int64)
+	err := s.mergeDistinct(ctx, `
+		SELECT g.genre, a.id, 1
+		FROM artist_genres g
+		JOIN artists a ON a.rowid = g.artist_rowid
+		ORDER BY g.genre, a.id`, func(genre, _ string, _ int64) {
+		counts[genre]++
+	})
+	if err != nil {
+		return nil, queryError(ctx, "list genres", err)
+	}
+	var genres []models.Genre
+	for name, n := range counts {
+		genres = append(genres, models.Genre{Name: name, ArtistCount: n})
+	}
+	slices.SortFunc(genres, func(a, b models.Genre) int {
+		return cmp.Or(cmp.Compare(b.ArtistCount, a.ArtistCount), strings.Compare(a.Name, b.Name))
+	})
+	return genres, nil
+}
+
+// genreArtists reads the first offset+limit artists of every shard, since
+// any of them could hold the page
+func (s *shardSet) genreArtists(ctx context.Context, genre string, limit, offset int) ([]models.Artist, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var artists []models.Artist
+	for _, d := range s.dbs {
+		var page []models.Artist
+		for n := 0; n < offset+limit; n += len(page) {
+			var err error
+			page, err = d.GenreArtists(ctx, genre, min(offset+limit-n, 50), n)
+			if err != nil {
+				return nil, err
+			}
+			artists = append(artists, page...)
+			if len(page) < min(offset+limit-n, 50) {
+				break
+			}
+		}
+	}
+
+	artists = dedupe(artists, func(a models.Artist) string { return a.ID })
+	slices.SortStableFunc(artists, func(a, b models.Artist) int { return cmp.Compare(b.Followers, a.Followers) })
+	if offset >= len(artists) {
+		return nil, nil
+	}
+	return artists[offset:min(len(artists), offset+limit)], nil
+}
+
+func (s *shardSet) genreAlbums(ctx context.Context, genre string, limit, offset int) ([]models.Album, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var albums []models.Album
+	for _, d := range s.dbs {
+		var page []models.Album
+		for n := 0; n < offset+limit; n += len(page) {
+			var err error
+			page, err = d.GenreAlbums(ctx, genre, min(offset+limit-n, 50), n)
+			if err != nil {
+				return nil, err
+			}
+			albums = append(albums, page...)
+			if len(page) < min(offset+limit-n, 50) {
+				break
+			}
+		}
+	}
+
+	albums = dedupe(albums, func(a models.Album) string { return a.ID })
+	slices.SortStableFunc(albums, func(a, b models.Album) int { return cmp.Compare(b.ReleaseDate, a.ReleaseDate) })
+	if offset >= len(albums) {
+		return nil, nil
+	}
+	return albums[offset:min(len(albums), offset+limit)], nil
+}
+
+// check reports each shard's databases under "<shard>/<database>"
+func (s *shardSet) check(ctx context.Context) map[string]models.DatabaseHealth {
+	checks := make([]map[string]models.DatabaseHealth, len(s.dbs))
+	s.each(func(i int, d *DB) error {
+		checks[i] = d.Check(ctx)
+		return nil
+	})
+
+	out := make(map[string]models.DatabaseHealth)
+	for i, c := range checks {
+		for name, h := range c {
+			out[s.names[i]+"/"+name] = h
+		}
+	}
+	return out
+}
+
+func (s *shardSet) stats(ctx context.Context, version string) (*models.Stats, error) {
+	all := make([]*models.Stats, len(s.dbs))
+	err := s.each(func(i int, d *DB) error {
+		var err error
+		all[i], err = d.Stats(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := &models.Stats{
+		DatasetVersion: version,
+		Files:          make(map[string]models.FileStats),
+	}
+	// Albums and artists are copied into every shard referencing them, so
+	// they and their images are counted once per ID; tracks aren't shared
+	distinct := []struct {
+		query string
+		dst   *int64
+	}{
+		{`SELECT id, '', 1 FROM albums ORDER BY id`, &out.Albums},
+		{`SELECT id, '', 1 FROM artists ORDER BY id`, &out.Artists},
+		{`SELECT a.id, '', COUNT(*) FROM album_images i JOIN albums a ON a.rowid = i.album_rowid GROUP BY a.id ORDER BY a.id`, &out.AlbumImages},
+		{`SELECT a.id, '', COUNT(*) FROM artist_images i JOIN artists a ON a.rowid = i.artist_rowid GROUP BY a.id ORDER BY a.id`, &out.ArtistImages},
+	}
+	for _, c := range distinct {
+		err := s.mergeDistinct(ctx, c.query, func(_, _ string, n int64) { *c.dst += n })
+		if err != nil {
+			return nil, queryError(ctx, "stats", err)
+		}
+	}
+	for i, st := range all {
+		out.Tracks += st.Tracks
+		out.TracksWithISRC += st.TracksWithISRC
+		out.TracksWithLyrics += st.TracksWithLyrics
+		for name, f := range st.Files {
+			out.Files[s.names[i]+"/"+name] = f
+		}
+		if st.SnapshotModifiedAt.After(out.SnapshotModifiedAt) {
+			out.SnapshotModifiedAt = st.SnapshotModifiedAt
+		}
+	}
+	out.ComputedAt = time.Now().UTC()
+	return out, nil
+}
+
+// mergeDistinct runs query, which selects a key, a subkey, and a count
+// ordered by key and subkey, on every shard, and calls fn once per
+// distinct key and subkey with the count of the first shard holding them.
+// The shards' rows are merged as they stream in, so no shard's keys are
+// held in memory.
+func (s *shardSet) mergeDistinct(ctx context.Context, query string, fn func(key, sub string, n int64)) error {
+	type head struct {
+		rows     *sql.Rows
+		key, sub string
+		n        int64
+		done     bool
+	}
+	heads := make([]*head, len(s.dbs))
+	defer func() {
+		for _, h := range heads {
+			if h != nil {
+				h.rows.Close()
+			}
+		}
+	}()
+	advance := func(h *head) error {
+		if !h.rows.Next() {
+			h.done = true
+			return h.rows.Err()
+		}
+		return h.rows.Scan(&h.key, &h.sub, &h.n)
+	}
+	for i, d := range s.dbs {
+		rows, err := d.main.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		heads[i] = &head{rows: rows}
+		if err := advance(heads[i]); err != nil {
+			return err
+		}
+	}
+
+	for {
+		// The first shard in order holding the smallest key wins
+		var first *head
+		for _, h := range heads {
+			if !h.done && (first == nil || cmp.Or(strings.Compare(h.key, first.key), strings.Compare(h.sub, first.sub)) < 0) {
+				first = h
+			}
+		}
+		if first == nil {
+			return nil
+		}
+		key, sub := first.key, first.sub
+		fn(key, sub, first.n)
+		for _, h := range heads {
+			if !h.done && h.key == key && h.sub == sub {
+				if err := advance(h); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (s *shardSet) nullCounts() map[string]int64 {
+	out := make(map[string]int64)
+	for _, d := range s.dbs {
+		for field, n := range d.NullCounts() {
+			out[field] += n
+		}
+	}
+	return out
+}
+
+// validate checks every shard, prefixing each result with its shard name
+func (s *shardSet) validate(ctx context.Context, quick bool) (ValidationReport, error) {
+	var rep ValidationReport
+	for i, d := range s.dbs {
+		r, err := d.Validate(ctx, quick)
+		if err != nil {
+			return rep, fmt.Errorf("shard %s: %w", s.names[i], err)
+		}
+		for _, res := range r.Integrity {
+			res.Database = s.names[i] + "/" + res.Database
+			rep.Integrity = append(rep.Integrity, res)
+		}
+		for _, o := range r.Orphans {
+			o.Name = s.names[i] + ": " + o.Name
+			rep.Orphans = append(rep.Orphans, o)
+		}
+	}
+	return rep, nil
+}
+
+// export streams each shard in turn, so rows are in rowid order within a
+// shard. The header is written once and the limit applies to the total.
+func (s *shardSet) export(ctx context.Context, spec ExportSpec, header func([]string) error, emit func([]any) error) error {
+	wroteHeader := false
+	onceHeader := func(cols []string) error {
+		if wroteHeader {
+			return nil
+		}
+		wroteHeader = true
+		return header(cols)
+	}
+
+	for _, d := range s.dbs {
+		n := 0
+		err := d.Export(ctx, spec, onceHeader, func(row []any) error {
+			n++
+			return emit(row)
+		})
+		if err != nil {
+			return err
+		}
+		if spec.Limit > 0 {
+			if spec.Limit -= n; spec.Limit <= 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// similarArtists caps how many artists sharing genres with the seeds
+// contribute candidates, and similarPerArtist how many of each artist's
+// most popular tracks are taken
+const (
+	similarArtists   = 20
+	similarPerArtist = 10
+)
+
+// SimilarCandidates returns up to limit tracks that could be recommended
+// alongside the track with id: the most popular tracks of its artists and
+// of the artists sharing the most genres with them, with album and artists
+// (and their genres) filled in. The track itself is left out.
+func (d *DB) SimilarCandidates(ctx context.Context, id string, limit int) ([]models.Track, error) {
+	if d.shards != nil {
+		return route(d.shards, id, func(s *DB) ([]models.Track, error) { return s.SimilarCandidates(ctx, id, limit) })
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 100
+	}
+	rowid, err := d.rowID(ctx, "track", id)
+	if err != nil {
+		return nil, err
+	}
+
+	artistRowIDs, err := d.rowIDs(ctx, `SELECT artist_rowid FROM track_artists WHERE track_rowid = ?`, rowid)
+	if err != nil {
+		return nil, queryError(ctx, "similar artists", err)
+	}
+	return d.candidatePool(ctx, artistRowIDs, nil, rowid, limit)
+}
+
+// RadioCandidates returns up to limit tracks for a radio seeded with the
+// artists with artistIDs and with genres: the most popular tracks of the
+// seed artists and of the artists sharing the most of the seed genres and
+// the seed artists' genres, filled in like SimilarCandidates. Unknown
+// artist IDs are skipped.
+func (d *DB) RadioCandidates(ctx context.Context, artistIDs, genres []string, limit int) ([]models.Track, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	if d.shards != nil {
+		return d.shards.radioCandidates(ctx, artistIDs, genres, limit)
+	}
+
+	var artistRowIDs []int64
+	for _, id := range artistIDs {
+		rowid, err := d.rowID(ctx, "artist", id)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidID) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		artistRowIDs = append(artistRowIDs, rowid)
+	}
+	return d.candidatePool(ctx, artistRowIDs, genres, 0, limit)
+}
+
+// candidatePool returns the most popular tracks of the seed artists and of
+// the artists sharing the most genres with them or with genres, leaving out
+// the track with rowid exclude
+func (d *DB) candidatePool(ctx context.Context, seeds []int64, genres []string, exclude int64, limit int) ([]models.Track, error) {
+	if len(seeds) == 0 && len(genres) == 0 {
+		return nil, nil
+	}
+
+	seedArgs := make([]any, len(seeds))
+	for i, r := range seeds {
+		seedArgs[i] = r
+	}
+	genreArgs := make([]any, len(genres))
+	for i, g := range genres {
+		genreArgs[i] = g
+	}
+	// SQLite accepts an empty IN list, so either kind of seed may be absent
+	args := append(append(append([]any{}, seedArgs...), genreArgs...), seedArgs...)
+	related, err := d.rowIDs(ctx, `
+		SELECT o.artist_rowid
+		FROM artist_genres o
+		JOIN artists a ON a.rowid = o.artist_rowid
+		WHERE (o.genre IN (SELECT genre FROM artist_genres WHERE artist_rowid IN (`+placeholders(len(seeds))+`))
+		       OR o.genre IN (`+placeholders(len(genres))+`))
+		  AND o.artist_rowid NOT IN (`+placeholders(len(seeds))+`)
+		GROUP BY o.artist_rowid
+		ORDER BY COUNT(*) DESC, a.followers_total DESC
+		LIMIT ?
+	`, append(args, similarArtists)...)
+	if err != nil {
+		return nil, queryError(ctx, "similar artists", err)
+	}
+
+	pool := append(seeds, related...)
+	if len(pool) == 0 {
+		return nil, nil
+	}
+	args = make([]any, 0, len(pool)+3)
+	for _, r := range pool {
+		args = append(args, r)
+	}
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT id FROM (
+			SELECT t.id, t.popularity,
+			       ROW_NUMBER() OVER (PARTITION BY ta.artist_rowid ORDER BY t.popularity DESC, t.rowid) AS n
+			FROM track_artists ta
+			JOIN tracks t ON t.rowid = ta.track_rowid
+			WHERE ta.artist_rowid IN (`+placeholders(len(pool))+`) AND t.rowid != ?
+		)
+		WHERE n <= ?
+		GROUP BY id
+		ORDER BY MAX(popularity) DESC
+		LIMIT ?
+	`, append(args, exclude, similarPerArtist, limit)...)
+	if err != nil {
+		return nil, queryError(ctx, "similar tracks", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, queryError(ctx, "similar tracks", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "similar tracks", err)
+	}
+
+	tracks := make([]models.Track, 0, len(ids))
+	for _, id := range ids {
+		t, err := d.LookupTrack(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, *t)
+	}
+	return tracks, nil
+}
+
+// placeholders returns n comma-separated ? placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
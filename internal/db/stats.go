@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"metadata-api/internal/models"
+)
+
+// statsCache holds the last computed stats. Counting a full snapshot takes
+// a while, so results are reused until the dataset version changes.
+type statsCache struct {
+	mu    sync.Mutex
+	stats *models.Stats
+}
+
+// Stats returns entity counts and file metadata for the snapshot
+func (d *DB) Stats(ctx context.Context) (*models.Stats, error) {
+	d.stats.mu.Lock()
+	defer d.stats.mu.Unlock()
+
+	if s := d.stats.stats; s != nil && s.DatasetVersion == d.version {
+		return s, nil
+	}
+	if d.shards != nil {
+		s, err := d.shards.stats(ctx, d.version)
+		if err != nil {
+			return nil, err
+		}
+		d.stats.stats = s
+		return s, nil
+	}
+
+	s := &models.Stats{
+		DatasetVersion: d.version,
+		Files:          make(map[string]models.FileStats),
+	}
+
+	counts := []struct {
+		conn  string
+		query string
+		dst   *int64
+	}{
+		{"main", `SELECT COUNT(*) FROM tracks`, &s.Tracks},
+		{"main", `SELECT COUNT(*) FROM albums`, &s.Albums},
+		{"main", `SELECT COUNT(*) FROM artists`, &s.Artists},
+		{"main", `SELECT COUNT(*) FROM album_images`, &s.AlbumImages},
+		{"main", `SELECT COUNT(*) FROM artist_images`, &s.ArtistImages},
+		{"main", `SELECT COUNT(*) FROM tracks WHERE external_id_isrc IS NOT NULL AND external_id_isrc != ''`, &s.TracksWithISRC},
+		{"track_files", `SELECT COUNT(*) FROM track_files WHERE has_lyrics = 1`, &s.TracksWithLyrics},
+	}
+	for _, c := range counts {
+		conn := d.main
+		if c.conn == "track_files" {
+			conn = d.trackFiles
+		}
+		if err := conn.QueryRowContext(ctx, c.query).Scan(c.dst); err != nil {
+			return nil, queryError(ctx, "stats", err)
+		}
+	}
+
+	for name, path := range map[string]string{"main": d.mainPath, "track_files": d.trackFilesPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, queryError(ctx, "stats", err)
+		}
+		s.Files[name] = models.FileStats{
+			Path:       path,
+			SizeBytes:  info.Size(),
+			ModifiedAt: info.ModTime().UTC(),
+		}
+		if name == "main" {
+			s.SnapshotModifiedAt = info.ModTime().UTC()
+		}
+	}
+
+	s.ComputedAt = time.Now().UTC()
+	d.stats.stats = s
+	return s, nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+
+	"metadata-api/internal/models"
+)
+
+// Store is the read API the HTTP handlers are written against. *DB is the
+// SQLite implementation; other backends, in-memory fakes, and decorators
+// such as caches can stand in for it. Implementations return the errors in
+// this package (ErrNotFound, ErrInvalidID, ErrTimeout, ...) so handlers map
+// them to status codes the same way.
+type Store interface {
+	DatasetVersion() string
+
+	// Capabilities of the snapshot
+	HasAudioFeatures() bool
+	HasLyricsTable() bool
+	HasMarkets() bool
+	HasMusicBrainz() bool
+	HasSearchIndex() bool
+
+	// Lookups by ID
+	LookupISRC(ctx context.Context, isrc string) ([]models.Track, error)
+	BestISRC(ctx context.Context, isrc, market string) (*models.Track, error)
+	LookupTrack(ctx context.Context, id string) (*models.Track, error)
+	LookupArtist(ctx context.Context, id string) (*models.Artist, error)
+	LookupAlbum(ctx context.Context, id string) (*models.Album, error)
+	GetAlbumTracks(ctx context.Context, albumID string) ([]models.Track, error)
+	TrackArtists(ctx context.Context, id string) ([]models.Artist, error)
+	AlbumArtists(ctx context.Context, id string) ([]models.Artist, error)
+	ArtistTracks(ctx context.Context, id, query string, limit, offset int) ([]models.Track, error)
+	ArtistLanguages(ctx context.Context, id string) ([]models.LanguageCount, error)
+	RelatedArtists(ctx context.Context, id string, limit int) ([]models.Artist, error)
+	Discography(ctx context.Context, id string, limit int, offsets map[string]int) (*models.Discography, error)
+	AudioFeatures(ctx context.Context, trackID string) (*models.AudioFeatures, error)
+	TrackHasLyrics(ctx context.Context, trackID string) (bool, error)
+	Lyrics(ctx context.Context, trackID string) (*models.Lyrics, error)
+	SpotifyIDsForMBID(ctx context.Context, typ, mbid string) ([]string, error)
+	SuggestIDs(ctx context.Context, table, id string) ([]string, error)
+	UPCTracks(ctx context.Context, upc string) ([]models.ReleaseTrack, error)
+
+	// Batches
+	BatchLookupTracks(ctx context.Context, ids []string) (map[string]*models.Track, error)
+	BatchLookupArtists(ctx context.Context, ids []string) (map[string]*models.Artist, error)
+	BatchLookupAlbums(ctx context.Context, ids []string) (map[string]*models.Album, error)
+	BatchLookupISRCs(ctx context.Context, isrcs []string) (map[string][]models.Track, error)
+	BatchAlbumTracks(ctx context.Context, albumIDs []string) (map[string][]models.Track, error)
+
+	// Search, browsing, and matching
+	SearchArtist(ctx context.Context, query string, limit int) ([]models.Artist, error)
+	SearchArtistPage(ctx context.Context, query string, limit int, sort SearchSort, c *SearchCursor) ([]models.Artist, *SearchCursor, error)
+	SearchTrack(ctx context.Context, query string, limit int) ([]models.Track, error)
+	SearchTrackPage(ctx context.Context, query string, limit int, sort SearchSort, filter TrackFilter, c *SearchCursor) ([]models.Track, *SearchCursor, error)
+	CountArtists(ctx context.Context, query string, sort SearchSort) (int, error)
+	CountTracks(ctx context.Context, query string, sort SearchSort, filter TrackFilter) (int, error)
+	ListGenres(ctx context.Context) ([]models.Genre, error)
+	GenreArtists(ctx context.Context, genre string, limit, offset int) ([]models.Artist, error)
+	GenreAlbums(ctx context.Context, genre string, limit, offset int) ([]models.Album, error)
+	MatchCandidates(ctx context.Context, q MatchQuery) ([]models.Track, error)
+	SimilarCandidates(ctx context.Context, id string, limit int) ([]models.Track, error)
+	RadioCandidates(ctx context.Context, artistIDs, genres []string, limit int) ([]models.Track, error)
+
+	// Operations
+	Check(ctx context.Context) map[string]models.DatabaseHealth
+	Ping(ctx context.Context) error
+	Stats(ctx context.Context) (*models.Stats, error)
+	NullCounts() map[string]int64
+}
+
+var _ Store = (*DB)(nil)
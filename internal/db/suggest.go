@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// idLength is the length of a base62 catalog ID
+const idLength = 22
+
+// confusables maps characters to the ones they are commonly mistaken for
+// when IDs are retyped or OCR'd from screenshots
+var confusables = map[rune][]rune{
+	'0': {'O', 'o'},
+	'O': {'0', 'o'},
+	'o': {'0', 'O'},
+	'1': {'l', 'I', 'i'},
+	'l': {'1', 'I', 'i'},
+	'I': {'1', 'l', 'i'},
+	'i': {'1', 'l', 'I'},
+	'|': {'1', 'l', 'I'},
+	'5': {'S', 's'},
+	'S': {'5', 's'},
+	's': {'5', 'S'},
+	'8': {'B'},
+	'B': {'8'},
+	'2': {'Z', 'z'},
+	'Z': {'2', 'z'},
+	'z': {'2', 'Z'},
+	'6': {'G', 'b'},
+	'G': {'6'},
+	'b': {'6'},
+	'9': {'g', 'q'},
+	'g': {'9', 'q'},
+	'q': {'9', 'g'},
+	'c': {'C'},
+	'C': {'c'},
+	'k': {'K'},
+	'K': {'k'},
+	'p': {'P'},
+	'P': {'p'},
+	'u': {'U', 'v'},
+	'U': {'u', 'V'},
+	'v': {'V', 'u'},
+	'V': {'v', 'U'},
+	'w': {'W'},
+	'W': {'w'},
+	'x': {'X'},
+	'X': {'x'},
+}
+
+// idCandidates returns every ID one confusable substitution away from id
+func idCandidates(id string) []string {
+	runes := []rune(id)
+	seen := map[string]bool{id: true}
+	var out []string
+	for i, r := range runes {
+		for _, alt := range confusables[r] {
+			c := make([]rune, len(runes))
+			copy(c, runes)
+			c[i] = alt
+			s := string(c)
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// SuggestIDs returns existing IDs in table that are one common typo away
+// from id. Only full-length IDs are considered.
+func (d *DB) SuggestIDs(ctx context.Context, table, id string) ([]string, error) {
+	if d.shards != nil {
+		return d.shards.suggestIDs(ctx, table, id)
+	}
+
+	switch table {
+	case "tracks", "albums", "artists":
+	default:
+		return nil, fmt.Errorf("suggest ids: unknown table %q", table)
+	}
+
+	id = strings.TrimSpace(id)
+	if len([]rune(id)) != idLength {
+		return nil, nil
+	}
+
+	candidates := idCandidates(id)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(candidates))
+	args := make([]interface{}, len(candidates))
+	for i, c := range candidates {
+		placeholders[i] = "?"
+		args[i] = c
+	}
+
+	query := fmt.Sprintf(`SELECT id FROM %s WHERE id IN (%s)`, table, strings.Join(placeholders, ","))
+	rows, err := d.main.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, queryError(ctx, "suggest ids", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, queryError(ctx, "scan id", err)
+		}
+		ids = append(ids, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "suggest ids", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,370 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"metadata-api/internal/models"
+)
+
+// Swap is a Store whose snapshot can be replaced while serving. Calls
+// already running finish on the snapshot they started on, which is closed
+// once the last of them returns.
+type Swap struct {
+	cur atomic.Pointer[swapped]
+}
+
+// swapped is a snapshot served by a Swap, with the calls using it
+type swapped struct {
+	*DB
+	calls   atomic.Int64
+	retired atomic.Bool
+	close   sync.Once
+}
+
+// NewSwap serves d until it is replaced
+func NewSwap(d *DB) *Swap {
+	s := &Swap{}
+	s.cur.Store(&swapped{DB: d})
+	return s
+}
+
+// Replace serves d from now on. The previous snapshot is closed once the
+// calls using it return.
+func (s *Swap) Replace(d *DB) {
+	old := s.cur.Swap(&swapped{DB: d})
+	old.retired.Store(true)
+	if old.calls.Load() == 0 {
+		old.close.Do(func() { old.DB.Close() })
+	}
+}
+
+// Current returns the snapshot being served. It stays open only as long
+// as it isn't replaced, so use it for configuration, not queries.
+func (s *Swap) Current() *DB {
+	return s.cur.Load().DB
+}
+
+// Close closes the snapshot being served
+func (s *Swap) Close() error {
+	return s.cur.Load().DB.Close()
+}
+
+// acquire returns the snapshot to run a call on, which the caller releases
+// when done
+func (s *Swap) acquire() *swapped {
+	for {
+		d := s.cur.Load()
+		d.calls.Add(1)
+		if !d.retired.Load() {
+			return d
+		}
+		// Replaced in the meantime; use its successor
+		d.release()
+	}
+}
+
+type pinnedKey struct{}
+
+// WithSnapshot makes the Swap calls made with ctx run on d rather than the
+// snapshot being served, for requests reading a historical snapshot. The
+// caller keeps d open until they return.
+func WithSnapshot(ctx context.Context, d *DB) context.Context {
+	return context.WithValue(ctx, pinnedKey{}, d)
+}
+
+// acquireFor is acquire for a call made with ctx, which may pin a snapshot
+func (s *Swap) acquireFor(ctx context.Context) *swapped {
+	if d, ok := ctx.Value(pinnedKey{}).(*DB); ok {
+		// Never retired, so releasing it closes nothing
+		return &swapped{DB: d}
+	}
+	return s.acquire()
+}
+
+func (d *swapped) release() {
+	if d.calls.Add(-1) == 0 && d.retired.Load() {
+		d.close.Do(func() { d.DB.Close() })
+	}
+}
+
+// ForEachImageURL runs on one snapshot throughout, even if it is replaced
+// in the meantime
+func (s *Swap) ForEachImageURL(ctx context.Context, fn func(url string) error) error {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.ForEachImageURL(ctx, fn)
+}
+
+func (s *Swap) DatasetVersion() string {
+	d := s.acquire()
+	defer d.release()
+	return d.DatasetVersion()
+}
+
+func (s *Swap) HasAudioFeatures() bool {
+	d := s.acquire()
+	defer d.release()
+	return d.HasAudioFeatures()
+}
+
+func (s *Swap) HasLyricsTable() bool {
+	d := s.acquire()
+	defer d.release()
+	return d.HasLyricsTable()
+}
+
+func (s *Swap) HasMarkets() bool {
+	d := s.acquire()
+	defer d.release()
+	return d.HasMarkets()
+}
+
+func (s *Swap) HasMusicBrainz() bool {
+	d := s.acquire()
+	defer d.release()
+	return d.HasMusicBrainz()
+}
+
+func (s *Swap) HasSearchIndex() bool {
+	d := s.acquire()
+	defer d.release()
+	return d.HasSearchIndex()
+}
+
+func (s *Swap) LookupISRC(ctx context.Context, isrc string) ([]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.LookupISRC(ctx, isrc)
+}
+
+func (s *Swap) BestISRC(ctx context.Context, isrc, market string) (*models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.BestISRC(ctx, isrc, market)
+}
+
+func (s *Swap) LookupTrack(ctx context.Context, id string) (*models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.LookupTrack(ctx, id)
+}
+
+func (s *Swap) LookupArtist(ctx context.Context, id string) (*models.Artist, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.LookupArtist(ctx, id)
+}
+
+func (s *Swap) LookupAlbum(ctx context.Context, id string) (*models.Album, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.LookupAlbum(ctx, id)
+}
+
+func (s *Swap) GetAlbumTracks(ctx context.Context, albumID string) ([]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.GetAlbumTracks(ctx, albumID)
+}
+
+func (s *Swap) TrackArtists(ctx context.Context, id string) ([]models.Artist, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.TrackArtists(ctx, id)
+}
+
+func (s *Swap) AlbumArtists(ctx context.Context, id string) ([]models.Artist, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.AlbumArtists(ctx, id)
+}
+
+func (s *Swap) ArtistTracks(ctx context.Context, id, query string, limit, offset int) ([]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.ArtistTracks(ctx, id, query, limit, offset)
+}
+
+func (s *Swap) ArtistLanguages(ctx context.Context, id string) ([]models.LanguageCount, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.ArtistLanguages(ctx, id)
+}
+
+func (s *Swap) RelatedArtists(ctx context.Context, id string, limit int) ([]models.Artist, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.RelatedArtists(ctx, id, limit)
+}
+
+func (s *Swap) Discography(ctx context.Context, id string, limit int, offsets map[string]int) (*models.Discography, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.Discography(ctx, id, limit, offsets)
+}
+
+func (s *Swap) AudioFeatures(ctx context.Context, trackID string) (*models.AudioFeatures, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.AudioFeatures(ctx, trackID)
+}
+
+func (s *Swap) TrackHasLyrics(ctx context.Context, trackID string) (bool, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.TrackHasLyrics(ctx, trackID)
+}
+
+func (s *Swap) Lyrics(ctx context.Context, trackID string) (*models.Lyrics, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.Lyrics(ctx, trackID)
+}
+
+func (s *Swap) SpotifyIDsForMBID(ctx context.Context, typ, mbid string) ([]string, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.SpotifyIDsForMBID(ctx, typ, mbid)
+}
+
+func (s *Swap) SuggestIDs(ctx context.Context, table, id string) ([]string, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.SuggestIDs(ctx, table, id)
+}
+
+func (s *Swap) UPCTracks(ctx context.Context, upc string) ([]models.ReleaseTrack, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.UPCTracks(ctx, upc)
+}
+
+func (s *Swap) BatchLookupTracks(ctx context.Context, ids []string) (map[string]*models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.BatchLookupTracks(ctx, ids)
+}
+
+func (s *Swap) BatchLookupArtists(ctx context.Context, ids []string) (map[string]*models.Artist, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.BatchLookupArtists(ctx, ids)
+}
+
+func (s *Swap) BatchLookupAlbums(ctx context.Context, ids []string) (map[string]*models.Album, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.BatchLookupAlbums(ctx, ids)
+}
+
+func (s *Swap) BatchLookupISRCs(ctx context.Context, isrcs []string) (map[string][]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.BatchLookupISRCs(ctx, isrcs)
+}
+
+func (s *Swap) BatchAlbumTracks(ctx context.Context, albumIDs []string) (map[string][]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.BatchAlbumTracks(ctx, albumIDs)
+}
+
+func (s *Swap) SearchArtist(ctx context.Context, query string, limit int) ([]models.Artist, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.SearchArtist(ctx, query, limit)
+}
+
+func (s *Swap) SearchArtistPage(ctx context.Context, query string, limit int, sort SearchSort, c *SearchCursor) ([]models.Artist, *SearchCursor, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.SearchArtistPage(ctx, query, limit, sort, c)
+}
+
+func (s *Swap) SearchTrack(ctx context.Context, query string, limit int) ([]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.SearchTrack(ctx, query, limit)
+}
+
+func (s *Swap) SearchTrackPage(ctx context.Context, query string, limit int, sort SearchSort, filter TrackFilter, c *SearchCursor) ([]models.Track, *SearchCursor, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.SearchTrackPage(ctx, query, limit, sort, filter, c)
+}
+
+func (s *Swap) CountArtists(ctx context.Context, query string, sort SearchSort) (int, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.CountArtists(ctx, query, sort)
+}
+
+func (s *Swap) CountTracks(ctx context.Context, query string, sort SearchSort, filter TrackFilter) (int, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.CountTracks(ctx, query, sort, filter)
+}
+
+func (s *Swap) ListGenres(ctx context.Context) ([]models.Genre, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.ListGenres(ctx)
+}
+
+func (s *Swap) GenreArtists(ctx context.Context, genre string, limit, offset int) ([]models.Artist, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.GenreArtists(ctx, genre, limit, offset)
+}
+
+func (s *Swap) GenreAlbums(ctx context.Context, genre string, limit, offset int) ([]models.Album, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.GenreAlbums(ctx, genre, limit, offset)
+}
+
+func (s *Swap) MatchCandidates(ctx context.Context, q MatchQuery) ([]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.MatchCandidates(ctx, q)
+}
+
+func (s *Swap) SimilarCandidates(ctx context.Context, id string, limit int) ([]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.SimilarCandidates(ctx, id, limit)
+}
+
+func (s *Swap) RadioCandidates(ctx context.Context, artistIDs, genres []string, limit int) ([]models.Track, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.RadioCandidates(ctx, artistIDs, genres, limit)
+}
+
+func (s *Swap) Check(ctx context.Context) map[string]models.DatabaseHealth {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.Check(ctx)
+}
+
+func (s *Swap) Ping(ctx context.Context) error {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.Ping(ctx)
+}
+
+func (s *Swap) Stats(ctx context.Context) (*models.Stats, error) {
+	d := s.acquireFor(ctx)
+	defer d.release()
+	return d.Stats(ctx)
+}
+
+func (s *Swap) NullCounts() map[string]int64 {
+	d := s.acquire()
+	defer d.release()
+	return d.NullCounts()
+}
+
+var _ Store = (*Swap)(nil)
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Trace records how one request's lookups were served. Handlers attach it
+// to the request context with WithTrace; shards of a request may record
+// into it concurrently.
+type Trace struct {
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context recording into a new Trace
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	t := new(Trace)
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// Cache is "hit" when every artist the request assembled came from memory,
+// the artist cache or the hot tables, and "miss" when any was read from
+// SQLite or nothing was cached
+func (t *Trace) Cache() string {
+	if t.cacheHits.Load() > 0 && t.cacheMisses.Load() == 0 {
+		return "hit"
+	}
+	return "miss"
+}
+
+// traceCache records a cache lookup into ctx's Trace, if it has one
+func traceCache(ctx context.Context, hit bool) {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	switch {
+	case t == nil:
+	case hit:
+		t.cacheHits.Add(1)
+	default:
+		t.cacheMisses.Add(1)
+	}
+}
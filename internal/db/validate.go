@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// IntegrityResult is the outcome of SQLite's integrity_check on one file
+type IntegrityResult struct {
+	Database string   `json:"database"`
+	OK       bool     `json:"ok"`
+	Messages []string `json:"messages,omitempty"`
+}
+
+// OrphanCheck counts rows whose reference points at a missing row
+type OrphanCheck struct {
+	Name    string  `json:"name"`
+	Orphans int64   `json:"orphans"`
+	Sample  []int64 `json:"sample_rowids,omitempty"`
+}
+
+// ValidationReport summarizes a full snapshot validation
+type ValidationReport struct {
+	Integrity []IntegrityResult `json:"integrity"`
+	Orphans   []OrphanCheck     `json:"orphans"`
+}
+
+// OK reports whether the snapshot passed every check
+func (r ValidationReport) OK() bool {
+	for _, i := range r.Integrity {
+		if !i.OK {
+			return false
+		}
+	}
+	for _, o := range r.Orphans {
+		if o.Orphans > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// orphanChecks are foreign-key style references within the main database
+var orphanChecks = []struct {
+	name  string
+	query string
+}{
+	{"tracks.album_rowid -> albums", `FROM tracks c WHERE NOT EXISTS (SELECT 1 FROM albums p WHERE p.rowid = c.album_rowid)`},
+	{"track_artists.track_rowid -> tracks", `FROM track_artists c WHERE NOT EXISTS (SELECT 1 FROM tracks p WHERE p.rowid = c.track_rowid)`},
+	{"track_artists.artist_rowid -> artists", `FROM track_artists c WHERE NOT EXISTS (SELECT 1 FROM artists p WHERE p.rowid = c.artist_rowid)`},
+	{"artist_albums.artist_rowid -> artists", `FROM artist_albums c WHERE NOT EXISTS (SELECT 1 FROM artists p WHERE p.rowid = c.artist_rowid)`},
+	{"artist_albums.album_rowid -> albums", `FROM artist_albums c WHERE NOT EXISTS (SELECT 1 FROM albums p WHERE p.rowid = c.album_rowid)`},
+	{"artist_genres.artist_rowid -> artists", `FROM artist_genres c WHERE NOT EXISTS (SELECT 1 FROM artists p WHERE p.rowid = c.artist_rowid)`},
+	{"album_images.album_rowid -> albums", `FROM album_images c WHERE NOT EXISTS (SELECT 1 FROM albums p WHERE p.rowid = c.album_rowid)`},
+	{"artist_images.artist_rowid -> artists", `FROM artist_images c WHERE NOT EXISTS (SELECT 1 FROM artists p WHERE p.rowid = c.artist_rowid)`},
+}
+
+// Validate runs integrity checks on both files and looks for orphaned rows.
+// On a full-size snapshot this reads every table and can take a long time.
+// quick uses quick_check, which skips index/table consistency checks.
+func (d *DB) Validate(ctx context.Context, quick bool) (ValidationReport, error) {
+	if d.shards != nil {
+		return d.shards.validate(ctx, quick)
+	}
+
+	var rep ValidationReport
+
+	pragma := "integrity_check"
+	if quick {
+		pragma = "quick_check"
+	}
+	for _, c := range []struct {
+		name string
+		conn *conn
+	}{{"main", d.main}, {"track_files", d.trackFiles}} {
+		res, err := integrity(ctx, c.conn, pragma)
+		if err != nil {
+			return rep, fmt.Errorf("%s %s: %w", c.name, pragma, err)
+		}
+		res.Database = c.name
+		rep.Integrity = append(rep.Integrity, res)
+	}
+
+	for _, oc := range orphanChecks {
+		check := OrphanCheck{Name: oc.name}
+		if err := d.main.QueryRowContext(ctx, `SELECT COUNT(*) `+oc.query).Scan(&check.Orphans); err != nil {
+			return rep, fmt.Errorf("orphan check %s: %w", oc.name, err)
+		}
+		if check.Orphans > 0 {
+			sample, err := d.orphanSample(ctx, oc.query)
+			if err != nil {
+				return rep, fmt.Errorf("orphan sample %s: %w", oc.name, err)
+			}
+			check.Sample = sample
+		}
+		rep.Orphans = append(rep.Orphans, check)
+	}
+
+	tf, err := d.trackFilesOrphans(ctx)
+	if err != nil {
+		return rep, err
+	}
+	rep.Orphans = append(rep.Orphans, tf)
+
+	return rep, nil
+}
+
+func integrity(ctx context.Context, c *conn, pragma string) (IntegrityResult, error) {
+	rows, err := c.QueryContext(ctx, `PRAGMA `+pragma)
+	if err != nil {
+		return IntegrityResult{}, err
+	}
+	defer rows.Close()
+
+	res := IntegrityResult{OK: true}
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return res, err
+		}
+		if msg != "ok" {
+			res.OK = false
+			res.Messages = append(res.Messages, msg)
+		}
+	}
+	return res, rows.Err()
+}
+
+func (d *DB) orphanSample(ctx context.Context, from string) ([]int64, error) {
+	rows, err := d.main.QueryContext(ctx, `SELECT c.rowid `+from+` LIMIT 10`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// trackFilesOrphans finds track_files rows with no matching track. The two
+// files are separate databases, so the main file is attached to a dedicated
+// connection for the duration of the check.
+func (d *DB) trackFilesOrphans(ctx context.Context) (OrphanCheck, error) {
+	check := OrphanCheck{Name: "track_files.track_id -> tracks"}
+
+	c, err := d.trackFiles.Conn(ctx)
+	if err != nil {
+		return check, err
+	}
+	defer c.Close()
+
+	path := strings.ReplaceAll(d.mainPath, "'", "''")
+	if _, err := c.ExecContext(ctx, `ATTACH DATABASE '`+path+`' AS snap`); err != nil {
+		return check, fmt.Errorf("attach main db: %w", err)
+	}
+	defer c.ExecContext(context.Background(), `DETACH DATABASE snap`)
+
+	from := `FROM track_files c WHERE NOT EXISTS (SELECT 1 FROM snap.tracks p WHERE p.id = c.track_id)`
+	if err := c.QueryRowContext(ctx, `SELECT COUNT(*) `+from).Scan(&check.Orphans); err != nil {
+		return check, fmt.Errorf("orphan check %s: %w", check.Name, err)
+	}
+	if check.Orphans > 0 {
+		rows, err := c.QueryContext(ctx, `SELECT c.rowid `+from+` LIMIT 10`)
+		if err != nil {
+			return check, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return check, err
+			}
+			check.Sample = append(check.Sample, id)
+		}
+	}
+	return check, nil
+}
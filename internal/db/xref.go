@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"metadata-api/internal/models"
+)
+
+// UPCTracks returns the tracks of the albums with the UPC, with their ISRCs
+// and positions, in album, disc, and track order. upc may be a UPC-A or an
+// EAN-13, EAN-8, or GTIN-14 for the same product; see barcodeForms. It
+// returns an empty list when no album has the UPC.
+func (d *DB) UPCTracks(ctx context.Context, upc string) ([]models.ReleaseTrack, error) {
+	forms, err := barcodeForms(upc)
+	if err != nil {
+		return nil, err
+	}
+	if d.shards != nil {
+		tracks, err := gather(d.shards, func(s *DB) ([]models.ReleaseTrack, error) { return s.UPCTracks(ctx, upc) })
+		if err != nil {
+			return nil, err
+		}
+		tracks = dedupe(tracks, func(t models.ReleaseTrack) string { return t.TrackID })
+		sortReleaseTracks(tracks)
+		return append([]models.ReleaseTrack{}, tracks...), nil
+	}
+
+	args := make([]any, len(forms))
+	for i, f := range forms {
+		args[i] = f
+	}
+	rows, err := d.main.QueryContext(ctx, `
+		SELECT a.id, t.id, t.name, t.external_id_isrc, t.disc_number, t.track_number
+		FROM albums a
+		JOIN tracks t ON t.album_rowid = a.rowid
+		WHERE a.external_id_upc IN (`+placeholders(len(forms))+`)
+	`, args...)
+	if err != nil {
+		return nil, queryError(ctx, "upc tracks", err)
+	}
+	defer rows.Close()
+
+	tracks := []models.ReleaseTrack{}
+	for rows.Next() {
+		var albumID, trackID, name, isrc sql.NullString
+		var disc, number sql.NullInt64
+		if err := rows.Scan(&albumID, &trackID, &name, &isrc, &disc, &number); err != nil {
+			return nil, queryError(ctx, "upc tracks", err)
+		}
+		tracks = append(tracks, models.ReleaseTrack{
+			ISRC:        isrc.String,
+			TrackID:     trackID.String,
+			Name:        name.String,
+			AlbumID:     albumID.String,
+			DiscNumber:  int(disc.Int64),
+			TrackNumber: int(number.Int64),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, "upc tracks", err)
+	}
+	sortReleaseTracks(tracks)
+	return tracks, nil
+}
+
+func sortReleaseTracks(tracks []models.ReleaseTrack) {
+	sort.Slice(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.AlbumID != b.AlbumID {
+			return a.AlbumID < b.AlbumID
+		}
+		if a.DiscNumber != b.DiscNumber {
+			return a.DiscNumber < b.DiscNumber
+		}
+		return a.TrackNumber < b.TrackNumber
+	})
+}
@@ -0,0 +1,123 @@
+package images
+
+import (
+	"container/list"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// usage tracks the images on disk by when they were last served, so the
+// cache can drop the least recently used once it outgrows its limit
+type usage struct {
+	max int64
+
+	mu    sync.Mutex
+	total int64
+	order *list.List               // of *cached, most recently used first
+	files map[string]*list.Element // hash -> element of order
+}
+
+type cached struct {
+	hash string
+	size int64
+}
+
+// LimitSize keeps the disk cache under maxBytes by removing the least
+// recently served images when a download would exceed it. It indexes the
+// images already on disk, taking the time they were written as their last
+// use, and removes the oldest right away if they exceed the limit.
+func (c *Cache) LimitSize(maxBytes int64) error {
+	if c.dir == "" || maxBytes <= 0 {
+		return nil
+	}
+
+	type found struct {
+		cached
+		mtime time.Time
+	}
+	var files []found
+	err := filepath.WalkDir(c.dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() || !hashPattern.MatchString(e.Name()) {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, found{cached{e.Name(), info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("index image cache: %w", err)
+	}
+	slices.SortFunc(files, func(a, b found) int { return b.mtime.Compare(a.mtime) })
+
+	u := &usage{max: maxBytes, order: list.New(), files: make(map[string]*list.Element, len(files))}
+	for _, f := range files {
+		u.files[f.hash] = u.order.PushBack(&f.cached)
+		u.total += f.size
+	}
+	c.usage = u
+	c.evict()
+	slog.Info("image cache limited", "images", len(files), "bytes", u.total, "max_bytes", maxBytes)
+	return nil
+}
+
+// used marks hash as just served
+func (u *usage) used(hash string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if e, ok := u.files[hash]; ok {
+		u.order.MoveToFront(e)
+	}
+}
+
+// added records a newly stored image
+func (u *usage) added(hash string, size int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if e, ok := u.files[hash]; ok {
+		u.total -= e.Value.(*cached).size
+		u.order.Remove(e)
+	}
+	u.files[hash] = u.order.PushFront(&cached{hash, size})
+	u.total += size
+}
+
+// victims takes the least recently used images off the index until the
+// rest fit, always keeping the most recent
+func (u *usage) victims() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var out []string
+	for u.total > u.max && u.order.Len() > 1 {
+		c := u.order.Remove(u.order.Back()).(*cached)
+		delete(u.files, c.hash)
+		u.total -= c.size
+		out = append(out, c.hash)
+	}
+	return out
+}
+
+// evict removes the images over the limit from disk. An image being
+// served as it is removed is read whole or not found, and then fetched
+// again.
+func (c *Cache) evict() {
+	if c.usage == nil {
+		return
+	}
+	for _, hash := range c.usage.victims() {
+		if err := os.Remove(c.path(hash)); err != nil && !os.IsNotExist(err) {
+			slog.Warn("evict cached image", "hash", hash, "err", err)
+		}
+	}
+}
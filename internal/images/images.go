@@ -0,0 +1,225 @@
+// Package images fetches Spotify artwork from the image CDN and keeps a
+// content-addressed copy on disk, so clients can use this server as their
+// only upstream for artwork.
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultUpstream is where image hashes are fetched from
+const DefaultUpstream = "https://i.scdn.co/image/"
+
+// maxImageBytes bounds a single download; the largest covers are ~300KB
+const maxImageBytes = 10 << 20
+
+var (
+	// ErrInvalidHash is returned for anything that is not a CDN image hash
+	ErrInvalidHash = errors.New("invalid image hash")
+	// ErrNotFound is returned when the upstream has no such image
+	ErrNotFound = errors.New("image not found")
+	// ErrNoVariant is returned when a size is requested that the image family lacks
+	ErrNoVariant = errors.New("size not available for this image")
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// variants maps the 16-character hash prefix that encodes an image's size
+// to the other sizes of the same family. The remaining 24 characters
+// identify the artwork and are shared by every size.
+var variants = []map[int]string{
+	{640: "ab67616d0000b273", 300: "ab67616d00001e02", 64: "ab67616d00004851"},  // album covers
+	{640: "ab6761610000e5eb", 320: "ab67616100005174", 160: "ab6761610000f178"}, // artist images
+}
+
+// Cache serves images from dir, fetching misses from upstream. An empty dir
+// disables the disk cache and every request goes upstream. Concurrent
+// misses for one image share a single download.
+type Cache struct {
+	dir      string
+	upstream string
+	client   *http.Client
+	fetches  singleflight.Group
+	usage    *usage // set by LimitSize
+}
+
+// New returns a Cache. upstream defaults to DefaultUpstream.
+func New(dir, upstream string) *Cache {
+	if upstream == "" {
+		upstream = DefaultUpstream
+	}
+	return &Cache{
+		dir:      dir,
+		upstream: upstream,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// HashFromURL returns the image hash at the end of a CDN URL as stored in
+// the snapshot, or "" for any other URL
+func HashFromURL(url string) string {
+	hash, ok := strings.CutPrefix(url, DefaultUpstream)
+	if !ok || !hashPattern.MatchString(hash) {
+		return ""
+	}
+	return hash
+}
+
+// Rewriter returns a function mapping CDN image URLs to base+hash, where
+// base is the public prefix of /images/. Other URLs pass through.
+func Rewriter(base string) func(string) string {
+	return func(url string) string {
+		if hash := HashFromURL(url); hash != "" {
+			return base + hash
+		}
+		return url
+	}
+}
+
+// Variant returns the hash of the same artwork at width size
+func Variant(hash string, size int) (string, error) {
+	if !hashPattern.MatchString(hash) {
+		return "", ErrInvalidHash
+	}
+	prefix, id := hash[:16], hash[16:]
+	for _, family := range variants {
+		for _, p := range family {
+			if p != prefix {
+				continue
+			}
+			if v, ok := family[size]; ok {
+				return v + id, nil
+			}
+			return "", ErrNoVariant
+		}
+	}
+	return "", ErrNoVariant
+}
+
+// Get returns the image bytes for hash and whether they came from disk
+func (c *Cache) Get(ctx context.Context, hash string) ([]byte, bool, error) {
+	if !hashPattern.MatchString(hash) {
+		return nil, false, ErrInvalidHash
+	}
+
+	if c.dir != "" {
+		data, err := os.ReadFile(c.path(hash))
+		if err == nil {
+			if c.usage != nil {
+				c.usage.used(hash)
+			}
+			return data, true, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, false, fmt.Errorf("read cached image: %w", err)
+		}
+	}
+
+	// The download outlives a caller that gives up, as others may be
+	// waiting for it; the client's timeout still bounds it
+	ch := c.fetches.DoChan(hash, func() (any, error) {
+		data, err := c.fetch(context.WithoutCancel(ctx), hash)
+		if err != nil {
+			return nil, err
+		}
+		if c.dir != "" {
+			if err := c.store(hash, data); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, false, res.Err
+		}
+		return res.Val.([]byte), false, nil
+	}
+}
+
+// Cached reports whether hash is already on disk
+func (c *Cache) Cached(hash string) bool {
+	if c.dir == "" || !hashPattern.MatchString(hash) {
+		return false
+	}
+	_, err := os.Stat(c.path(hash))
+	return err == nil
+}
+
+func (c *Cache) fetch(ctx context.Context, hash string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.upstream+hash, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("fetch image: upstream returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch image: %w", err)
+	}
+	if len(data) > maxImageBytes {
+		return nil, fmt.Errorf("fetch image: larger than %d bytes", maxImageBytes)
+	}
+	return data, nil
+}
+
+// path shards files by the first bytes of the artwork ID so no directory
+// grows unbounded; the shared size prefix would put everything in one.
+func (c *Cache) path(hash string) string {
+	return filepath.Join(c.dir, hash[16:18], hash[18:20], hash)
+}
+
+// store writes via a temporary file so concurrent readers never see a
+// partial image
+func (c *Cache) store(hash string, data []byte) error {
+	path := c.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("cache image: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("cache image: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cache image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cache image: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cache image: %w", err)
+	}
+	if c.usage != nil {
+		c.usage.added(hash, int64(len(data)))
+		c.evict()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MirrorStats counts what a mirror run did
+type MirrorStats struct {
+	Seen       int64 `json:"seen"`
+	Downloaded int64 `json:"downloaded"`
+	Cached     int64 `json:"cached"`
+	Skipped    int64 `json:"skipped"` // URLs not on the upstream CDN
+	Failed     int64 `json:"failed"`
+}
+
+// Mirror downloads every image URL produced by walk into the disk cache
+// using workers concurrent fetches. Images already on disk are skipped, so
+// an interrupted run resumes where it left off. Individual failures are
+// logged and counted rather than aborting the run.
+func (c *Cache) Mirror(ctx context.Context, walk func(func(url string) error) error, workers int) (MirrorStats, error) {
+	var stats MirrorStats
+	if c.dir == "" {
+		return stats, errors.New("image mirror needs a cache directory")
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var seen, downloaded, cached, skipped, failed atomic.Int64
+	hashes := make(chan string, workers*4)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range hashes {
+				if _, _, err := c.Get(ctx, hash); err != nil {
+					if ctx.Err() == nil {
+						slog.Warn("mirror image", "hash", hash, "err", err)
+					}
+					failed.Add(1)
+					continue
+				}
+				downloaded.Add(1)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				slog.Info("image mirror progress", "seen", seen.Load(), "downloaded", downloaded.Load(),
+					"cached", cached.Load(), "failed", failed.Load())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := walk(func(url string) error {
+		seen.Add(1)
+		hash := HashFromURL(url)
+		switch {
+		case hash == "":
+			skipped.Add(1)
+		case c.Cached(hash):
+			cached.Add(1)
+		default:
+			select {
+			case hashes <- hash:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	close(hashes)
+	wg.Wait()
+	close(done)
+
+	stats = MirrorStats{
+		Seen:       seen.Load(),
+		Downloaded: downloaded.Load(),
+		Cached:     cached.Load(),
+		Skipped:    skipped.Load(),
+		Failed:     failed.Load(),
+	}
+	return stats, err
+}
@@ -0,0 +1,107 @@
+// Package logging configures the process-wide slog logger and carries
+// per-request fields through contexts.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type ctxKey struct{}
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Setup installs the default logger writing to w in the given format
+// ("json", or "text"/"logfmt") and returns the level variable controlling it.
+func Setup(w io.Writer, format, level string) (*slog.LevelVar, error) {
+	lv := new(slog.LevelVar)
+	if err := lv.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lv}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text", "logfmt":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+
+	slog.SetDefault(slog.New(contextHandler{h}))
+	return lv, nil
+}
+
+// contextHandler adds the request ID from the record's context to every
+// record, so any subsystem logging with slog.*Context gets it for free
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Toggle flips between debug and the previous level. It is wired to SIGUSR1.
+func Toggle(lv *slog.LevelVar, base slog.Level) {
+	if lv.Level() == slog.LevelDebug {
+		lv.Set(base)
+	} else {
+		lv.Set(slog.LevelDebug)
+	}
+	slog.Info("log level changed", "level", lv.Level().String())
+}
+
+// LevelHandler serves the current level on GET and changes it on PUT/POST
+// with a body or ?level= parameter such as "debug" or "warn".
+func LevelHandler(lv *slog.LevelVar) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut || r.Method == http.MethodPost {
+			level := r.URL.Query().Get("level")
+			if level == "" {
+				var body struct {
+					Level string `json:"level"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				level = body.Level
+			}
+			var next slog.Level
+			if err := next.UnmarshalText([]byte(level)); err != nil {
+				http.Error(w, "invalid level", http.StatusBadRequest)
+				return
+			}
+			lv.Set(next)
+			slog.InfoContext(r.Context(), "log level changed", "level", next.String())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"level": lv.Level().String()})
+	})
+}
@@ -0,0 +1,88 @@
+package match
+
+import (
+	"context"
+	"sort"
+
+	"metadata-api/internal/models"
+)
+
+// albumBonus is added to candidates on the batch's dominant album, and
+// again when their track number also matches the item's
+const albumBonus = 0.05
+
+// Batch matches every item and then uses the batch as context: files from
+// one rip usually come from one album, so candidates on the album most items
+// agree on are preferred, especially at the item's track number. It returns
+// the results in item order and the dominant album ID, if any.
+func Batch(ctx context.Context, s Store, items []models.MatchRequest, limit int) ([]models.MatchBatchResult, string, error) {
+	results := make([]models.MatchBatchResult, len(items))
+	for i, item := range items {
+		results[i].Index = i
+		candidates, err := Track(ctx, s, item, limit)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", ctx.Err()
+			}
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Candidates = candidates
+	}
+
+	// Each item votes once for every album among its near-best candidates,
+	// so a tie between a release and its remaster doesn't split the vote
+	votes := make(map[string]int)
+	for _, res := range results {
+		voted := make(map[string]bool)
+		for _, c := range res.Candidates {
+			if c.Score < res.Candidates[0].Score-albumBonus || c.Track.Album == nil || voted[c.Track.Album.ID] {
+				continue
+			}
+			voted[c.Track.Album.ID] = true
+			votes[c.Track.Album.ID]++
+		}
+	}
+	var album string
+	for id, n := range votes {
+		if n > votes[album] || (n == votes[album] && id < album) {
+			album = id
+		}
+	}
+	if votes[album] < 2 {
+		album = ""
+	}
+
+	for i := range results {
+		res := &results[i]
+		if album != "" {
+			// Rank on unclamped scores so the bonus still separates
+			// candidates that already scored 1
+			type ranked struct {
+				c   models.MatchCandidate
+				raw float64
+			}
+			rs := make([]ranked, len(res.Candidates))
+			for j, c := range res.Candidates {
+				rs[j] = ranked{c, c.Score}
+				if c.Track.Album == nil || c.Track.Album.ID != album {
+					continue
+				}
+				rs[j].raw += albumBonus
+				if n := items[i].TrackNumber; n > 0 && c.Track.TrackNum == n {
+					rs[j].raw += albumBonus
+				}
+			}
+			sort.SliceStable(rs, func(a, b int) bool { return rs[a].raw > rs[b].raw })
+			for j, r := range rs {
+				r.c.Score = round(min(r.raw, 1))
+				res.Candidates[j] = r.c
+			}
+		}
+		if len(res.Candidates) > 0 {
+			res.Best = &res.Candidates[0]
+			res.Confidence = res.Best.Score
+		}
+	}
+	return results, album, nil
+}
@@ -0,0 +1,255 @@
+// Package match ranks catalog tracks against loosely described ones, such
+// as a tag-fixing tool's title, artist, and duration read from a file.
+package match
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/models"
+)
+
+// DefaultTolerance is the duration window used when a request sets none
+const DefaultTolerance = 5000
+
+// ErrNoTitle is returned when the title normalizes to nothing searchable
+var ErrNoTitle = errors.New("title has no searchable words")
+
+// Store is the subset of the db layer matching needs.
+type Store interface {
+	MatchCandidates(ctx context.Context, q db.MatchQuery) ([]models.Track, error)
+}
+
+// Track returns up to limit candidates for req, best first.
+func Track(ctx context.Context, s Store, req models.MatchRequest, limit int) ([]models.MatchCandidate, error) {
+	if limit <= 0 || limit > 20 {
+		limit = 5
+	}
+
+	title := Normalize(req.Title)
+	terms := searchTerms(title, 3)
+	if len(terms) == 0 {
+		return nil, ErrNoTitle
+	}
+
+	var artistTerm string
+	if t := searchTerms(Normalize(req.Artist), 1); len(t) > 0 {
+		artistTerm = t[0]
+	}
+	q := db.MatchQuery{ArtistTerm: artistTerm}
+	tolerance := req.DurationToleranceMs
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	if req.DurationMs > 0 {
+		q.MinMs = max(req.DurationMs-tolerance, 0)
+		q.MaxMs = req.DurationMs + tolerance
+	}
+
+	// A typo in the most selective word would leave no candidates, so
+	// retry with the next ones
+	var tracks []models.Track
+	for _, term := range terms {
+		q.TitleTerm = term
+		var err error
+		tracks, err = s.MatchCandidates(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if len(tracks) > 0 {
+			break
+		}
+	}
+
+	artist := Normalize(req.Artist)
+	album := Normalize(req.Album)
+	candidates := make([]models.MatchCandidate, 0, len(tracks))
+	for _, t := range tracks {
+		c := models.MatchCandidate{Track: t}
+
+		// Weighted mean over the signals the request supplied
+		c.TitleScore = round(Similarity(title, Normalize(t.Name)))
+		total, weight := 0.6*c.TitleScore, 0.6
+		if artist != "" {
+			best := 0.0
+			for _, a := range t.Artists {
+				best = math.Max(best, Similarity(artist, Normalize(a.Name)))
+			}
+			c.ArtistScore = ptr(round(best))
+			total += 0.25 * best
+			weight += 0.25
+		}
+		if req.DurationMs > 0 {
+			diff := t.DurationMs - req.DurationMs
+			c.DurationDiffMs = &diff
+			score := math.Max(0, 1-math.Abs(float64(diff))/float64(tolerance))
+			total += 0.15 * score
+			weight += 0.15
+		}
+		if album != "" && t.Album != nil {
+			score := Similarity(album, Normalize(t.Album.Name))
+			c.AlbumScore = ptr(round(score))
+			total += 0.1 * score
+			weight += 0.1
+		}
+		c.Score = round(total / weight)
+		candidates = append(candidates, c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+// noise are words that describe a release rather than the song, dropped
+// when they appear in brackets or after a dash
+var noise = []string{"remaster", "live", "version", "edit", "mix", "mono", "stereo", "deluxe", "explicit", "bonus"}
+
+// Normalize lowercases s and strips what commonly differs between a file
+// name or tag and the catalog: leading track numbers, bracketed suffixes,
+// featured artists, "- Remastered 2011" style suffixes, and punctuation.
+func Normalize(s string) string {
+	s = strings.ToLower(s)
+
+	// Bracketed parts: "(feat. X)", "[Remastered]", "{Live}"
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	s = b.String()
+
+	for _, sep := range []string{" feat. ", " feat ", " ft. ", " ft ", " featuring "} {
+		if i := strings.Index(s, sep); i >= 0 {
+			s = s[:i]
+		}
+	}
+	if i := strings.LastIndex(s, " - "); i >= 0 {
+		suffix := s[i:]
+		for _, n := range noise {
+			if strings.Contains(suffix, n) {
+				s = s[:i]
+				break
+			}
+		}
+	}
+
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	// "01 - Title" or "01. Title" from file names
+	if len(words) > 1 && isTrackNumber(words[0]) {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+func isTrackNumber(w string) bool {
+	if len(w) > 3 {
+		return false
+	}
+	for _, r := range w {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Similarity scores two normalized strings from 0 to 1, taking the better
+// of word overlap (robust to reordering and extra words) and edit distance
+// (robust to typos).
+func Similarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	return math.Max(dice(strings.Fields(a), strings.Fields(b)), levenshteinRatio(a, b))
+}
+
+// dice is the Sørensen–Dice coefficient of two word lists
+func dice(a, b []string) float64 {
+	set := make(map[string]int, len(a))
+	for _, w := range a {
+		set[w]++
+	}
+	shared := 0
+	for _, w := range b {
+		if set[w] > 0 {
+			set[w]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+func levenshteinRatio(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// searchTerms picks up to n distinct words to drive the candidate query,
+// longest (most selective) first
+func searchTerms(s string, n int) []string {
+	var words []string
+	seen := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return len([]rune(words[i])) > len([]rune(words[j]))
+	})
+	if len(words) > n {
+		words = words[:n]
+	}
+	return words
+}
+
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,238 @@
+package models
+
+import "strings"
+
+// Language is an ISO 639-1 language with its English and native names
+type Language struct {
+	Code       string `json:"code"`
+	Name       string `json:"name,omitempty"`
+	NativeName string `json:"native_name,omitempty"`
+}
+
+// LanguageOf returns the language with code, or one with just the code if
+// it isn't in ISO 639-1 (the snapshot also carries codes like "zxx" for
+// instrumentals)
+func LanguageOf(code string) Language {
+	if l, ok := languagesByCode[strings.ToLower(code)]; ok {
+		return l
+	}
+	return Language{Code: code}
+}
+
+// LanguagesOf returns LanguageOf each code
+func LanguagesOf(codes []string) []Language {
+	out := make([]Language, len(codes))
+	for i, code := range codes {
+		out[i] = LanguageOf(code)
+	}
+	return out
+}
+
+// FindLanguage returns the code of the language called s, which may be its
+// code or its English or native name, in any case
+func FindLanguage(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if l, ok := languagesByCode[strings.ToLower(s)]; ok {
+		return l.Code, true
+	}
+	for _, l := range languages {
+		if strings.EqualFold(s, l.Name) || strings.EqualFold(s, l.NativeName) {
+			return l.Code, true
+		}
+	}
+	return "", false
+}
+
+var languagesByCode = func() map[string]Language {
+	m := make(map[string]Language, len(languages))
+	for _, l := range languages {
+		m[l.Code] = l
+	}
+	return m
+}()
+
+var languages = []Language{
+	{"aa", "Afar", "Afaraf"},
+	{"ab", "Abkhaz", "аҧсуа бызшәа"},
+	{"ae", "Avestan", "avesta"},
+	{"af", "Afrikaans", "Afrikaans"},
+	{"ak", "Akan", "Akan"},
+	{"am", "Amharic", "አማርኛ"},
+	{"an", "Aragonese", "aragonés"},
+	{"ar", "Arabic", "العربية"},
+	{"as", "Assamese", "অসমীয়া"},
+	{"av", "Avaric", "авар мацӀ"},
+	{"ay", "Aymara", "aymar aru"},
+	{"az", "Azerbaijani", "azərbaycan dili"},
+	{"ba", "Bashkir", "башҡорт теле"},
+	{"be", "Belarusian", "беларуская мова"},
+	{"bg", "Bulgarian", "български език"},
+	{"bi", "Bislama", "Bislama"},
+	{"bm", "Bambara", "bamanankan"},
+	{"bn", "Bengali", "বাংলা"},
+	{"bo", "Tibetan", "བོད་ཡིག"},
+	{"br", "Breton", "brezhoneg"},
+	{"bs", "Bosnian", "bosanski jezik"},
+	{"ca", "Catalan", "català"},
+	{"ce", "Chechen", "нохчийн мотт"},
+	{"ch", "Chamorro", "Chamoru"},
+	{"co", "Corsican", "corsu"},
+	{"cr", "Cree", "ᓀᐦᐃᔭᐍᐏᐣ"},
+	{"cs", "Czech", "čeština"},
+	{"cu", "Old Church Slavonic", "ѩзыкъ словѣньскъ"},
+	{"cv", "Chuvash", "чӑваш чӗлхи"},
+	{"cy", "Welsh", "Cymraeg"},
+	{"da", "Danish", "dansk"},
+	{"de", "German", "Deutsch"},
+	{"dv", "Divehi", "ދިވެހި"},
+	{"dz", "Dzongkha", "རྫོང་ཁ"},
+	{"ee", "Ewe", "Eʋegbe"},
+	{"el", "Greek", "Ελληνικά"},
+	{"en", "English", "English"},
+	{"eo", "Esperanto", "Esperanto"},
+	{"es", "Spanish", "español"},
+	{"et", "Estonian", "eesti"},
+	{"eu", "Basque", "euskara"},
+	{"fa", "Persian", "فارسی"},
+	{"ff", "Fula", "Fulfulde"},
+	{"fi", "Finnish", "suomi"},
+	{"fj", "Fijian", "vosa Vakaviti"},
+	{"fo", "Faroese", "føroyskt"},
+	{"fr", "French", "français"},
+	{"fy", "Western Frisian", "Frysk"},
+	{"ga", "Irish", "Gaeilge"},
+	{"gd", "Scottish Gaelic", "Gàidhlig"},
+	{"gl", "Galician", "galego"},
+	{"gn", "Guaraní", "Avañe'ẽ"},
+	{"gu", "Gujarati", "ગુજરાતી"},
+	{"gv", "Manx", "Gaelg"},
+	{"ha", "Hausa", "Hausa"},
+	{"he", "Hebrew", "עברית"},
+	{"hi", "Hindi", "हिन्दी"},
+	{"ho", "Hiri Motu", "Hiri Motu"},
+	{"hr", "Croatian", "hrvatski jezik"},
+	{"ht", "Haitian", "Kreyòl ayisyen"},
+	{"hu", "Hungarian", "magyar"},
+	{"hy", "Armenian", "Հայերեն"},
+	{"hz", "Herero", "Otjiherero"},
+	{"ia", "Interlingua", "Interlingua"},
+	{"id", "Indonesian", "Bahasa Indonesia"},
+	{"ie", "Interlingue", "Interlingue"},
+	{"ig", "Igbo", "Asụsụ Igbo"},
+	{"ii", "Nuosu", "ꆈꌠ꒿ Nuosuhxop"},
+	{"ik", "Inupiaq", "Iñupiaq"},
+	{"io", "Ido", "Ido"},
+	{"is", "Icelandic", "íslenska"},
+	{"it", "Italian", "italiano"},
+	{"iu", "Inuktitut", "ᐃᓄᒃᑎᑐᑦ"},
+	{"ja", "Japanese", "日本語"},
+	{"jv", "Javanese", "basa Jawa"},
+	{"ka", "Georgian", "ქართული"},
+	{"kg", "Kongo", "Kikongo"},
+	{"ki", "Kikuyu", "Gĩkũyũ"},
+	{"kj", "Kwanyama", "Kuanyama"},
+	{"kk", "Kazakh", "қазақ тілі"},
+	{"kl", "Kalaallisut", "kalaallisut"},
+	{"km", "Khmer", "ខ្មែរ"},
+	{"kn", "Kannada", "ಕನ್ನಡ"},
+	{"ko", "Korean", "한국어"},
+	{"kr", "Kanuri", "Kanuri"},
+	{"ks", "Kashmiri", "कश्मीरी"},
+	{"ku", "Kurdish", "Kurdî"},
+	{"kv", "Komi", "коми кыв"},
+	{"kw", "Cornish", "Kernewek"},
+	{"ky", "Kyrgyz", "Кыргызча"},
+	{"la", "Latin", "latine"},
+	{"lb", "Luxembourgish", "Lëtzebuergesch"},
+	{"lg", "Ganda", "Luganda"},
+	{"li", "Limburgish", "Limburgs"},
+	{"ln", "Lingala", "Lingála"},
+	{"lo", "Lao", "ພາສາລາວ"},
+	{"lt", "Lithuanian", "lietuvių kalba"},
+	{"lu", "Luba-Katanga", "Kiluba"},
+	{"lv", "Latvian", "latviešu valoda"},
+	{"mg", "Malagasy", "fiteny malagasy"},
+	{"mh", "Marshallese", "Kajin M̧ajeļ"},
+	{"mi", "Māori", "te reo Māori"},
+	{"mk", "Macedonian", "македонски јазик"},
+	{"ml", "Malayalam", "മലയാളം"},
+	{"mn", "Mongolian", "Монгол хэл"},
+	{"mr", "Marathi", "मराठी"},
+	{"ms", "Malay", "Bahasa Melayu"},
+	{"mt", "Maltese", "Malti"},
+	{"my", "Burmese", "ဗမာစာ"},
+	{"na", "Nauru", "Dorerin Naoero"},
+	{"nb", "Norwegian Bokmål", "Norsk bokmål"},
+	{"nd", "Northern Ndebele", "isiNdebele"},
+	{"ne", "Nepali", "नेपाली"},
+	{"ng", "Ndonga", "Owambo"},
+	{"nl", "Dutch", "Nederlands"},
+	{"nn", "Norwegian Nynorsk", "Norsk nynorsk"},
+	{"no", "Norwegian", "Norsk"},
+	{"nr", "Southern Ndebele", "isiNdebele"},
+	{"nv", "Navajo", "Diné bizaad"},
+	{"ny", "Chichewa", "chiCheŵa"},
+	{"oc", "Occitan", "occitan"},
+	{"oj", "Ojibwe", "ᐊᓂᔑᓈᐯᒧᐎᓐ"},
+	{"om", "Oromo", "Afaan Oromoo"},
+	{"or", "Oriya", "ଓଡ଼ିଆ"},
+	{"os", "Ossetian", "ирон æвзаг"},
+	{"pa", "Punjabi", "ਪੰਜਾਬੀ"},
+	{"pi", "Pāli", "पाऴि"},
+	{"pl", "Polish", "polski"},
+	{"ps", "Pashto", "پښتو"},
+	{"pt", "Portuguese", "português"},
+	{"qu", "Quechua", "Runa Simi"},
+	{"rm", "Romansh", "rumantsch grischun"},
+	{"rn", "Kirundi", "Ikirundi"},
+	{"ro", "Romanian", "română"},
+	{"ru", "Russian", "русский"},
+	{"rw", "Kinyarwanda", "Ikinyarwanda"},
+	{"sa", "Sanskrit", "संस्कृतम्"},
+	{"sc", "Sardinian", "sardu"},
+	{"sd", "Sindhi", "सिन्धी"},
+	{"se", "Northern Sami", "Davvisámegiella"},
+	{"sg", "Sango", "yângâ tî sängö"},
+	{"si", "Sinhala", "සිංහල"},
+	{"sk", "Slovak", "slovenčina"},
+	{"sl", "Slovenian", "slovenščina"},
+	{"sm", "Samoan", "gagana fa'a Samoa"},
+	{"sn", "Shona", "chiShona"},
+	{"so", "Somali", "Soomaaliga"},
+	{"sq", "Albanian", "Shqip"},
+	{"sr", "Serbian", "српски језик"},
+	{"ss", "Swati", "SiSwati"},
+	{"st", "Southern Sotho", "Sesotho"},
+	{"su", "Sundanese", "Basa Sunda"},
+	{"sv", "Swedish", "svenska"},
+	{"sw", "Swahili", "Kiswahili"},
+	{"ta", "Tamil", "தமிழ்"},
+	{"te", "Telugu", "తెలుగు"},
+	{"tg", "Tajik", "тоҷикӣ"},
+	{"th", "Thai", "ไทย"},
+	{"ti", "Tigrinya", "ትግርኛ"},
+	{"tk", "Turkmen", "Türkmençe"},
+	{"tl", "Tagalog", "Wikang Tagalog"},
+	{"tn", "Tswana", "Setswana"},
+	{"to", "Tonga", "faka Tonga"},
+	{"tr", "Turkish", "Türkçe"},
+	{"ts", "Tsonga", "Xitsonga"},
+	{"tt", "Tatar", "татар теле"},
+	{"tw", "Twi", "Twi"},
+	{"ty", "Tahitian", "Reo Tahiti"},
+	{"ug", "Uyghur", "ئۇيغۇرچە"},
+	{"uk", "Ukrainian", "українська"},
+	{"ur", "Urdu", "اردو"},
+	{"uz", "Uzbek", "Oʻzbek"},
+	{"ve", "Venda", "Tshivenḓa"},
+	{"vi", "Vietnamese", "Tiếng Việt"},
+	{"vo", "Volapük", "Volapük"},
+	{"wa", "Walloon", "walon"},
+	{"wo", "Wolof", "Wollof"},
+	{"xh", "Xhosa", "isiXhosa"},
+	{"yi", "Yiddish", "ייִדיש"},
+	{"yo", "Yoruba", "Yorùbá"},
+	{"za", "Zhuang", "Saɯ cueŋƅ"},
+	{"zh", "Chinese", "中文"},
+	{"zu", "Zulu", "isiZulu"},
+}
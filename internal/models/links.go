@@ -0,0 +1,36 @@
+package models
+
+import "sync/atomic"
+
+// PublicURL is the scheme and host this API is reached at, such as
+// "https://api.example.com", prefixed to href links (-public-url). Empty
+// leaves them relative to the server root.
+var PublicURL atomic.Value // string
+
+// ExternalURLs links to an entity outside this API
+type ExternalURLs struct {
+	Spotify string `json:"spotify"`
+}
+
+// Links are the uri, external_urls, and href of the entity of kind
+// ("track", "album", or "artist") with id. They are derived when the
+// entity is marshaled, so they are always consistent with its ID.
+type Links struct {
+	URI          string
+	ExternalURLs *ExternalURLs
+	Href         string
+}
+
+// LinksFor returns the links of the entity of kind with id, or none
+// without an ID
+func LinksFor(kind, id string) Links {
+	if id == "" {
+		return Links{}
+	}
+	base, _ := PublicURL.Load().(string)
+	return Links{
+		URI:          "spotify:" + kind + ":" + id,
+		ExternalURLs: &ExternalURLs{Spotify: "https://open.spotify.com/" + kind + "/" + id},
+		Href:         base + "/lookup/" + kind + "/" + id,
+	}
+}
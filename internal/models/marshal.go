@@ -0,0 +1,140 @@
+package models
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// Serialization options, set once at startup from flags. They apply to
+// every response that embeds these types.
+var (
+	// SrcsetEnabled adds images_srcset to albums and artists (-images-srcset)
+	SrcsetEnabled atomic.Bool
+	// OmitPopularity drops popularity and followers everywhere, for
+	// downstream datasets that must not carry Spotify's popularity signals
+	// (-omit-popularity)
+	OmitPopularity atomic.Bool
+	// LegacyArtistRoles writes artist_roles as the plain role strings
+	// tracks carried before roles were resolved to artists
+	// (-legacy-artist-roles)
+	LegacyArtistRoles atomic.Bool
+	// LanguageNames writes track languages as objects with the code and
+	// the English and native names instead of bare codes (-language-names)
+	LanguageNames atomic.Bool
+)
+
+// The wrappers below shadow fields of the embedded plain type: a field at
+// a shallower depth with the same JSON name wins, and a nil pointer with
+// omitempty removes it from the output.
+
+func (a Album) MarshalJSON() ([]byte, error) {
+	type plain Album
+	a.ReleaseDateParsed = ParseReleaseDate(a.ReleaseDate, a.ReleaseDatePrecision)
+	a.setLinks(LinksFor("album", a.ID))
+	if !SrcsetEnabled.Load() {
+		return json.Marshal(plain(a))
+	}
+	return json.Marshal(struct {
+		plain
+		ImagesSrcset string `json:"images_srcset,omitempty"`
+	}{plain(a), Srcset(a.Images)})
+}
+
+func (a Artist) MarshalJSON() ([]byte, error) {
+	type plain Artist
+	a.setLinks(LinksFor("artist", a.ID))
+	srcset, omit := SrcsetEnabled.Load(), OmitPopularity.Load()
+	if !srcset && !omit {
+		return json.Marshal(plain(a))
+	}
+
+	out := struct {
+		plain
+		Followers    *int64 `json:"followers,omitempty"`
+		Popularity   *int   `json:"popularity,omitempty"`
+		ImagesSrcset string `json:"images_srcset,omitempty"`
+	}{plain: plain(a)}
+	if !omit {
+		out.Followers, out.Popularity = &a.Followers, &a.Popularity
+	}
+	if srcset {
+		out.ImagesSrcset = Srcset(a.Images)
+	}
+	return json.Marshal(out)
+}
+
+func (t Track) MarshalJSON() ([]byte, error) {
+	type plain Track
+	t.setLinks(LinksFor("track", t.ID))
+	omit, legacy, names := OmitPopularity.Load(), LegacyArtistRoles.Load(), LanguageNames.Load()
+	if !omit && !legacy && !names {
+		return json.Marshal(plain(t))
+	}
+
+	// The shadows hold the fields' usual values unless an option changes
+	// them
+	out := struct {
+		plain
+		Popularity  *int `json:"popularity,omitempty"`
+		Languages   any  `json:"languages,omitempty"`
+		ArtistRoles any  `json:"artist_roles,omitempty"`
+	}{plain: plain(t)}
+	if !omit {
+		out.Popularity = &t.Popularity
+	}
+	if len(t.Languages) > 0 {
+		out.Languages = t.Languages
+		if names {
+			out.Languages = LanguagesOf(t.Languages)
+		}
+	}
+	if len(t.ArtistRoles) > 0 {
+		out.ArtistRoles = t.ArtistRoles
+		if legacy {
+			roles := make([]string, len(t.ArtistRoles))
+			for i, r := range t.ArtistRoles {
+				roles[i] = r.Role
+			}
+			out.ArtistRoles = roles
+		}
+	}
+	return json.Marshal(out)
+}
+
+// MarshalJSON leaves out popularity_score under OmitPopularity, as it is
+// derived from the tracks' popularity
+func (s SimilarTrack) MarshalJSON() ([]byte, error) {
+	type plain SimilarTrack
+	if !OmitPopularity.Load() {
+		return json.Marshal(plain(s))
+	}
+	return json.Marshal(struct {
+		plain
+		PopularityScore *float64 `json:"popularity_score,omitempty"`
+	}{plain: plain(s)})
+}
+
+func (l LinkedFrom) MarshalJSON() ([]byte, error) {
+	type plain LinkedFrom
+	l.Type = "track"
+	l.setLinks(LinksFor("track", l.ID))
+	return json.Marshal(plain(l))
+}
+
+func (a *Album) setLinks(l Links)      { a.URI, a.ExternalURLs, a.Href = l.URI, l.ExternalURLs, l.Href }
+func (a *Artist) setLinks(l Links)     { a.URI, a.ExternalURLs, a.Href = l.URI, l.ExternalURLs, l.Href }
+func (t *Track) setLinks(l Links)      { t.URI, t.ExternalURLs, t.Href = l.URI, l.ExternalURLs, l.Href }
+func (f *LinkedFrom) setLinks(l Links) { f.URI, f.ExternalURLs, f.Href = l.URI, l.ExternalURLs, l.Href }
+
+// UnmarshalJSON also accepts a plain role string, as artist_roles held
+// before roles were resolved to artists, so older overlay entries and
+// patch files still load
+func (r *ArtistRole) UnmarshalJSON(data []byte) error {
+	var role string
+	if json.Unmarshal(data, &role) == nil {
+		*r = ArtistRole{Role: role}
+		return nil
+	}
+	type plain ArtistRole
+	return json.Unmarshal(data, (*plain)(r))
+}
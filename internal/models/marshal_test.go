@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// popularityFields are the fields -omit-popularity strips
+var popularityFields = []string{"popularity", "followers", "popularity_score"}
+
+func sampleArtist() Artist {
+	return Artist{ID: "a1", Name: "Queen", Followers: 1000, Popularity: 90, Genres: []string{"rock"}}
+}
+
+func sampleTrack() Track {
+	return Track{
+		ID:         "t1",
+		Name:       "Bohemian Rhapsody",
+		Popularity: 80,
+		Album:      &Album{ID: "al1", Name: "A Night at the Opera", Artists: []Artist{sampleArtist()}},
+		Artists:    []Artist{sampleArtist()},
+	}
+}
+
+// withOmitPopularity sets OmitPopularity for the rest of the test
+func withOmitPopularity(t *testing.T, omit bool) {
+	t.Helper()
+	prev := OmitPopularity.Load()
+	OmitPopularity.Store(omit)
+	t.Cleanup(func() { OmitPopularity.Store(prev) })
+}
+
+// findKeys returns the keys of keys found anywhere in the decoded JSON v
+func findKeys(v any, keys []string) []string {
+	var found []string
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			for _, want := range keys {
+				if k == want {
+					found = append(found, k)
+				}
+			}
+			found = append(found, findKeys(child, keys)...)
+		}
+	case []any:
+		for _, child := range v {
+			found = append(found, findKeys(child, keys)...)
+		}
+	}
+	return found
+}
+
+func TestOmitPopularityJSON(t *testing.T) {
+	values := map[string]any{
+		"artist":  sampleArtist(),
+		"track":   sampleTrack(),
+		"album":   *sampleTrack().Album,
+		"similar": []SimilarTrack{{Score: 0.9, PopularityScore: 0.8, Track: sampleTrack()}},
+		"page":    TrackPage{Items: []Track{sampleTrack()}, Total: 1},
+	}
+	for _, omit := range []bool{false, true} {
+		withOmitPopularity(t, omit)
+		for name, v := range values {
+			data, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			var tree any
+			if err := json.Unmarshal(data, &tree); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			found := findKeys(tree, popularityFields)
+			switch {
+			case omit && len(found) > 0:
+				t.Errorf("%s with OmitPopularity carries %v: %s", name, found, data)
+			case !omit && len(found) == 0:
+				t.Errorf("%s without OmitPopularity carries no popularity fields: %s", name, data)
+			}
+		}
+	}
+}
+
+func TestOmitPopularityKeepsOtherFields(t *testing.T) {
+	withOmitPopularity(t, true)
+	data, err := json.Marshal(SimilarTrack{Score: 0.9, ArtistScore: 1, Track: sampleTrack()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"score", "artist_score", "genre_score", "duration_score", "track"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("similar track lost %s: %s", key, data)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"sort"
+	"time"
+)
+
 type Image struct {
 	URL    string `json:"url"`
 	Width  int    `json:"width"`
@@ -13,40 +18,332 @@ type Artist struct {
 	Popularity int      `json:"popularity"`
 	Genres     []string `json:"genres,omitempty"`
 	Images     []Image  `json:"images,omitempty"`
+	MBID       string   `json:"mbid,omitempty"`
+
+	// Derived from ID when marshaled
+	URI          string        `json:"uri,omitempty"`
+	ExternalURLs *ExternalURLs `json:"external_urls,omitempty"`
+	Href         string        `json:"href,omitempty"`
+}
+
+type Genre struct {
+	Name        string `json:"name"`
+	ArtistCount int64  `json:"artist_count"`
 }
 
 type Album struct {
-	ID                   string   `json:"id"`
-	Name                 string   `json:"name"`
-	Type                 string   `json:"type"`
-	Label                string   `json:"label"`
+	ID                   string       `json:"id"`
+	Name                 string       `json:"name"`
+	Type                 string       `json:"type"`
+	Label                string       `json:"label"`
+	ReleaseDate          string       `json:"release_date"`
+	ReleaseDatePrecision string       `json:"release_date_precision"`
+	ReleaseDateParsed    *ReleaseDate `json:"release_date_parsed,omitempty"` // derived from ReleaseDate when marshaled
+	UPC                  string       `json:"upc,omitempty"`
+	TotalTracks          int          `json:"total_tracks"`
+	CopyrightC           string       `json:"copyright,omitempty"`
+	CopyrightP           string       `json:"copyright_p,omitempty"`
+	Genres               []string     `json:"genres,omitempty"`
+	Images               []Image      `json:"images,omitempty"`
+	Artists              []Artist     `json:"artists,omitempty"`
+	Tracks               []Track      `json:"tracks,omitempty"`
+
+	PrimaryArtist *ArtistRef      `json:"primary_artist,omitempty"`
+	Languages     []LanguageCount `json:"languages,omitempty"`
+	MBID          string          `json:"mbid,omitempty"`
+
+	AvailableMarkets []string `json:"available_markets,omitzero"`
+
+	// Derived from ID when marshaled
+	URI          string        `json:"uri,omitempty"`
+	ExternalURLs *ExternalURLs `json:"external_urls,omitempty"`
+	Href         string        `json:"href,omitempty"`
+}
+
+// LanguageCount is the number of tracks performed in a language
+type LanguageCount struct {
+	Language string `json:"language"`
+	Tracks   int    `json:"tracks"`
+}
+
+// Discography is an artist's releases bucketed by how the artist appears on
+// them. Each bucket is paged independently.
+type Discography struct {
+	Albums       AlbumPage `json:"albums"`
+	Singles      AlbumPage `json:"singles"`
+	Compilations AlbumPage `json:"compilations"`
+	AppearsOn    AlbumPage `json:"appears_on"`
+}
+
+// AlbumPage is one page of a list of albums
+type AlbumPage struct {
+	Items  []Album `json:"items"`
+	Total  int     `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+// ArtistPage is one page of artist search results. Total counts every
+// match, not just this page's.
+type ArtistPage struct {
+	Items  []Artist `json:"items"`
+	Total  int      `json:"total"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+}
+
+// TrackPage is one page of track search results, like ArtistPage
+type TrackPage struct {
+	Items  []Track `json:"items"`
+	Total  int     `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+// Disc is one disc of an album, its tracks in track order
+type Disc struct {
+	DiscNumber int     `json:"disc_number"`
+	TrackCount int     `json:"track_count"`
+	DurationMs int64   `json:"duration_ms"`
+	Tracks     []Track `json:"tracks"`
+}
+
+// GroupByDisc nests tracks under their discs, in the order each disc first
+// appears
+func GroupByDisc(tracks []Track) []Disc {
+	discs := []Disc{}
+	index := make(map[int]int)
+	for _, t := range tracks {
+		i, ok := index[t.DiscNum]
+		if !ok {
+			i = len(discs)
+			index[t.DiscNum] = i
+			discs = append(discs, Disc{DiscNumber: t.DiscNum})
+		}
+		d := &discs[i]
+		d.Tracks = append(d.Tracks, t)
+		d.TrackCount++
+		d.DurationMs += t.DurationMs
+	}
+	return discs
+}
+
+// Release is an album a recording was released on, identified by its UPC
+type Release struct {
+	UPC                  string   `json:"upc"`
+	AlbumID              string   `json:"album_id"`
+	AlbumName            string   `json:"album_name"`
+	AlbumType            string   `json:"album_type"`
 	ReleaseDate          string   `json:"release_date"`
 	ReleaseDatePrecision string   `json:"release_date_precision"`
-	UPC                  string   `json:"upc,omitempty"`
-	TotalTracks          int      `json:"total_tracks"`
-	CopyrightC           string   `json:"copyright,omitempty"`
-	CopyrightP           string   `json:"copyright_p,omitempty"`
-	Images               []Image  `json:"images,omitempty"`
-	Artists              []Artist `json:"artists,omitempty"`
+	TrackIDs             []string `json:"track_ids"` // the album's tracks of the recording
+}
+
+// ISRCReleases are the releases of the recording with an ISRC
+type ISRCReleases struct {
+	ISRC string    `json:"isrc"`
+	UPCs []Release `json:"upcs"`
+}
+
+// ReleaseTrack is a track's position on a release, with its ISRC
+type ReleaseTrack struct {
+	ISRC        string `json:"isrc"` // empty when the track has none
+	TrackID     string `json:"track_id"`
+	Name        string `json:"name"`
+	AlbumID     string `json:"album_id"`
+	DiscNumber  int    `json:"disc_number"`
+	TrackNumber int    `json:"track_number"`
+}
+
+// UPCTracks are the tracks of the releases with a UPC
+type UPCTracks struct {
+	UPC   string         `json:"upc"`
+	ISRCs []ReleaseTrack `json:"isrcs"`
+}
+
+// ReleasesOf groups tracks by album into releases, earliest first. Albums
+// without a UPC are left out.
+func ReleasesOf(tracks []Track) []Release {
+	releases := []Release{}
+	index := make(map[string]int)
+	for _, t := range tracks {
+		a := t.Album
+		if a == nil || a.UPC == "" {
+			continue
+		}
+		i, ok := index[a.ID]
+		if !ok {
+			i = len(releases)
+			index[a.ID] = i
+			releases = append(releases, Release{
+				UPC:                  a.UPC,
+				AlbumID:              a.ID,
+				AlbumName:            a.Name,
+				AlbumType:            a.Type,
+				ReleaseDate:          a.ReleaseDate,
+				ReleaseDatePrecision: a.ReleaseDatePrecision,
+			})
+		}
+		releases[i].TrackIDs = append(releases[i].TrackIDs, t.ID)
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		if releases[i].ReleaseDate != releases[j].ReleaseDate {
+			return releases[i].ReleaseDate < releases[j].ReleaseDate
+		}
+		return releases[i].UPC < releases[j].UPC
+	})
+	return releases
+}
+
+// ArtistRef is a minimal artist reference for list rendering
+type ArtistRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// SetArtists sets the album's artists, ordered by index_in_album, and
+// derives PrimaryArtist from the first of them
+func (a *Album) SetArtists(artists []Artist) {
+	a.Artists = artists
+	a.PrimaryArtist = nil
+	if len(artists) > 0 {
+		a.PrimaryArtist = &ArtistRef{ID: artists[0].ID, Name: artists[0].Name}
+	}
 }
 
 type Track struct {
-	ID            string   `json:"id"`
-	Name          string   `json:"name"`
-	ISRC          string   `json:"isrc,omitempty"`
-	DurationMs    int64    `json:"duration_ms"`
-	Explicit      bool     `json:"explicit"`
-	TrackNum      int      `json:"track_number"`
-	DiscNum       int      `json:"disc_number"`
-	Popularity    int      `json:"popularity"`
-	PreviewURL    string   `json:"preview_url,omitempty"`
-	Album         *Album   `json:"album,omitempty"`
-	Artists       []Artist `json:"artists,omitempty"`
-	OriginalTitle string   `json:"original_title,omitempty"`
-	VersionTitle  string   `json:"version_title,omitempty"`
-	HasLyrics     *bool    `json:"has_lyrics,omitempty"`
-	Languages     []string `json:"languages,omitempty"`
-	ArtistRoles   []string `json:"artist_roles,omitempty"`
+	ID            string       `json:"id"`
+	Name          string       `json:"name"`
+	ISRC          string       `json:"isrc,omitempty"`
+	DurationMs    int64        `json:"duration_ms"`
+	Explicit      bool         `json:"explicit"`
+	TrackNum      int          `json:"track_number"`
+	DiscNum       int          `json:"disc_number"`
+	Popularity    int          `json:"popularity"`
+	PreviewURL    string       `json:"preview_url,omitempty"`
+	Album         *Album       `json:"album,omitempty"`
+	Artists       []Artist     `json:"artists,omitempty"`
+	OriginalTitle string       `json:"original_title,omitempty"`
+	VersionTitle  string       `json:"version_title,omitempty"`
+	HasLyrics     *bool        `json:"has_lyrics,omitempty"`
+	Languages     []string     `json:"languages,omitempty"`
+	ArtistRoles   []ArtistRole `json:"artist_roles,omitempty"`
+	MBID          string       `json:"mbid,omitempty"`
+
+	AvailableMarkets []string `json:"available_markets,omitzero"`
+	IsPlayable       *bool    `json:"is_playable,omitempty"`
+
+	// Set when a relinked lookup returned this release of the recording
+	// in place of the one requested
+	LinkedFrom *LinkedFrom `json:"linked_from,omitempty"`
+
+	AudioFeatures *AudioFeatures `json:"audio_features,omitempty"`
+
+	// Derived from ID when marshaled
+	URI          string        `json:"uri,omitempty"`
+	ExternalURLs *ExternalURLs `json:"external_urls,omitempty"`
+	Href         string        `json:"href,omitempty"`
+}
+
+// LinkedFrom is the track a relinked lookup was asked for
+type LinkedFrom struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+
+	// Derived from ID when marshaled
+	URI          string        `json:"uri,omitempty"`
+	ExternalURLs *ExternalURLs `json:"external_urls,omitempty"`
+	Href         string        `json:"href,omitempty"`
+}
+
+// TrackAlternatives are the other releases of a track's recording: the
+// tracks sharing its ISRC
+type TrackAlternatives struct {
+	ID           string   `json:"id"`
+	ISRC         string   `json:"isrc,omitempty"`
+	Alternatives []string `json:"alternatives"`
+}
+
+// ArtistRole is how an artist is credited on a track. ArtistID and Name
+// are empty when the role couldn't be matched to one of the track's
+// artists.
+type ArtistRole struct {
+	Role     string `json:"role"`
+	ArtistID string `json:"artist_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// NewArtistRoles resolves the track_files role list against the track's
+// artists. Roles are listed in artist order, so they are matched by
+// position, but only when the counts agree; otherwise the roles are kept
+// unresolved rather than credited to the wrong artist.
+func NewArtistRoles(roles []string, artists []Artist) []ArtistRole {
+	if len(roles) == 0 {
+		return nil
+	}
+	out := make([]ArtistRole, len(roles))
+	for i, role := range roles {
+		out[i].Role = role
+		if len(roles) == len(artists) {
+			out[i].ArtistID, out[i].Name = artists[i].ID, artists[i].Name
+		}
+	}
+	return out
+}
+
+type AudioFeatures struct {
+	Danceability     float64 `json:"danceability"`
+	Energy           float64 `json:"energy"`
+	Key              int     `json:"key"`
+	Loudness         float64 `json:"loudness"`
+	Mode             int     `json:"mode"`
+	Speechiness      float64 `json:"speechiness"`
+	Acousticness     float64 `json:"acousticness"`
+	Instrumentalness float64 `json:"instrumentalness"`
+	Liveness         float64 `json:"liveness"`
+	Valence          float64 `json:"valence"`
+	Tempo            float64 `json:"tempo"`
+	TimeSignature    int     `json:"time_signature"`
+}
+
+type Lyrics struct {
+	TrackID string      `json:"track_id"`
+	Plain   string      `json:"plain,omitempty"`
+	Synced  []LyricLine `json:"synced,omitempty"`
+	LRC     string      `json:"lrc,omitempty"`
+}
+
+type LyricLine struct {
+	StartMs int64  `json:"start_ms"`
+	Text    string `json:"text"`
+}
+
+type DatabaseHealth struct {
+	Status    string `json:"status"`
+	MaxRowID  int64  `json:"max_rowid,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Stats struct {
+	DatasetVersion     string               `json:"dataset_version"`
+	Tracks             int64                `json:"tracks"`
+	Albums             int64                `json:"albums"`
+	Artists            int64                `json:"artists"`
+	AlbumImages        int64                `json:"album_images"`
+	ArtistImages       int64                `json:"artist_images"`
+	TracksWithISRC     int64                `json:"tracks_with_isrc"`
+	TracksWithLyrics   int64                `json:"tracks_with_lyrics"`
+	Files              map[string]FileStats `json:"files"`
+	SnapshotModifiedAt time.Time            `json:"snapshot_modified_at"`
+	ComputedAt         time.Time            `json:"computed_at"`
+	NullCounts         map[string]int64     `json:"null_counts"`
+}
+
+type FileStats struct {
+	Path       string    `json:"path"`
+	SizeBytes  int64     `json:"size_bytes"`
+	ModifiedAt time.Time `json:"modified_at"`
 }
 
 type BatchLookupRequest struct {
@@ -63,3 +360,84 @@ type BatchLookupResponse struct {
 	ISRCs   map[string][]Track `json:"isrcs,omitempty"`
 	Errors  map[string]string  `json:"errors,omitempty"`
 }
+
+type AlbumTracksRequest struct {
+	Albums []string `json:"albums"` // album IDs
+}
+
+type AlbumTracksResponse struct {
+	Albums map[string][]Track `json:"albums"`           // album ID to its tracks
+	Errors map[string]string  `json:"errors,omitempty"` // unknown album IDs
+}
+
+type MatchRequest struct {
+	Title               string `json:"title"`
+	Artist              string `json:"artist,omitempty"`
+	Album               string `json:"album,omitempty"`
+	DurationMs          int64  `json:"duration_ms,omitempty"`
+	DurationToleranceMs int64  `json:"duration_tolerance_ms,omitempty"` // default 5000
+	TrackNumber         int    `json:"track_number,omitempty"`          // used by /match/batch
+}
+
+// MatchCandidate is a catalog track with how well it matched the request.
+// Component scores are present only for the fields the request supplied.
+type MatchCandidate struct {
+	Score          float64  `json:"score"`
+	TitleScore     float64  `json:"title_score"`
+	ArtistScore    *float64 `json:"artist_score,omitempty"`
+	AlbumScore     *float64 `json:"album_score,omitempty"`
+	DurationDiffMs *int64   `json:"duration_diff_ms,omitempty"`
+	Track          Track    `json:"track"`
+}
+
+// SimilarTrack is a recommended track with how closely it resembles the
+// one recommendations were asked for. Each component score is from 0 to 1;
+// Score is their mean under the request's weights.
+type SimilarTrack struct {
+	Score           float64 `json:"score"`
+	ArtistScore     float64 `json:"artist_score"`
+	GenreScore      float64 `json:"genre_score"`
+	PopularityScore float64 `json:"popularity_score"`
+	DurationScore   float64 `json:"duration_score"`
+	PlaylistScore   float64 `json:"playlist_score,omitempty"` // with -collections-db, when a collection holds the track
+	Track           Track   `json:"track"`
+}
+
+// Radio is a list of recommendations blended from several seeds
+type Radio struct {
+	Tracks []Track     `json:"tracks"`
+	Seeds  []RadioSeed `json:"seeds"`
+}
+
+// RadioSeed is one seed of a radio with how many candidates related to it
+// before and after the popularity bounds and duplicate recordings were
+// filtered out
+type RadioSeed struct {
+	ID                 string `json:"id"`
+	Type               string `json:"type"` // artist, track, or genre
+	InitialPoolSize    int    `json:"initial_pool_size"`
+	AfterFilteringSize int    `json:"after_filtering_size"`
+}
+
+type MatchResponse struct {
+	Candidates []MatchCandidate `json:"candidates"`
+}
+
+type MatchBatchRequest struct {
+	Items []MatchRequest `json:"items"`
+}
+
+// MatchBatchResult is the outcome for one item, in request order
+type MatchBatchResult struct {
+	Index      int              `json:"index"`
+	Best       *MatchCandidate  `json:"best"`
+	Confidence float64          `json:"confidence"`
+	Candidates []MatchCandidate `json:"candidates,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+type MatchBatchResponse struct {
+	// AlbumID is the album most items matched, when there is one
+	AlbumID string             `json:"album_id,omitempty"`
+	Results []MatchBatchResult `json:"results"`
+}
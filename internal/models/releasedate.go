@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ReleaseDate is a release date split into its parts. Month and Day are
+// zero, and omitted, below the precision the date is known to.
+type ReleaseDate struct {
+	Year  int `json:"year"`
+	Month int `json:"month,omitempty"`
+	Day   int `json:"day,omitempty"`
+}
+
+// ParseReleaseDate parses a "YYYY", "YYYY-MM", or "YYYY-MM-DD" release date,
+// keeping only the parts precision ("year", "month", or "day") vouches for;
+// an empty precision trusts the date's own form. It returns nil for dates
+// that are missing or malformed, including the "0000" placeholder some
+// releases carry.
+func ParseReleaseDate(date, precision string) *ReleaseDate {
+	parts := strings.Split(date, "-")
+	if len(parts) > 3 {
+		return nil
+	}
+	switch precision {
+	case "year":
+		parts = parts[:1]
+	case "month":
+		parts = parts[:min(2, len(parts))]
+	}
+
+	var d ReleaseDate
+	limits := []struct {
+		n        *int
+		digits   int
+		min, max int
+	}{{&d.Year, 4, 1, 9999}, {&d.Month, 2, 1, 12}, {&d.Day, 2, 1, 31}}
+	for i, part := range parts {
+		l := limits[i]
+		n, err := strconv.Atoi(part)
+		if err != nil || len(part) != l.digits || n < l.min || n > l.max {
+			return nil
+		}
+		*l.n = n
+	}
+	return &d
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Srcset formats images as an HTML srcset ("url 64w, url 300w, url 640w"),
+// smallest first. Images without a width are left out; browsers need one.
+func Srcset(images []Image) string {
+	sized := make([]Image, 0, len(images))
+	for _, img := range images {
+		if img.Width > 0 && img.URL != "" {
+			sized = append(sized, img)
+		}
+	}
+	slices.SortStableFunc(sized, func(a, b Image) int { return a.Width - b.Width })
+
+	var b strings.Builder
+	for i, img := range sized {
+		if i > 0 && img.Width == sized[i-1].Width {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(img.URL)
+		b.WriteByte(' ')
+		b.WriteString(strconv.Itoa(img.Width))
+		b.WriteByte('w')
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TrackTags are the tags a tagger writes into a track's audio file, keyed
+// by ID3v2.4 frame ID and by Vorbis comment field name. Values are ready to
+// write: several artists are joined with "; ", and empty values are left
+// out.
+type TrackTags struct {
+	ID3    map[string]string `json:"id3"`
+	Vorbis map[string]string `json:"vorbis"`
+}
+
+// TagsFor maps a track, its album, and their artists to tags
+func TagsFor(t *Track) TrackTags {
+	var (
+		album, label, date, upc, copyright string
+		albumArtists                       []Artist
+	)
+	if a := t.Album; a != nil {
+		album, label, date, upc = a.Name, a.Label, a.ReleaseDate, a.UPC
+		copyright = a.CopyrightC
+		if copyright == "" {
+			copyright = a.CopyrightP
+		}
+		albumArtists = a.Artists
+	}
+	artists := artistNames(t.Artists)
+	albumArtist := artistNames(albumArtists)
+	var track, disc, length string
+	if t.TrackNum > 0 {
+		track = strconv.Itoa(t.TrackNum)
+	}
+	if t.DiscNum > 0 {
+		disc = strconv.Itoa(t.DiscNum)
+	}
+	if t.DurationMs > 0 {
+		length = strconv.FormatInt(t.DurationMs, 10)
+	}
+
+	return TrackTags{
+		ID3: tagMap(
+			"TIT2", t.Name,
+			"TPE1", artists,
+			"TPE2", albumArtist,
+			"TALB", album,
+			"TSRC", t.ISRC,
+			"TRCK", track,
+			"TPOS", disc,
+			"TDRC", date, // yyyy, yyyy-MM, or yyyy-MM-dd, as precise as the release date
+			"TPUB", label,
+			"TCOP", copyright,
+			"TLEN", length,
+			"TXXX:BARCODE", upc,
+		),
+		Vorbis: tagMap(
+			"TITLE", t.Name,
+			"ARTIST", artists,
+			"ALBUMARTIST", albumArtist,
+			"ALBUM", album,
+			"ISRC", t.ISRC,
+			"TRACKNUMBER", track,
+			"DISCNUMBER", disc,
+			"DATE", date,
+			"LABEL", label,
+			"COPYRIGHT", copyright,
+			"BARCODE", upc,
+		),
+	}
+}
+
+func artistNames(artists []Artist) string {
+	names := make([]string, len(artists))
+	for i, a := range artists {
+		names[i] = a.Name
+	}
+	return strings.Join(names, "; ")
+}
+
+// tagMap builds a map from alternating keys and values, leaving out empty
+// values
+func tagMap(kv ...string) map[string]string {
+	m := make(map[string]string, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			m[kv[i]] = kv[i+1]
+		}
+	}
+	return m
+}
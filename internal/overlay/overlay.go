@@ -0,0 +1,466 @@
+// Package overlay layers local corrections and additions over a read-only
+// snapshot. Entries are kept in a small writable SQLite database and applied
+// to every response at read time, so fixing an ISRC or adding a missing
+// release doesn't require regenerating the snapshot.
+package overlay
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// Kinds of entity the overlay holds, named like their admin routes
+const (
+	Tracks  = "tracks"
+	Albums  = "albums"
+	Artists = "artists"
+)
+
+// Kinds lists every kind in route order
+var Kinds = []string{Tracks, Albums, Artists}
+
+var (
+	// ErrExists means an addition's ID is already in the snapshot or the
+	// overlay
+	ErrExists = errors.New("already exists")
+	// ErrInvalid means a submitted entity or correction doesn't fit the
+	// entity's fields
+	ErrInvalid = errors.New("invalid entity")
+	// ErrReadOnly means a write was attempted on a patch opened with
+	// OpenPatch
+	ErrReadOnly = errors.New("overlay is read-only")
+)
+
+// Entry is one correction or addition
+type Entry struct {
+	Kind      string          `json:"kind"`
+	ID        string          `json:"id"`
+	Added     bool            `json:"added"`
+	Data      json.RawMessage `json:"data"` // the whole entity when Added, otherwise the corrected fields
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Store serves the snapshot in the embedded db.Store with the overlay's
+// entries applied. Corrections show up everywhere the entity does;
+// additions are served by ID, ISRC, and album track lookups but are not in
+// search, browse, or discography results.
+type Store struct {
+	db.Store
+	conn     *sql.DB
+	name     string // "overlay", or "patch:<file>" for read-only patches
+	readOnly bool
+
+	mu       sync.RWMutex
+	entries  map[string]map[string]Entry // kind -> id -> entry
+	byISRC   map[string][]string         // ISRC -> IDs of tracks whose entry sets it
+	byAlbum  map[string][]string         // album ID -> IDs of added tracks on it
+	revision int64
+	onChange []func(kind, id string)
+}
+
+const schema = `
+	CREATE TABLE IF NOT EXISTS entries (
+		kind TEXT NOT NULL,
+		id TEXT NOT NULL,
+		added INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		PRIMARY KEY (kind, id)
+	);
+	CREATE TABLE IF NOT EXISTS overlay_meta (key TEXT PRIMARY KEY, value INTEGER NOT NULL);
+`
+
+// Open opens the overlay database at path, creating it if needed, and
+// layers it over base
+func Open(path string, base db.Store) (*Store, error) {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open overlay: %w", err)
+	}
+	// Writes are rare and small; one connection avoids SQLITE_BUSY
+	conn.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	for _, stmt := range []string{`PRAGMA journal_mode = WAL`, schema} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("init overlay: %w", err)
+		}
+	}
+
+	s := &Store{Store: base, conn: conn, name: "overlay"}
+	if err := s.load(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenPatch layers a read-only overlay database over base. Patches let
+// corrections be shipped separately from the snapshot: any overlay file,
+// such as one built up with the admin routes, can be distributed as one.
+// Every entry is validated up front so a bad patch fails at startup.
+func OpenPatch(path string, base db.Store) (*Store, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("open patch: %w", err)
+	}
+	conn, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_query_only=true")
+	if err != nil {
+		return nil, fmt.Errorf("open patch: %w", err)
+	}
+
+	s := &Store{Store: base, conn: conn, name: "patch:" + filepath.Base(path), readOnly: true}
+	if err := s.load(context.Background()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("patch %s: %w", path, err)
+	}
+	for _, k := range Kinds {
+		for id, e := range s.entries[k] {
+			if _, _, err := validate(k, e.Data); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("patch %s: %s %q: %w", path, k, id, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Close closes the overlay database. The snapshot is left open.
+func (s *Store) Close() error {
+	return s.conn.Close()
+}
+
+// Reload rereads the overlay database, picking up changes written by
+// another replica sharing it
+func (s *Store) Reload(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(ctx)
+}
+
+// OnChange registers fn to be called after each correction, addition, or
+// deletion is written, with the kind and id of the entry
+func (s *Store) OnChange(fn func(kind, id string)) {
+	s.mu.Lock()
+	s.onChange = append(s.onChange, fn)
+	s.mu.Unlock()
+}
+
+// changed calls the OnChange functions. Callers don't hold s.mu.
+func (s *Store) changed(kind, id string) {
+	s.mu.RLock()
+	fns := s.onChange
+	s.mu.RUnlock()
+	for _, fn := range fns {
+		fn(kind, id)
+	}
+}
+
+func (s *Store) load(ctx context.Context) error {
+	rows, err := s.conn.QueryContext(ctx, `SELECT kind, id, added, data, updated_at FROM entries`)
+	if err != nil {
+		return fmt.Errorf("load overlay: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string]map[string]Entry)
+	for _, k := range Kinds {
+		entries[k] = make(map[string]Entry)
+	}
+	for rows.Next() {
+		var e Entry
+		var data, updated string
+		if err := rows.Scan(&e.Kind, &e.ID, &e.Added, &data, &updated); err != nil {
+			return fmt.Errorf("load overlay: %w", err)
+		}
+		if entries[e.Kind] == nil {
+			return fmt.Errorf("load overlay: unknown kind %q", e.Kind)
+		}
+		e.Data = json.RawMessage(data)
+		e.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updated)
+		entries[e.Kind][e.ID] = e
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load overlay: %w", err)
+	}
+
+	var revision int64
+	err = s.conn.QueryRowContext(ctx, `SELECT value FROM overlay_meta WHERE key = 'revision'`).Scan(&revision)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("load overlay: %w", err)
+	}
+
+	s.entries = entries
+	s.revision = revision
+	s.index()
+	return nil
+}
+
+// index rebuilds the ISRC and album indexes from s.entries. Callers hold
+// s.mu for writing.
+func (s *Store) index() {
+	s.byISRC = make(map[string][]string)
+	s.byAlbum = make(map[string][]string)
+	for _, id := range slices.Sorted(maps.Keys(s.entries[Tracks])) {
+		e := s.entries[Tracks][id]
+		var t models.Track
+		json.Unmarshal(e.Data, &t)
+		if t.ISRC != "" {
+			s.byISRC[t.ISRC] = append(s.byISRC[t.ISRC], id)
+		}
+		if e.Added && t.Album != nil {
+			s.byAlbum[t.Album.ID] = append(s.byAlbum[t.Album.ID], id)
+		}
+	}
+}
+
+// Entries returns every entry, oldest change first
+func (s *Store) Entries() []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []Entry
+	for _, k := range Kinds {
+		out = slices.AppendSeq(out, maps.Values(s.entries[k]))
+	}
+	slices.SortFunc(out, func(a, b Entry) int { return a.UpdatedAt.Compare(b.UpdatedAt) })
+	return out
+}
+
+// Add stores a new entity of kind. data is the whole entity as the API
+// returns it, and its ID must not exist in the snapshot or the overlay.
+func (s *Store) Add(ctx context.Context, kind string, data []byte) (string, error) {
+	if s.readOnly {
+		return "", ErrReadOnly
+	}
+	id, data, err := validate(kind, data)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", fmt.Errorf("%w: id is required", ErrInvalid)
+	}
+	if err := db.CheckID(id); err != nil {
+		return "", err
+	}
+
+	switch _, err := s.lookup(ctx, kind, id); {
+	case err == nil:
+		return "", fmt.Errorf("%s %q: %w", kind, id, ErrExists)
+	case !errors.Is(err, db.ErrNotFound):
+		return "", err
+	}
+
+	return id, s.put(ctx, Entry{Kind: kind, ID: id, Added: true, Data: data})
+}
+
+// Correct sets fields of the entity of kind with id. data holds only the
+// fields to change, named as in API responses; it merges into any earlier
+// correction. Nested entities are corrected through their own kind.
+func (s *Store) Correct(ctx context.Context, kind, id string, data []byte) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := db.CheckID(id); err != nil {
+		return err
+	}
+	got, data, err := validate(kind, data)
+	if err != nil {
+		return err
+	}
+	if got != "" && got != id {
+		return fmt.Errorf("%w: id cannot be changed", ErrInvalid)
+	}
+
+	var fields map[string]json.RawMessage
+	json.Unmarshal(data, &fields)
+	delete(fields, "id")
+	for _, nested := range []string{"album", "artists", "tracks"} {
+		if _, ok := fields[nested]; ok {
+			return fmt.Errorf("%w: correct %s through their own routes", ErrInvalid, nested)
+		}
+	}
+
+	if _, err := s.lookup(ctx, kind, id); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	prev, ok := s.entries[kind][id]
+	s.mu.RUnlock()
+
+	e := Entry{Kind: kind, ID: id}
+	switch {
+	case ok && prev.Added:
+		// Additions are stored whole, so fold the change in
+		v := newEntity(kind)
+		json.Unmarshal(prev.Data, v)
+		json.Unmarshal(data, v)
+		e.Added = true
+		e.Data, _ = json.Marshal(v)
+	case ok:
+		var merged map[string]json.RawMessage
+		json.Unmarshal(prev.Data, &merged)
+		maps.Copy(merged, fields)
+		e.Data, _ = json.Marshal(merged)
+	default:
+		e.Data, _ = json.Marshal(fields)
+	}
+	return s.put(ctx, e)
+}
+
+// Delete removes the entry for kind and id, reverting a correction or
+// withdrawing an addition
+func (s *Store) Delete(ctx context.Context, kind, id string) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	s.mu.Lock()
+	if _, ok := s.entries[kind][id]; !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("overlay entry for %s %q: %w", kind, id, db.ErrNotFound)
+	}
+	err := s.write(ctx, `DELETE FROM entries WHERE kind = ? AND id = ?`, kind, id)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	delete(s.entries[kind], id)
+	s.index()
+	s.mu.Unlock()
+
+	s.changed(kind, id)
+	return nil
+}
+
+func (s *Store) put(ctx context.Context, e Entry) error {
+	s.mu.Lock()
+	e.UpdatedAt = time.Now().UTC()
+	err := s.write(ctx, `
+		INSERT INTO entries (kind, id, added, data, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (kind, id) DO UPDATE SET added = excluded.added, data = excluded.data, updated_at = excluded.updated_at
+	`, e.Kind, e.ID, e.Added, string(e.Data), e.UpdatedAt.Format(time.RFC3339Nano))
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.entries[e.Kind][e.ID] = e
+	s.index()
+	s.mu.Unlock()
+
+	s.changed(e.Kind, e.ID)
+	return nil
+}
+
+// write runs stmt and bumps the revision in one transaction. Callers hold
+// s.mu for writing.
+func (s *Store) write(ctx context.Context, stmt string, args ...any) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("write overlay: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+		return fmt.Errorf("write overlay: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO overlay_meta (key, value) VALUES ('revision', 1)
+		ON CONFLICT (key) DO UPDATE SET value = value + 1
+	`)
+	if err != nil {
+		return fmt.Errorf("write overlay: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("write overlay: %w", err)
+	}
+	s.revision++
+	return nil
+}
+
+// lookup returns the entity of kind with id with the overlay applied
+func (s *Store) lookup(ctx context.Context, kind, id string) (any, error) {
+	switch kind {
+	case Tracks:
+		return s.LookupTrack(ctx, id)
+	case Albums:
+		return s.LookupAlbum(ctx, id)
+	default:
+		return s.LookupArtist(ctx, id)
+	}
+}
+
+func newEntity(kind string) any {
+	switch kind {
+	case Tracks:
+		return &models.Track{}
+	case Albums:
+		return &models.Album{}
+	default:
+		return &models.Artist{}
+	}
+}
+
+// derived are response fields computed from others. They are dropped from
+// submissions at any depth, so a lookup response can be posted back as is.
+var derived = []string{"images_srcset"}
+
+// validate checks that data is a JSON object whose fields all belong to
+// kind. It returns the id it carries, if any, and the object without
+// derived fields.
+func validate(kind string, data []byte) (string, []byte, error) {
+	if !slices.Contains(Kinds, kind) {
+		return "", nil, fmt.Errorf("%w: unknown kind %q", ErrInvalid, kind)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return "", nil, fmt.Errorf("%w: expected a non-empty object", ErrInvalid)
+	}
+	obj, ok := v.(map[string]any)
+	if !ok || len(obj) == 0 {
+		return "", nil, fmt.Errorf("%w: expected a non-empty object", ErrInvalid)
+	}
+	dropDerived(obj)
+	data, _ = json.Marshal(obj)
+
+	dec = json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(newEntity(kind)); err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	id, _ := obj["id"].(string)
+	return id, data, nil
+}
+
+func dropDerived(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, f := range derived {
+			delete(v, f)
+		}
+		for _, e := range v {
+			dropDerived(e)
+		}
+	case []any:
+		for _, e := range v {
+			dropDerived(e)
+		}
+	}
+}
@@ -0,0 +1,660 @@
+package overlay
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/models"
+)
+
+// The methods below wrap the snapshot's so that every entity in a response
+// passes through the overlay. The caller's copy is patched in place, but
+// its slices may be shared: hot tables and the artist cache hand the same
+// genres and images to every request. patch gives corrected fields fresh
+// storage before decoding into them.
+
+// DatasetVersion includes the overlay revision, so anything keyed on the
+// version notices corrections
+func (s *Store) DatasetVersion() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	kind, _, _ := strings.Cut(s.name, ":")
+	return fmt.Sprintf("%s+%s.%d", s.Store.DatasetVersion(), kind, s.revision)
+}
+
+// Check adds the overlay database to the health report of the store below
+func (s *Store) Check(ctx context.Context) map[string]models.DatabaseHealth {
+	checks := s.Store.Check(ctx)
+	h := models.DatabaseHealth{Status: "ok"}
+	if err := s.conn.PingContext(ctx); err != nil {
+		h = models.DatabaseHealth{Status: "error", Error: err.Error()}
+	}
+	checks[s.name] = h
+	return checks
+}
+
+// patch applies the correction for kind and id, if there is one, to v.
+// Callers hold s.mu for reading.
+func (s *Store) patch(kind, id string, v any) {
+	if e, ok := s.entries[kind][id]; ok && !e.Added {
+		// Corrections were checked against the entity's fields when stored
+		detach(v, e.Data)
+		json.Unmarshal(e.Data, v)
+	}
+}
+
+// detach zeroes the fields of the struct v points to that data sets, so
+// decoding data allocates them afresh instead of writing through slices
+// and pointers the snapshot may share between requests. Corrections only
+// set top-level fields.
+func detach(v any, data []byte) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return
+	}
+	rv := reflect.ValueOf(v).Elem()
+	for i := range rv.NumField() {
+		f := rv.Type().Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		for k := range fields {
+			// encoding/json matches names case-insensitively
+			if strings.EqualFold(k, name) {
+				rv.Field(i).SetZero()
+				break
+			}
+		}
+	}
+}
+
+// added decodes the addition for kind and id into v, reporting whether
+// there is one. Callers hold s.mu for reading.
+func (s *Store) added(kind, id string, v any) bool {
+	e, ok := s.entries[kind][id]
+	if !ok || !e.Added {
+		return false
+	}
+	json.Unmarshal(e.Data, v)
+	return true
+}
+
+func (s *Store) track(t *models.Track) {
+	s.patch(Tracks, t.ID, t)
+	if t.Album != nil {
+		s.album(t.Album)
+	}
+	s.artists(t.Artists)
+}
+
+func (s *Store) album(a *models.Album) {
+	s.patch(Albums, a.ID, a)
+	if len(a.Artists) > 0 {
+		s.artists(a.Artists)
+		a.SetArtists(a.Artists)
+	}
+	for i := range a.Tracks {
+		s.track(&a.Tracks[i])
+	}
+}
+
+func (s *Store) artists(artists []models.Artist) {
+	for i := range artists {
+		s.patch(Artists, artists[i].ID, &artists[i])
+	}
+}
+
+func (s *Store) tracks(tracks []models.Track) {
+	for i := range tracks {
+		s.track(&tracks[i])
+	}
+}
+
+// addedTrack returns the added track with id, with corrections to the
+// album and artists it embeds applied. Callers hold s.mu for reading.
+func (s *Store) addedTrack(id string) (*models.Track, bool) {
+	var t models.Track
+	if !s.added(Tracks, id, &t) {
+		return nil, false
+	}
+	s.track(&t)
+	return &t, true
+}
+
+// resolveTracks fills in the albums and artists that added tracks name by
+// ID alone, such as a snapshot album a missing track belongs to, from the
+// snapshot or the overlay. An embedded entity without a name is such a
+// reference; ones that don't exist anywhere are left as they are. It takes
+// s.mu itself, so callers must not hold it.
+func (s *Store) resolveTracks(ctx context.Context, tracks []*models.Track) error {
+	var albumIDs []string
+	for _, t := range tracks {
+		if t.Album != nil && t.Album.ID != "" && t.Album.Name == "" {
+			albumIDs = append(albumIDs, t.Album.ID)
+		}
+	}
+	if len(albumIDs) > 0 {
+		albums, err := s.BatchLookupAlbums(ctx, albumIDs)
+		if err != nil {
+			return err
+		}
+		for _, t := range tracks {
+			if t.Album == nil || t.Album.Name != "" {
+				continue
+			}
+			if a, ok := albums[t.Album.ID]; ok {
+				album := *a
+				t.Album = &album
+			}
+		}
+	}
+
+	var refs []*models.Artist
+	for _, t := range tracks {
+		refs = artistRefs(refs, t.Artists)
+	}
+	return s.resolveArtists(ctx, refs)
+}
+
+// resolveAlbums is resolveTracks for the artists of added albums
+func (s *Store) resolveAlbums(ctx context.Context, albums []*models.Album) error {
+	var refs []*models.Artist
+	for _, a := range albums {
+		refs = artistRefs(refs, a.Artists)
+	}
+	if err := s.resolveArtists(ctx, refs); err != nil {
+		return err
+	}
+	for _, a := range albums {
+		if len(a.Artists) > 0 {
+			a.SetArtists(a.Artists)
+		}
+	}
+	return nil
+}
+
+// artistRefs appends the artists named by ID alone to refs
+func artistRefs(refs []*models.Artist, artists []models.Artist) []*models.Artist {
+	for i := range artists {
+		if artists[i].ID != "" && artists[i].Name == "" {
+			refs = append(refs, &artists[i])
+		}
+	}
+	return refs
+}
+
+func (s *Store) resolveArtists(ctx context.Context, refs []*models.Artist) error {
+	if len(refs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(refs))
+	for i, a := range refs {
+		ids[i] = a.ID
+	}
+	found, err := s.BatchLookupArtists(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, a := range refs {
+		if artist, ok := found[a.ID]; ok {
+			*a = *artist
+		}
+	}
+	return nil
+}
+
+// addedTracks returns the tracks in tracks the overlay added, to resolve.
+// Snapshot tracks are left alone: their storage may be shared.
+func (s *Store) addedTracks(tracks []models.Track) []*models.Track {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var added []*models.Track
+	for i := range tracks {
+		if s.entries[Tracks][tracks[i].ID].Added {
+			added = append(added, &tracks[i])
+		}
+	}
+	return added
+}
+
+// addedIn is addedTracks for the results of a batch lookup of kind
+func addedIn[T any](s *Store, kind string, result map[string]*T) []*T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var added []*T
+	for id, v := range result {
+		if s.entries[kind][id].Added {
+			added = append(added, v)
+		}
+	}
+	return added
+}
+
+func (s *Store) LookupTrack(ctx context.Context, id string) (*models.Track, error) {
+	s.mu.RLock()
+	t, ok := s.addedTrack(id)
+	s.mu.RUnlock()
+	if ok {
+		if err := s.resolveTracks(ctx, []*models.Track{t}); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	t, err := s.Store.LookupTrack(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.track(t)
+	return t, nil
+}
+
+func (s *Store) LookupArtist(ctx context.Context, id string) (*models.Artist, error) {
+	s.mu.RLock()
+	var a models.Artist
+	ok := s.added(Artists, id, &a)
+	s.mu.RUnlock()
+	if ok {
+		return &a, nil
+	}
+
+	artist, err := s.Store.LookupArtist(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.patch(Artists, id, artist)
+	return artist, nil
+}
+
+func (s *Store) LookupAlbum(ctx context.Context, id string) (*models.Album, error) {
+	s.mu.RLock()
+	var a models.Album
+	if s.added(Albums, id, &a) {
+		s.album(&a)
+		s.mu.RUnlock()
+		if err := s.resolveAlbums(ctx, []*models.Album{&a}); err != nil {
+			return nil, err
+		}
+		return &a, nil
+	}
+	s.mu.RUnlock()
+
+	album, err := s.Store.LookupAlbum(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.album(album)
+	return album, nil
+}
+
+// albumTracks merges the added tracks on albumID into tracks, in disc and
+// track order. Callers hold s.mu for reading.
+func (s *Store) albumTracks(albumID string, tracks []models.Track) []models.Track {
+	s.tracks(tracks)
+	ids := s.byAlbum[albumID]
+	if len(ids) == 0 {
+		return tracks
+	}
+	for _, id := range ids {
+		if t, ok := s.addedTrack(id); ok {
+			tracks = append(tracks, *t)
+		}
+	}
+	slices.SortStableFunc(tracks, func(a, b models.Track) int {
+		return cmp.Or(cmp.Compare(a.DiscNum, b.DiscNum), cmp.Compare(a.TrackNum, b.TrackNum))
+	})
+	return tracks
+}
+
+func (s *Store) GetAlbumTracks(ctx context.Context, albumID string) ([]models.Track, error) {
+	s.mu.RLock()
+	added := s.entries[Albums][albumID].Added
+	s.mu.RUnlock()
+
+	tracks := []models.Track{}
+	if !added {
+		var err error
+		tracks, err = s.Store.GetAlbumTracks(ctx, albumID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.mu.RLock()
+	tracks = s.albumTracks(albumID, tracks)
+	s.mu.RUnlock()
+	if err := s.resolveTracks(ctx, s.addedTracks(tracks)); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+func (s *Store) BatchAlbumTracks(ctx context.Context, albumIDs []string) (map[string][]models.Track, error) {
+	result, err := s.Store.BatchAlbumTracks(ctx, albumIDs)
+	if result == nil {
+		result = make(map[string][]models.Track)
+	}
+	s.mu.RLock()
+	for _, id := range albumIDs {
+		tracks, ok := result[id]
+		if !ok && !s.entries[Albums][id].Added {
+			continue
+		}
+		if tracks == nil {
+			tracks = []models.Track{}
+		}
+		result[id] = s.albumTracks(id, tracks)
+	}
+	s.mu.RUnlock()
+
+	var added []*models.Track
+	for _, tracks := range result {
+		added = append(added, s.addedTracks(tracks)...)
+	}
+	if rerr := s.resolveTracks(ctx, added); err == nil {
+		err = rerr
+	}
+	return result, err
+}
+
+// isrcTracks applies the overlay to the snapshot's tracks for isrc: tracks
+// corrected to another ISRC are dropped, and tracks the overlay gives the
+// ISRC are added, most popular first
+func (s *Store) isrcTracks(ctx context.Context, isrc string, tracks []models.Track) ([]models.Track, error) {
+	s.mu.RLock()
+	s.tracks(tracks)
+	tracks = slices.DeleteFunc(tracks, func(t models.Track) bool { return t.ISRC != isrc })
+	var fetch []string
+	for _, id := range s.byISRC[isrc] {
+		if slices.ContainsFunc(tracks, func(t models.Track) bool { return t.ID == id }) {
+			continue
+		}
+		if t, ok := s.addedTrack(id); ok {
+			if t.ISRC == isrc {
+				tracks = append(tracks, *t)
+			}
+		} else {
+			fetch = append(fetch, id)
+		}
+	}
+	s.mu.RUnlock()
+
+	// Tracks corrected to the ISRC come from the snapshot, which is read
+	// without holding the lock
+	if len(fetch) > 0 {
+		found, _ := s.Store.BatchLookupTracks(ctx, fetch)
+		s.mu.RLock()
+		for _, id := range fetch {
+			if t, ok := found[id]; ok {
+				s.track(t)
+				if t.ISRC == isrc {
+					tracks = append(tracks, *t)
+				}
+			}
+		}
+		s.mu.RUnlock()
+	}
+	if err := s.resolveTracks(ctx, s.addedTracks(tracks)); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(tracks, func(a, b models.Track) int { return cmp.Compare(b.Popularity, a.Popularity) })
+	return tracks, nil
+}
+
+func (s *Store) LookupISRC(ctx context.Context, isrc string) ([]models.Track, error) {
+	tracks, err := s.Store.LookupISRC(ctx, isrc)
+	if err != nil {
+		return nil, err
+	}
+	return s.isrcTracks(ctx, isrc, tracks)
+}
+
+func (s *Store) BestISRC(ctx context.Context, isrc, market string) (*models.Track, error) {
+	s.mu.RLock()
+	untouched := len(s.entries[Tracks]) == 0
+	s.mu.RUnlock()
+	if untouched {
+		t, err := s.Store.BestISRC(ctx, isrc, market)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		s.track(t)
+		return t, nil
+	}
+
+	tracks, err := s.LookupISRC(ctx, isrc)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("isrc %q: %w", isrc, db.ErrNotFound)
+	}
+	if market != "" {
+		slices.SortStableFunc(tracks, func(a, b models.Track) int {
+			ina, inb := slices.Contains(a.AvailableMarkets, market), slices.Contains(b.AvailableMarkets, market)
+			switch {
+			case ina == inb:
+				return 0
+			case ina:
+				return -1
+			default:
+				return 1
+			}
+		})
+	}
+	return &tracks[0], nil
+}
+
+func (s *Store) BatchLookupISRCs(ctx context.Context, isrcs []string) (map[string][]models.Track, error) {
+	result, err := s.Store.BatchLookupISRCs(ctx, isrcs)
+	if result == nil {
+		result = make(map[string][]models.Track)
+	}
+	for _, isrc := range isrcs {
+		tracks, terr := s.isrcTracks(ctx, isrc, result[isrc])
+		if terr != nil && err == nil {
+			err = terr
+		}
+		if len(tracks) > 0 {
+			result[isrc] = tracks
+		} else {
+			delete(result, isrc)
+		}
+	}
+	return result, err
+}
+
+// batch looks up ids in the overlay's additions and the rest with lookup,
+// then applies fn to every result
+func batch[T any](s *Store, kind string, ids []string, lookup func([]string) (map[string]*T, error), fn func(*T)) (map[string]*T, error) {
+	s.mu.RLock()
+	found := make(map[string]*T)
+	var rest []string
+	for _, id := range ids {
+		v := new(T)
+		if s.added(kind, id, v) {
+			found[id] = v
+		} else {
+			rest = append(rest, id)
+		}
+	}
+	s.mu.RUnlock()
+
+	result, err := lookup(rest)
+	if result == nil {
+		result = make(map[string]*T)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for id, v := range found {
+		result[id] = v
+	}
+	for _, v := range result {
+		fn(v)
+	}
+	return result, err
+}
+
+func (s *Store) BatchLookupTracks(ctx context.Context, ids []string) (map[string]*models.Track, error) {
+	result, err := batch(s, Tracks, ids, func(ids []string) (map[string]*models.Track, error) {
+		return s.Store.BatchLookupTracks(ctx, ids)
+	}, s.track)
+	if rerr := s.resolveTracks(ctx, addedIn(s, Tracks, result)); err == nil {
+		err = rerr
+	}
+	return result, err
+}
+
+func (s *Store) BatchLookupArtists(ctx context.Context, ids []string) (map[string]*models.Artist, error) {
+	return batch(s, Artists, ids, func(ids []string) (map[string]*models.Artist, error) {
+		return s.Store.BatchLookupArtists(ctx, ids)
+	}, func(a *models.Artist) { s.patch(Artists, a.ID, a) })
+}
+
+func (s *Store) BatchLookupAlbums(ctx context.Context, ids []string) (map[string]*models.Album, error) {
+	result, err := batch(s, Albums, ids, func(ids []string) (map[string]*models.Album, error) {
+		return s.Store.BatchLookupAlbums(ctx, ids)
+	}, s.album)
+	if rerr := s.resolveAlbums(ctx, addedIn(s, Albums, result)); err == nil {
+		err = rerr
+	}
+	return result, err
+}
+
+func (s *Store) TrackArtists(ctx context.Context, id string) ([]models.Artist, error) {
+	s.mu.RLock()
+	t, ok := s.addedTrack(id)
+	s.mu.RUnlock()
+	if ok {
+		if err := s.resolveTracks(ctx, []*models.Track{t}); err != nil {
+			return nil, err
+		}
+		return append([]models.Artist{}, t.Artists...), nil
+	}
+	return s.withArtists(s.Store.TrackArtists(ctx, id))
+}
+
+func (s *Store) AlbumArtists(ctx context.Context, id string) ([]models.Artist, error) {
+	s.mu.RLock()
+	var a models.Album
+	ok := s.added(Albums, id, &a)
+	if ok {
+		s.album(&a)
+	}
+	s.mu.RUnlock()
+	if ok {
+		if err := s.resolveAlbums(ctx, []*models.Album{&a}); err != nil {
+			return nil, err
+		}
+		return append([]models.Artist{}, a.Artists...), nil
+	}
+	return s.withArtists(s.Store.AlbumArtists(ctx, id))
+}
+
+func (s *Store) RelatedArtists(ctx context.Context, id string, limit int) ([]models.Artist, error) {
+	return s.withArtists(s.Store.RelatedArtists(ctx, id, limit))
+}
+
+func (s *Store) GenreArtists(ctx context.Context, genre string, limit, offset int) ([]models.Artist, error) {
+	return s.withArtists(s.Store.GenreArtists(ctx, genre, limit, offset))
+}
+
+func (s *Store) GenreAlbums(ctx context.Context, genre string, limit, offset int) ([]models.Album, error) {
+	albums, err := s.Store.GenreAlbums(ctx, genre, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range albums {
+		s.album(&albums[i])
+	}
+	return albums, nil
+}
+
+func (s *Store) SearchArtist(ctx context.Context, query string, limit int) ([]models.Artist, error) {
+	return s.withArtists(s.Store.SearchArtist(ctx, query, limit))
+}
+
+func (s *Store) SearchArtistPage(ctx context.Context, query string, limit int, sort db.SearchSort, c *db.SearchCursor) ([]models.Artist, *db.SearchCursor, error) {
+	artists, next, err := s.Store.SearchArtistPage(ctx, query, limit, sort, c)
+	artists, err = s.withArtists(artists, err)
+	return artists, next, err
+}
+
+func (s *Store) ArtistTracks(ctx context.Context, id, query string, limit, offset int) ([]models.Track, error) {
+	return s.withTracks(s.Store.ArtistTracks(ctx, id, query, limit, offset))
+}
+
+func (s *Store) SearchTrack(ctx context.Context, query string, limit int) ([]models.Track, error) {
+	return s.withTracks(s.Store.SearchTrack(ctx, query, limit))
+}
+
+func (s *Store) SearchTrackPage(ctx context.Context, query string, limit int, sort db.SearchSort, filter db.TrackFilter, c *db.SearchCursor) ([]models.Track, *db.SearchCursor, error) {
+	tracks, next, err := s.Store.SearchTrackPage(ctx, query, limit, sort, filter, c)
+	tracks, err = s.withTracks(tracks, err)
+	return tracks, next, err
+}
+
+func (s *Store) MatchCandidates(ctx context.Context, q db.MatchQuery) ([]models.Track, error) {
+	return s.withTracks(s.Store.MatchCandidates(ctx, q))
+}
+
+func (s *Store) SimilarCandidates(ctx context.Context, id string, limit int) ([]models.Track, error) {
+	return s.withTracks(s.Store.SimilarCandidates(ctx, id, limit))
+}
+
+func (s *Store) RadioCandidates(ctx context.Context, artistIDs, genres []string, limit int) ([]models.Track, error) {
+	return s.withTracks(s.Store.RadioCandidates(ctx, artistIDs, genres, limit))
+}
+
+func (s *Store) Discography(ctx context.Context, id string, limit int, offsets map[string]int) (*models.Discography, error) {
+	disc, err := s.Store.Discography(ctx, id, limit, offsets)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, page := range []*models.AlbumPage{&disc.Albums, &disc.Singles, &disc.Compilations, &disc.AppearsOn} {
+		for i := range page.Items {
+			s.album(&page.Items[i])
+		}
+	}
+	return disc, nil
+}
+
+func (s *Store) withArtists(artists []models.Artist, err error) ([]models.Artist, error) {
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.artists(artists)
+	return artists, nil
+}
+
+func (s *Store) withTracks(tracks []models.Track, err error) ([]models.Track, error) {
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.tracks(tracks)
+	return tracks, nil
+}
+
+var _ db.Store = (*Store)(nil)
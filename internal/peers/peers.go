@@ -0,0 +1,221 @@
+package peers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventPath is the route peers POST events to.
+const EventPath = "/internal/peers/events"
+
+const (
+	EventInvalidate = "invalidate" // drop cached entries for Keys
+	EventReload     = "reload"     // dataset was swapped or reloaded
+)
+
+// Event is a notification propagated between replicas.
+type Event struct {
+	Type   string   `json:"type"`
+	Keys   []string `json:"keys,omitempty"`
+	Origin string   `json:"origin"`
+}
+
+// Config controls how peers are discovered.
+// Either Static or SRV may be set; both may be combined.
+type Config struct {
+	Static  []string      // base URLs, e.g. http://10.0.0.2:8080
+	SRV     string        // DNS SRV name, e.g. _metadata._tcp.api.internal
+	Secret  string        // shared secret sent in X-Peer-Secret
+	Refresh time.Duration // SRV re-resolution interval
+}
+
+// Cluster broadcasts events to peers and dispatches received events to subscribers.
+type Cluster struct {
+	cfg    Config
+	nodeID string
+	client *http.Client
+
+	mu    sync.RWMutex
+	peers []string
+	subs  []func(Event)
+}
+
+// New creates a cluster. Call Start to begin SRV discovery.
+func New(cfg Config) *Cluster {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = 30 * time.Second
+	}
+	return &Cluster{
+		cfg:    cfg,
+		nodeID: newNodeID(),
+		client: &http.Client{Timeout: 5 * time.Second},
+		peers:  normalize(cfg.Static),
+	}
+}
+
+// Enabled reports whether any peers are configured.
+func (c *Cluster) Enabled() bool {
+	return len(c.cfg.Static) > 0 || c.cfg.SRV != ""
+}
+
+// Start resolves SRV peers periodically until ctx is cancelled.
+func (c *Cluster) Start(ctx context.Context) {
+	if c.cfg.SRV == "" {
+		return
+	}
+	c.resolve(ctx)
+	go func() {
+		ticker := time.NewTicker(c.cfg.Refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.resolve(ctx)
+			}
+		}
+	}()
+}
+
+func (c *Cluster) resolve(ctx context.Context) {
+	_, addrs, err := net.DefaultResolver.LookupSRV(ctx, "", "", c.cfg.SRV)
+	if err != nil {
+		slog.ErrorContext(ctx, "resolve peers", "srv", c.cfg.SRV, "err", err)
+		return
+	}
+
+	peers := normalize(c.cfg.Static)
+	for _, a := range addrs {
+		host := strings.TrimSuffix(a.Target, ".")
+		peers = append(peers, "http://"+net.JoinHostPort(host, strconv.Itoa(int(a.Port))))
+	}
+
+	c.mu.Lock()
+	c.peers = peers
+	c.mu.Unlock()
+}
+
+// Peers returns the current peer list.
+func (c *Cluster) Peers() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.peers...)
+}
+
+// Subscribe registers fn to receive events from other replicas.
+func (c *Cluster) Subscribe(fn func(Event)) {
+	c.mu.Lock()
+	c.subs = append(c.subs, fn)
+	c.mu.Unlock()
+}
+
+// Broadcast sends an event to every peer. Delivery is best-effort;
+// failures are logged and do not stop delivery to the remaining peers.
+func (c *Cluster) Broadcast(ctx context.Context, ev Event) {
+	ev.Origin = c.nodeID
+	body, err := json.Marshal(ev)
+	if err != nil {
+		slog.ErrorContext(ctx, "encode peer event", "err", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, peer := range c.Peers() {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			if err := c.send(ctx, peer, body); err != nil {
+				slog.ErrorContext(ctx, "send peer event", "peer", peer, "type", ev.Type, "err", err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) send(ctx context.Context, peer string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+EventPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.Secret != "" {
+		req.Header.Set("X-Peer-Secret", c.cfg.Secret)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ServeHTTP receives events from peers. Without a secret, every event is
+// refused.
+func (c *Cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	got := r.Header.Get("X-Peer-Secret")
+	if c.cfg.Secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(c.cfg.Secret)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var ev Event
+	if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// SRV discovery usually includes ourselves
+	if ev.Origin != c.nodeID {
+		c.dispatch(r.Context(), ev)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Cluster) dispatch(ctx context.Context, ev Event) {
+	c.mu.RLock()
+	subs := append([](func(Event)){}, c.subs...)
+	c.mu.RUnlock()
+
+	slog.InfoContext(ctx, "peer event", "type", ev.Type, "keys", len(ev.Keys), "origin", ev.Origin)
+	for _, fn := range subs {
+		fn(ev)
+	}
+}
+
+func normalize(urls []string) []string {
+	var out []string
+	for _, u := range urls {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u == "" {
+			continue
+		}
+		if !strings.Contains(u, "://") {
+			u = "http://" + u
+		}
+		out = append(out, u)
+	}
+	return out
+}
+
+func newNodeID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,134 @@
+// Package relevance scores search ranking against a corpus of
+// (query -> expected top results) cases using NDCG.
+package relevance
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"metadata-api/internal/models"
+)
+
+//go:embed corpus.json
+var defaultCorpus []byte
+
+// Case is a single query with its expected results, most relevant first.
+type Case struct {
+	Kind     string   `json:"kind"` // "track" or "artist"
+	Query    string   `json:"query"`
+	Expected []string `json:"expected"`
+}
+
+// Searcher is the subset of the db layer the harness exercises.
+type Searcher interface {
+	SearchTrack(ctx context.Context, query string, limit int) ([]models.Track, error)
+	SearchArtist(ctx context.Context, query string, limit int) ([]models.Artist, error)
+}
+
+// Result is the score for one case.
+type Result struct {
+	Case Case     `json:"case"`
+	Got  []string `json:"got"`
+	NDCG float64  `json:"ndcg"`
+	Err  string   `json:"error,omitempty"`
+}
+
+// Report summarizes a corpus run.
+type Report struct {
+	K       int      `json:"k"`
+	Mean    float64  `json:"mean_ndcg"`
+	Results []Result `json:"results"`
+}
+
+// DefaultCorpus returns the corpus shipped with the binary.
+func DefaultCorpus() ([]Case, error) {
+	return parse(defaultCorpus)
+}
+
+// LoadCorpus reads a corpus from a JSON file.
+func LoadCorpus(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read corpus: %w", err)
+	}
+	return parse(data)
+}
+
+func parse(data []byte) ([]Case, error) {
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("parse corpus: %w", err)
+	}
+	return cases, nil
+}
+
+// Run executes every case against s and scores the top k results.
+func Run(ctx context.Context, s Searcher, cases []Case, k int) Report {
+	rep := Report{K: k}
+	for _, c := range cases {
+		res := Result{Case: c}
+		ids, err := search(ctx, s, c, k)
+		if err != nil {
+			res.Err = err.Error()
+		}
+		res.Got = ids
+		res.NDCG = NDCG(ids, c.Expected, k)
+		rep.Results = append(rep.Results, res)
+		rep.Mean += res.NDCG
+	}
+	if len(cases) > 0 {
+		rep.Mean /= float64(len(cases))
+	}
+	return rep
+}
+
+func search(ctx context.Context, s Searcher, c Case, k int) ([]string, error) {
+	var ids []string
+	switch c.Kind {
+	case "track":
+		tracks, err := s.SearchTrack(ctx, c.Query, k)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tracks {
+			ids = append(ids, t.ID)
+		}
+	case "artist":
+		artists, err := s.SearchArtist(ctx, c.Query, k)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range artists {
+			ids = append(ids, a.ID)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %q", c.Kind)
+	}
+	return ids, nil
+}
+
+// NDCG computes normalized discounted cumulative gain at k.
+// Expected IDs are graded by position: the first has the highest gain.
+func NDCG(got, expected []string, k int) float64 {
+	if len(expected) == 0 {
+		return 1
+	}
+
+	gain := make(map[string]float64, len(expected))
+	for i, id := range expected {
+		gain[id] = float64(len(expected) - i)
+	}
+
+	var dcg, idcg float64
+	for i := 0; i < k && i < len(got); i++ {
+		dcg += gain[got[i]] / math.Log2(float64(i+2))
+	}
+	for i := 0; i < k && i < len(expected); i++ {
+		idcg += gain[expected[i]] / math.Log2(float64(i+2))
+	}
+	return dcg / idcg
+}
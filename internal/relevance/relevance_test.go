@@ -0,0 +1,190 @@
+package relevance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/models"
+)
+
+// fixtureEnv names a snapshot to run the corpus against instead of the
+// built-in fixture, for checking a real dataset
+const fixtureEnv = "RELEVANCE_FIXTURE_DB"
+
+// threshold is the mean NDCG the built-in corpus must reach
+const threshold = 0.9
+
+// fixtureSchema is the part of the snapshot schema search reads
+const fixtureSchema = `
+CREATE TABLE artists(id TEXT, name TEXT, followers_total INTEGER, popularity INTEGER);
+CREATE TABLE albums(id TEXT, name TEXT, album_type TEXT, label TEXT, release_date TEXT, release_date_precision TEXT, external_id_upc TEXT, total_tracks INTEGER, copyright_c TEXT, copyright_p TEXT);
+CREATE TABLE tracks(id TEXT, name TEXT, external_id_isrc TEXT, duration_ms INTEGER, explicit INTEGER, track_number INTEGER, disc_number INTEGER, popularity INTEGER, preview_url TEXT, album_rowid INTEGER);
+CREATE TABLE track_artists(track_rowid INTEGER, artist_rowid INTEGER);
+CREATE TABLE artist_albums(artist_rowid INTEGER, album_rowid INTEGER, index_in_album INTEGER);
+CREATE TABLE artist_genres(artist_rowid INTEGER, genre TEXT);
+CREATE TABLE album_images(album_rowid INTEGER, url TEXT, width INTEGER, height INTEGER);
+CREATE TABLE artist_images(artist_rowid INTEGER, url TEXT, width INTEGER, height INTEGER);
+`
+
+// fixtureRows holds the corpus' expected results next to less popular
+// decoys matching the same queries, so ranking has something to get wrong
+const fixtureRows = `
+INSERT INTO artists VALUES
+	('1dfeR4HaWDbWqFHLkxsg1d', 'Queen', 1000, 90),
+	('0du5cEVh5yTK9QJze8zA0C', 'Bruno Mars', 5000, 95),
+	('1HY2Jd0NmPuamShAr6KMms', 'Lady Gaga', 4000, 94),
+	('4pejUc4iciQfgdX6OKulQn', 'Queens of the Stone Age', 800, 70),
+	('7zTtZyb8qf0NLB1hAm0XMB', 'Queen Naija', 300, 60),
+	('0kd5kDhhXbWmT8Ch0jDJsL', 'Gaga Tribute Band', 5, 10),
+	('3Wt7N2Mpx2ZbIN0Bl6KFmx', 'Bruno Mars Karaoke', 3, 5);
+INSERT INTO albums VALUES
+	('6i6folBtxKV28WX3msQ4FE', 'A Night at the Opera', 'album', 'EMI', '1975-11-21', 'day', '0602547288233', 2, 'c', 'p'),
+	('10FLjwfpbxLmW8c25Xyc2N', 'Die With A Smile', 'single', 'Interscope', '2024-08-16', 'day', '0602577880001', 1, 'c', 'p'),
+	('1mQ3P5Gm8Qc2VL3n1Yd0Fz', 'Rhapsody Covers', 'compilation', 'Budget', '2010', 'year', NULL, 2, NULL, NULL);
+INSERT INTO tracks VALUES
+	('4u7EnebtmKWzUH433cf5Qv', 'Bohemian Rhapsody', 'GBUM71029604', 354000, 0, 11, 1, 80, NULL, 1),
+	('7tFiyTwD0nx5a1eklYtX2J', 'Love of My Life', 'GBUM71029605', 219000, 0, 9, 1, 70, NULL, 1),
+	('2plbrEY59IikOBgBGLjaoe', 'Die With A Smile', 'USUM72409273', 251000, 0, 1, 1, 99, NULL, 2),
+	('5Zf3tTNv6DUhIqk7ycQZdH', 'Bohemian Rhapsody (Karaoke Version)', 'QZAAA1000001', 355000, 0, 1, 1, 12, NULL, 3),
+	('0ZVkl8s1qY2C5Vdh7uB2fn', 'Die With A Smile (Piano Cover)', 'QZAAA1000002', 250000, 0, 2, 1, 8, NULL, 3);
+INSERT INTO track_artists VALUES (1, 1), (2, 1), (3, 2), (3, 3), (4, 6), (5, 7);
+INSERT INTO artist_albums VALUES (1, 1, 0), (2, 2, 0), (3, 2, 1), (6, 3, 0), (7, 3, 1);
+INSERT INTO artist_genres VALUES (1, 'rock'), (2, 'pop'), (3, 'pop'), (4, 'rock');
+`
+
+// fixtureDB writes the fixture snapshot into a temporary directory and
+// returns the path of its main database
+func fixtureDB(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, script := range map[string]string{
+		"main_database.sqlite3": fixtureSchema + fixtureRows,
+		"track_files.sqlite3":   `CREATE TABLE track_files(track_id TEXT, has_lyrics INTEGER, original_title TEXT, version_title TEXT, language_of_performance TEXT, artist_roles TEXT);`,
+	} {
+		conn, err := sql.Open("sqlite", filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Exec(script); err != nil {
+			conn.Close()
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := conn.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "main_database.sqlite3")
+}
+
+func TestCorpusNDCG(t *testing.T) {
+	path := os.Getenv(fixtureEnv)
+	if path == "" {
+		path = fixtureDB(t)
+	}
+	cases, err := DefaultCorpus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	rep := Run(context.Background(), database, cases, 10)
+	for _, res := range rep.Results {
+		if res.Err != "" || res.NDCG < threshold {
+			t.Logf("%.3f  %s %q %v %s", res.NDCG, res.Case.Kind, res.Case.Query, res.Got, res.Err)
+		}
+	}
+	if rep.Mean < threshold {
+		t.Errorf("mean NDCG@%d = %.3f over %d cases, want at least %.3f", rep.K, rep.Mean, len(rep.Results), threshold)
+	}
+}
+
+func TestNDCG(t *testing.T) {
+	// Gains are 2 for a and 1 for b, discounted by log2(position+1)
+	swapped := (1 + 2/math.Log2(3)) / (2 + 1/math.Log2(3))
+	tests := []struct {
+		name          string
+		got, expected []string
+		k             int
+		want          float64
+	}{
+		{"ideal", []string{"a", "b"}, []string{"a", "b"}, 10, 1},
+		{"ideal with extras", []string{"a", "b", "x", "y"}, []string{"a", "b"}, 10, 1},
+		{"swapped", []string{"b", "a"}, []string{"a", "b"}, 10, swapped},
+		{"nothing relevant", []string{"x", "y"}, []string{"a", "b"}, 10, 0},
+		{"no results", nil, []string{"a"}, 10, 0},
+		{"nothing expected", []string{"x"}, nil, 10, 1},
+		{"below k", []string{"x", "a"}, []string{"a"}, 2, 1 / math.Log2(3)},
+		{"past k", []string{"x", "a"}, []string{"a"}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NDCG(tt.got, tt.expected, tt.k); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("NDCG(%v, %v, %d) = %v, want %v", tt.got, tt.expected, tt.k, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSearcher answers track and artist searches from fixed IDs
+type fakeSearcher struct {
+	tracks  map[string][]string
+	artists map[string][]string
+}
+
+func (f fakeSearcher) SearchTrack(ctx context.Context, query string, limit int) ([]models.Track, error) {
+	ids, ok := f.tracks[query]
+	if !ok {
+		return nil, errors.New("search failed")
+	}
+	var tracks []models.Track
+	for _, id := range ids {
+		tracks = append(tracks, models.Track{ID: id})
+	}
+	return tracks, nil
+}
+
+func (f fakeSearcher) SearchArtist(ctx context.Context, query string, limit int) ([]models.Artist, error) {
+	var artists []models.Artist
+	for _, id := range f.artists[query] {
+		artists = append(artists, models.Artist{ID: id})
+	}
+	return artists, nil
+}
+
+func TestRun(t *testing.T) {
+	s := fakeSearcher{
+		tracks:  map[string][]string{"hit": {"t1", "t2"}},
+		artists: map[string][]string{"miss": {"a9"}},
+	}
+	cases := []Case{
+		{Kind: "track", Query: "hit", Expected: []string{"t1"}},
+		{Kind: "artist", Query: "miss", Expected: []string{"a1"}},
+		{Kind: "track", Query: "broken", Expected: []string{"t1"}},
+		{Kind: "album", Query: "hit", Expected: []string{"t1"}},
+	}
+	rep := Run(context.Background(), s, cases, 10)
+
+	if rep.K != 10 || len(rep.Results) != len(cases) {
+		t.Fatalf("got K %d and %d results, want 10 and %d", rep.K, len(rep.Results), len(cases))
+	}
+	wantNDCG := []float64{1, 0, 0, 0}
+	wantErr := []bool{false, false, true, true}
+	for i, res := range rep.Results {
+		if res.NDCG != wantNDCG[i] || (res.Err != "") != wantErr[i] {
+			t.Errorf("case %d: NDCG %v, error %q; want %v, error %v", i, res.NDCG, res.Err, wantNDCG[i], wantErr[i])
+		}
+	}
+	if rep.Mean != 0.25 {
+		t.Errorf("mean NDCG = %v, want 0.25", rep.Mean)
+	}
+}
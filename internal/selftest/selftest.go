@@ -0,0 +1,248 @@
+// Package selftest runs a manifest of representative queries against the
+// db layer at startup to catch bad mounts, wrong snapshots, and missing
+// indexes before traffic arrives.
+package selftest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"metadata-api/internal/models"
+)
+
+// DefaultMaxLatency applies when neither the check nor the manifest sets one
+const DefaultMaxLatency = time.Second
+
+// Check is a single query with the shape its result must have.
+type Check struct {
+	Name  string `json:"name,omitempty"`
+	Kind  string `json:"kind"`            // isrc, track, artist, album, album_tracks, search_track, search_artist
+	ID    string `json:"id,omitempty"`    // ISRC or Spotify ID for lookups
+	Query string `json:"query,omitempty"` // search text
+
+	// ExpectID must appear among the results; lookups by ID default to ID
+	ExpectID     string `json:"expect_id,omitempty"`
+	MinResults   int    `json:"min_results,omitempty"` // list kinds; defaults to 1
+	MaxLatencyMs int    `json:"max_latency_ms,omitempty"`
+}
+
+// Manifest is the file passed to -self-test.
+type Manifest struct {
+	MaxLatencyMs int     `json:"max_latency_ms,omitempty"`
+	Checks       []Check `json:"checks"`
+}
+
+// Store is the subset of the db layer the self-test exercises.
+type Store interface {
+	LookupISRC(ctx context.Context, isrc string) ([]models.Track, error)
+	LookupTrack(ctx context.Context, id string) (*models.Track, error)
+	LookupArtist(ctx context.Context, id string) (*models.Artist, error)
+	LookupAlbum(ctx context.Context, id string) (*models.Album, error)
+	GetAlbumTracks(ctx context.Context, albumID string) ([]models.Track, error)
+	SearchTrack(ctx context.Context, query string, limit int) ([]models.Track, error)
+	SearchArtist(ctx context.Context, query string, limit int) ([]models.Artist, error)
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Check     Check   `json:"check"`
+	OK        bool    `json:"ok"`
+	LatencyMs float64 `json:"latency_ms"`
+	Err       string  `json:"error,omitempty"`
+}
+
+// Report summarizes a manifest run.
+type Report struct {
+	Passed  int      `json:"passed"`
+	Failed  int      `json:"failed"`
+	Results []Result `json:"results"`
+}
+
+// OK reports whether every check passed.
+func (r Report) OK() bool {
+	return r.Failed == 0
+}
+
+// LoadManifest reads a manifest from a JSON file.
+func LoadManifest(path string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, fmt.Errorf("read manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parse manifest: %w", err)
+	}
+	if len(m.Checks) == 0 {
+		return m, errors.New("manifest has no checks")
+	}
+	return m, nil
+}
+
+// Run executes every check against s in order.
+func Run(ctx context.Context, s Store, m Manifest) Report {
+	var rep Report
+	for _, c := range m.Checks {
+		limit := DefaultMaxLatency
+		if m.MaxLatencyMs > 0 {
+			limit = time.Duration(m.MaxLatencyMs) * time.Millisecond
+		}
+		if c.MaxLatencyMs > 0 {
+			limit = time.Duration(c.MaxLatencyMs) * time.Millisecond
+		}
+
+		start := time.Now()
+		err := run(ctx, s, c)
+		took := time.Since(start)
+		if err == nil && took > limit {
+			err = fmt.Errorf("took %s, limit %s", took.Round(time.Millisecond), limit)
+		}
+
+		res := Result{Check: c, OK: err == nil, LatencyMs: float64(took.Microseconds()) / 1000}
+		if err != nil {
+			res.Err = err.Error()
+			rep.Failed++
+		} else {
+			rep.Passed++
+		}
+		rep.Results = append(rep.Results, res)
+	}
+	return rep
+}
+
+func run(ctx context.Context, s Store, c Check) error {
+	expect := c.ExpectID
+	minResults := c.MinResults
+	if minResults <= 0 {
+		minResults = 1
+	}
+
+	var ids []string
+	switch c.Kind {
+	case "isrc":
+		tracks, err := s.LookupISRC(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		for _, t := range tracks {
+			if err := trackShape(&t); err != nil {
+				return err
+			}
+			ids = append(ids, t.ID)
+		}
+	case "track":
+		t, err := s.LookupTrack(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		if err := sameID(t.ID, c); err != nil {
+			return err
+		}
+		return trackShape(t)
+	case "artist":
+		a, err := s.LookupArtist(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		if err := sameID(a.ID, c); err != nil {
+			return err
+		}
+		return artistShape(a)
+	case "album":
+		a, err := s.LookupAlbum(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		if err := sameID(a.ID, c); err != nil {
+			return err
+		}
+		if a.Name == "" {
+			return errors.New("album missing name")
+		}
+		if len(a.Artists) == 0 {
+			return errors.New("album has no artists")
+		}
+		return nil
+	case "album_tracks":
+		tracks, err := s.GetAlbumTracks(ctx, c.ID)
+		if err != nil {
+			return err
+		}
+		// Album track listings carry neither album nor artists
+		for _, t := range tracks {
+			if t.ID == "" {
+				return errors.New("track missing id")
+			}
+			ids = append(ids, t.ID)
+		}
+	case "search_track":
+		tracks, err := s.SearchTrack(ctx, c.Query, 20)
+		if err != nil {
+			return err
+		}
+		for _, t := range tracks {
+			if err := trackShape(&t); err != nil {
+				return err
+			}
+			ids = append(ids, t.ID)
+		}
+	case "search_artist":
+		artists, err := s.SearchArtist(ctx, c.Query, 20)
+		if err != nil {
+			return err
+		}
+		for _, a := range artists {
+			if err := artistShape(&a); err != nil {
+				return err
+			}
+			ids = append(ids, a.ID)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", c.Kind)
+	}
+
+	if len(ids) < minResults {
+		return fmt.Errorf("got %d results, want at least %d", len(ids), minResults)
+	}
+	if expect != "" && !slices.Contains(ids, expect) {
+		return fmt.Errorf("%s not among results", expect)
+	}
+	return nil
+}
+
+func trackShape(t *models.Track) error {
+	if t.ID == "" || t.Name == "" {
+		return errors.New("track missing id or name")
+	}
+	if t.Album == nil || t.Album.ID == "" {
+		return fmt.Errorf("track %s has no album", t.ID)
+	}
+	if len(t.Artists) == 0 {
+		return fmt.Errorf("track %s has no artists", t.ID)
+	}
+	return nil
+}
+
+func artistShape(a *models.Artist) error {
+	if a.ID == "" || a.Name == "" {
+		return errors.New("artist missing id or name")
+	}
+	return nil
+}
+
+// sameID checks that a lookup by ID returned that entity
+func sameID(got string, c Check) error {
+	want := c.ExpectID
+	if want == "" {
+		want = c.ID
+	}
+	if got != want {
+		return fmt.Errorf("got %q, want %q", got, want)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package similar
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+
+	"metadata-api/internal/models"
+)
+
+// MaxSeeds is the most seeds, of all kinds together, a radio takes
+const MaxSeeds = 5
+
+// radioPool is how many candidates a radio is blended from
+const radioPool = 300
+
+// Radio scoring weights. Popularity only counts when there is a target.
+const (
+	radioArtistWeight     = 0.4
+	radioGenreWeight      = 0.4
+	radioPopularityWeight = 0.2
+)
+
+// ErrSeeds is returned when a radio has no seeds or more than MaxSeeds
+var ErrSeeds = errors.New("between 1 and 5 seeds (artists, tracks, and genres together) required")
+
+// Seeds are what a radio is built from, with optional popularity bounds.
+// Target, Min, and Max are 0-100; nil leaves them unset, and without a
+// Target the mean popularity of the seed tracks, or else of the seed
+// artists, is aimed for.
+type Seeds struct {
+	Artists []string
+	Tracks  []string
+	Genres  []string
+
+	Target *int
+	Min    *int
+	Max    *int
+}
+
+// radioSeed is one seed resolved to the artists and genres candidates are
+// related to it through
+type radioSeed struct {
+	info    models.RadioSeed
+	artists map[string]bool
+	genres  map[string]bool
+	ranked  []int // indexes of the candidates matching it, best first
+}
+
+// matches reports whether a candidate with artists and genres relates to s:
+// it credits one of the seed's artists or shares one of its genres
+func (s *radioSeed) matches(artists, genres map[string]bool) bool {
+	for a := range artists {
+		if s.artists[a] {
+			return true
+		}
+	}
+	for g := range genres {
+		if s.genres[g] {
+			return true
+		}
+	}
+	return false
+}
+
+// Radio returns up to limit tracks blended from the candidates of every
+// seed: each candidate is scored on crediting a seed artist (or an artist
+// of a seed track), on genre overlap with the seeds, and on closeness to
+// the target popularity, and the seeds then take turns contributing their
+// best remaining candidate, so every seed is represented.
+func Radio(ctx context.Context, s Store, seeds Seeds, limit int) (*models.Radio, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	n := len(seeds.Artists) + len(seeds.Tracks) + len(seeds.Genres)
+	if n == 0 || n > MaxSeeds {
+		return nil, ErrSeeds
+	}
+
+	var all []*radioSeed
+	seedArtists := make(map[string]bool)
+	seedGenres := make(map[string]bool)
+	seedRecordings := make(map[string]bool)
+	var trackPopularity, artistPopularity []int
+	for _, id := range seeds.Artists {
+		a, err := s.LookupArtist(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		seed := &radioSeed{
+			info:    models.RadioSeed{ID: a.ID, Type: "artist"},
+			artists: map[string]bool{a.ID: true},
+			genres:  setOf(a.Genres),
+		}
+		all = append(all, seed)
+		artistPopularity = append(artistPopularity, a.Popularity)
+	}
+	for _, id := range seeds.Tracks {
+		t, err := s.LookupTrack(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		seed := &radioSeed{
+			info:    models.RadioSeed{ID: t.ID, Type: "track"},
+			artists: artistIDs(*t),
+			genres:  genres(*t),
+		}
+		all = append(all, seed)
+		seedRecordings[recording(*t)] = true
+		trackPopularity = append(trackPopularity, t.Popularity)
+	}
+	for _, g := range seeds.Genres {
+		all = append(all, &radioSeed{
+			info:   models.RadioSeed{ID: g, Type: "genre"},
+			genres: map[string]bool{g: true},
+		})
+	}
+	for _, seed := range all {
+		for a := range seed.artists {
+			seedArtists[a] = true
+		}
+		for g := range seed.genres {
+			seedGenres[g] = true
+		}
+	}
+
+	target := seeds.Target
+	if target == nil {
+		if p, ok := mean(trackPopularity); ok {
+			target = &p
+		} else if p, ok := mean(artistPopularity); ok {
+			target = &p
+		}
+	}
+
+	artists := make([]string, 0, len(seedArtists))
+	for a := range seedArtists {
+		artists = append(artists, a)
+	}
+	tracks, err := s.RadioCandidates(ctx, artists, seeds.Genres, radioPool)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		track models.Track
+		score float64
+	}
+	var candidates []candidate
+	seen := make(map[string]bool)
+	for _, t := range tracks {
+		trackArtists, trackGenres := artistIDs(t), genres(t)
+		var related []*radioSeed
+		for _, seed := range all {
+			if seed.matches(trackArtists, trackGenres) {
+				seed.info.InitialPoolSize++
+				related = append(related, seed)
+			}
+		}
+		if seeds.Min != nil && t.Popularity < *seeds.Min || seeds.Max != nil && t.Popularity > *seeds.Max {
+			continue
+		}
+		rec := recording(t)
+		if seedRecordings[rec] || seen[rec] {
+			continue
+		}
+		seen[rec] = true
+
+		credited := 0.0
+		for a := range trackArtists {
+			if seedArtists[a] {
+				credited = 1
+			}
+		}
+		total := radioArtistWeight*credited + radioGenreWeight*overlap(trackGenres, seedGenres)
+		weight := radioArtistWeight + radioGenreWeight
+		if target != nil {
+			total += radioPopularityWeight * (1 - math.Abs(float64(t.Popularity-*target))/100)
+			weight += radioPopularityWeight
+		}
+		for _, seed := range related {
+			seed.info.AfterFilteringSize++
+			seed.ranked = append(seed.ranked, len(candidates))
+		}
+		candidates = append(candidates, candidate{t, total / weight})
+	}
+
+	radio := &models.Radio{Tracks: []models.Track{}, Seeds: make([]models.RadioSeed, len(all))}
+	for i, seed := range all {
+		sort.SliceStable(seed.ranked, func(a, b int) bool {
+			return candidates[seed.ranked[a]].score > candidates[seed.ranked[b]].score
+		})
+		radio.Seeds[i] = seed.info
+	}
+	picked := make([]bool, len(candidates))
+	for more := true; more && len(radio.Tracks) < limit; {
+		more = false
+		for _, seed := range all {
+			for len(seed.ranked) > 0 && picked[seed.ranked[0]] {
+				seed.ranked = seed.ranked[1:]
+			}
+			if len(seed.ranked) == 0 || len(radio.Tracks) == limit {
+				continue
+			}
+			picked[seed.ranked[0]] = true
+			radio.Tracks = append(radio.Tracks, candidates[seed.ranked[0]].track)
+			more = true
+		}
+	}
+	return radio, nil
+}
+
+// overlap is the size of the intersection of a and b over the smaller of
+// them, so a candidate matching one seed genre of many still scores fully
+func overlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for g := range a {
+		if b[g] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(min(len(a), len(b)))
+}
+
+func setOf(items []string) map[string]bool {
+	out := make(map[string]bool, len(items))
+	for _, item := range items {
+		out[item] = true
+	}
+	return out
+}
+
+func mean(values []int) (int, bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / len(values), true
+}
@@ -0,0 +1,194 @@
+// Package similar recommends catalog tracks to play alongside a given one,
+// or alongside a radio's seed artists, tracks, and genres: tracks sharing
+// their artists or genres, with comparable popularity and duration. It is a
+// heuristic over the snapshot's metadata, not a listening-history model.
+package similar
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+
+	"metadata-api/internal/models"
+)
+
+// durationScale is the duration difference at which a candidate's
+// duration score reaches zero
+const durationScale = 120000
+
+// candidatePool is how many candidates are scored per request
+const candidatePool = 100
+
+// ErrNoWeight is returned when every weight is zero
+var ErrNoWeight = errors.New("at least one weight must be positive")
+
+// Store is the subset of the db layer recommendations need
+type Store interface {
+	LookupTrack(ctx context.Context, id string) (*models.Track, error)
+	LookupArtist(ctx context.Context, id string) (*models.Artist, error)
+	SimilarCandidates(ctx context.Context, id string, limit int) ([]models.Track, error)
+	RadioCandidates(ctx context.Context, artistIDs, genres []string, limit int) ([]models.Track, error)
+}
+
+// Weights sets how much each signal counts toward a candidate's score
+type Weights struct {
+	Artist     float64 // share of the track's artists the candidate credits
+	Genre      float64 // overlap of the two tracks' artist genres
+	Popularity float64 // closeness in popularity
+	Duration   float64 // closeness in duration
+	Playlists  float64 // playlists holding the candidate; only with PlaylistCounts
+}
+
+// DefaultWeights favor shared artists and genres over closeness, and give
+// local playlists a nudge
+var DefaultWeights = Weights{Artist: 0.4, Genre: 0.3, Popularity: 0.15, Duration: 0.15, Playlists: 0.1}
+
+// PlaylistCounts returns how many playlists hold each of the tracks with
+// ids, leaving out tracks in none, as collections.Store.Counts does
+type PlaylistCounts func(ctx context.Context, ids []string) (map[string]int, error)
+
+// Tracks returns up to limit recommendations for the track with id, best
+// first. Other releases of the same recording are left out. With playlists
+// set, candidates in more local playlists score higher; without it the
+// Playlists weight is ignored.
+func Tracks(ctx context.Context, s Store, id string, w Weights, playlists PlaylistCounts, limit int) ([]models.SimilarTrack, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	if playlists == nil {
+		w.Playlists = 0
+	}
+	total := w.Artist + w.Genre + w.Popularity + w.Duration + w.Playlists
+	if w.Artist < 0 || w.Genre < 0 || w.Popularity < 0 || w.Duration < 0 || w.Playlists < 0 || total <= 0 {
+		return nil, ErrNoWeight
+	}
+
+	seed, err := s.LookupTrack(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := s.SimilarCandidates(ctx, id, candidatePool)
+	if err != nil {
+		return nil, err
+	}
+	inPlaylists, err := playlistScores(ctx, playlists, tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	seedArtists := artistIDs(*seed)
+	seedGenres := genres(*seed)
+	seen := map[string]bool{recording(*seed): true}
+	out := make([]models.SimilarTrack, 0, len(tracks))
+	for _, t := range tracks {
+		if seen[recording(t)] {
+			continue
+		}
+		seen[recording(t)] = true
+
+		c := models.SimilarTrack{Track: t}
+		shared := 0
+		for a := range artistIDs(t) {
+			if seedArtists[a] {
+				shared++
+			}
+		}
+		if len(seedArtists) > 0 {
+			c.ArtistScore = round(float64(shared) / float64(len(seedArtists)))
+		}
+		c.GenreScore = round(jaccard(seedGenres, genres(t)))
+		c.PopularityScore = round(1 - math.Abs(float64(t.Popularity-seed.Popularity))/100)
+		c.DurationScore = round(math.Max(0, 1-math.Abs(float64(t.DurationMs-seed.DurationMs))/durationScale))
+		c.PlaylistScore = round(inPlaylists[t.ID])
+		c.Score = round((w.Artist*c.ArtistScore + w.Genre*c.GenreScore +
+			w.Popularity*c.PopularityScore + w.Duration*c.DurationScore + w.Playlists*c.PlaylistScore) / total)
+		out = append(out, c)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Score > out[j].Score
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// playlistScores scores each candidate by how many playlists hold it, on a
+// log scale relative to the candidate in the most. A few curated lists
+// are all it takes to stand out, but one in hundreds doesn't drown the
+// other signals.
+func playlistScores(ctx context.Context, playlists PlaylistCounts, tracks []models.Track) (map[string]float64, error) {
+	if playlists == nil || len(tracks) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(tracks))
+	for i, t := range tracks {
+		ids[i] = t.ID
+	}
+	counts, err := playlists(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	most := 0
+	for _, n := range counts {
+		most = max(most, n)
+	}
+	scores := make(map[string]float64, len(counts))
+	for id, n := range counts {
+		scores[id] = math.Log1p(float64(n)) / math.Log1p(float64(most))
+	}
+	return scores, nil
+}
+
+// recording identifies a track across releases: by ISRC when it has one,
+// otherwise by name and lead artist
+func recording(t models.Track) string {
+	if t.ISRC != "" {
+		return "isrc:" + t.ISRC
+	}
+	lead := ""
+	if len(t.Artists) > 0 {
+		lead = t.Artists[0].ID
+	}
+	return "name:" + strings.ToLower(t.Name) + "\x00" + lead
+}
+
+func artistIDs(t models.Track) map[string]bool {
+	ids := make(map[string]bool, len(t.Artists))
+	for _, a := range t.Artists {
+		ids[a.ID] = true
+	}
+	return ids
+}
+
+// genres is the union of the genres of t's artists
+func genres(t models.Track) map[string]bool {
+	out := make(map[string]bool)
+	for _, a := range t.Artists {
+		for _, g := range a.Genres {
+			out[g] = true
+		}
+	}
+	return out
+}
+
+// jaccard is the size of the intersection of a and b over their union
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for g := range a {
+		if b[g] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
@@ -0,0 +1,204 @@
+// Package snapshots manages read-only handles to several dataset snapshots
+// stored side by side, for serving historical versions of the catalog.
+//
+// Each snapshot is a directory under the root holding the usual database
+// files. Whatever downloads or copies snapshots into the root must follow a
+// simple protocol so a half-written file is never opened:
+//
+//  1. create LockFile in the snapshot directory before writing anything
+//  2. copy the database files
+//  3. write ManifestFile, listing every file with its size
+//  4. remove LockFile
+//
+// A snapshot is only opened when it has a manifest, no lock file, and every
+// file in the manifest has the recorded size. Writers that replace an
+// existing snapshot must take the lock again first.
+package snapshots
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+
+	"metadata-api/internal/db"
+)
+
+const (
+	// ManifestFile is written last by the downloader and marks a snapshot
+	// as complete
+	ManifestFile = "manifest.json"
+	// LockFile is present while a snapshot is being written
+	LockFile = ".lock"
+	// MainFile is the main database inside a snapshot directory
+	MainFile = "main_database.sqlite3"
+)
+
+var (
+	ErrNotFound = errors.New("snapshot not found")
+	ErrNotReady = errors.New("snapshot is being written")
+	ErrInvalid  = errors.New("invalid snapshot name")
+)
+
+// Manifest describes a complete snapshot
+type Manifest struct {
+	Created string           `json:"created,omitempty"`
+	Files   map[string]int64 `json:"files"` // file name -> size in bytes
+}
+
+// Manager lazily opens snapshots and keeps at most max of them open,
+// closing the least recently used. A handle that is still in use when it is
+// evicted stays open until its last user releases it, so the limit can be
+// exceeded briefly under load.
+type Manager struct {
+	root    string
+	prepare func(*db.DB) error
+
+	mu   sync.Mutex
+	open *simplelru.LRU[string, *handle]
+}
+
+type handle struct {
+	db      *db.DB
+	refs    int
+	evicted bool
+}
+
+// New returns a Manager for the snapshot directories under root. prepare,
+// if not nil, configures each snapshot after it is opened, as the served
+// one is.
+func New(root string, max int, prepare func(*db.DB) error) (*Manager, error) {
+	m := &Manager{root: root, prepare: prepare}
+	open, err := simplelru.NewLRU[string, *handle](max, m.evict)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot manager: %w", err)
+	}
+	m.open = open
+	return m, nil
+}
+
+// evict runs with m.mu held when the LRU drops a handle
+func (m *Manager) evict(_ string, h *handle) {
+	h.evicted = true
+	if h.refs == 0 {
+		h.db.Close()
+	}
+}
+
+// Acquire returns the database for the named snapshot, opening it if
+// needed. The caller must call release once done with it.
+func (m *Manager) Acquire(name string) (*db.DB, func(), error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, nil, ErrInvalid
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.open.Get(name)
+	if !ok {
+		dir := filepath.Join(m.root, name)
+		if err := checkReady(dir); err != nil {
+			return nil, nil, err
+		}
+		d, err := db.Open(filepath.Join(dir, MainFile))
+		if err != nil {
+			return nil, nil, fmt.Errorf("open snapshot %s: %w", name, err)
+		}
+		if m.prepare != nil {
+			if err := m.prepare(d); err != nil {
+				d.Close()
+				return nil, nil, fmt.Errorf("prepare snapshot %s: %w", name, err)
+			}
+		}
+		h = &handle{db: d}
+		m.open.Add(name, h)
+	}
+
+	h.refs++
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			h.refs--
+			if h.refs == 0 && h.evicted {
+				h.db.Close()
+			}
+		})
+	}
+	return h.db, release, nil
+}
+
+// List returns the names of the complete snapshots under the root, sorted
+func (m *Manager) List() ([]string, error) {
+	entries, err := os.ReadDir(m.root)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if checkReady(filepath.Join(m.root, e.Name())) == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Close closes every open snapshot. Handles still in use are closed when
+// released.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.open.Purge()
+}
+
+// checkReady reports whether the snapshot in dir is complete and not being
+// written
+func checkReady(dir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if _, err := os.Stat(filepath.Join(dir, LockFile)); err == nil {
+		return ErrNotReady
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotReady
+	}
+	if err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	var mf Manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return fmt.Errorf("parse manifest %s: %w", dir, err)
+	}
+	if _, ok := mf.Files[MainFile]; !ok {
+		return fmt.Errorf("manifest %s does not list %s", dir, MainFile)
+	}
+
+	for name, size := range mf.Files {
+		// Only files in the snapshot directory itself, never ../ or an
+		// absolute path a manifest could otherwise point anywhere with
+		if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+			return fmt.Errorf("manifest %s: invalid file name %q", dir, name)
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil || info.Size() != size {
+			return fmt.Errorf("%w: %s does not match the manifest", ErrNotReady, name)
+		}
+	}
+	return nil
+}
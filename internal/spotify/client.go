@@ -0,0 +1,422 @@
+// Package spotify is a minimal Spotify Web API client and a background job
+// that refreshes parts of the snapshot from it. It uses the client
+// credentials flow, so it only sees public catalog data.
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"metadata-api/internal/models"
+)
+
+// Default endpoints of the Web API and its token service
+const (
+	DefaultAPI      = "https://api.spotify.com/v1"
+	DefaultTokenURL = "https://accounts.spotify.com/api/token"
+)
+
+// Batch sizes the Web API accepts per request
+const (
+	maxArtistIDs = 50
+	maxAlbumIDs  = 20
+	maxTrackIDs  = 50
+)
+
+// maxRetries bounds how often a request is retried after a 429 or 5xx
+const maxRetries = 3
+
+// ErrUnauthorized means the client credentials were rejected
+var ErrUnauthorized = errors.New("spotify credentials rejected")
+
+// Client calls the Web API with an app token, refreshing it as it expires
+type Client struct {
+	id, secret string
+	api        string
+	tokenURL   string
+	http       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClient returns a Client for the app with the given credentials. api
+// and tokenURL default to DefaultAPI and DefaultTokenURL.
+func NewClient(clientID, clientSecret, api, tokenURL string) *Client {
+	if api == "" {
+		api = DefaultAPI
+	}
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	return &Client{
+		id:       clientID,
+		secret:   clientSecret,
+		api:      strings.TrimSuffix(api, "/"),
+		tokenURL: tokenURL,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// accessToken returns a cached token, fetching a new one a minute before
+// the old one expires
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.id, c.secret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("spotify token: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		return "", ErrUnauthorized
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("spotify token: %s", resp.Status)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("spotify token: %w", err)
+	}
+	c.token = tok.AccessToken
+	c.expires = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// get fetches path (or an absolute next-page URL) into v, waiting out rate
+// limits and retrying server errors
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	u := path
+	if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		u = c.api + path
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := c.accessToken(ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return fmt.Errorf("spotify %s: %w", path, err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			err := json.NewDecoder(resp.Body).Decode(v)
+			resp.Body.Close()
+			if err != nil {
+				return fmt.Errorf("spotify %s: %w", path, err)
+			}
+			return nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		wait := time.Duration(1<<attempt) * time.Second
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			// The token was revoked early; fetch a fresh one
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+		case resp.StatusCode == http.StatusTooManyRequests:
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(secs) * time.Second
+			}
+		case resp.StatusCode < 500:
+			return fmt.Errorf("spotify %s: %s", path, resp.Status)
+		}
+		if attempt == maxRetries {
+			return fmt.Errorf("spotify %s: %s after %d retries", path, resp.Status, maxRetries)
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Web API object shapes, trimmed to the fields the snapshot has
+
+type apiImage struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type apiArtist struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Followers struct {
+		Total int64 `json:"total"`
+	} `json:"followers"`
+	Popularity int        `json:"popularity"`
+	Genres     []string   `json:"genres"`
+	Images     []apiImage `json:"images"`
+}
+
+type apiAlbum struct {
+	ID                   string      `json:"id"`
+	Name                 string      `json:"name"`
+	AlbumType            string      `json:"album_type"`
+	Label                string      `json:"label"`
+	ReleaseDate          string      `json:"release_date"`
+	ReleaseDatePrecision string      `json:"release_date_precision"`
+	TotalTracks          int         `json:"total_tracks"`
+	Images               []apiImage  `json:"images"`
+	Artists              []apiArtist `json:"artists"`
+	ExternalIDs          struct {
+		UPC string `json:"upc"`
+	} `json:"external_ids"`
+	Copyrights []struct {
+		Text string `json:"text"`
+		Type string `json:"type"`
+	} `json:"copyrights"`
+	Tracks struct {
+		Items []apiTrack `json:"items"`
+		Next  string     `json:"next"`
+	} `json:"tracks"`
+}
+
+type apiTrack struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	DurationMs  int64       `json:"duration_ms"`
+	Explicit    bool        `json:"explicit"`
+	TrackNumber int         `json:"track_number"`
+	DiscNumber  int         `json:"disc_number"`
+	Popularity  int         `json:"popularity"`
+	PreviewURL  string      `json:"preview_url"`
+	Artists     []apiArtist `json:"artists"`
+	Album       *apiAlbum   `json:"album"`
+	ExternalIDs struct {
+		ISRC string `json:"isrc"`
+	} `json:"external_ids"`
+}
+
+// Artists fetches full artist objects. Unknown IDs are left out.
+func (c *Client) Artists(ctx context.Context, ids []string) ([]models.Artist, error) {
+	var out []models.Artist
+	for chunk := range slices.Chunk(ids, maxArtistIDs) {
+		var resp struct {
+			Artists []*apiArtist `json:"artists"`
+		}
+		if err := c.get(ctx, "/artists?ids="+strings.Join(chunk, ","), &resp); err != nil {
+			return nil, err
+		}
+		for _, a := range resp.Artists {
+			if a != nil {
+				out = append(out, a.model())
+			}
+		}
+	}
+	return out, nil
+}
+
+// ArtistAlbumIDs lists the IDs of an artist's albums, singles, and
+// compilations
+func (c *Client) ArtistAlbumIDs(ctx context.Context, artistID string) ([]string, error) {
+	var ids []string
+	next := "/artists/" + url.PathEscape(artistID) + "/albums?include_groups=album,single,compilation&limit=50"
+	for next != "" {
+		var page struct {
+			Items []apiAlbum `json:"items"`
+			Next  string     `json:"next"`
+		}
+		if err := c.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		for _, a := range page.Items {
+			ids = append(ids, a.ID)
+		}
+		next = page.Next
+	}
+	return ids, nil
+}
+
+// Albums fetches full albums. Their Tracks hold the track IDs only; fetch
+// the tracks themselves with Tracks.
+func (c *Client) Albums(ctx context.Context, ids []string) ([]models.Album, error) {
+	var out []models.Album
+	for chunk := range slices.Chunk(ids, maxAlbumIDs) {
+		var resp struct {
+			Albums []*apiAlbum `json:"albums"`
+		}
+		if err := c.get(ctx, "/albums?ids="+strings.Join(chunk, ","), &resp); err != nil {
+			return nil, err
+		}
+		for _, a := range resp.Albums {
+			if a == nil {
+				continue
+			}
+			// Albums embed the first 50 tracks; page through the rest
+			for next := a.Tracks.Next; next != ""; {
+				var page struct {
+					Items []apiTrack `json:"items"`
+					Next  string     `json:"next"`
+				}
+				if err := c.get(ctx, next, &page); err != nil {
+					return nil, err
+				}
+				a.Tracks.Items = append(a.Tracks.Items, page.Items...)
+				next = page.Next
+			}
+			album := a.model()
+			for _, t := range a.Tracks.Items {
+				album.Tracks = append(album.Tracks, models.Track{ID: t.ID})
+			}
+			out = append(out, album)
+		}
+	}
+	return out, nil
+}
+
+// Tracks fetches full tracks. Their Album holds the album's own fields
+// without tracks.
+func (c *Client) Tracks(ctx context.Context, ids []string) ([]models.Track, error) {
+	var out []models.Track
+	for chunk := range slices.Chunk(ids, maxTrackIDs) {
+		var resp struct {
+			Tracks []*apiTrack `json:"tracks"`
+		}
+		if err := c.get(ctx, "/tracks?ids="+strings.Join(chunk, ","), &resp); err != nil {
+			return nil, err
+		}
+		for _, t := range resp.Tracks {
+			if t != nil {
+				out = append(out, t.model())
+			}
+		}
+	}
+	return out, nil
+}
+
+// SearchISRC finds the tracks with isrc
+func (c *Client) SearchISRC(ctx context.Context, isrc string) ([]models.Track, error) {
+	var resp struct {
+		Tracks struct {
+			Items []apiTrack `json:"items"`
+		} `json:"tracks"`
+	}
+	q := url.Values{"q": {"isrc:" + isrc}, "type": {"track"}, "limit": {"50"}}
+	if err := c.get(ctx, "/search?"+q.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	out := make([]models.Track, 0, len(resp.Tracks.Items))
+	for _, t := range resp.Tracks.Items {
+		// Search matches loosely; keep exact hits only
+		if strings.EqualFold(t.ExternalIDs.ISRC, isrc) {
+			out = append(out, t.model())
+		}
+	}
+	return out, nil
+}
+
+func (a *apiArtist) model() models.Artist {
+	return models.Artist{
+		ID:         a.ID,
+		Name:       a.Name,
+		Followers:  a.Followers.Total,
+		Popularity: a.Popularity,
+		Genres:     a.Genres,
+		Images:     images(a.Images),
+	}
+}
+
+func (a *apiAlbum) model() models.Album {
+	album := models.Album{
+		ID:                   a.ID,
+		Name:                 a.Name,
+		Type:                 a.AlbumType,
+		Label:                a.Label,
+		ReleaseDate:          a.ReleaseDate,
+		ReleaseDatePrecision: a.ReleaseDatePrecision,
+		UPC:                  a.ExternalIDs.UPC,
+		TotalTracks:          a.TotalTracks,
+		Images:               images(a.Images),
+	}
+	for _, c := range a.Copyrights {
+		switch c.Type {
+		case "C":
+			album.CopyrightC = c.Text
+		case "P":
+			album.CopyrightP = c.Text
+		}
+	}
+	album.SetArtists(artistRefs(a.Artists))
+	return album
+}
+
+func (t *apiTrack) model() models.Track {
+	track := models.Track{
+		ID:         t.ID,
+		Name:       t.Name,
+		ISRC:       t.ExternalIDs.ISRC,
+		DurationMs: t.DurationMs,
+		Explicit:   t.Explicit,
+		TrackNum:   t.TrackNumber,
+		DiscNum:    t.DiscNumber,
+		Popularity: t.Popularity,
+		PreviewURL: t.PreviewURL,
+		Artists:    artistRefs(t.Artists),
+	}
+	if t.Album != nil {
+		album := t.Album.model()
+		track.Album = &album
+	}
+	return track
+}
+
+// artistRefs keeps the ID and name of the simplified artists embedded in
+// albums and tracks
+func artistRefs(artists []apiArtist) []models.Artist {
+	out := make([]models.Artist, len(artists))
+	for i, a := range artists {
+		out[i] = models.Artist{ID: a.ID, Name: a.Name}
+	}
+	return out
+}
+
+func images(imgs []apiImage) []models.Image {
+	out := make([]models.Image, len(imgs))
+	for i, img := range imgs {
+		out[i] = models.Image(img)
+	}
+	return out
+}
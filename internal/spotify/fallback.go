@@ -0,0 +1,130 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"golang.org/x/time/rate"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/models"
+	"metadata-api/internal/overlay"
+)
+
+// Misses are remembered so a client retrying an ID Spotify doesn't know
+// either doesn't spend the rate limit again
+const (
+	missCacheSize = 10000
+	missTTL       = time.Hour
+)
+
+// Fallback serves track and ISRC lookups from the Web API when the overlay
+// and the snapshot below it have no answer. Hits are added to the overlay,
+// so each is fetched once and then served locally.
+type Fallback struct {
+	*overlay.Store
+	client  *Client
+	limiter *rate.Limiter
+	timeout time.Duration
+	misses  *expirable.LRU[string, struct{}]
+}
+
+// NewFallback returns a Fallback over ov that makes at most limit calls per
+// second, with bursts of burst, each given up to timeout
+func NewFallback(client *Client, ov *overlay.Store, limit rate.Limit, burst int, timeout time.Duration) *Fallback {
+	return &Fallback{
+		Store:   ov,
+		client:  client,
+		limiter: rate.NewLimiter(limit, burst),
+		timeout: timeout,
+		misses:  expirable.NewLRU[string, struct{}](missCacheSize, nil, missTTL),
+	}
+}
+
+func (f *Fallback) LookupTrack(ctx context.Context, id string) (*models.Track, error) {
+	t, err := f.Store.LookupTrack(ctx, id)
+	if !errors.Is(err, db.ErrNotFound) || db.CheckID(id) != nil {
+		return t, err
+	}
+	tracks := f.fetch(ctx, "track:"+id, func(ctx context.Context) ([]models.Track, error) {
+		return f.client.Tracks(ctx, []string{id})
+	})
+	if len(tracks) == 0 {
+		return nil, err
+	}
+	if t, err := f.Store.LookupTrack(ctx, id); err == nil {
+		return t, nil
+	}
+	return &tracks[0], nil
+}
+
+func (f *Fallback) LookupISRC(ctx context.Context, isrc string) ([]models.Track, error) {
+	tracks, err := f.Store.LookupISRC(ctx, isrc)
+	if err != nil || len(tracks) > 0 {
+		return tracks, err
+	}
+	return f.isrc(ctx, isrc), nil
+}
+
+func (f *Fallback) BestISRC(ctx context.Context, isrc, market string) (*models.Track, error) {
+	t, err := f.Store.BestISRC(ctx, isrc, market)
+	if !errors.Is(err, db.ErrNotFound) {
+		return t, err
+	}
+	if len(f.isrc(ctx, isrc)) == 0 {
+		return nil, err
+	}
+	return f.Store.BestISRC(ctx, isrc, market)
+}
+
+// isrc fetches the tracks with isrc and returns them as the overlay now
+// serves them
+func (f *Fallback) isrc(ctx context.Context, isrc string) []models.Track {
+	fetched := f.fetch(ctx, "isrc:"+isrc, func(ctx context.Context) ([]models.Track, error) {
+		return f.client.SearchISRC(ctx, isrc)
+	})
+	if len(fetched) == 0 {
+		return []models.Track{}
+	}
+	// A track already in the snapshot under another ISRC isn't re-added,
+	// so fall back to Spotify's copy if the overlay still has nothing
+	if tracks, err := f.Store.LookupISRC(ctx, isrc); err == nil && len(tracks) > 0 {
+		return tracks
+	}
+	return fetched
+}
+
+// fetch calls the Web API unless key missed recently or the rate limit is
+// spent, and adds what it finds to the overlay. Failures are logged and
+// treated as misses that aren't remembered.
+func (f *Fallback) fetch(ctx context.Context, key string, call func(context.Context) ([]models.Track, error)) []models.Track {
+	if f.misses.Contains(key) || !f.limiter.Allow() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	tracks, err := call(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "spotify fallback", "key", key, "err", err)
+		return nil
+	}
+	if len(tracks) == 0 {
+		f.misses.Add(key, struct{}{})
+		return nil
+	}
+
+	for _, t := range tracks {
+		err := add(ctx, f.Store, overlay.Tracks, t)
+		if err != nil {
+			slog.WarnContext(ctx, "spotify fallback cache", "track", t.ID, "err", err)
+		}
+	}
+	slog.InfoContext(ctx, "spotify fallback hit", "key", key, "tracks", len(tracks))
+	return tracks
+}
+
+var _ db.Store = (*Fallback)(nil)
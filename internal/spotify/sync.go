@@ -0,0 +1,187 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"metadata-api/internal/db"
+	"metadata-api/internal/models"
+	"metadata-api/internal/overlay"
+)
+
+// Syncer keeps configured artists current by writing what changed on
+// Spotify into an overlay: popularity and follower counts as corrections,
+// and releases missing from the snapshot as additions.
+type Syncer struct {
+	client  *Client
+	overlay *overlay.Store
+	artists []string
+}
+
+// SyncStats counts what one sync pass did
+type SyncStats struct {
+	Artists       int `json:"artists"`        // artists fetched
+	ArtistUpdates int `json:"artist_updates"` // popularity or follower corrections
+	ArtistsAdded  int `json:"artists_added"`
+	AlbumsAdded   int `json:"albums_added"`
+	TracksAdded   int `json:"tracks_added"`
+	Failed        int `json:"failed"` // artists whose releases could not be synced
+}
+
+// NewSyncer returns a Syncer for the given artist IDs
+func NewSyncer(client *Client, ov *overlay.Store, artists []string) *Syncer {
+	return &Syncer{client: client, overlay: ov, artists: artists}
+}
+
+// Run syncs immediately and then every interval until ctx is cancelled
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		start := time.Now()
+		stats, err := s.Sync(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("spotify sync", "err", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Info("spotify sync finished", "duration", time.Since(start).Round(time.Millisecond),
+			"artists", stats.Artists, "artist_updates", stats.ArtistUpdates, "artists_added", stats.ArtistsAdded,
+			"albums_added", stats.AlbumsAdded, "tracks_added", stats.TracksAdded, "failed", stats.Failed)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sync runs one pass over the configured artists. An artist whose releases
+// fail to sync is logged and counted and the pass moves on; rejected
+// credentials end it.
+func (s *Syncer) Sync(ctx context.Context) (SyncStats, error) {
+	var stats SyncStats
+	artists, err := s.client.Artists(ctx, s.artists)
+	if err != nil {
+		return stats, err
+	}
+	stats.Artists = len(artists)
+
+	for _, a := range artists {
+		if err := s.syncArtist(ctx, a, &stats); err != nil {
+			return stats, err
+		}
+		err := s.syncReleases(ctx, a.ID, &stats)
+		switch {
+		case errors.Is(err, ErrUnauthorized) || ctx.Err() != nil:
+			return stats, err
+		case err != nil:
+			slog.Warn("spotify sync releases", "artist", a.ID, "err", err)
+			stats.Failed++
+		}
+	}
+	return stats, nil
+}
+
+// syncArtist corrects popularity and followers when they moved, or adds the
+// artist when the snapshot lacks it
+func (s *Syncer) syncArtist(ctx context.Context, a models.Artist, stats *SyncStats) error {
+	cur, err := s.overlay.LookupArtist(ctx, a.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		if err := add(ctx, s.overlay, overlay.Artists, a); err != nil {
+			return err
+		}
+		stats.ArtistsAdded++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if cur.Popularity == a.Popularity && cur.Followers == a.Followers {
+		return nil
+	}
+
+	data, _ := json.Marshal(map[string]any{"popularity": a.Popularity, "followers": a.Followers})
+	if err := s.overlay.Correct(ctx, overlay.Artists, a.ID, data); err != nil {
+		return err
+	}
+	stats.ArtistUpdates++
+	return nil
+}
+
+// syncReleases adds the artist's albums that neither the snapshot nor the
+// overlay has, along with their tracks
+func (s *Syncer) syncReleases(ctx context.Context, artistID string, stats *SyncStats) error {
+	ids, err := s.client.ArtistAlbumIDs(ctx, artistID)
+	if err != nil {
+		return err
+	}
+	known, err := s.overlay.BatchLookupAlbums(ctx, ids)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, id := range ids {
+		if known[id] == nil {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	albums, err := s.client.Albums(ctx, missing)
+	if err != nil {
+		return err
+	}
+	for _, album := range albums {
+		trackIDs := make([]string, len(album.Tracks))
+		for i, t := range album.Tracks {
+			trackIDs[i] = t.ID
+		}
+		tracks, err := s.client.Tracks(ctx, trackIDs)
+		if err != nil {
+			return err
+		}
+		knownTracks, err := s.overlay.BatchLookupTracks(ctx, trackIDs)
+		if err != nil {
+			return err
+		}
+
+		album.Tracks = nil
+		if err := add(ctx, s.overlay, overlay.Albums, album); err != nil {
+			return err
+		}
+		stats.AlbumsAdded++
+		for _, t := range tracks {
+			if knownTracks[t.ID] != nil {
+				continue
+			}
+			// Embed the full album rather than the simplified one tracks carry
+			t.Album = &album
+			if err := add(ctx, s.overlay, overlay.Tracks, t); err != nil {
+				return err
+			}
+			stats.TracksAdded++
+		}
+	}
+	return nil
+}
+
+// add stores v in ov as an addition. An entity another writer added first
+// is left alone.
+func add(ctx context.Context, ov *overlay.Store, kind string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := ov.Add(ctx, kind, data); err != nil && !errors.Is(err, overlay.ErrExists) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package usage records who calls the API and which endpoints they use.
+// Requests are counted in memory per minute, client, and route and flushed
+// to a small writable SQLite database, so recording costs no I/O on the
+// request path and summaries survive restarts.
+package usage
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// bucket is the granularity counts are stored at
+const bucket = time.Minute
+
+const schema = `
+CREATE TABLE IF NOT EXISTS usage (
+	minute        INTEGER NOT NULL, -- unix seconds at the start of the minute
+	client        TEXT    NOT NULL,
+	route         TEXT    NOT NULL,
+	requests      INTEGER NOT NULL,
+	client_errors INTEGER NOT NULL, -- 4xx responses
+	server_errors INTEGER NOT NULL, -- 5xx responses
+	PRIMARY KEY (minute, client, route)
+) WITHOUT ROWID`
+
+type key struct {
+	minute int64
+	client string
+	route  string
+}
+
+type counts struct {
+	requests, clientErrors, serverErrors int64
+}
+
+// Recorder counts requests and periodically writes the counts out
+type Recorder struct {
+	conn      *sql.DB
+	retention time.Duration
+
+	mu      sync.Mutex
+	pending map[key]*counts
+}
+
+// Open opens or creates the usage database at path. Counts older than
+// retention are deleted as new ones are flushed; 0 keeps them forever.
+func Open(path string, retention time.Duration) (*Recorder, error) {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open usage db: %w", err)
+	}
+	conn.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	for _, stmt := range []string{`PRAGMA journal_mode = WAL`, schema} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("init usage db: %w", err)
+		}
+	}
+	return &Recorder{conn: conn, retention: retention, pending: make(map[key]*counts)}, nil
+}
+
+// Record counts one request by client to route that answered with status
+func (rec *Recorder) Record(client, route string, status int, at time.Time) {
+	k := key{minute: at.Truncate(bucket).Unix(), client: client, route: route}
+	rec.mu.Lock()
+	c := rec.pending[k]
+	if c == nil {
+		c = &counts{}
+		rec.pending[k] = c
+	}
+	c.requests++
+	switch {
+	case status >= 500:
+		c.serverErrors++
+	case status >= 400:
+		c.clientErrors++
+	}
+	rec.mu.Unlock()
+}
+
+// Run flushes counts every interval until ctx is done. Close flushes what
+// is left.
+func (rec *Recorder) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := rec.Flush(ctx); err != nil {
+				slog.ErrorContext(ctx, "flush usage", "err", err)
+			}
+		}
+	}
+}
+
+// Flush writes pending counts and prunes expired ones. Counts that fail
+// to write are kept for the next flush.
+func (rec *Recorder) Flush(ctx context.Context) error {
+	rec.mu.Lock()
+	pending := rec.pending
+	rec.pending = make(map[key]*counts)
+	rec.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := rec.write(ctx, pending); err != nil {
+		rec.mu.Lock()
+		for k, c := range pending {
+			if cur := rec.pending[k]; cur != nil {
+				cur.requests += c.requests
+				cur.clientErrors += c.clientErrors
+				cur.serverErrors += c.serverErrors
+			} else {
+				rec.pending[k] = c
+			}
+		}
+		rec.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (rec *Recorder) write(ctx context.Context, pending map[key]*counts) error {
+	tx, err := rec.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO usage (minute, client, route, requests, client_errors, server_errors)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (minute, client, route) DO UPDATE SET
+			requests = requests + excluded.requests,
+			client_errors = client_errors + excluded.client_errors,
+			server_errors = server_errors + excluded.server_errors`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for k, c := range pending {
+		if _, err := stmt.ExecContext(ctx, k.minute, k.client, k.route, c.requests, c.clientErrors, c.serverErrors); err != nil {
+			return err
+		}
+	}
+	if rec.retention > 0 {
+		cutoff := time.Now().Add(-rec.retention).Unix()
+		if _, err := tx.ExecContext(ctx, `DELETE FROM usage WHERE minute < ?`, cutoff); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Summary is the usage over a window, with the busiest clients and routes
+// first
+type Summary struct {
+	Window       string    `json:"window"`
+	Since        time.Time `json:"since"`
+	Requests     int64     `json:"requests"`
+	ClientErrors int64     `json:"client_errors"`
+	ServerErrors int64     `json:"server_errors"`
+	ErrorRate    float64   `json:"error_rate"`
+	Clients      []Usage   `json:"clients"`
+	Routes       []Usage   `json:"routes"`
+}
+
+// Usage is the counts for one client or route. Clients also list the
+// routes they called most.
+type Usage struct {
+	Client       string  `json:"client,omitempty"`
+	Route        string  `json:"route,omitempty"`
+	Requests     int64   `json:"requests"`
+	ClientErrors int64   `json:"client_errors"`
+	ServerErrors int64   `json:"server_errors"`
+	ErrorRate    float64 `json:"error_rate"` // fraction of requests answered with 4xx or 5xx
+	TopRoutes    []Usage `json:"top_routes,omitempty"`
+}
+
+// topRoutesPerClient bounds Usage.TopRoutes
+const topRoutesPerClient = 5
+
+// Summarize reports the usage since window ago, including counts not yet
+// flushed, listing at most limit clients and routes
+func (rec *Recorder) Summarize(ctx context.Context, window time.Duration, limit int) (*Summary, error) {
+	if err := rec.Flush(ctx); err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-window).Truncate(bucket)
+	rows, err := rec.conn.QueryContext(ctx, `
+		SELECT client, route, SUM(requests), SUM(client_errors), SUM(server_errors)
+		FROM usage WHERE minute >= ?
+		GROUP BY client, route`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	s := &Summary{Window: window.String(), Since: since.UTC()}
+	clients := make(map[string]*Usage)
+	routes := make(map[string]*Usage)
+	for rows.Next() {
+		var u Usage
+		if err := rows.Scan(&u.Client, &u.Route, &u.Requests, &u.ClientErrors, &u.ServerErrors); err != nil {
+			return nil, err
+		}
+		s.Requests += u.Requests
+		s.ClientErrors += u.ClientErrors
+		s.ServerErrors += u.ServerErrors
+
+		c := clients[u.Client]
+		if c == nil {
+			c = &Usage{Client: u.Client}
+			clients[u.Client] = c
+		}
+		c.add(u)
+		c.TopRoutes = append(c.TopRoutes, Usage{Route: u.Route, Requests: u.Requests, ClientErrors: u.ClientErrors, ServerErrors: u.ServerErrors})
+
+		r := routes[u.Route]
+		if r == nil {
+			r = &Usage{Route: u.Route}
+			routes[u.Route] = r
+		}
+		r.add(u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.ErrorRate = errorRate(s.Requests, s.ClientErrors+s.ServerErrors)
+	s.Clients = ranked(clients, limit)
+	for i := range s.Clients {
+		c := &s.Clients[i]
+		c.TopRoutes = rankUsages(c.TopRoutes, topRoutesPerClient)
+	}
+	s.Routes = ranked(routes, limit)
+	return s, nil
+}
+
+// Close flushes pending counts and closes the database
+func (rec *Recorder) Close() error {
+	err := rec.Flush(context.Background())
+	if cerr := rec.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (u *Usage) add(o Usage) {
+	u.Requests += o.Requests
+	u.ClientErrors += o.ClientErrors
+	u.ServerErrors += o.ServerErrors
+}
+
+func ranked(m map[string]*Usage, limit int) []Usage {
+	out := make([]Usage, 0, len(m))
+	for _, u := range m {
+		out = append(out, *u)
+	}
+	return rankUsages(out, limit)
+}
+
+// rankUsages sorts by request count, busiest first, fills in error rates,
+// and keeps the first limit
+func rankUsages(us []Usage, limit int) []Usage {
+	slices.SortFunc(us, func(a, b Usage) int {
+		if n := cmp.Compare(b.Requests, a.Requests); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.Client+a.Route, b.Client+b.Route)
+	})
+	if len(us) > limit {
+		us = us[:limit]
+	}
+	for i := range us {
+		us[i].ErrorRate = errorRate(us[i].Requests, us[i].ClientErrors+us[i].ServerErrors)
+	}
+	return us
+}
+
+func errorRate(requests, errors int64) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(errors*10000/requests) / 10000
+}
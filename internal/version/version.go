@@ -0,0 +1,16 @@
+// Package version holds build metadata stamped in with -ldflags -X; see the
+// Makefile. Plain `go build` leaves the defaults.
+package version
+
+import "fmt"
+
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+// String formats the build metadata for -version output and logs.
+func String() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, Commit, Date)
+}
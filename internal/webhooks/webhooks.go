@@ -0,0 +1,121 @@
+// Package webhooks notifies downstream systems, such as caches and search
+// indexes built from this API, when the served snapshot changes.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventSnapshotLoaded is sent once a snapshot is open and being served
+const EventSnapshotLoaded = "snapshot.loaded"
+
+// SignatureHeader carries the hex HMAC-SHA256 of the body, keyed with the
+// shared secret, as "sha256=<hex>"
+const SignatureHeader = "X-Webhook-Signature"
+
+// maxAttempts bounds delivery attempts per URL
+const maxAttempts = 4
+
+// Event is the JSON body POSTed to every webhook URL
+type Event struct {
+	Type           string    `json:"type"`
+	DatasetVersion string    `json:"dataset_version"`
+	Counts         Counts    `json:"counts"`
+	DurationMs     int64     `json:"duration_ms"` // time taken to open and warm the snapshot
+	Host           string    `json:"host,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// Counts are the snapshot's entity counts
+type Counts struct {
+	Tracks  int64 `json:"tracks"`
+	Albums  int64 `json:"albums"`
+	Artists int64 `json:"artists"`
+}
+
+// Notifier POSTs events to a fixed set of URLs
+type Notifier struct {
+	urls   []string
+	secret string
+	client *http.Client
+}
+
+// New returns a Notifier for urls. A non-empty secret signs every body.
+func New(urls []string, secret string) *Notifier {
+	return &Notifier{
+		urls:   urls,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send delivers ev to every URL concurrently and waits for all of them.
+// Failed deliveries are retried with backoff, then logged; they don't stop
+// delivery to the other URLs.
+func (n *Notifier) Send(ctx context.Context, ev Event) {
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = time.Now().UTC()
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		slog.ErrorContext(ctx, "encode webhook event", "err", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, url := range n.urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for attempt := 1; ; attempt++ {
+				err := n.post(ctx, url, body)
+				if err == nil {
+					slog.DebugContext(ctx, "webhook delivered", "url", url, "type", ev.Type)
+					return
+				}
+				if attempt == maxAttempts || ctx.Err() != nil {
+					slog.ErrorContext(ctx, "webhook delivery failed", "url", url, "type", ev.Type, "attempts", attempt, "err", err)
+					return
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Duration(1<<(attempt-1)) * time.Second):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
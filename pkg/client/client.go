@@ -0,0 +1,354 @@
+// Package client is a Go client for the metadata API. It handles the base
+// URL, API keys, retries with backoff on rate limits and transient
+// failures, and context cancellation, and decodes responses into the same
+// types the server encodes.
+//
+//	c := client.New("http://localhost:8080", client.WithAPIKey(key))
+//	track, err := c.LookupTrack(ctx, "4u7EnebtmKWzUH433cf5Qv")
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"metadata-api/internal/models"
+)
+
+// Response types, shared with the server so the two can't drift apart
+type (
+	Track         = models.Track
+	Album         = models.Album
+	Artist        = models.Artist
+	ArtistPage    = models.ArtistPage
+	TrackPage     = models.TrackPage
+	BatchRequest  = models.BatchLookupRequest
+	BatchResponse = models.BatchLookupResponse
+)
+
+// maxBatchItems is the most IDs the server accepts in one batch lookup
+const maxBatchItems = 400
+
+// Retry backoff bounds; Retry-After from the server takes precedence
+const (
+	minBackoff = 200 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+var (
+	// ErrNotFound matches errors for 404 responses
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited matches errors for 429 responses that outlasted the
+	// retries
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// Error is a non-2xx response from the server
+type Error struct {
+	StatusCode int
+	Message    string // the response body, trimmed
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("metadata api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is lets errors.Is match ErrNotFound and ErrRateLimited
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Client calls one metadata API server. It is safe for concurrent use.
+type Client struct {
+	base    string
+	http    *http.Client
+	apiKey  string
+	retries int
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the underlying HTTP client (default: 30s timeout)
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithAPIKey sends key in X-API-Key, for servers with per-key budgets
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithRetries sets how often a request is retried after a 429, a 502-504,
+// or a network error (default 3; 0 disables retries)
+func WithRetries(n int) Option {
+	return func(c *Client) { c.retries = n }
+}
+
+// New returns a Client for the server at baseURL, e.g.
+// "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		base:    strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+		retries: 3,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// LookupTrack fetches a track by Spotify ID
+func (c *Client) LookupTrack(ctx context.Context, id string) (*Track, error) {
+	var t Track
+	if err := c.get(ctx, "/lookup/track/"+url.PathEscape(id), nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// LookupAlbum fetches an album by Spotify ID
+func (c *Client) LookupAlbum(ctx context.Context, id string) (*Album, error) {
+	var a Album
+	if err := c.get(ctx, "/lookup/album/"+url.PathEscape(id), nil, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// LookupArtist fetches an artist by Spotify ID
+func (c *Client) LookupArtist(ctx context.Context, id string) (*Artist, error) {
+	var a Artist
+	if err := c.get(ctx, "/lookup/artist/"+url.PathEscape(id), nil, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// AlbumTracks fetches every track on an album
+func (c *Client) AlbumTracks(ctx context.Context, albumID string) ([]Track, error) {
+	var tracks []Track
+	if err := c.get(ctx, "/lookup/album/"+url.PathEscape(albumID)+"/tracks", nil, &tracks); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// LookupISRC fetches the tracks with isrc. An unknown ISRC yields an empty
+// slice, not an error.
+func (c *Client) LookupISRC(ctx context.Context, isrc string) ([]Track, error) {
+	var tracks []Track
+	if err := c.get(ctx, "/lookup/isrc/"+url.PathEscape(isrc), nil, &tracks); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// BatchISRCs looks up many ISRCs, splitting them into as many batch
+// requests as the server's limits need. ISRCs without tracks map to empty
+// slices.
+func (c *Client) BatchISRCs(ctx context.Context, isrcs []string) (map[string][]Track, error) {
+	out := make(map[string][]Track, len(isrcs))
+	for start := 0; start < len(isrcs); start += maxBatchItems {
+		chunk := isrcs[start:min(start+maxBatchItems, len(isrcs))]
+		resp, err := c.Batch(ctx, BatchRequest{ISRCs: chunk})
+		if err != nil {
+			return nil, err
+		}
+		if msg := resp.Errors["isrcs"]; msg != "" {
+			return nil, fmt.Errorf("metadata api: %s", msg)
+		}
+		for isrc, tracks := range resp.ISRCs {
+			out[isrc] = tracks
+		}
+	}
+	return out, nil
+}
+
+// Batch sends one POST /batch/lookup. The server accepts at most 400 IDs
+// across all types; per-type failures are reported in the response's
+// Errors rather than as an error.
+func (c *Client) Batch(ctx context.Context, req BatchRequest) (*BatchResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp BatchResponse
+	if err := c.do(ctx, http.MethodPost, "/batch/lookup", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SearchArtist searches artists by name, returning up to limit results
+func (c *Client) SearchArtist(ctx context.Context, query string, limit int) ([]Artist, error) {
+	page, _, err := c.SearchArtistPage(ctx, query, limit, "")
+	if err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+// SearchArtistPage fetches one page of artist results, with the total
+// number of matches. Pass the returned cursor to get the next page; it is
+// empty after the last one.
+func (c *Client) SearchArtistPage(ctx context.Context, query string, limit int, cursor string) (*ArtistPage, string, error) {
+	var page ArtistPage
+	next, err := c.search(ctx, "/search/artist", query, limit, cursor, &page)
+	if err != nil {
+		return nil, "", err
+	}
+	return &page, next, nil
+}
+
+// SearchTrack searches tracks by name, returning up to limit results
+func (c *Client) SearchTrack(ctx context.Context, query string, limit int) ([]Track, error) {
+	page, _, err := c.SearchTrackPage(ctx, query, limit, "")
+	if err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+// SearchTrackPage fetches one page of track results, like SearchArtistPage
+func (c *Client) SearchTrackPage(ctx context.Context, query string, limit int, cursor string) (*TrackPage, string, error) {
+	var page TrackPage
+	next, err := c.search(ctx, "/search/track", query, limit, cursor, &page)
+	if err != nil {
+		return nil, "", err
+	}
+	return &page, next, nil
+}
+
+func (c *Client) search(ctx context.Context, path, query string, limit int, cursor string, v any) (string, error) {
+	q := url.Values{"q": {query}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	var next string
+	err := c.doHeader(ctx, http.MethodGet, path, q, nil, v, func(h http.Header) {
+		next = h.Get("X-Next-Cursor")
+	})
+	return next, err
+}
+
+func (c *Client) get(ctx context.Context, path string, q url.Values, v any) error {
+	return c.do(ctx, http.MethodGet, path, q, nil, v)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, body []byte, v any) error {
+	return c.doHeader(ctx, method, path, q, body, v, nil)
+}
+
+// doHeader sends a request, retrying as configured, and decodes a 2xx
+// body into v. onHeader, if set, sees the final response's headers.
+func (c *Client) doHeader(ctx context.Context, method, path string, q url.Values, body []byte, v any, onHeader func(http.Header)) error {
+	u := c.base + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		var rd io.Reader
+		if body != nil {
+			rd = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, rd)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		}
+
+		resp, err := c.http.Do(req)
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if attempt >= c.retries {
+				return err
+			}
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			defer resp.Body.Close()
+			if onHeader != nil {
+				onHeader(resp.Header)
+			}
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				return fmt.Errorf("metadata api: decode %s: %w", path, err)
+			}
+			return nil
+		default:
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+			if !retryable(resp.StatusCode) || attempt >= c.retries {
+				return apiErr
+			}
+			wait = retryAfter(resp.Header)
+		}
+
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter reads a Retry-After header given in seconds, or returns 0
+func retryAfter(h http.Header) time.Duration {
+	secs, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// backoff doubles from minBackoff up to maxBackoff, with full jitter so
+// many clients throttled together don't retry in lockstep
+func backoff(attempt int) time.Duration {
+	d := min(minBackoff<<attempt, maxBackoff)
+	return time.Duration(rand.Int64N(int64(d))) + time.Millisecond
+}